@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
@@ -20,15 +21,29 @@ type BackupCommand struct {
 	Site        string        `short:"s" long:"site" env:"SITE" default:"remark" description:"site name"`
 	Timeout     time.Duration `long:"timeout" default:"15m" description:"export (backup) timeout"`
 	AdminPasswd string        `long:"admin-passwd" env:"ADMIN_PASSWD" required:"true" description:"admin basic auth password"`
+	Secret      string        `long:"encrypt-secret" env:"ENCRYPT_SECRET" description:"secret to encrypt backup file"`
+	Archive     bool          `long:"archive" description:"full-site archive with pictures and avatars"`
 	CommonOpts
 }
 
 // Execute runs export with ExportCommand parameters, entry point for "export" command
 func (ec *BackupCommand) Execute(args []string) error {
 	log.Printf("[INFO] export to %s, site %s", ec.ExportPath, ec.Site)
-	resetEnv("SECRET", "ADMIN_PASSWD")
+	resetEnv("SECRET", "ADMIN_PASSWD", "ENCRYPT_SECRET")
 
-	fp := fileParser{site: ec.Site, path: ec.ExportPath, file: ec.ExportFile}
+	crypter, err := makeCrypter(ec.Secret)
+	if err != nil {
+		return err
+	}
+
+	exportFile, format := ec.ExportFile, "native"
+	if ec.Archive {
+		format = "archive"
+		if strings.HasSuffix(exportFile, ".gz") && !strings.HasSuffix(exportFile, ".tar.gz") {
+			exportFile = strings.TrimSuffix(exportFile, ".gz") + ".tar.gz"
+		}
+	}
+	fp := fileParser{site: ec.Site, path: ec.ExportPath, file: exportFile}
 	fname, err := fp.parse(time.Now())
 	if err != nil {
 		return err
@@ -40,7 +55,7 @@ func (ec *BackupCommand) Execute(args []string) error {
 	client := http.Client{}
 	ctx, cancel := context.WithTimeout(context.Background(), ec.Timeout)
 	defer cancel()
-	exportURL := fmt.Sprintf("%s/api/v1/admin/export?mode=file&site=%s", ec.RemarkURL, ec.Site)
+	exportURL := fmt.Sprintf("%s/api/v1/admin/export?mode=file&site=%s&format=%s", ec.RemarkURL, ec.Site, format)
 	req, err := http.NewRequest(http.MethodGet, exportURL, nil)
 	if err != nil {
 		return errors.Wrapf(err, "can't make export request for %s", exportURL)
@@ -72,9 +87,20 @@ func (ec *BackupCommand) Execute(args []string) error {
 		}
 	}()
 
-	if _, err = io.Copy(fh, resp.Body); err != nil {
+	var w io.WriteCloser = fh
+	if crypter != nil {
+		if w, err = crypter.NewWriter(fh); err != nil {
+			return errors.Wrapf(err, "can't make encrypted writer for %s", fname)
+		}
+	}
+	if _, err = io.Copy(w, resp.Body); err != nil {
 		return errors.Wrapf(err, "failed to write backup file %s", fname)
 	}
+	if crypter != nil {
+		if err = w.Close(); err != nil {
+			return errors.Wrapf(err, "failed to finish encrypted backup file %s", fname)
+		}
+	}
 
 	log.Printf("[INFO] export completed, file %s", fname)
 	return nil
@@ -11,6 +11,8 @@ import (
 	flags "github.com/jessevdk/go-flags"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 func TestBackup_Execute(t *testing.T) {
@@ -35,6 +37,56 @@ func TestBackup_Execute(t *testing.T) {
 	assert.Equal(t, "blah\nblah2\n12345678\n", string(data))
 }
 
+func TestBackup_ExecuteArchive(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "archive", r.URL.Query().Get("format"))
+		fmt.Fprint(w, "archive data")
+	}))
+	defer ts.Close()
+
+	cmd := BackupCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--path=/tmp", "--file={{.SITE}}-test-archive.gz", "--admin-passwd=secret",
+		"--archive"})
+	require.Nil(t, err)
+	err = cmd.Execute(nil)
+	assert.NoError(t, err)
+	defer os.Remove("/tmp/remark-test-archive.tar.gz")
+
+	data, err := ioutil.ReadFile("/tmp/remark-test-archive.tar.gz")
+	require.Nil(t, err)
+	assert.Equal(t, "archive data", string(data))
+}
+
+func TestBackup_ExecuteEncrypted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "blah\nblah2\n12345678\n")
+	}))
+	defer ts.Close()
+
+	cmd := BackupCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--path=/tmp", "--file={{.SITE}}-test-enc.export", "--admin-passwd=secret",
+		"--encrypt-secret=enc-secret"})
+	require.Nil(t, err)
+	err = cmd.Execute(nil)
+	assert.NoError(t, err)
+	defer os.Remove("/tmp/remark-test-enc.export")
+
+	fh, err := os.Open("/tmp/remark-test-enc.export")
+	require.Nil(t, err)
+	defer fh.Close()
+	crypter, err := store.NewCrypter("enc-secret")
+	require.NoError(t, err)
+	rd, err := crypter.NewReader(fh)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rd)
+	require.Nil(t, err)
+	assert.Equal(t, "blah\nblah2\n12345678\n", string(data))
+}
+
 func TestBackup_ExecuteFailedStatus(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, r.URL.Path, "/api/v1/admin/export")
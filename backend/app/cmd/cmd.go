@@ -14,6 +14,8 @@ import (
 
 	log "github.com/go-pkgz/lgr"
 	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 // CommonOptionsCommander extends flags.Commander with SetCommon
@@ -108,3 +110,12 @@ func makeDirs(dirs ...string) error {
 	}
 	return nil
 }
+
+// makeCrypter makes crypter for the secret, nil if secret not set and encryption disabled
+func makeCrypter(secret string) (*store.Crypter, error) {
+	if secret == "" {
+		return nil, nil
+	}
+	crypter, err := store.NewCrypter(secret)
+	return crypter, errors.Wrap(err, "can't make crypter")
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config file is yaml with the same structure as command line options. Keys are long names of options,
+// groups are nested by their namespaces, i.e. "--store.bolt.path" and "--admin.shared.id" are
+//
+//   store:
+//     bolt:
+//       path: ./var
+//   admin:
+//     shared:
+//       id: [admin1, admin2]
+//
+// Options set in command line or environment take precedence over config file.
+
+// reloadableOptions can be changed on SIGHUP without restart
+var reloadableOptions = map[string]bool{
+	"admin.shared.id":       true,
+	"admin.shared.email":    true,
+	"restricted-words":      true,
+	"max-comment":           true,
+	"max-votes":             true,
+	"positive-score":        true,
+	"edit-time":             true,
+	"low-score":             true,
+	"critical-score":        true,
+	"notify.telegram.token": true,
+	"notify.telegram.chan":  true,
+	"allowed-origins":       true,
+}
+
+var choiceTagRe = regexp.MustCompile(`choice:"([^"]*)"`)
+
+// loadConfigFile reads yaml config and flattens it to long names of options with namespaces, like "store.bolt.path"
+func loadConfigFile(fname string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(fname) // nolint
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read config file %s", fname)
+	}
+	raw := map[interface{}]interface{}{}
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrapf(err, "can't parse config file %s", fname)
+	}
+	res := map[string][]string{}
+	if err = flattenConfig("", raw, res); err != nil {
+		return nil, errors.Wrapf(err, "invalid config file %s", fname)
+	}
+	return res, nil
+}
+
+func flattenConfig(prefix string, m map[interface{}]interface{}, res map[string][]string) error {
+	for k, v := range m {
+		key := prefix + fmt.Sprintf("%v", k)
+		switch val := v.(type) {
+		case map[interface{}]interface{}:
+			if err := flattenConfig(key+".", val, res); err != nil {
+				return err
+			}
+		case []interface{}:
+			res[key] = []string{}
+			for _, item := range val {
+				switch item.(type) {
+				case map[interface{}]interface{}, []interface{}:
+					return errors.Errorf("%s should be a list of values", key)
+				}
+				res[key] = append(res[key], fmt.Sprintf("%v", item))
+			}
+		case nil:
+			res[key] = []string{""}
+		default:
+			res[key] = []string{fmt.Sprintf("%v", val)}
+		}
+	}
+	return nil
+}
+
+// lockedOptions returns names of options set in command line or environment, config file doesn't change them.
+// cliSet reports if option with given name set in command line, can be nil.
+func lockedOptions(opts interface{}, cliSet func(name string) bool) map[string]bool {
+	res := map[string]bool{}
+	_ = walkOptions(reflect.ValueOf(opts).Elem(), "", "", func(_ reflect.Value, _ reflect.StructTag, name, env string) error {
+		if cliSet != nil && cliSet(name) {
+			res[name] = true
+		}
+		if _, ok := os.LookupEnv(env); ok && env != "" {
+			res[name] = true
+		}
+		return nil
+	})
+	return res
+}
+
+// applyConfig sets options from config file values, skips locked options. Fails on unknown options.
+func applyConfig(opts interface{}, values map[string][]string, locked map[string]bool) error {
+	known := map[string]bool{}
+	err := walkOptions(reflect.ValueOf(opts).Elem(), "", "", func(fld reflect.Value, tag reflect.StructTag, name, _ string) error {
+		known[name] = true
+		vals, ok := values[name]
+		if !ok || locked[name] {
+			return nil
+		}
+		return errors.Wrapf(setOption(fld, tag, vals), "can't set %s", name)
+	})
+	if err != nil {
+		return err
+	}
+
+	unknown := []string{}
+	for k := range values {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown options %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// optionChange describes changed option, values of secrets not shown
+type optionChange struct {
+	name     string
+	old, upd interface{}
+}
+
+func (c optionChange) String() string {
+	if isSecretOption(c.name) {
+		return c.name + ": changed"
+	}
+	return fmt.Sprintf("%s: %v -> %v", c.name, c.old, c.upd)
+}
+
+// optionsDiff returns changed options, sorted by name
+func optionsDiff(old, upd interface{}) (res []optionChange) {
+	values := func(opts interface{}) map[string]interface{} {
+		vals := map[string]interface{}{}
+		_ = walkOptions(reflect.ValueOf(opts).Elem(), "", "", func(fld reflect.Value, _ reflect.StructTag, name, _ string) error {
+			vals[name] = fld.Interface()
+			return nil
+		})
+		return vals
+	}
+
+	oldVals, updVals := values(old), values(upd)
+	for name, o := range oldVals {
+		u := updVals[name]
+		if reflect.DeepEqual(o, u) {
+			continue
+		}
+		ov, uv := reflect.ValueOf(o), reflect.ValueOf(u)
+		if ov.Kind() == reflect.Slice && ov.Len() == 0 && uv.Len() == 0 { // nil and empty slices are the same
+			continue
+		}
+		res = append(res, optionChange{name: name, old: o, upd: u})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
+
+func isSecretOption(name string) bool {
+	for _, s := range []string{"token", "csec", "passwd", "secret"} {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkOptions calls fn for each option field of go-flags struct with option's long name and env key, both with namespaces
+func walkOptions(v reflect.Value, prefix, envPrefix string,
+	fn func(fld reflect.Value, tag reflect.StructTag, name, env string) error) error {
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fld, tag := v.Field(i), t.Field(i).Tag
+		if _, ok := tag.Lookup("group"); ok && fld.Kind() == reflect.Struct {
+			ns, envNs := prefix, envPrefix
+			if n := tag.Get("namespace"); n != "" {
+				ns += n + "."
+			}
+			if n := tag.Get("env-namespace"); n != "" {
+				envNs += n + "_"
+			}
+			if err := walkOptions(fld, ns, envNs, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		long := tag.Get("long")
+		if long == "" || !fld.CanSet() {
+			continue
+		}
+		env := ""
+		if e := tag.Get("env"); e != "" {
+			env = envPrefix + e
+		}
+		if err := fn(fld, tag, prefix+long, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOption converts and sets string values to the option field
+func setOption(fld reflect.Value, tag reflect.StructTag, vals []string) error {
+	if choices := choiceTagRe.FindAllStringSubmatch(string(tag), -1); len(choices) > 0 {
+		for _, v := range vals {
+			found := false
+			for _, c := range choices {
+				found = found || c[1] == v
+			}
+			if !found {
+				return errors.Errorf("invalid value %q", v)
+			}
+		}
+	}
+
+	if fld.Kind() == reflect.Slice {
+		if fld.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("unsupported type %s", fld.Type())
+		}
+		fld.Set(reflect.ValueOf(append([]string{}, vals...)))
+		return nil
+	}
+
+	if len(vals) != 1 {
+		return errors.Errorf("single value expected, got %d", len(vals))
+	}
+	val := vals[0]
+
+	if fld.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		fld.SetInt(int64(d))
+		return nil
+	}
+
+	switch fld.Kind() {
+	case reflect.String:
+		fld.SetString(val)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		fld.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		fld.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fld.SetBool(b)
+	default:
+		return errors.Errorf("unsupported type %s", fld.Type())
+	}
+	return nil
+}
+
+// validateReloadable checks options which can be changed on SIGHUP
+func (s *ServerCommand) validateReloadable() error {
+	if s.CriticalScore > s.LowScore {
+		return errors.Errorf("critical score %d above low score %d", s.CriticalScore, s.LowScore)
+	}
+	if s.EditDuration < 0 {
+		return errors.Errorf("negative edit time %v", s.EditDuration)
+	}
+	for _, w := range s.RestrictedWords {
+		if n := utf8.RuneCountInString(strings.TrimSpace(w)); n < 1 || n > 64 {
+			return errors.Errorf("invalid restricted word %q, length should be 1-64", w)
+		}
+	}
+	for _, o := range s.AllowedOrigins {
+		if o == "" || strings.Count(o, "*") > 1 {
+			return errors.Errorf("invalid allowed origin %q", o)
+		}
+	}
+	if s.Notify.Type == "telegram" && (s.Notify.Telegram.Token == "" || s.Notify.Telegram.Channel == "") {
+		return errors.New("telegram token and channel required")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Apply(t *testing.T) {
+	fname := writeConfig(t, `
+site: [site1, site2]
+max-comment: 4096
+positive-score: true
+edit-time: 10m
+update-limit: 1.5
+store:
+  type: bolt
+  bolt:
+    path: /tmp/remark-cfg
+admin:
+  shared:
+    id: [a1, a2]
+auth:
+  ttl:
+    jwt: 1m
+notify:
+  telegram:
+    chan: remark
+`)
+	defer os.Remove(fname)
+
+	cmd := ServerCommand{}
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--max-comment=1000"})
+	require.NoError(t, err)
+
+	values, err := loadConfigFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2"}, values["admin.shared.id"])
+	assert.Equal(t, []string{"/tmp/remark-cfg"}, values["store.bolt.path"])
+
+	locked := lockedOptions(&cmd, func(name string) bool {
+		opt := p.FindOptionByLongName(name)
+		return opt != nil && opt.IsSet() && !opt.IsSetDefault()
+	})
+	assert.Equal(t, map[string]bool{"max-comment": true}, locked)
+
+	require.NoError(t, applyConfig(&cmd, values, locked))
+	assert.Equal(t, []string{"site1", "site2"}, cmd.Sites)
+	assert.Equal(t, 1000, cmd.MaxCommentSize, "set in command line")
+	assert.True(t, cmd.PositiveScore)
+	assert.Equal(t, 10*time.Minute, cmd.EditDuration)
+	assert.Equal(t, 1.5, cmd.UpdateLimit)
+	assert.Equal(t, "/tmp/remark-cfg", cmd.Store.Bolt.Path)
+	assert.Equal(t, []string{"a1", "a2"}, cmd.Admin.Shared.Admins)
+	assert.Equal(t, time.Minute, cmd.Auth.TTL.JWT)
+	assert.Equal(t, "remark", cmd.Notify.Telegram.Channel)
+	assert.Equal(t, 8080, cmd.Port, "default kept")
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	fname := writeConfig(t, "max-votes: 10\nmax-comment: 100\n")
+	defer os.Remove(fname)
+
+	require.NoError(t, os.Setenv("MAX_VOTES", "5"))
+	defer os.Unsetenv("MAX_VOTES")
+
+	cmd := ServerCommand{}
+	_, err := flags.NewParser(&cmd, flags.Default).ParseArgs([]string{})
+	require.NoError(t, err)
+
+	values, err := loadConfigFile(fname)
+	require.NoError(t, err)
+	require.NoError(t, applyConfig(&cmd, values, lockedOptions(&cmd, nil)))
+	assert.Equal(t, 5, cmd.MaxVotes, "set in env")
+	assert.Equal(t, 100, cmd.MaxCommentSize)
+}
+
+func TestConfig_ApplyFailed(t *testing.T) {
+	tbl := []struct {
+		cfg string
+		err string
+	}{
+		{"blah: 1\nstore: {xyz: 2}", "unknown options blah, store.xyz"},
+		{"store: {type: xyz}", `can't set store.type: invalid value "xyz"`},
+		{"max-comment: abc", `can't set max-comment: strconv.ParseInt: parsing "abc": invalid syntax`},
+		{"edit-time: [1, 2]", "can't set edit-time: single value expected, got 2"},
+		{"edit-time: 5 min", `can't set edit-time: time: unknown unit " min" in duration "5 min"`},
+	}
+
+	for i, tt := range tbl {
+		fname := writeConfig(t, tt.cfg)
+		values, err := loadConfigFile(fname)
+		require.NoError(t, err, "case #%d", i)
+		cmd := ServerCommand{}
+		assert.EqualError(t, applyConfig(&cmd, values, nil), tt.err, "case #%d", i)
+		os.Remove(fname)
+	}
+
+	_, err := loadConfigFile("/tmp/no-such-remark-config.yml")
+	assert.Error(t, err)
+
+	fname := writeConfig(t, "site: [{a: 1}]")
+	defer os.Remove(fname)
+	_, err = loadConfigFile(fname)
+	assert.EqualError(t, err, "invalid config file "+fname+": site should be a list of values")
+}
+
+func TestConfig_Diff(t *testing.T) {
+	c1, c2 := ServerCommand{MaxVotes: 1}, ServerCommand{MaxVotes: 2, RestrictedWords: []string{}}
+	c2.Notify.Telegram.Token = "secret-token"
+	c2.Admin.Shared.Admins = []string{"a1"}
+
+	res := []string{}
+	for _, c := range optionsDiff(&c1, &c2) {
+		res = append(res, c.String())
+	}
+	assert.Equal(t, []string{"admin.shared.id: [] -> [a1]", "max-votes: 1 -> 2", "notify.telegram.token: changed"}, res)
+}
+
+func TestServerApp_ReloadConfig(t *testing.T) {
+	fname := writeConfig(t, `
+admin: {shared: {id: [a1, a2], email: admin@example.com}}
+restricted-words: [duck]
+max-comment: 100
+low-score: -2
+critical-score: -3
+allowed-origins: ["https://*.example.com"]
+port: 9999
+`)
+	defer os.Remove(fname)
+
+	app, _ := prepServerApp(t, 500*time.Millisecond, func(o ServerCommand) ServerCommand {
+		o.ConfigFile = fname
+		o.Notify.Type = "none"
+		return o
+	})
+	defer app.dataService.Close()
+	app.baseOpts, app.loadedOpts, app.lockedOpts = *app.ServerCommand, *app.ServerCommand, map[string]bool{}
+
+	require.NoError(t, app.reloadConfig())
+	assert.Equal(t, []string{"a1", "a2"}, app.dataService.AdminStore.Admins("remark"))
+	assert.Equal(t, "admin@example.com", app.dataService.AdminStore.Email("remark"))
+	words, err := app.restrictedWords.List("remark")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"duck"}, words)
+	assert.Equal(t, 100, app.dataService.SiteConfig("remark").MaxCommentSize)
+	assert.Equal(t, -2, app.restSrv.ScoreThresholds.Low)
+	assert.Equal(t, -3, app.restSrv.ScoreThresholds.Critical)
+	assert.Equal(t, []string{"https://*.example.com"}, app.restSrv.AllowedOrigins)
+	assert.Equal(t, 9999, app.loadedOpts.Port, "changed in loaded options")
+	assert.NotEqual(t, 9999, app.Port, "not applied")
+
+	// invalid config rejected, nothing changed
+	require.NoError(t, ioutil.WriteFile(fname, []byte("max-comment: 200\nlow-score: -5\ncritical-score: -1\n"), 0600))
+	assert.EqualError(t, app.reloadConfig(), "invalid config: critical score -1 above low score -5")
+	assert.Equal(t, 100, app.dataService.SiteConfig("remark").MaxCommentSize)
+}
+
+func writeConfig(t *testing.T, cfg string) string {
+	f, err := ioutil.TempFile("", "remark-config-*.yml")
+	require.NoError(t, err)
+	_, err = f.WriteString(cfg)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,32 +14,51 @@ import (
 
 	log "github.com/go-pkgz/lgr"
 	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/migrator"
+	"github.com/umputun/remark/backend/app/store"
 )
 
+// waitPollTimeout is the timeout of a single import/wait request, below server's timeout of admin requests
+const waitPollTimeout = 20 * time.Second
+
 // ImportCommand set of flags and command for import
 type ImportCommand struct {
 	InputFile   string        `short:"f" long:"file" description:"input file name" required:"true"`
-	Provider    string        `short:"p" long:"provider" default:"disqus" choice:"disqus" choice:"wordpress" description:"import format"`
+	Provider    string        `short:"p" long:"provider" default:"disqus" choice:"disqus" choice:"wordpress" choice:"archive" description:"import format"`
 	Site        string        `short:"s" long:"site" env:"SITE" default:"remark" description:"site name"`
 	Timeout     time.Duration `long:"timeout" default:"15m" description:"import timeout"`
 	AdminPasswd string        `long:"admin-passwd" env:"ADMIN_PASSWD" required:"true" description:"admin basic auth password"`
+	Secret      string        `long:"encrypt-secret" env:"ENCRYPT_SECRET" description:"secret to decrypt encrypted file"`
+	Merge       bool          `long:"merge" description:"merge with comments of the site, add missing and update changed ones"`
+	DryRun      bool          `long:"dry-run" description:"validate import file and report problems, nothing imported"`
 	CommonOpts
 }
 
 // Execute runs import with ImportCommand parameters, entry point for "import" command
 func (ic *ImportCommand) Execute(args []string) error {
 	log.Printf("[INFO] import %s (%s), site %s", ic.InputFile, ic.Provider, ic.Site)
-	resetEnv("SECRET", "ADMIN_PASSWD")
+	resetEnv("SECRET", "ADMIN_PASSWD", "ENCRYPT_SECRET")
 
 	reader, err := ic.reader(ic.InputFile)
 	if err != nil {
 		return errors.Wrapf(err, "can't open import file %s", ic.InputFile)
 	}
+	return ic.send(reader)
+}
 
+// send posts data from reader to remark's import api
+func (ic *ImportCommand) send(reader io.Reader) error {
 	client := http.Client{}
 	ctx, cancel := context.WithTimeout(context.Background(), ic.Timeout)
 	defer cancel()
 	importURL := fmt.Sprintf("%s/api/v1/admin/import?site=%s&provider=%s", ic.RemarkURL, ic.Site, ic.Provider)
+	switch {
+	case ic.DryRun:
+		importURL += "&mode=dry-run"
+	case ic.Merge:
+		importURL += "&mode=merge"
+	}
 	req, err := http.NewRequest(http.MethodPost, importURL, reader)
 	if err != nil {
 		return errors.Wrapf(err, "can't make import request for %s", importURL)
@@ -64,19 +84,133 @@ func (ic *ImportCommand) Execute(args []string) error {
 	}
 
 	log.Printf("[INFO] completed, status=%d, %s", resp.StatusCode, string(body))
+	if !ic.Merge && !ic.DryRun {
+		return nil
+	}
+
+	res, err := ic.wait(ctx, &client)
+	if err != nil {
+		return err
+	}
+	if ic.DryRun {
+		if res.Validated == nil {
+			return errors.New("validation failed, see server's log")
+		}
+		return ic.printReport(*res.Validated)
+	}
+	if res.Merged == nil {
+		return errors.New("merge failed, see server's log")
+	}
+	stats := res.Merged
+	log.Printf("[INFO] merged, inserted %d, updated %d, skipped %d, failed %d", stats.Inserted, stats.Updated,
+		stats.Skipped, stats.Failed)
+	if stats.Failed > 0 {
+		return errors.Errorf("failed to merge %d comments", stats.Failed)
+	}
 	return nil
 }
 
-// reader returns reader for file. For .gz file wraps with gunzip
+// waitResult is response of import/wait, with results of merge or dry-run
+type waitResult struct {
+	Merged    *migrator.ImportStats      `json:"merged"`
+	Validated *migrator.ValidationReport `json:"validated"`
+}
+
+// wait waits for completion of merge or dry-run running in background and returns its results.
+// Polls import/wait with short timeout, each request completes within timeouts of the server.
+func (ic *ImportCommand) wait(ctx context.Context, client *http.Client) (waitResult, error) {
+	for {
+		res, done, err := ic.poll(ctx, client)
+		if err != nil || done {
+			return res, err
+		}
+	}
+}
+
+// poll makes single import/wait request, done is false if merge or dry-run still running
+func (ic *ImportCommand) poll(ctx context.Context, client *http.Client) (res waitResult, done bool, err error) {
+	waitURL := fmt.Sprintf("%s/api/v1/admin/import/wait?site=%s&timeout=%s", ic.RemarkURL, ic.Site, waitPollTimeout)
+	req, err := http.NewRequest(http.MethodGet, waitURL, nil)
+	if err != nil {
+		return res, false, errors.Wrapf(err, "can't make wait request for %s", waitURL)
+	}
+	req.SetBasicAuth("admin", ic.AdminPasswd)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return res, false, errors.Wrapf(err, "request failed for %s", waitURL)
+	}
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			log.Printf("[WARN] failed to close response, %s", e)
+		}
+	}()
+	if resp.StatusCode == http.StatusGatewayTimeout {
+		return res, false, nil
+	}
+	if resp.StatusCode >= 300 {
+		return res, false, responseError(resp)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, false, errors.Wrap(err, "can't decode import results")
+	}
+	return res, true, nil
+}
+
+// printReport logs validation report of dry-run, fails if problems found
+func (ic *ImportCommand) printReport(report migrator.ValidationReport) error {
+	log.Printf("[INFO] %d posts, %d comments", report.Posts, report.Comments)
+	issues := []struct {
+		name  string
+		issue migrator.ValidationIssue
+	}{
+		{"orphaned parents", report.Orphans},
+		{"duplicate ids", report.Duplicates},
+		{"invalid timestamps", report.InvalidTime},
+		{"users without id", report.NoUserID},
+		{"comments of unknown post", report.NoURL},
+		{"oversized texts", report.Oversized},
+	}
+	if report.Failed > 0 {
+		log.Printf("[WARN] failed to decode %d records", report.Failed)
+	}
+	for _, i := range issues {
+		if i.issue.Count > 0 {
+			log.Printf("[WARN] %s: %d, %s", i.name, i.issue.Count, strings.Join(i.issue.IDs, ", "))
+		}
+	}
+	for _, c := range report.Sample {
+		log.Printf("[INFO] sample %s, %s by %s (%s) at %s: %s", c.ID, c.Locator.URL, c.User.Name, c.User.ID,
+			c.Timestamp.Format(time.RFC3339), c.Text)
+	}
+	if n := report.Issues(); n > 0 {
+		return errors.Errorf("found %d problems in %s", n, ic.InputFile)
+	}
+	return nil
+}
+
+// reader returns reader for file. Encrypted file decrypted, for .gz file wraps with gunzip,
+// archive passed gzipped as is
 func (ic *ImportCommand) reader(inp string) (reader io.Reader, err error) {
 	inpFile, err := os.Open(inp)
 	if err != nil {
 		return nil, errors.Wrapf(err, "import failed, can't open %s", inp)
 	}
 
-	reader = inpFile
-	if strings.HasSuffix(ic.InputFile, ".gz") {
-		if reader, err = gzip.NewReader(inpFile); err != nil {
+	encrypted, reader := store.IsEncryptedStream(inpFile)
+	if encrypted {
+		crypter, e := makeCrypter(ic.Secret)
+		if e != nil {
+			return nil, e
+		}
+		if crypter == nil {
+			return nil, errors.Errorf("%s encrypted, secret not set", inp)
+		}
+		if reader, err = crypter.NewReader(reader); err != nil {
+			return nil, errors.Wrapf(err, "can't decrypt %s", inp)
+		}
+	}
+	if strings.HasSuffix(ic.InputFile, ".gz") && ic.Provider != "archive" {
+		if reader, err = gzip.NewReader(reader); err != nil {
 			return nil, errors.Wrap(err, "can't make gz reader")
 		}
 	}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +15,8 @@ import (
 	flags "github.com/jessevdk/go-flags"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 func TestImport_Execute(t *testing.T) {
@@ -48,6 +52,117 @@ func TestImport_Execute(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestImport_ExecuteEncrypted(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "blah\nblah2\n12345678\n", string(body))
+		fmt.Fprintln(w, "some response")
+	}))
+	defer ts.Close()
+
+	data, err := ioutil.ReadFile("testdata/import.txt.gz")
+	require.NoError(t, err)
+	crypter, err := store.NewCrypter("enc-secret")
+	require.NoError(t, err)
+	buf := bytes.Buffer{}
+	w, err := crypter.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	fname := os.TempDir() + "/remark-import-encrypted.gz"
+	require.NoError(t, ioutil.WriteFile(fname, buf.Bytes(), 0600))
+	defer os.Remove(fname)
+
+	cmd := ImportCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--file=" + fname, "--admin-passwd=secret", "--encrypt-secret=enc-secret"})
+	require.Nil(t, err)
+	assert.NoError(t, cmd.Execute(nil))
+
+	cmd = ImportCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p = flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--file=" + fname, "--admin-passwd=secret"})
+	require.Nil(t, err)
+	err = cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "encrypted, secret not set")
+}
+
+func TestImport_ExecuteMerge(t *testing.T) {
+	failed, polls := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/admin/import":
+			assert.Equal(t, "POST", r.Method)
+			assert.Equal(t, "merge", r.URL.Query().Get("mode"))
+			fmt.Fprintln(w, `{"status":"import request accepted"}`)
+		case "/api/v1/admin/import/wait":
+			assert.Equal(t, "GET", r.Method)
+			assert.Equal(t, "remark", r.URL.Query().Get("site"))
+			if polls++; polls%2 == 1 { // merge still running
+				w.WriteHeader(http.StatusGatewayTimeout)
+				fmt.Fprintln(w, `{"status":"timeout expired"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"merged":{"inserted":1,"updated":2,"skipped":3,"failed":%d},"status":"completed"}`, failed)
+		default:
+			t.Fatalf("unexpected request %s", r.URL)
+		}
+	}))
+	defer ts.Close()
+
+	cmd := ImportCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--file=testdata/import.txt", "--admin-passwd=secret", "--merge"})
+	require.Nil(t, err)
+	assert.NoError(t, cmd.Execute(nil))
+
+	failed = 1
+	assert.EqualError(t, cmd.Execute(nil), "failed to merge 1 comments")
+}
+
+func TestImport_ExecuteDryRun(t *testing.T) {
+	report := `{"posts":2,"comments":3,"failed":0,"orphans":{"count":0},"duplicates":{"count":0},"invalid_timestamps":{"count":0},` +
+		`"no_user_id":{"count":%d,"ids":["c2"]},"oversized":{"count":0},"sample":[{"id":"c1","text":"some text"}]}`
+	noUserID := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/admin/import":
+			assert.Equal(t, "dry-run", r.URL.Query().Get("mode"))
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, `{"status":"import request accepted"}`)
+		case "/api/v1/admin/import/wait":
+			if noUserID < 0 { // validation failed
+				fmt.Fprintln(w, `{"status":"completed"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"validated":`+report+`,"status":"completed"}`, noUserID)
+		default:
+			t.Fatalf("unexpected request %s", r.URL)
+		}
+	}))
+	defer ts.Close()
+
+	cmd := ImportCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err := p.ParseArgs([]string{"--site=remark", "--file=testdata/import.txt", "--admin-passwd=secret", "--dry-run"})
+	require.Nil(t, err)
+	assert.NoError(t, cmd.Execute(nil))
+
+	noUserID = 1
+	assert.EqualError(t, cmd.Execute(nil), "found 1 problems in testdata/import.txt")
+
+	noUserID = -1
+	assert.EqualError(t, cmd.Execute(nil), "validation failed, see server's log")
+}
+
 func TestImport_ExecuteFailed(t *testing.T) {
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,40 +1,186 @@
 package cmd
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/migrator"
 )
 
 // RestoreCommand set of flags and command for restore from backup
 type RestoreCommand struct {
 	ImportPath string `short:"p" long:"path" env:"BACKUP_PATH" default:"./var/backup" description:"export path"`
-	ImportFile string `short:"f" long:"file" default:"userbackup-{{.SITE}}-{{.YYYYMMDD}}.gz" description:"file name" required:"true"`
+	ImportFile string `short:"f" long:"file" default:"userbackup-{{.SITE}}-{{.YYYYMMDD}}.gz" description:"file name"`
+	Time       string `short:"t" long:"time" description:"restore state at the time, like 2006-01-02T15:04:05, from backups and change log backups"`
+	List       bool   `long:"list" description:"list remote backups of the site"`
 
 	Site        string        `short:"s" long:"site" env:"SITE" default:"remark" description:"site name"`
 	Timeout     time.Duration `long:"timeout" default:"15m" description:"import timeout"`
 	AdminPasswd string        `long:"admin-passwd" env:"ADMIN_PASSWD" required:"true" description:"admin basic auth password"`
+	Secret      string        `long:"encrypt-secret" env:"ENCRYPT_SECRET" description:"secret to decrypt encrypted backup"`
+	S3          S3Group       `group:"backup-s3" namespace:"backup-s3" env-namespace:"BACKUP_S3"`
 	CommonOpts
 }
 
+// timeFormats accepted by --time, without zone the time is local
+var timeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
 // Execute runs import with RestoreCommand parameters, entry point for "restore" command
-// uses ImportCommand with constructed full file name
+// uses ImportCommand with constructed full file name, .tar.gz file restored as full-site archive.
+// With s3 bucket set, backups missing locally fetched from s3.
 func (rc *RestoreCommand) Execute(args []string) error {
-	log.Printf("[INFO] restore %s, site %s", rc.ImportFile, rc.Site)
-	resetEnv("SECRET", "ADMIN_PASSWD")
+	resetEnv("SECRET", "ADMIN_PASSWD", "ENCRYPT_SECRET", "BACKUP_S3_SECRET_KEY")
 
-	fp := fileParser{site: rc.Site, path: rc.ImportPath, file: rc.ImportFile}
-	fname, err := fp.parse(time.Now())
-	if err != nil {
-		return err
+	sink := rc.S3.makeSink()
+	if rc.List {
+		return rc.listRemote(sink)
 	}
+
 	importer := ImportCommand{
-		InputFile:   fname,
 		Site:        rc.Site,
 		Provider:    "native",
 		Timeout:     rc.Timeout,
 		AdminPasswd: rc.AdminPasswd,
+		Secret:      rc.Secret,
 		CommonOpts:  rc.CommonOpts,
 	}
+	if rc.Time != "" {
+		if sink != nil {
+			if err := rc.fetchAll(sink); err != nil {
+				return err
+			}
+		}
+		return rc.restoreAt(&importer)
+	}
+
+	log.Printf("[INFO] restore %s, site %s", rc.ImportFile, rc.Site)
+	fp := fileParser{site: rc.Site, path: rc.ImportPath, file: rc.ImportFile}
+	fname, err := fp.parse(time.Now())
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(fname); os.IsNotExist(err) && sink != nil {
+		if err = makeDirs(filepath.Dir(fname)); err != nil {
+			return err
+		}
+		if err = fetchRemote(sink, filepath.Base(fname), fname); err != nil {
+			return err
+		}
+	}
+	importer.InputFile = fname
+	if strings.HasSuffix(fname, ".tar.gz") {
+		importer.Provider = "archive"
+	}
 	return importer.Execute(args)
 }
+
+// listRemote prints backups of the site stored in s3
+func (rc *RestoreCommand) listRemote(sink migrator.BackupSink) error {
+	if sink == nil {
+		return errors.New("remote backups not set, s3 bucket required")
+	}
+	files, err := sink.List(rc.Site)
+	if err != nil {
+		return errors.Wrapf(err, "can't list remote backups of %s", rc.Site)
+	}
+	for _, f := range files {
+		fmt.Printf("%s\t%d\t%s\n", f.Name, f.Size, f.Modified.Format(time.RFC3339))
+	}
+	log.Printf("[INFO] %d remote backups of %s", len(files), rc.Site)
+	return nil
+}
+
+// fetchAll fetches remote backups and change log backups of the site missing locally
+func (rc *RestoreCommand) fetchAll(sink migrator.BackupSink) error {
+	files, err := sink.List(rc.Site)
+	if err != nil {
+		return errors.Wrapf(err, "can't list remote backups of %s", rc.Site)
+	}
+	if err = makeDirs(rc.ImportPath); err != nil {
+		return err
+	}
+	for _, f := range files {
+		fileName, e := rc.remoteFile(f.Name)
+		if e != nil {
+			log.Printf("[WARN] skip remote backup, %v", e)
+			continue
+		}
+		if _, err = os.Stat(fileName); err == nil {
+			continue
+		}
+		if err = fetchRemote(sink, f.Name, fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteFile returns local file for remote backup of the site. Rejects names not made by backup
+// and names able to escape import path, object names come from the bucket as is.
+func (rc *RestoreCommand) remoteFile(name string) (string, error) {
+	if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", errors.Errorf("invalid name %q", name)
+	}
+	if !strings.HasPrefix(name, "backup-"+rc.Site+"-") && !strings.HasPrefix(name, "changes-"+rc.Site+"-") {
+		return "", errors.Errorf("name %q is not a backup of %s", name, rc.Site)
+	}
+	return filepath.Join(rc.ImportPath, name), nil
+}
+
+// fetchRemote downloads remote backup to the file, checksum verified by sink
+func fetchRemote(sink migrator.BackupSink, name, fileName string) error {
+	log.Printf("[INFO] fetch remote backup %s", name)
+	tmpName := fileName + ".tmp"
+	fh, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "can't create %s", tmpName)
+	}
+	err = sink.Get(name, fh)
+	if e := fh.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return errors.Wrapf(err, "can't fetch remote backup %s", name)
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// restoreAt rebuilds state of the site at rc.Time from backups and sends it to import
+func (rc *RestoreCommand) restoreAt(importer *ImportCommand) error {
+	ts, err := parseTime(rc.Time)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] restore site %s at %s", rc.Site, ts.Format(time.RFC3339))
+
+	crypter, err := makeCrypter(rc.Secret)
+	if err != nil {
+		return err
+	}
+	pit := migrator.PointInTime{BackupLocation: rc.ImportPath, SiteID: rc.Site, Crypter: crypter}
+	buf := &bytes.Buffer{}
+	backup, replayed, err := pit.Restore(buf, ts)
+	if err != nil {
+		return errors.Wrapf(err, "can't restore %s at %s", rc.Site, rc.Time)
+	}
+	log.Printf("[INFO] state at %s made from %s and %d changes", ts.Format(time.RFC3339), backup, replayed)
+	return importer.send(buf)
+}
+
+// parseTime parses time in one of timeFormats
+func parseTime(s string) (time.Time, error) {
+	for _, f := range timeFormats {
+		if ts, err := time.ParseInLocation(f, s, time.Local); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("can't parse time %q, expected format like 2006-01-02T15:04:05", s)
+}
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"compress/gzip"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	flags "github.com/jessevdk/go-flags"
 	"github.com/stretchr/testify/assert"
@@ -36,3 +41,192 @@ func TestRestore_Execute(t *testing.T) {
 	err = cmd.Execute(nil)
 	assert.NoError(t, err)
 }
+
+func TestRestore_ExecuteArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore_archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(dir+"/remark-archive.tar.gz", []byte("gzipped tar"), 0600))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "archive", r.URL.Query().Get("provider"))
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "gzipped tar", string(body), "archive sent as is")
+		fmt.Fprintln(w, "some response")
+	}))
+	defer ts.Close()
+
+	cmd := RestoreCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--path=" + dir, "--file={{.SITE}}-archive.tar.gz", "--admin-passwd=secret"})
+	require.Nil(t, err)
+	assert.NoError(t, cmd.Execute(nil))
+}
+
+func TestRestore_ExecuteAt(t *testing.T) {
+	loc, err := ioutil.TempDir("", "remark-restore")
+	require.NoError(t, err)
+	defer os.RemoveAll(loc)
+
+	created := time.Date(2019, 5, 20, 10, 0, 0, 0, time.Local)
+	comment := `{"id":"id1","text":"some text","locator":{"site":"remark","url":"https://example.com"},"user":{"id":"u1"},"time":"2019-05-20T09:00:00Z"}`
+	writeGz(t, loc+"/backup-remark-20190520.gz", fmt.Sprintf(`{"version":1,"created":%q}`, created.Format(time.RFC3339))+"\n"+comment+"\n")
+	edited := strings.Replace(comment, "some text", "edited text", 1)
+	writeGz(t, loc+"/changes-remark-20190520120000.gz",
+		fmt.Sprintf(`{"seq":1,"site":"remark","type":"edit","time":%q,"comment":%s}`, created.Add(time.Hour).Format(time.RFC3339), edited)+"\n")
+
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/api/v1/admin/import")
+		assert.Equal(t, "native", r.URL.Query().Get("provider"))
+		b, e := ioutil.ReadAll(r.Body)
+		assert.NoError(t, e)
+		body = string(b)
+		fmt.Fprintln(w, "some response")
+	}))
+	defer ts.Close()
+
+	cmd := RestoreCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--path=" + loc, "--time=2019-05-20T10:30:00", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+	assert.Contains(t, body, `"created":"2019-05-20T10:30:00`)
+	assert.Contains(t, body, `"text":"some text"`)
+
+	_, err = p.ParseArgs([]string{"--site=remark", "--path=" + loc, "--time=2019-05-20 11:30", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+	assert.Contains(t, body, `"text":"edited text"`)
+
+	_, err = p.ParseArgs([]string{"--site=remark", "--path=" + loc, "--time=2019-05-19T10:30:00", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), "can't restore remark at 2019-05-19T10:30:00: no backup of remark made before "+
+		time.Date(2019, 5, 19, 10, 30, 0, 0, time.Local).Format(time.RFC3339))
+
+	_, err = p.ParseArgs([]string{"--site=remark", "--path=" + loc, "--time=yesterday", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), `can't parse time "yesterday", expected format like 2006-01-02T15:04:05`)
+}
+
+func writeGz(t *testing.T, fileName, data string) {
+	fh, err := os.Create(fileName)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(fh)
+	_, err = gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, fh.Close())
+}
+
+func TestRestore_ExecuteRemote(t *testing.T) {
+	loc, err := ioutil.TempDir("", "remark-restore")
+	require.NoError(t, err)
+	defer os.RemoveAll(loc)
+
+	writeGz(t, loc+"/remote.gz", "blah\n")
+	content, err := ioutil.ReadFile(loc + "/remote.gz")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(loc+"/remote.gz"))
+
+	// s3 stand-in with two backups, the second one damaged
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=key/")
+		switch {
+		case r.URL.Path == "/bkt/remark42/backup-remark-20190520.gz":
+			w.Header().Set("X-Amz-Meta-Sha256", fmt.Sprintf("%x", sha256.Sum256(content)))
+			_, _ = w.Write(content)
+		case r.URL.Path == "/bkt/remark42/backup-remark-20190521.gz":
+			w.Header().Set("X-Amz-Meta-Sha256", fmt.Sprintf("%x", sha256.Sum256(content)))
+			_, _ = w.Write(content[1:])
+		case r.URL.Path == "/bkt/" && r.URL.Query().Get("prefix") == "remark42/backup-remark-":
+			fmt.Fprint(w, "<ListBucketResult><Contents><Key>remark42/backup-remark-20190520.gz</Key><Size>5</Size>"+
+				"<LastModified>2019-05-20T10:00:00Z</LastModified></Contents>"+
+				"<Contents><Key>remark42/backup-remark-/../../evil.gz</Key><Size>5</Size>"+
+				"<LastModified>2019-05-20T10:00:00Z</LastModified></Contents></ListBucketResult>")
+		case r.URL.Path == "/bkt/":
+			fmt.Fprint(w, "<ListBucketResult></ListBucketResult>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s3.Close()
+
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, e := ioutil.ReadAll(r.Body)
+		assert.NoError(t, e)
+		body = string(b)
+		fmt.Fprintln(w, "some response")
+	}))
+	defer ts.Close()
+
+	cmd := RestoreCommand{}
+	cmd.SetCommon(CommonOpts{RemarkURL: ts.URL, SharedSecret: "123456"})
+	p := flags.NewParser(&cmd, flags.Default)
+	s3opts := []string{"--backup-s3.endpoint=" + s3.URL, "--backup-s3.bucket=bkt", "--backup-s3.prefix=remark42/",
+		"--backup-s3.access-key=key", "--backup-s3.secret-key=secret"}
+
+	_, err = p.ParseArgs(append([]string{"--site=remark", "--path=" + loc, "--list", "--admin-passwd=secret"}, s3opts...))
+	require.NoError(t, err)
+	assert.NoError(t, cmd.Execute(nil))
+
+	cmd.List = false
+	_, err = p.ParseArgs(append([]string{"--site=remark", "--path=" + loc + "/sub", "--file=backup-remark-20190520.gz",
+		"--admin-passwd=secret"}, s3opts...))
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+	assert.Equal(t, "blah\n", body)
+	_, err = os.Stat(loc + "/sub/backup-remark-20190520.gz")
+	assert.NoError(t, err, "fetched")
+
+	_, err = p.ParseArgs(append([]string{"--site=remark", "--path=" + loc, "--file=backup-remark-20190521.gz",
+		"--admin-passwd=secret"}, s3opts...))
+	require.NoError(t, err)
+	err = cmd.Execute(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch for backup-remark-20190521.gz")
+	_, err = os.Stat(loc + "/backup-remark-20190521.gz")
+	assert.True(t, os.IsNotExist(err), "not fetched with bad checksum")
+
+	_, err = p.ParseArgs(append([]string{"--site=remark", "--path=" + loc, "--time=2019-05-21T10:00:00",
+		"--admin-passwd=secret"}, s3opts...))
+	require.NoError(t, err)
+	assert.Error(t, cmd.Execute(nil), "not a native export")
+	_, err = os.Stat(loc + "/backup-remark-20190520.gz")
+	assert.NoError(t, err, "all listed backups fetched")
+
+	cmd = RestoreCommand{}
+	p = flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--path=" + loc, "--list", "--admin-passwd=secret"})
+	require.NoError(t, err)
+	assert.EqualError(t, cmd.Execute(nil), "remote backups not set, s3 bucket required")
+}
+
+func TestRestore_RemoteFile(t *testing.T) {
+	rc := RestoreCommand{ImportPath: "/tmp/backup", Site: "remark"}
+	tbl := []struct {
+		name, file string
+		ok         bool
+	}{
+		{"backup-remark-20190520.gz", "/tmp/backup/backup-remark-20190520.gz", true},
+		{"changes-remark-20190520T100000.gz", "/tmp/backup/changes-remark-20190520T100000.gz", true},
+		{"backup-remark-/../../evil.gz", "", false},
+		{"backup-remark-..gz", "", false},
+		{`backup-remark-x\evil.gz`, "", false},
+		{"backup-other-20190520.gz", "", false},
+		{"evil.gz", "", false},
+	}
+	for _, tt := range tbl {
+		file, err := rc.remoteFile(tt.name)
+		if !tt.ok {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.file, file)
+	}
+}
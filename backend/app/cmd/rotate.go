@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/engine"
+)
+
+// RotateKeyCommand set of flags and command for re-encryption of bolt files and backups in place.
+// Should run with server stopped. Empty old secret encrypts plain data, empty new secret decrypts it.
+type RotateKeyCommand struct {
+	BoltPath       string        `long:"bolt-path" env:"STORE_BOLT_PATH" default:"./var" description:"parent dir for bolt files"`
+	BackupLocation string        `long:"backup" env:"BACKUP_PATH" default:"./var/backup" description:"backups location"`
+	Sites          []string      `long:"site" env:"SITE" default:"remark" description:"site names" env-delim:","`
+	Timeout        time.Duration `long:"timeout" default:"30s" description:"bolt timeout"`
+	OldSecret      string        `long:"old-secret" env:"OLD_ENCRYPT_SECRET" description:"current secret, empty for plain data"`
+	NewSecret      string        `long:"new-secret" env:"ENCRYPT_SECRET" description:"new secret, empty to decrypt data"`
+	CommonOpts
+}
+
+// Execute runs re-encryption with RotateKeyCommand parameters, entry point for "rotate-key" command
+func (rc *RotateKeyCommand) Execute(args []string) error {
+	log.Printf("[INFO] rotate encryption key for %v", rc.Sites)
+	resetEnv("SECRET", "OLD_ENCRYPT_SECRET", "ENCRYPT_SECRET")
+
+	if rc.OldSecret == rc.NewSecret {
+		return errors.New("old and new secrets are the same")
+	}
+	from, err := makeCrypter(rc.OldSecret)
+	if err != nil {
+		return err
+	}
+	to, err := makeCrypter(rc.NewSecret)
+	if err != nil {
+		return err
+	}
+
+	for _, site := range rc.Sites {
+		fileName := fmt.Sprintf("%s/%s.db", rc.BoltPath, site)
+		if _, err = os.Stat(fileName); err != nil {
+			return errors.Wrapf(err, "can't access bolt file of %s", site)
+		}
+		count, err := engine.RotateBoltKey(fileName, bolt.Options{Timeout: rc.Timeout}, from, to)
+		if err != nil {
+			return errors.Wrapf(err, "can't rotate key of %s", site)
+		}
+		log.Printf("[INFO] %d values of %s re-encrypted", count, fileName)
+
+		files, err := rc.backupFiles(site)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err = rotateFile(f, from, to); err != nil {
+				return errors.Wrapf(err, "can't rotate key of %s", f)
+			}
+		}
+		log.Printf("[INFO] %d backups of %s re-encrypted", len(files), site)
+	}
+	return nil
+}
+
+// backupFiles returns automatic and manual backups of the site
+func (rc *RotateKeyCommand) backupFiles(site string) (res []string, err error) {
+	files, err := ioutil.ReadDir(rc.BackupLocation)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "can't read backup directory %s", rc.BackupLocation)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "backup-"+site+"-") || strings.HasPrefix(f.Name(), "userbackup-"+site+"-") {
+			res = append(res, filepath.Join(rc.BackupLocation, f.Name()))
+		}
+	}
+	return res, nil
+}
+
+// rotateFile re-encrypts file with new crypter, written to temp file and renamed when completed.
+// Plain file encrypted, with nil to the file left decrypted.
+func rotateFile(fileName string, from, to *store.Crypter) (err error) {
+	fh, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := fh.Close(); e != nil {
+			log.Printf("[WARN] can't close %s, %v", fileName, e)
+		}
+	}()
+
+	encrypted, reader := store.IsEncryptedStream(fh)
+	if !encrypted && to == nil {
+		return nil // plain already
+	}
+	if encrypted {
+		if from == nil {
+			return errors.New("encrypted file, old secret not set")
+		}
+		if reader, err = from.NewReader(reader); err != nil {
+			return err
+		}
+	}
+
+	tmpName := fileName + ".tmp"
+	tmp, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "can't make temp file")
+	}
+	var w io.WriteCloser = tmp
+	if to != nil {
+		if w, err = to.NewWriter(tmp); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if _, err = io.Copy(w, reader); err == nil && to != nil {
+		err = w.Close()
+	}
+	if e := tmp.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
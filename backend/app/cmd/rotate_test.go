@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	flags "github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/engine"
+)
+
+func TestRotateKey_Execute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remark-rotate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(dir+"/backup", 0700))
+
+	c1, err := store.NewCrypter("secret1")
+	require.NoError(t, err)
+	b, err := engine.NewEncryptedBoltDB(bolt.Options{}, c1, engine.BoltSite{FileName: dir + "/remark.db", SiteID: "remark"})
+	require.NoError(t, err)
+	loc := store.Locator{URL: "https://remark42.com/blah", SiteID: "remark"}
+	_, err = b.Create(store.Comment{ID: "id-1", Text: "some text", Locator: loc, User: store.User{ID: "user1"},
+		Timestamp: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	buf := bytes.Buffer{}
+	w, err := c1.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("encrypted backup"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, ioutil.WriteFile(dir+"/backup/backup-remark-20191010.gz", buf.Bytes(), 0600))
+	require.NoError(t, ioutil.WriteFile(dir+"/backup/userbackup-remark-20191011.gz", []byte("plain backup"), 0600))
+	require.NoError(t, ioutil.WriteFile(dir+"/backup/backup-other-20191010.gz", []byte("other site"), 0600))
+
+	cmd := RotateKeyCommand{}
+	p := flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--bolt-path=" + dir, "--backup=" + dir + "/backup",
+		"--old-secret=secret1", "--new-secret=secret2"})
+	require.NoError(t, err)
+	require.NoError(t, cmd.Execute(nil))
+
+	c2, err := store.NewCrypter("secret2")
+	require.NoError(t, err)
+	b, err = engine.NewEncryptedBoltDB(bolt.Options{}, c2, engine.BoltSite{FileName: dir + "/remark.db", SiteID: "remark"})
+	require.NoError(t, err)
+	c, err := b.Get(loc, "id-1")
+	require.NoError(t, err)
+	assert.Equal(t, "some text", c.Text)
+	require.NoError(t, b.Close())
+
+	readBackup := func(name string) string {
+		fh, err := os.Open(dir + "/backup/" + name)
+		require.NoError(t, err)
+		defer fh.Close()
+		encrypted, rd := store.IsEncryptedStream(fh)
+		require.True(t, encrypted, name)
+		rd, err = c2.NewReader(rd)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(rd)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "encrypted backup", readBackup("backup-remark-20191010.gz"))
+	assert.Equal(t, "plain backup", readBackup("userbackup-remark-20191011.gz"), "plain backup encrypted")
+	data, err := ioutil.ReadFile(dir + "/backup/backup-other-20191010.gz")
+	require.NoError(t, err)
+	assert.Equal(t, "other site", string(data), "backup of other site untouched")
+
+	cmd = RotateKeyCommand{}
+	p = flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=remark", "--bolt-path=" + dir, "--backup=" + dir + "/backup",
+		"--old-secret=secret1", "--new-secret=secret3"})
+	require.NoError(t, err)
+	assert.Error(t, cmd.Execute(nil), "wrong old secret")
+
+	cmd = RotateKeyCommand{}
+	p = flags.NewParser(&cmd, flags.Default)
+	_, err = p.ParseArgs([]string{"--site=bad", "--bolt-path=" + dir, "--old-secret=secret1", "--new-secret=secret3"})
+	require.NoError(t, err)
+	assert.Error(t, cmd.Execute(nil), "no bolt file for site")
+}
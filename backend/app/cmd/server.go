@@ -47,11 +47,20 @@ type ServerCommand struct {
 	Image  ImageGroup  `group:"image" namespace:"image" env-namespace:"IMAGE"`
 	SSL    SSLGroup    `group:"ssl" namespace:"ssl" env-namespace:"SSL"`
 	Stream StreamGroup `group:"stream" namespace:"stream" env-namespace:"STREAM"`
+	Trust  TrustGroup  `group:"trust" namespace:"trust" env-namespace:"TRUST"`
+
+	Retention  RetentionGroup  `group:"retention" namespace:"retention" env-namespace:"RETENTION"`
+	ChangeLog  ChangeLogGroup  `group:"changelog" namespace:"changelog" env-namespace:"CHANGELOG"`
+	BackupS3   S3Group         `group:"backup-s3" namespace:"backup-s3" env-namespace:"BACKUP_S3"`
+	BackupKeep BackupKeepGroup `group:"backup-keep" namespace:"backup-keep" env-namespace:"BACKUP_KEEP"`
 
 	Sites           []string      `long:"site" env:"SITE" default:"remark" description:"site names" env-delim:","`
 	AdminPasswd     string        `long:"admin-passwd" env:"ADMIN_PASSWD" default:"" description:"admin basic auth password"`
 	BackupLocation  string        `long:"backup" env:"BACKUP_PATH" default:"./var/backup" description:"backups location"`
 	MaxBackupFiles  int           `long:"max-back" env:"MAX_BACKUP_FILES" default:"10" description:"max backups to keep"`
+	BackupSchedule  string        `long:"backup-schedule" env:"BACKUP_SCHEDULE" description:"cron-like schedule of backups, i.e. \"30 3 * * *\", default every 24h"`
+	BackupChanges   time.Duration `long:"backup-changes" env:"BACKUP_CHANGES" default:"0s" description:"change log backup interval for point-in-time restore, 0 - disabled"`
+	BackupArchive   bool          `long:"backup-archive" env:"BACKUP_ARCHIVE" description:"make backups as full-site archives with pictures and avatars"`
 	ImageProxy      bool          `long:"img-proxy" env:"IMG_PROXY" description:"enable image proxy"`
 	MaxCommentSize  int           `long:"max-comment" env:"MAX_COMMENT_SIZE" default:"2048" description:"max comment size"`
 	MaxVotes        int           `long:"max-votes" env:"MAX_VOTES" default:"-1" description:"maximum number of votes per comment"`
@@ -60,10 +69,16 @@ type ServerCommand struct {
 	PositiveScore   bool          `long:"positive-score" env:"POSITIVE_SCORE" description:"enable positive score only"`
 	ReadOnlyAge     int           `long:"read-age" env:"READONLY_AGE" default:"0" description:"read-only age of comments, days"`
 	EditDuration    time.Duration `long:"edit-time" env:"EDIT_TIME" default:"5m" description:"edit window"`
+	TrashDuration   time.Duration `long:"trash-time" env:"TRASH_TIME" default:"0s" description:"keep deleted comments for restore, 0 - disabled"`
 	Port            int           `long:"port" env:"REMARK_PORT" default:"8080" description:"port"`
 	WebRoot         string        `long:"web-root" env:"REMARK_WEB_ROOT" default:"./web" description:"web root directory"`
 	UpdateLimit     float64       `long:"update-limit" env:"UPDATE_LIMIT" default:"0.5" description:"updates/sec limit"`
 	RestrictedWords []string      `long:"restricted-words" env:"RESTRICTED_WORDS" description:"words prohibited to use in comments" env-delim:","`
+	AllowedOrigins  []string      `long:"allowed-origins" env:"ALLOWED_ORIGINS" default:"*" description:"CORS allowed origins" env-delim:","`
+	ConfigFile      string        `long:"config" env:"CONFIG" description:"yaml config file, reloaded on SIGHUP"`
+	AutoMod         []string      `long:"auto-mod" env:"AUTO_MOD" description:"auto-moderation rule, like name=spam,deleted=3,period=720h,action=block,ttl=168h" env-delim:";"`
+	DeleteApproval  bool          `long:"delete-approval" env:"DELETE_APPROVAL" description:"require admin's approval of user's data deletion"`
+	EncryptSecret   string        `long:"encrypt-secret" env:"ENCRYPT_SECRET" description:"secret for encryption of bolt values and backups"`
 
 	Auth struct {
 		TTL struct {
@@ -79,6 +94,8 @@ type ServerCommand struct {
 	} `group:"auth" namespace:"auth" env-namespace:"AUTH"`
 
 	CommonOpts
+
+	cliSet func(name string) bool // reports options set in command line
 }
 
 // AuthGroup defines options group for auth params
@@ -178,24 +195,101 @@ type StreamGroup struct {
 	MaxActive       int           `long:"max" env:"MAX" default:"500" description:"max number of parallel streams"`
 }
 
+// TrustGroup defines options for trust levels
+type TrustGroup struct {
+	Enabled    bool          `long:"enabled" env:"ENABLED" description:"enable trust levels"`
+	LinksLevel int           `long:"links-level" env:"LINKS_LEVEL" default:"1" description:"min trust level to post links and images"`
+	Flood      []int         `long:"flood" env:"FLOOD" default:"5" default:"20" default:"60" default:"0" description:"max comments per hour for each trust level, 0 - unlimited" env-delim:","`
+	Refresh    time.Duration `long:"refresh" env:"REFRESH" default:"10m" description:"trust level recalculation interval"`
+}
+
+// RetentionGroup defines global retention rules, replaced by per-site rules from admin's settings
+type RetentionGroup struct {
+	IPDays       int           `long:"ip" env:"IP" default:"0" description:"days to keep ip hashes, 0 - forever"`
+	DeletedDays  int           `long:"deleted" env:"DELETED" default:"0" description:"days to keep soft-deleted comments, 0 - forever"`
+	DeletedUsers bool          `long:"deleted-users" env:"DELETED_USERS" description:"purge comments left from deleted users"`
+	Interval     time.Duration `long:"interval" env:"INTERVAL" default:"24h" description:"retention rules run interval"`
+}
+
+// ChangeLogGroup defines options group for change log of comments, votes, blocks and read-only status
+type ChangeLogGroup struct {
+	Enabled bool          `long:"enabled" env:"ENABLED" description:"enable change log"`
+	Keep    time.Duration `long:"keep" env:"KEEP" default:"720h" description:"change log records kept for, 0 - forever"`
+}
+
+// BackupKeepGroup defines options group for grandfather-father-son retention of backups, replaces max-back if set
+type BackupKeepGroup struct {
+	Daily   int `long:"daily" env:"DAILY" description:"daily backups to keep"`
+	Weekly  int `long:"weekly" env:"WEEKLY" description:"weekly backups to keep"`
+	Monthly int `long:"monthly" env:"MONTHLY" description:"monthly backups to keep"`
+}
+
+// S3Group defines options group for s3-compatible storage of backups
+type S3Group struct {
+	Endpoint  string `long:"endpoint" env:"ENDPOINT" default:"https://s3.amazonaws.com" description:"s3 endpoint"`
+	Region    string `long:"region" env:"REGION" default:"us-east-1" description:"s3 region"`
+	Bucket    string `long:"bucket" env:"BUCKET" description:"s3 bucket, enables upload of backups"`
+	Prefix    string `long:"prefix" env:"PREFIX" description:"path prefix of backups in the bucket"`
+	AccessKey string `long:"access-key" env:"ACCESS_KEY" description:"s3 access key"`
+	SecretKey string `long:"secret-key" env:"SECRET_KEY" description:"s3 secret key"`
+}
+
+// makeSink makes s3 backup sink, nil if bucket not set
+func (g S3Group) makeSink() migrator.BackupSink {
+	if g.Bucket == "" {
+		return nil
+	}
+	return &migrator.S3Sink{Endpoint: g.Endpoint, Region: g.Region, Bucket: g.Bucket, Prefix: g.Prefix,
+		AccessKey: g.AccessKey, SecretKey: g.SecretKey, Client: http.Client{Timeout: 5 * time.Minute}}
+}
+
 // serverApp holds all active objects
 type serverApp struct {
 	*ServerCommand
-	restSrv       *api.Rest
-	migratorSrv   *api.Migrator
-	exporter      migrator.Exporter
-	devAuth       *provider.DevAuthServer
-	dataService   *service.DataStore
-	avatarStore   avatar.Store
-	notifyService *notify.Service
-	imageService  *image.Service
-	terminated    chan struct{}
+	restSrv         *api.Rest
+	migratorSrv     *api.Migrator
+	exporter        migrator.Exporter
+	devAuth         *provider.DevAuthServer
+	dataService     *service.DataStore
+	avatarStore     avatar.Store
+	notifyService   *notify.Service
+	imageService    *image.Service
+	adminStore      admin.Store
+	restrictedWords *service.DynamicRestrictedWordsLister
+	crypter         *store.Crypter
+	backupSchedule  *migrator.Schedule // nil for backup every 24h
+	terminated      chan struct{}
+
+	// config file reload
+	baseOpts   ServerCommand   // options from command line, env and defaults, without config file
+	lockedOpts map[string]bool // options set in command line or env, not changed by config file
+	loadedOpts ServerCommand   // last applied options
+}
+
+// SetCliChecker sets function reporting if option with given long name set in command line.
+// Such options are not changed by config file.
+func (s *ServerCommand) SetCliChecker(fn func(name string) bool) {
+	s.cliSet = fn
 }
 
 // Execute is the entry point for "server" command, called by flag parser
 func (s *ServerCommand) Execute(args []string) error {
+	locked := lockedOptions(s, s.cliSet)
+	baseOpts := *s
+	if s.ConfigFile != "" {
+		values, err := loadConfigFile(s.ConfigFile)
+		if err != nil {
+			return err
+		}
+		if err = applyConfig(s, values, locked); err != nil {
+			return errors.Wrapf(err, "can't apply config file %s", s.ConfigFile)
+		}
+		log.Printf("[INFO] config file %s loaded", s.ConfigFile)
+	}
+
 	log.Printf("[INFO] start server on port %d", s.Port)
-	resetEnv("SECRET", "AUTH_GOOGLE_CSEC", "AUTH_GITHUB_CSEC", "AUTH_FACEBOOK_CSEC", "AUTH_YANDEX_CSEC", "ADMIN_PASSWD")
+	resetEnv("SECRET", "AUTH_GOOGLE_CSEC", "AUTH_GITHUB_CSEC", "AUTH_FACEBOOK_CSEC", "AUTH_YANDEX_CSEC", "ADMIN_PASSWD",
+		"ENCRYPT_SECRET", "BACKUP_S3_SECRET_KEY")
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() { // catch signal and invoke graceful termination
@@ -211,6 +305,7 @@ func (s *ServerCommand) Execute(args []string) error {
 		log.Printf("[PANIC] failed to setup application, %+v", err)
 		return err
 	}
+	app.baseOpts, app.lockedOpts, app.loadedOpts = baseOpts, locked, *s
 	if err = app.run(ctx); err != nil {
 		log.Printf("[ERROR] remark terminated with error %+v", err)
 		return err
@@ -226,13 +321,26 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 	if err := makeDirs(s.BackupLocation); err != nil {
 		return nil, err
 	}
+	var backupSchedule *migrator.Schedule
+	if s.BackupSchedule != "" {
+		sched, err := migrator.ParseSchedule(s.BackupSchedule)
+		if err != nil {
+			return nil, err
+		}
+		backupSchedule = sched
+	}
 
 	if !strings.HasPrefix(s.RemarkURL, "http://") && !strings.HasPrefix(s.RemarkURL, "https://") {
 		return nil, errors.Errorf("invalid remark42 url %s", s.RemarkURL)
 	}
 	log.Printf("[INFO] root url=%s", s.RemarkURL)
 
-	storeEngine, err := s.makeDataStore()
+	crypter, err := makeCrypter(s.EncryptSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	storeEngine, err := s.makeDataStore(crypter)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make data store engine")
 	}
@@ -248,16 +356,33 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 	}
 	log.Printf("[DEBUG] image service for url=%s, ttl=%v", imageService.ImageAPI, imageService.TTL)
 
+	restrictedWords := service.NewDynamicRestrictedWordsLister(s.RestrictedWords)
 	dataService := &service.DataStore{
-		Interface:              storeEngine,
-		EditDuration:           s.EditDuration,
-		AdminStore:             adminStore,
-		MaxCommentSize:         s.MaxCommentSize,
-		MaxVotes:               s.MaxVotes,
-		PositiveScore:          s.PositiveScore,
-		ImageService:           imageService,
-		TitleExtractor:         service.NewTitleExtractor(http.Client{Timeout: time.Second * 5}),
-		RestrictedWordsMatcher: service.NewRestrictedWordsMatcher(service.StaticRestrictedWordsLister{Words: s.RestrictedWords}),
+		Interface:      storeEngine,
+		EditDuration:   s.EditDuration,
+		AdminStore:     adminStore,
+		MaxCommentSize: s.MaxCommentSize,
+		MaxVotes:       s.MaxVotes,
+		PositiveScore:  s.PositiveScore,
+		ImageService:   imageService,
+		TitleExtractor: service.NewTitleExtractor(http.Client{Timeout: time.Second * 5}),
+		RestrictedWordsMatcher: service.NewRestrictedWordsMatcher(service.EngineRestrictedWordsLister{
+			Engine:  storeEngine,
+			Default: service.SettingsRestrictedWordsLister{Settings: storeEngine, Default: restrictedWords},
+		}),
+		TrustPolicy:      s.makeTrustPolicy(),
+		DeletionApproval: s.DeleteApproval,
+		TrashDuration:    s.TrashDuration,
+		ChangeLog:        s.ChangeLog.Enabled || s.BackupChanges > 0, // change log backup needs the change log
+		ChangeLogKeep:    s.ChangeLog.Keep,
+		Retention: store.RetentionPolicy{IPDays: s.Retention.IPDays, DeletedDays: s.Retention.DeletedDays,
+			PurgeDeletedUsers: s.Retention.DeletedUsers},
+	}
+	if err = dataService.Retention.Validate(); err != nil {
+		return nil, errors.Wrap(err, "bad retention options")
+	}
+	if dataService.AutoModRules, err = s.makeAutoModRules(); err != nil {
+		return nil, errors.Wrap(err, "failed to make auto-moderation rules")
 	}
 
 	loadingCache, err := s.makeCache()
@@ -269,9 +394,15 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to make avatar store")
 	}
-	authenticator := s.makeAuthenticator(dataService, avatarStore, adminStore)
+	authenticator := s.makeAuthenticator(dataService, avatarStore, adminStore, loadingCache)
 
 	exporter := &migrator.Native{DataStore: dataService}
+	archive := &migrator.Archive{
+		NativeExporter: exporter,
+		NativeImporter: &migrator.Native{DataStore: dataService},
+		ImageService:   imageService,
+		AvatarStore:    avatarStore,
+	}
 
 	migr := &api.Migrator{
 		Cache:             loadingCache,
@@ -279,6 +410,8 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		DisqusImporter:    &migrator.Disqus{DataStore: dataService},
 		WordPressImporter: &migrator.WordPress{DataStore: dataService},
 		NativeExporter:    &migrator.Native{DataStore: dataService},
+		ArchiveImporter:   archive,
+		ArchiveExporter:   archive,
 		KeyStore:          adminStore,
 	}
 
@@ -287,6 +420,8 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		log.Printf("[WARN] failed to make notify service, %s", err)
 		notifyService = notify.NopService // disable notifier
 	}
+	dataService.ModerationNotifier = notifyService
+	dataService.DeletionNotifier = notifyService
 
 	imgProxy := &proxy.Image{Enabled: s.ImageProxy, RoutePath: "/api/v1/img", RemarkURL: s.RemarkURL}
 	commentFormatter := store.NewCommentFormatter(imgProxy)
@@ -311,6 +446,7 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		NotifyService:    notifyService,
 		SSLConfig:        sslConfig,
 		UpdateLimiter:    s.UpdateLimit,
+		AllowedOrigins:   s.AllowedOrigins,
 		ImageService:     imageService,
 		Streamer: &api.Streamer{
 			TimeOut:   s.Stream.TimeOut,
@@ -330,17 +466,26 @@ func (s *ServerCommand) newServerApp() (*serverApp, error) {
 		devAuth = da
 	}
 
+	var backupExporter migrator.Exporter = exporter
+	if s.BackupArchive {
+		backupExporter = archive
+	}
+
 	return &serverApp{
-		ServerCommand: s,
-		restSrv:       srv,
-		migratorSrv:   migr,
-		exporter:      exporter,
-		devAuth:       devAuth,
-		dataService:   dataService,
-		avatarStore:   avatarStore,
-		notifyService: notifyService,
-		imageService:  imageService,
-		terminated:    make(chan struct{}),
+		ServerCommand:   s,
+		restSrv:         srv,
+		migratorSrv:     migr,
+		exporter:        backupExporter,
+		devAuth:         devAuth,
+		dataService:     dataService,
+		avatarStore:     avatarStore,
+		notifyService:   notifyService,
+		imageService:    imageService,
+		adminStore:      adminStore,
+		restrictedWords: restrictedWords,
+		crypter:         crypter,
+		backupSchedule:  backupSchedule,
+		terminated:      make(chan struct{}),
 	}, nil
 }
 
@@ -376,6 +521,18 @@ func (a *serverApp) run(ctx context.Context) error {
 
 	go a.imageService.Cleanup(ctx) // pictures cleanup for staging images
 
+	// per-site retention rules can be set with admin's settings, job runs even if global rules disabled.
+	// expired trash purged and change log compacted by the same job
+	if a.Retention.Interval > 0 {
+		go a.dataService.RunRetention(ctx, a.Sites, a.Retention.Interval, func(siteID string) {
+			a.restSrv.Cache.Flush(cache.Flusher(siteID))
+		})
+	}
+
+	if a.ConfigFile != "" {
+		go a.reloadOnSignal(ctx)
+	}
+
 	a.restSrv.Run(a.Port)
 	close(a.terminated)
 	return nil
@@ -386,22 +543,120 @@ func (a *serverApp) Wait() {
 	<-a.terminated
 }
 
+// reloadOnSignal reloads config file on SIGHUP
+func (a *serverApp) reloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("[INFO] SIGHUP detected, reload config %s", a.ConfigFile)
+			if err := a.reloadConfig(); err != nil {
+				log.Printf("[WARN] config not reloaded, %v", err)
+			}
+		}
+	}
+}
+
+// reloadConfig reads config file again and applies changes of reloadable options to running services.
+// Changes of other options are ignored and require restart.
+func (a *serverApp) reloadConfig() error {
+	values, err := loadConfigFile(a.ConfigFile)
+	if err != nil {
+		return err
+	}
+	upd := a.baseOpts
+	if err = applyConfig(&upd, values, a.lockedOpts); err != nil {
+		return err
+	}
+	if upd.Admin.Type == "shared" {
+		upd.setDefaultAdminEmail()
+	}
+	if err = upd.validateReloadable(); err != nil {
+		return errors.Wrap(err, "invalid config")
+	}
+
+	changed, ignored := []string{}, []string{}
+	for _, c := range optionsDiff(&a.loadedOpts, &upd) {
+		if !reloadableOptions[c.name] {
+			ignored = append(ignored, c.name)
+			continue
+		}
+		changed = append(changed, c.String())
+	}
+	if len(ignored) > 0 {
+		log.Printf("[WARN] changes of %s ignored, restart required", strings.Join(ignored, ", "))
+	}
+	if len(changed) == 0 {
+		log.Printf("[INFO] config reloaded, no changes")
+		return nil
+	}
+
+	if err = a.applyReloadable(&upd); err != nil {
+		return err
+	}
+	a.loadedOpts = upd
+	log.Printf("[INFO] config reloaded, %s", strings.Join(changed, "; "))
+	return nil
+}
+
+// applyReloadable updates running services with reloadable options
+func (a *serverApp) applyReloadable(upd *ServerCommand) error {
+	// make new destination first, it may fail and nothing should be changed in this case
+	var tg notify.Destination
+	if a.Notify.Type == "telegram" && (upd.Notify.Telegram.Token != a.loadedOpts.Notify.Telegram.Token ||
+		upd.Notify.Telegram.Channel != a.loadedOpts.Notify.Telegram.Channel) {
+		t, err := notify.NewTelegram(upd.Notify.Telegram.Token, upd.Notify.Telegram.Channel,
+			upd.Notify.Telegram.Timeout, upd.Notify.Telegram.API)
+		if err != nil {
+			return errors.Wrap(err, "failed to create telegram notification destination")
+		}
+		tg = t
+	}
+
+	if st, ok := a.adminStore.(*admin.StaticStore); ok {
+		st.Set(upd.Admin.Shared.Admins, upd.Admin.Shared.Email)
+	}
+	a.restrictedWords.Set(upd.RestrictedWords)
+	a.dataService.SetParams(upd.EditDuration, upd.MaxCommentSize, upd.MaxVotes, upd.PositiveScore)
+	a.restSrv.SetParams(upd.LowScore, upd.CriticalScore, upd.AllowedOrigins)
+	if tg != nil {
+		if err := a.notifyService.SetDestinations(tg); err != nil {
+			log.Printf("[WARN] can't update notification destinations, %v", err)
+		}
+	}
+	return nil
+}
+
 // activateBackup runs background backups for each site
 func (a *serverApp) activateBackup(ctx context.Context) {
 	for _, siteID := range a.Sites {
 		backup := migrator.AutoBackup{
 			Exporter:       a.exporter,
+			Archive:        a.BackupArchive,
 			BackupLocation: a.BackupLocation,
 			SiteID:         siteID,
 			KeepMax:        a.MaxBackupFiles,
 			Duration:       24 * time.Hour,
+			Schedule:       a.backupSchedule,
+			Retention:      migrator.Retention{Daily: a.BackupKeep.Daily, Weekly: a.BackupKeep.Weekly, Monthly: a.BackupKeep.Monthly},
+			Crypter:        a.crypter,
+			Sink:           a.BackupS3.makeSink(),
+			Notifier:       a.notifyService,
+		}
+		if a.BackupChanges > 0 {
+			backup.ChangeLog = a.dataService
+			backup.ChangesDuration = a.BackupChanges
 		}
 		go backup.Do(ctx)
 	}
 }
 
-// makeDataStore creates store for all sites
-func (s *ServerCommand) makeDataStore() (result engine.Interface, err error) {
+// makeDataStore creates store for all sites, bolt values encrypted with crypter if set
+func (s *ServerCommand) makeDataStore(crypter *store.Crypter) (result engine.Interface, err error) {
 	log.Printf("[INFO] make data store, type=%s", s.Store.Type)
 
 	switch s.Store.Type {
@@ -413,8 +668,11 @@ func (s *ServerCommand) makeDataStore() (result engine.Interface, err error) {
 		for _, site := range s.Sites {
 			sites = append(sites, engine.BoltSite{SiteID: site, FileName: fmt.Sprintf("%s/%s.db", s.Store.Bolt.Path, site)})
 		}
-		result, err = engine.NewBoltDB(bolt.Options{Timeout: s.Store.Bolt.Timeout}, sites...)
+		result, err = engine.NewEncryptedBoltDB(bolt.Options{Timeout: s.Store.Bolt.Timeout}, crypter, sites...)
 	case "mongo":
+		if crypter != nil {
+			log.Printf("[WARN] encryption supported by bolt store only, comments in mongo not encrypted")
+		}
 		mgServer, e := s.makeMongo()
 		if e != nil {
 			return result, errors.Wrap(e, "failed to create mongo server")
@@ -479,11 +737,7 @@ func (s *ServerCommand) makeAdminStore() (admin.Store, error) {
 
 	switch s.Admin.Type {
 	case "shared":
-		if s.Admin.Shared.Email == "" { // no admin email, use admin@domain
-			if u, err := url.Parse(s.RemarkURL); err == nil {
-				s.Admin.Shared.Email = "admin@" + u.Host
-			}
-		}
+		s.setDefaultAdminEmail()
 		return admin.NewStaticStore(s.SharedSecret, s.Admin.Shared.Admins, s.Admin.Shared.Email), nil
 	case "mongo":
 		mgServer, e := s.makeMongo()
@@ -497,6 +751,15 @@ func (s *ServerCommand) makeAdminStore() (admin.Store, error) {
 	}
 }
 
+// setDefaultAdminEmail sets admin@domain if no admin email defined
+func (s *ServerCommand) setDefaultAdminEmail() {
+	if s.Admin.Shared.Email == "" {
+		if u, err := url.Parse(s.RemarkURL); err == nil {
+			s.Admin.Shared.Email = "admin@" + u.Host
+		}
+	}
+}
+
 func (s *ServerCommand) makeCache() (cache.LoadingCache, error) {
 	log.Printf("[INFO] make cache, type=%s", s.Cache.Type)
 	switch s.Cache.Type {
@@ -517,6 +780,33 @@ func (s *ServerCommand) makeCache() (cache.LoadingCache, error) {
 	return nil, errors.Errorf("unsupported cache type %s", s.Cache.Type)
 }
 
+// makeTrustPolicy returns default trust policy with limits from options, nil if trust levels disabled
+func (s *ServerCommand) makeTrustPolicy() *service.TrustPolicy {
+	if !s.Trust.Enabled {
+		return nil
+	}
+	policy := service.DefaultTrustPolicy
+	policy.LinksLevel = store.TrustLevel(s.Trust.LinksLevel)
+	policy.FloodLimits = s.Trust.Flood
+	policy.Refresh = s.Trust.Refresh
+	log.Printf("[INFO] trust levels enabled, links level %d, flood limits %v", policy.LinksLevel, policy.FloodLimits)
+	return &policy
+}
+
+// makeAutoModRules parses auto-moderation rules from options, rules without score use global critical score
+func (s *ServerCommand) makeAutoModRules() ([]service.AutoModRule, error) {
+	rules := make([]service.AutoModRule, 0, len(s.AutoMod))
+	for _, r := range s.AutoMod {
+		rule, err := service.ParseAutoModRule(r, s.CriticalScore)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %q", r)
+		}
+		log.Printf("[INFO] auto-moderation rule %+v", rule)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
 func (s *ServerCommand) makeMongo() (result *mongo.Server, err error) {
 	if s.Mongo.URL == "" {
 		return nil, errors.New("no mongo URL provided")
@@ -618,7 +908,8 @@ func (s *ServerCommand) makeSSLConfig() (config api.SSLConfig, err error) {
 	return config, err
 }
 
-func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Store, admns admin.Store) *auth.Service {
+func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Store, admns admin.Store,
+	lc cache.LoadingCache) *auth.Service {
 	authenticator := auth.NewService(auth.Opts{
 		URL:            strings.TrimSuffix(s.RemarkURL, "/"),
 		Issuer:         "remark42",
@@ -634,6 +925,9 @@ func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Sto
 			}
 			c.User.SetAdmin(ds.IsAdmin(c.Audience, c.User.ID))
 			c.User.SetBoolAttr("blocked", ds.IsBlocked(c.Audience, c.User.ID))
+			siteID := c.Audience
+			user := store.User{ID: c.User.ID, Name: c.User.Name, Picture: c.User.Picture}
+			ds.UpdateProfile(siteID, user, func() { lc.Flush(cache.Flusher(siteID)) }) // renamed user's comments in any scope
 			return c
 		}),
 		AdminPasswd: s.AdminPasswd,
@@ -641,7 +935,7 @@ func (s *ServerCommand) makeAuthenticator(ds *service.DataStore, avas avatar.Sto
 			if claims.User == nil {
 				return false
 			}
-			return !claims.User.BoolAttr("blocked")
+			return !claims.User.BoolAttr("blocked") && !claims.User.BoolAttr("merge_me") // merge token can't be used for login
 		}),
 		JWTQuery:          "jwt", // change default from "token" as it used for deleteme
 		AvatarStore:       avas,
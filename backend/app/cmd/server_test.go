@@ -284,6 +284,12 @@ func TestServerApp_Failed(t *testing.T) {
 	_, err = opts.newServerApp()
 	assert.EqualError(t, err, "failed to make data store engine: unsupported store type blah")
 	t.Log(err)
+
+	// invalid backup schedule
+	opts = ServerCommand{BackupLocation: "/tmp", BackupSchedule: "0 25 * * *"}
+	opts.SetCommon(CommonOpts{RemarkURL: "https://demo.remark42.com", SharedSecret: "123456"})
+	_, err = opts.newServerApp()
+	assert.EqualError(t, err, `bad hour in schedule "0 25 * * *": "25" out of range 0-23`)
 }
 
 func TestServerApp_Shutdown(t *testing.T) {
@@ -15,12 +15,13 @@ import (
 
 // Opts with all cli commands and flags
 type Opts struct {
-	ServerCmd  cmd.ServerCommand  `command:"server"`
-	ImportCmd  cmd.ImportCommand  `command:"import"`
-	BackupCmd  cmd.BackupCommand  `command:"backup"`
-	RestoreCmd cmd.RestoreCommand `command:"restore"`
-	AvatarCmd  cmd.AvatarCommand  `command:"avatar"`
-	CleanupCmd cmd.CleanupCommand `command:"cleanup"`
+	ServerCmd  cmd.ServerCommand    `command:"server"`
+	ImportCmd  cmd.ImportCommand    `command:"import"`
+	BackupCmd  cmd.BackupCommand    `command:"backup"`
+	RestoreCmd cmd.RestoreCommand   `command:"restore"`
+	AvatarCmd  cmd.AvatarCommand    `command:"avatar"`
+	CleanupCmd cmd.CleanupCommand   `command:"cleanup"`
+	RotateCmd  cmd.RotateKeyCommand `command:"rotate-key"`
 
 	RemarkURL    string `long:"url" env:"REMARK_URL" required:"true" description:"url to remark"`
 	SharedSecret string `long:"secret" env:"SECRET" required:"true" description:"shared secret key"`
@@ -44,6 +45,12 @@ func main() {
 			SharedSecret: opts.SharedSecret,
 			Revision:     revision,
 		})
+		if srv, ok := command.(*cmd.ServerCommand); ok { // config file doesn't override options set in command line
+			srv.SetCliChecker(func(name string) bool {
+				opt := p.Active.FindOptionByLongName(name)
+				return opt != nil && opt.IsSet() && !opt.IsSetDefault()
+			})
+		}
 		err := c.Execute(args)
 		if err != nil {
 			log.Printf("[ERROR] failed with %+v", err)
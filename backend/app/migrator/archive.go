@@ -0,0 +1,281 @@
+package migrator
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/auth/avatar"
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/image"
+)
+
+const archiveVersion = 1
+
+// archive entries
+const (
+	archiveManifest = "manifest.json"
+	archiveComments = "comments.json"
+	archiveImages   = "images/"
+	archiveAvatars  = "avatars/"
+)
+
+// avatarPath is the part of avatar's url before avatar id
+const avatarPath = "/api/v1/avatar/"
+
+// Archive implements exporter and importer of full-site archive, gzipped tarball with manifest,
+// native export of comments, committed pictures referenced by comments and avatars of comments' authors.
+// Pictures and avatars skipped without ImageService and AvatarStore.
+type Archive struct {
+	NativeExporter Exporter
+	NativeImporter Importer
+	ImageService   *image.Service
+	AvatarStore    avatar.Store
+}
+
+// manifest describes content of the archive, pictures and avatars referenced by comments
+type manifest struct {
+	Version  int               `json:"version"`
+	SiteID   string            `json:"site"`
+	Created  time.Time         `json:"created"`
+	Comments int               `json:"comments"`
+	Images   []string          `json:"images"`
+	Avatars  map[string]string `json:"avatars"` // avatar id to user id, needed to put avatar back
+}
+
+// Export writes archive of the site to w. Native export made first to temp file to collect referenced
+// pictures and avatars, pictures and avatars failed to load logged and skipped.
+func (a *Archive) Export(w io.Writer, siteID string) (size int, err error) {
+	tmp, err := ioutil.TempFile("", "remark42_archive")
+	if err != nil {
+		return 0, errors.Wrap(err, "can't make temp file")
+	}
+	defer func() {
+		_ = tmp.Close()
+		if e := os.Remove(tmp.Name()); e != nil {
+			log.Printf("[WARN] can't remove %s, %v", tmp.Name(), e)
+		}
+	}()
+
+	m := manifest{Version: archiveVersion, SiteID: siteID, Created: time.Now(), Avatars: map[string]string{}}
+	if m.Comments, err = a.NativeExporter.Export(tmp, siteID); err != nil {
+		return 0, errors.Wrapf(err, "export failed for %s", siteID)
+	}
+	if err = a.collect(tmp, &m); err != nil {
+		return 0, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err = a.writeManifest(tw, m); err != nil {
+		return 0, err
+	}
+	st, err := tmp.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "can't get size of export")
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "can't rewind export")
+	}
+	if err = writeEntry(tw, archiveComments, tmp, st.Size()); err != nil {
+		return 0, err
+	}
+
+	for _, id := range m.Images {
+		r, sz, e := a.ImageService.Load(id)
+		if e != nil {
+			log.Printf("[WARN] can't load picture %s, skipped, %v", id, e)
+			continue
+		}
+		err = writeEntry(tw, archiveImages+id, r, sz)
+		_ = r.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	avatarIDs := make([]string, 0, len(m.Avatars))
+	for id := range m.Avatars {
+		avatarIDs = append(avatarIDs, id)
+	}
+	sort.Strings(avatarIDs)
+	for _, id := range avatarIDs {
+		r, sz, e := a.AvatarStore.Get(id)
+		if e != nil {
+			log.Printf("[WARN] can't load avatar %s, skipped, %v", id, e)
+			continue
+		}
+		err = writeEntry(tw, archiveAvatars+id, r, int64(sz))
+		_ = r.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return 0, errors.Wrap(err, "can't close tar")
+	}
+	if err = gz.Close(); err != nil {
+		return 0, errors.Wrap(err, "can't close gz")
+	}
+	log.Printf("[DEBUG] archived %d comments, %d pictures and %d avatars of %s", m.Comments, len(m.Images),
+		len(m.Avatars), siteID)
+	return m.Comments, nil
+}
+
+// Import reads archive made by Export, comments imported with native importer replacing all comments of the site,
+// pictures and avatars stored as they were on export
+func (a *Archive) Import(r io.Reader, siteID string) (size int, err error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't make gz reader")
+	}
+	tr := tar.NewReader(gz)
+
+	m := manifest{}
+	imported, images, avatars := false, 0, 0
+	for {
+		hdr, e := tr.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return size, errors.Wrap(e, "can't read archive")
+		}
+
+		switch name := hdr.Name; {
+		case name == archiveManifest:
+			if err = json.NewDecoder(tr).Decode(&m); err != nil {
+				return 0, errors.Wrap(err, "can't decode manifest")
+			}
+			if m.Version != archiveVersion {
+				return 0, errors.Errorf("unexpected archive version %d", m.Version)
+			}
+		case name == archiveComments:
+			if size, err = a.NativeImporter.Import(tr, siteID); err != nil {
+				return size, err
+			}
+			imported = true
+		case strings.HasPrefix(name, archiveImages) && a.ImageService != nil:
+			if e := a.ImageService.Put(strings.TrimPrefix(name, archiveImages), tr); e != nil {
+				log.Printf("[WARN] can't restore picture %s, %v", name, e)
+				continue
+			}
+			images++
+		case strings.HasPrefix(name, archiveAvatars) && a.AvatarStore != nil:
+			id := strings.TrimPrefix(name, archiveAvatars)
+			userID, ok := m.Avatars[id]
+			if !ok {
+				log.Printf("[WARN] user of avatar %s unknown, skipped", id)
+				continue
+			}
+			if _, e := a.AvatarStore.Put(userID, tr); e != nil {
+				log.Printf("[WARN] can't restore avatar %s, %v", id, e)
+				continue
+			}
+			avatars++
+		default:
+			log.Printf("[DEBUG] archive entry %s skipped", name)
+		}
+	}
+	if !imported {
+		return 0, errors.New("no comments in archive")
+	}
+	log.Printf("[INFO] restored %d comments, %d pictures and %d avatars from archive of %s", size, images, avatars, m.SiteID)
+	return size, nil
+}
+
+// Validate reads archive made by Export and reports problems found in its comments, nothing written to the store
+func (a *Archive) Validate(r io.Reader, siteID string) (ValidationReport, error) {
+	v, ok := a.NativeImporter.(Validator)
+	if !ok {
+		return ValidationReport{}, errors.New("native importer can't validate")
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ValidationReport{}, errors.Wrap(err, "can't make gz reader")
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, e := tr.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return ValidationReport{}, errors.Wrap(e, "can't read archive")
+		}
+		if hdr.Name == archiveComments {
+			return v.Validate(tr, siteID)
+		}
+	}
+	return ValidationReport{}, errors.New("no comments in archive")
+}
+
+// collect adds pictures and avatars referenced by exported comments to manifest
+func (a *Archive) collect(export io.ReadSeeker, m *manifest) error {
+	if _, err := export.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "can't rewind export")
+	}
+	dec := json.NewDecoder(export)
+	if err := dec.Decode(&meta{}); err != nil {
+		return errors.Wrap(err, "can't decode exported meta")
+	}
+	images := map[string]bool{}
+	for {
+		c := store.Comment{}
+		if err := dec.Decode(&c); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrap(err, "can't decode exported comment")
+		}
+		if a.ImageService != nil {
+			ids, err := a.ImageService.ExtractPictures(c.Text)
+			if err != nil {
+				return errors.Wrapf(err, "can't extract pictures of %s", c.ID)
+			}
+			for _, id := range ids {
+				images[id] = true
+			}
+		}
+		if a.AvatarStore != nil && strings.Contains(c.User.Picture, avatarPath) {
+			if u, err := url.Parse(c.User.Picture); err == nil {
+				m.Avatars[path.Base(u.Path)] = c.User.ID
+			}
+		}
+	}
+	m.Images = make([]string, 0, len(images))
+	for id := range images {
+		m.Images = append(m.Images, id)
+	}
+	sort.Strings(m.Images)
+	return nil
+}
+
+func (a *Archive) writeManifest(tw *tar.Writer, m manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal manifest")
+	}
+	return writeEntry(tw, archiveManifest, strings.NewReader(string(data)), int64(len(data)))
+}
+
+// writeEntry adds file to tar
+func writeEntry(tw *tar.Writer, name string, r io.Reader, size int64) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "can't write header of %s", name)
+	}
+	_, err := io.CopyN(tw, r, size)
+	return errors.Wrapf(err, "can't write %s", name)
+}
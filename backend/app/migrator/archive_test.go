@@ -0,0 +1,140 @@
+package migrator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/go-pkgz/auth/avatar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+	"github.com/umputun/remark/backend/app/store/engine"
+	"github.com/umputun/remark/backend/app/store/image"
+	"github.com/umputun/remark/backend/app/store/service"
+)
+
+func TestArchive_ExportImport(t *testing.T) {
+	defer os.Remove(testDb)
+	b := prep(t) // write 2 comments
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// source site with a picture and an avatar
+	images := &image.Service{Store: &image.FileSystem{Location: dir + "/pics", Staging: dir + "/staging", Partitions: 10},
+		ImageAPI: "/api/v1/picture/"}
+	require.NoError(t, images.Put("user1/pic1.png", strings.NewReader("picture data")))
+	avatars := avatar.NewLocalFS(dir + "/avatars")
+	avatarID, err := avatars.Put("user1", strings.NewReader("avatar data"))
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{
+		Text:      `pic <img src="https://remark42.example.com/api/v1/picture/user1/pic1.png">`,
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"},
+		User:      store.User{ID: "user1", Name: "user name", Picture: "https://remark42.example.com/api/v1/avatar/" + avatarID},
+	})
+	require.NoError(t, err)
+
+	a := Archive{NativeExporter: &Native{DataStore: b}, ImageService: images, AvatarStore: avatars}
+	buf := &bytes.Buffer{}
+	size, err := a.Export(buf, "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 3, size)
+
+	entries := map[string]string{}
+	gz, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, e := tr.Next()
+		if e == io.EOF {
+			break
+		}
+		require.NoError(t, e)
+		data, e := ioutil.ReadAll(tr)
+		require.NoError(t, e)
+		entries[hdr.Name] = string(data)
+	}
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, "picture data", entries["images/user1/pic1.png"])
+	assert.Equal(t, "avatar data", entries["avatars/"+avatarID])
+	m := manifest{}
+	require.NoError(t, json.Unmarshal([]byte(entries["manifest.json"]), &m))
+	assert.Equal(t, 3, m.Comments)
+	assert.Equal(t, []string{"user1/pic1.png"}, m.Images)
+	assert.Equal(t, map[string]string{avatarID: "user1"}, m.Avatars)
+
+	// restore to empty site on another host
+	dbFile := "/tmp/test-remark-archive.db"
+	defer os.Remove(dbFile)
+	boltStore, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{SiteID: "radio-t", FileName: dbFile})
+	require.NoError(t, err)
+	b2 := &service.DataStore{Interface: boltStore, AdminStore: admin.NewStaticStore("12345", []string{}, "")}
+	images2 := &image.Service{Store: &image.FileSystem{Location: dir + "/pics2", Staging: dir + "/staging2", Partitions: 10},
+		ImageAPI: "/api/v1/picture/"}
+	avatars2 := avatar.NewLocalFS(dir + "/avatars2")
+	a2 := Archive{NativeImporter: &Native{DataStore: b2}, ImageService: images2, AvatarStore: avatars2}
+	size, err = a2.Import(bytes.NewReader(buf.Bytes()), "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 3, size)
+
+	comments, err := b2.Find(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, "time", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+
+	r, _, err := images2.Load("user1/pic1.png")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "picture data", string(data))
+
+	ar, _, err := avatars2.Get(avatarID)
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(ar)
+	require.NoError(t, err)
+	assert.NoError(t, ar.Close())
+	assert.Equal(t, "avatar data", string(data))
+}
+
+func TestArchive_ImportNoComments(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, writeEntry(tw, "images/user1/pic1.png", strings.NewReader("data"), 4))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	a := Archive{NativeImporter: &Native{}}
+	_, err := a.Import(buf, "radio-t")
+	assert.EqualError(t, err, "no comments in archive")
+}
+
+func TestArchive_Validate(t *testing.T) {
+	defer os.Remove(testDb)
+	b := prep(t) // write 2 comments
+	a := Archive{NativeExporter: &Native{DataStore: b}, NativeImporter: &Native{DataStore: b}}
+	buf := &bytes.Buffer{}
+	_, err := a.Export(buf, "radio-t")
+	require.NoError(t, err)
+
+	report, err := a.Validate(buf, "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Posts)
+	assert.Equal(t, 2, report.Comments)
+	assert.Equal(t, 0, report.Issues())
+
+	_, err = a.Validate(strings.NewReader("not gzip"), "radio-t")
+	assert.EqualError(t, err, "can't make gz reader: unexpected EOF")
+}
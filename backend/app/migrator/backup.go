@@ -3,41 +3,115 @@ package migrator
 import (
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
 	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
-// AutoBackup struct handles daily backups params for siteID
+// AutoBackup struct handles daily backups params for siteID.
+// With Schedule set, backups made by schedule instead of every Duration. With Retention set, backups kept by
+// daily, weekly and monthly tiers instead of KeepMax. Each backup verified after writing, failures reported to Notifier.
+// With ChangeLog and ChangesDuration set, records of change log saved between backups for point-in-time restore.
+// With Sink set, backup files uploaded to it and removed from it by the same rules as local files.
+// With Archive set, Exporter expected to make full-site archive, written as is to .tar.gz backup file.
 type AutoBackup struct {
-	Exporter       Exporter
-	BackupLocation string
-	SiteID         string
-	KeepMax        int
-	Duration       time.Duration
+	Exporter        Exporter
+	Archive         bool
+	BackupLocation  string
+	SiteID          string
+	KeepMax         int
+	Duration        time.Duration
+	Schedule        *Schedule
+	Retention       Retention
+	Crypter         *store.Crypter // encrypts backup files if set
+	ChangeLog       ChangeLog
+	ChangesDuration time.Duration
+	Sink            BackupSink
+	Notifier        BackupNotifier
+}
+
+// Retention defines grandfather-father-son retention of backups. The latest backup of each of the last Daily days,
+// Weekly weeks and Monthly months kept. Empty Retention means KeepMax of the latest backups kept.
+type Retention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// BackupNotifier defines interface to report failed backups
+type BackupNotifier interface {
+	SubmitBackupFailure(f store.BackupFailure)
+}
+
+// ChangeLog defines interface to read records of change log
+type ChangeLog interface {
+	Changes(siteID string, since int64, limit int) ([]store.Change, error)
+}
+
+// BackupSink defines remote storage of backup files
+type BackupSink interface {
+	Put(name string, r io.ReadSeeker) error
+	List(siteID string) ([]RemoteFile, error) // backups and change log backups of the site, sorted by name
+	Get(name string, w io.Writer) error       // fails on checksum mismatch
+	Remove(name string) error
+}
+
+// RemoteFile describes backup file stored in sink
+type RemoteFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
 }
 
-// Do runs daily export to local files, keeps up to keepMax backups for given siteID
+const changesPageSize = 1000
+
+// Do runs daily, or scheduled, export to local files and removes expired backups of the siteID
 func (ab AutoBackup) Do(ctx context.Context) {
-	log.Printf("[INFO] activate auto-backup for %s under %s, duration %s", ab.SiteID, ab.BackupLocation, ab.Duration)
-	tick := time.NewTicker(ab.Duration)
-	log.Printf("[DEBUG] first backup for %s at %s", ab.SiteID, time.Now().Add(ab.Duration))
+	log.Printf("[INFO] activate auto-backup for %s under %s, %s", ab.SiteID, ab.BackupLocation, ab.schedule())
+	next := ab.next(time.Now())
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	log.Printf("[DEBUG] first backup for %s at %s", ab.SiteID, next)
+
+	var changesTick <-chan time.Time // nil channel never fires, changes backup disabled
+	lastSeq := int64(0)
+	if ab.ChangeLog != nil && ab.ChangesDuration > 0 {
+		log.Printf("[INFO] activate change log backup for %s, duration %s", ab.SiteID, ab.ChangesDuration)
+		ticker := time.NewTicker(ab.ChangesDuration)
+		defer ticker.Stop()
+		changesTick = ticker.C
+		lastSeq = ab.lastBackupSeq()
+	}
 
 	for {
 		select {
-		case <-tick.C:
-			if _, err := ab.makeBackup(); err != nil {
-				log.Printf("[WARN] auto-backup for %s failed, %s", ab.SiteID, err)
+		case <-timer.C:
+			ab.backup()
+			next = ab.next(time.Now())
+			timer.Reset(time.Until(next))
+			log.Printf("[DEBUG] next backup for %s at %s", ab.SiteID, next)
+		case <-changesTick:
+			changesFile, seq, err := ab.makeChangesBackup(lastSeq)
+			if err != nil {
+				log.Printf("[WARN] change log backup for %s failed, %s", ab.SiteID, err)
+				ab.notify(changesFile, err)
 				continue
 			}
-			ab.removeOldBackupFiles()
-			log.Printf("[DEBUG] next backup for %s at %s", ab.SiteID, time.Now().Add(ab.Duration))
+			lastSeq = seq
+			if changesFile != "" {
+				ab.upload(changesFile)
+			}
 		case <-ctx.Done():
 			log.Printf("[WARN] terminated autobackup for %s", ab.SiteID)
 			return
@@ -45,50 +119,375 @@ func (ab AutoBackup) Do(ctx context.Context) {
 	}
 }
 
+// backup makes backup, uploads it and removes expired backups
+func (ab AutoBackup) backup() {
+	backupFile, err := ab.makeBackup()
+	if err != nil {
+		log.Printf("[WARN] auto-backup for %s failed, %s", ab.SiteID, err)
+		ab.notify(backupFile, err)
+		return
+	}
+	ab.upload(backupFile)
+	ab.removeOldBackupFiles()
+}
+
+// next returns time of the next backup after t
+func (ab AutoBackup) next(t time.Time) time.Time {
+	if ab.Schedule != nil {
+		return ab.Schedule.Next(t)
+	}
+	return t.Add(ab.Duration)
+}
+
+func (ab AutoBackup) schedule() string {
+	if ab.Schedule != nil {
+		return "schedule " + ab.Schedule.String()
+	}
+	return "duration " + ab.Duration.String()
+}
+
+// makeBackup exports comments to the backup file and verifies it. Returns name of the file, made or failed.
+// Backup written to temp file first and replaces the file made earlier the same day only after verification.
 func (ab AutoBackup) makeBackup() (string, error) {
 	log.Printf("[DEBUG] make backup for %s", ab.SiteID)
-	backupFile := fmt.Sprintf("%s/backup-%s-%s.gz", ab.BackupLocation, ab.SiteID, time.Now().Format("20060102"))
-	fh, err := os.Create(backupFile)
+	ext := ".gz"
+	if ab.Archive {
+		ext = ".tar.gz"
+	}
+	backupFile := fmt.Sprintf("%s/backup-%s-%s%s", ab.BackupLocation, ab.SiteID, time.Now().Format("20060102"), ext)
+	count := 0
+	err := ab.writeVerified(backupFile, !ab.Archive, func(w io.Writer) (e error) {
+		count, e = ab.Exporter.Export(w, ab.SiteID)
+		return errors.Wrapf(e, "export failed for %s", ab.SiteID)
+	}, func(fileName string) error {
+		return verifyBackup(fileName, ab.Crypter, ab.Archive, count)
+	})
+	if err != nil {
+		return backupFile, err
+	}
+	log.Printf("[DEBUG] created backup file %s, %d comments", backupFile, count)
+	return backupFile, nil
+}
+
+// makeChangesBackup saves records of change log after since seq to the new file, one json record per line.
+// Returns file name, empty if nothing recorded, and seq of the last saved record.
+func (ab AutoBackup) makeChangesBackup(since int64) (string, int64, error) {
+	from := since
+	changes := []store.Change{}
+	for {
+		page, err := ab.ChangeLog.Changes(ab.SiteID, since, changesPageSize)
+		if err != nil {
+			return "", since, errors.Wrapf(err, "can't get changes of %s", ab.SiteID)
+		}
+		if len(page) == 0 {
+			break
+		}
+		changes = append(changes, page...)
+		since = page[len(page)-1].Seq
+	}
+	if len(changes) == 0 {
+		return "", since, nil
+	}
+
+	changesFile := fmt.Sprintf("%s/changes-%s-%s.gz", ab.BackupLocation, ab.SiteID, time.Now().Format("20060102150405"))
+	err := ab.writeVerified(changesFile, true, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, c := range changes {
+			if e := enc.Encode(c); e != nil {
+				return errors.Wrapf(e, "can't write change %d", c.Seq)
+			}
+		}
+		return nil
+	}, func(fileName string) error {
+		saved, e := readChanges(fileName, ab.Crypter)
+		if e != nil {
+			return e
+		}
+		if len(saved) != len(changes) {
+			return errors.Errorf("%d changes saved, %d expected", len(saved), len(changes))
+		}
+		return nil
+	})
 	if err != nil {
-		return "", errors.Wrapf(err, "can't create backup file %s", backupFile)
+		return changesFile, from, err
 	}
-	gz := gzip.NewWriter(fh)
+	log.Printf("[DEBUG] created change log backup file %s, %d records", changesFile, len(changes))
+	return changesFile, since, nil
+}
 
-	if _, err = ab.Exporter.Export(gz, ab.SiteID); err != nil {
-		return "", errors.Wrapf(err, "export failed for %s", ab.SiteID)
+// upload puts backup file to the sink, if set. Failure logged and reported, local file kept anyway.
+func (ab AutoBackup) upload(fileName string) {
+	if ab.Sink == nil {
+		return
 	}
-	if err = gz.Close(); err != nil {
-		return "", errors.Wrapf(err, "can't close gz for %s", backupFile)
+	fh, err := os.Open(fileName)
+	if err != nil {
+		log.Printf("[WARN] can't open %s for upload, %s", fileName, err)
+		ab.notify(fileName, err)
+		return
+	}
+	defer func() {
+		if e := fh.Close(); e != nil {
+			log.Printf("[WARN] can't close %s, %s", fileName, e)
+		}
+	}()
+	if err = ab.Sink.Put(filepath.Base(fileName), fh); err != nil {
+		log.Printf("[WARN] can't upload %s, %s", fileName, err)
+		ab.notify(fileName, errors.Wrap(err, "upload failed"))
+		return
+	}
+	log.Printf("[DEBUG] uploaded %s", fileName)
+}
+
+// notify reports failed backup to notifier, if set
+func (ab AutoBackup) notify(fileName string, err error) {
+	if ab.Notifier == nil {
+		return
+	}
+	ab.Notifier.SubmitBackupFailure(store.BackupFailure{SiteID: ab.SiteID, File: filepath.Base(fileName),
+		Error: err.Error(), Timestamp: time.Now()})
+}
+
+// lastBackupSeq returns seq of the last record saved by change log backup, 0 if nothing saved
+func (ab AutoBackup) lastBackupSeq() (seq int64) {
+	files, err := backupFiles(ab.BackupLocation, "changes-"+ab.SiteID+"-")
+	if err != nil || len(files) == 0 {
+		return 0
+	}
+	changes, err := readChanges(filepath.Join(ab.BackupLocation, files[len(files)-1]), ab.Crypter)
+	if err != nil {
+		log.Printf("[WARN] can't read the last change log backup of %s, %v", ab.SiteID, err)
+		return 0
+	}
+	for _, c := range changes {
+		if c.Seq > seq {
+			seq = c.Seq
+		}
+	}
+	return seq
+}
+
+// writeVerified writes backup file to temp file in the same location, checks it with verify and renames
+// to fileName. Temp file named with leading dot to be ignored as backup. Written data gzipped if compress set.
+func (ab AutoBackup) writeVerified(fileName string, compress bool, write func(w io.Writer) error,
+	verify func(fileName string) error) error {
+	tmpFile := filepath.Join(filepath.Dir(fileName), "."+filepath.Base(fileName)+".tmp")
+	defer func() {
+		if e := os.Remove(tmpFile); e != nil && !os.IsNotExist(e) {
+			log.Printf("[WARN] can't remove %s, %s", tmpFile, e)
+		}
+	}()
+	if err := ab.writeFile(tmpFile, compress, write); err != nil {
+		return err
+	}
+	if err := verify(tmpFile); err != nil {
+		return errors.Wrapf(err, "verification of %s failed", fileName)
+	}
+	return errors.Wrapf(os.Rename(tmpFile, fileName), "can't rename %s", tmpFile)
+}
+
+// verifyBackup re-reads backup file, native export or archive, and checks number of comments in it
+func verifyBackup(fileName string, crypter *store.Crypter, archive bool, expected int) error {
+	count := 0
+	err := readExport(fileName, crypter, archive, func(r io.Reader) error {
+		dec := json.NewDecoder(r)
+		if err := dec.Decode(&meta{}); err != nil {
+			return errors.Wrap(err, "can't decode meta")
+		}
+		for {
+			if err := dec.Decode(&store.Comment{}); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return errors.Wrapf(err, "can't decode comment #%d", count+1)
+			}
+			count++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if count != expected {
+		return errors.Errorf("%d comments in backup, %d expected", count, expected)
+	}
+	return nil
+}
+
+// writeFile makes backup file, gzipped if compress set and encrypted with crypter if set
+func (ab AutoBackup) writeFile(fileName string, compress bool, write func(w io.Writer) error) error {
+	fh, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "can't create backup file %s", fileName)
+	}
+	var w io.WriteCloser = fh
+	if ab.Crypter != nil {
+		if w, err = ab.Crypter.NewWriter(fh); err != nil {
+			return errors.Wrapf(err, "can't make encrypted writer for %s", fileName)
+		}
+	}
+	if !compress {
+		if err = write(w); err != nil {
+			return err
+		}
+	} else {
+		gz := gzip.NewWriter(w)
+		if err = write(gz); err != nil {
+			return err
+		}
+		if err = gz.Close(); err != nil {
+			return errors.Wrapf(err, "can't close gz for %s", fileName)
+		}
+	}
+	if ab.Crypter != nil {
+		if err = w.Close(); err != nil {
+			return errors.Wrapf(err, "can't close encrypted writer for %s", fileName)
+		}
 	}
 	if err = fh.Close(); err != nil {
-		return "", errors.Wrapf(err, "can't close file handler for %s", backupFile)
+		return errors.Wrapf(err, "can't close file handler for %s", fileName)
 	}
-	log.Printf("[DEBUG] created backup file %s", backupFile)
-	return backupFile, nil
+	return nil
 }
 
+// removeOldBackupFiles removes expired backup files, local and uploaded to sink
 func (ab AutoBackup) removeOldBackupFiles() {
-	files, err := ioutil.ReadDir(ab.BackupLocation)
+	files, err := backupFiles(ab.BackupLocation, "")
 	if err != nil {
 		log.Printf("[WARN] can't read files in backup directory %s, %s", ab.BackupLocation, err)
 		return
 	}
-	backFiles := []os.FileInfo{}
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "backup-"+ab.SiteID) {
-			backFiles = append(backFiles, file)
+	for _, f := range ab.expiredFiles(files) {
+		fpath := filepath.Join(ab.BackupLocation, f)
+		if e := os.Remove(fpath); e != nil {
+			log.Printf("[WARN] can't delete %s, %s", fpath, e)
+			continue
 		}
+		log.Printf("[DEBUG] removed %s", fpath)
 	}
-	sort.Slice(backFiles, func(i int, j int) bool { return backFiles[i].Name() < backFiles[j].Name() })
 
-	if len(backFiles) > ab.KeepMax {
-		for i := 0; i < len(backFiles)-ab.KeepMax; i++ {
-			fpath := ab.BackupLocation + "/" + backFiles[i].Name()
-			if e := os.Remove(fpath); e != nil {
-				log.Printf("[WARN] can't delete %s, %s", fpath, err)
+	if ab.Sink == nil {
+		return
+	}
+	remote, err := ab.Sink.List(ab.SiteID)
+	if err != nil {
+		log.Printf("[WARN] can't list remote backups of %s, %s", ab.SiteID, err)
+		return
+	}
+	names := make([]string, len(remote))
+	for i, r := range remote {
+		names[i] = r.Name
+	}
+	for _, f := range ab.expiredFiles(names) {
+		if e := ab.Sink.Remove(f); e != nil {
+			log.Printf("[WARN] can't delete remote %s, %s", f, e)
+			continue
+		}
+		log.Printf("[DEBUG] removed remote %s", f)
+	}
+}
+
+// expiredFiles returns backups of the site not kept by retention rules and change log backups made before the day
+// of the oldest kept backup, not usable for restore. With Retention set, change log backups kept back to the oldest
+// daily backup only. Files expected to be sorted by name.
+func (ab AutoBackup) expiredFiles(files []string) (res []string) {
+	backupPrefix, changesPrefix := "backup-"+ab.SiteID+"-", "changes-"+ab.SiteID+"-"
+	backups, changes := []string{}, []string{}
+	for _, f := range files {
+		switch {
+		case strings.HasPrefix(f, backupPrefix):
+			backups = append(backups, f)
+		case strings.HasPrefix(f, changesPrefix):
+			changes = append(changes, f)
+		}
+	}
+
+	keep, changesFrom := ab.keepBackups(backups, backupPrefix)
+	for _, f := range backups {
+		if !keep[f] {
+			res = append(res, f)
+		}
+	}
+	if changesFrom.IsZero() {
+		return res
+	}
+	day := changesFrom.Format("20060102")
+	for _, c := range changes {
+		if strings.TrimPrefix(c, changesPrefix) >= day {
+			break
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// keepBackups returns set of backups to keep and the day of the oldest backup change log backups needed for,
+// zero if unknown. Backups with unexpected names kept by retention tiers.
+func (ab AutoBackup) keepBackups(backups []string, prefix string) (keep map[string]bool, changesFrom time.Time) {
+	keep = map[string]bool{}
+	day := func(f string) (time.Time, error) { return backupDay(f, prefix) }
+
+	if ab.Retention == (Retention{}) {
+		if len(backups) > ab.KeepMax {
+			backups = backups[len(backups)-ab.KeepMax:]
+		}
+		for _, f := range backups {
+			keep[f] = true
+			if d, err := day(f); err == nil && changesFrom.IsZero() {
+				changesFrom = d
+			}
+		}
+		return keep, changesFrom
+	}
+
+	// the latest backup of each period kept, for the given number of the latest periods
+	tiers := []struct {
+		limit  int
+		period func(d time.Time) string
+		seen   map[string]bool
+	}{
+		{ab.Retention.Daily, func(d time.Time) string { return d.Format("20060102") }, map[string]bool{}},
+		{ab.Retention.Weekly, func(d time.Time) string { y, w := d.ISOWeek(); return fmt.Sprintf("%d-%d", y, w) }, map[string]bool{}},
+		{ab.Retention.Monthly, func(d time.Time) string { return d.Format("200601") }, map[string]bool{}},
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		d, err := day(backups[i])
+		if err != nil {
+			keep[backups[i]] = true
+			continue
+		}
+		for n, tier := range tiers {
+			p := tier.period(d)
+			if tier.seen[p] || len(tier.seen) >= tier.limit {
 				continue
 			}
-			log.Printf("[DEBUG] removed %s", fpath)
+			tier.seen[p] = true
+			keep[backups[i]] = true
+			if n == 0 || ab.Retention.Daily == 0 {
+				changesFrom = d
+			}
+		}
+	}
+	return keep, changesFrom
+}
+
+// backupDay returns day of backup from its name, prefix followed by yyyymmdd and .gz, or .tar.gz for archive
+func backupDay(fileName, prefix string) (time.Time, error) {
+	day := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(fileName, prefix), ".gz"), ".tar")
+	return time.ParseInLocation("20060102", day, time.Local)
+}
+
+// backupFiles returns sorted names of files in backup location with the prefix
+func backupFiles(location, prefix string) ([]string, error) {
+	files, err := ioutil.ReadDir(location)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), prefix) {
+			res = append(res, f.Name())
 		}
 	}
+	sort.Strings(res)
+	return res, nil
 }
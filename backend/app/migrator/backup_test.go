@@ -1,15 +1,23 @@
 package migrator
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 func TestBackup_RemoveOldBackupFiles(t *testing.T) {
@@ -49,9 +57,87 @@ func TestBackup_MakeBackup(t *testing.T) {
 	expFile := fmt.Sprintf("/tmp/remark-backups.test/backup-site1-%s.gz", time.Now().Format("20060102"))
 	assert.Equal(t, expFile, fname)
 
-	fi, err := os.Lstat(expFile)
-	assert.NoError(t, err)
-	assert.Equal(t, int64(52), fi.Size())
+	assert.Equal(t, mockExport, readBackupFile(t, expFile))
+}
+
+func TestBackup_MakeBackupArchive(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", KeepMax: 1, Archive: true,
+		Exporter: &Archive{NativeExporter: &mockExporter{}}}
+	fname, err := bk.makeBackup()
+	require.NoError(t, err)
+	expFile := fmt.Sprintf("/tmp/remark-backups.test/backup-site1-%s.tar.gz", time.Now().Format("20060102"))
+	assert.Equal(t, expFile, fname)
+
+	var data []byte
+	err = readExport(fname, nil, true, func(r io.Reader) (e error) {
+		data, e = ioutil.ReadAll(r)
+		return e
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mockExport, string(data), "native export in archive")
+
+	bk.Exporter = &Archive{NativeExporter: &mockExporter{size: 3}}
+	_, err = bk.makeBackup()
+	assert.Contains(t, err.Error(), "2 comments in backup, 3 expected")
+
+	// archive backup expired as any other backup
+	require.NoError(t, ioutil.WriteFile(loc+"/backup-site1-20171201.tar.gz", []byte("blah"), 0600))
+	bk.removeOldBackupFiles()
+	files, err := backupFiles(loc, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Base(expFile)}, files)
+}
+
+func TestBackup_MakeBackupVerifyFailed(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	notifier := &mockNotifier{}
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", KeepMax: 3, Exporter: &mockExporter{}, Notifier: notifier}
+	fname, err := bk.makeBackup()
+	require.NoError(t, err)
+
+	bk.Exporter = &mockExporter{size: 3}
+	bk.backup()
+	require.Equal(t, 1, len(notifier.failures))
+	assert.Equal(t, "site1", notifier.failures[0].SiteID)
+	assert.Equal(t, filepath.Base(fname), notifier.failures[0].File)
+	assert.Contains(t, notifier.failures[0].Error, "2 comments in backup, 3 expected")
+
+	files, err := ioutil.ReadDir(loc)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files), "no temp file left")
+	assert.Equal(t, mockExport, readBackupFile(t, fname), "backup made earlier the same day kept")
+}
+
+func TestBackup_MakeBackupEncrypted(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	crypter, err := store.NewCrypter("secret")
+	require.NoError(t, err)
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", KeepMax: 3, Exporter: &mockExporter{}, Crypter: crypter}
+	fname, err := bk.makeBackup()
+	require.NoError(t, err)
+
+	fh, err := os.Open(fname)
+	require.NoError(t, err)
+	defer fh.Close()
+	encrypted, rd := store.IsEncryptedStream(fh)
+	assert.True(t, encrypted)
+	rd, err = crypter.NewReader(rd)
+	require.NoError(t, err)
+	gz, err := gzip.NewReader(rd)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, mockExport, string(data))
 }
 
 func TestBackup_Do(t *testing.T) {
@@ -69,14 +155,181 @@ func TestBackup_Do(t *testing.T) {
 	bk.Do(ctx)
 
 	expFile := fmt.Sprintf("/tmp/remark-backups.test/backup-site1-%s.gz", time.Now().Format("20060102"))
-	fi, err := os.Lstat(expFile)
-	assert.NoError(t, err)
-	assert.Equal(t, int64(52), fi.Size())
+	assert.Equal(t, mockExport, readBackupFile(t, expFile))
 }
 
-type mockExporter struct{}
+func TestBackup_MakeChangesBackup(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	changeLog := &mockChangeLog{}
+	for i := 1; i <= 2500; i++ {
+		changeLog.changes = append(changeLog.changes, store.Change{Seq: int64(i), SiteID: "site1", Type: store.ChangeVote})
+	}
+	crypter, err := store.NewCrypter("secret")
+	require.NoError(t, err)
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", ChangeLog: changeLog, Crypter: crypter}
+	assert.Equal(t, int64(0), bk.lastBackupSeq(), "nothing saved yet")
+
+	fname, seq, err := bk.makeChangesBackup(2000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2500), seq)
+	changes, err := readChanges(fname, crypter)
+	require.NoError(t, err)
+	require.Equal(t, 500, len(changes))
+	assert.Equal(t, int64(2001), changes[0].Seq)
+	assert.Equal(t, int64(2500), bk.lastBackupSeq())
+
+	fname, seq, err = bk.makeChangesBackup(2500)
+	require.NoError(t, err)
+	assert.Equal(t, "", fname, "nothing new")
+	assert.Equal(t, int64(2500), seq)
+
+	_, err = readChanges(fname, nil)
+	assert.Error(t, err)
+}
+
+func TestBackup_RemoveOldChangesFiles(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	for i := 1; i <= 5; i++ {
+		for _, f := range []string{"backup-site1-201712%02d.gz", "changes-site1-201712%02d120000.gz", "changes-site2-201712%02d120000.gz"} {
+			require.NoError(t, ioutil.WriteFile(fmt.Sprintf(loc+"/"+f, i), []byte("blah"), 0600))
+		}
+	}
+
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", KeepMax: 3}
+	bk.removeOldBackupFiles()
+	files, err := backupFiles(loc, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backup-site1-20171203.gz", "backup-site1-20171204.gz", "backup-site1-20171205.gz",
+		"changes-site1-20171203120000.gz", "changes-site1-20171204120000.gz", "changes-site1-20171205120000.gz",
+		"changes-site2-20171201120000.gz", "changes-site2-20171202120000.gz", "changes-site2-20171203120000.gz",
+		"changes-site2-20171204120000.gz", "changes-site2-20171205120000.gz"}, files)
+}
+
+func TestBackup_RemoveOldFilesRetention(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	// daily backups from 2017-10-01 to 2017-12-31 and change log backup for each day
+	for d := time.Date(2017, 10, 1, 0, 0, 0, 0, time.Local); d.Year() == 2017; d = d.AddDate(0, 0, 1) {
+		require.NoError(t, ioutil.WriteFile(loc+"/backup-site1-"+d.Format("20060102")+".gz", []byte("blah"), 0600))
+		require.NoError(t, ioutil.WriteFile(loc+"/changes-site1-"+d.Format("20060102")+"120000.gz", []byte("blah"), 0600))
+	}
+
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", KeepMax: 3, Retention: Retention{Daily: 3, Weekly: 2, Monthly: 3}}
+	bk.removeOldBackupFiles()
+	files, err := backupFiles(loc, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"backup-site1-20171031.gz", // monthly
+		"backup-site1-20171130.gz", // monthly
+		"backup-site1-20171224.gz", // weekly, sunday of 51st week
+		"backup-site1-20171229.gz", // daily
+		"backup-site1-20171230.gz", // daily
+		"backup-site1-20171231.gz", // daily, weekly and monthly
+		"changes-site1-20171229120000.gz", "changes-site1-20171230120000.gz", "changes-site1-20171231120000.gz",
+	}, files)
+
+	// without daily tier change log backups kept back to the oldest backup
+	bk.Retention = Retention{Weekly: 1, Monthly: 2}
+	bk.removeOldBackupFiles()
+	files, err = backupFiles(loc, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"backup-site1-20171130.gz", "backup-site1-20171231.gz",
+		"changes-site1-20171229120000.gz", "changes-site1-20171230120000.gz", "changes-site1-20171231120000.gz"}, files)
+}
+
+func TestBackup_Sink(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	fs := newFakeS3()
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+	sink := &S3Sink{Endpoint: ts.URL, Bucket: "bkt", AccessKey: "key", SecretKey: "secret"}
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, sink.Put(fmt.Sprintf("backup-site1-201712%02d.gz", i), strings.NewReader("blah")))
+		require.NoError(t, sink.Put(fmt.Sprintf("changes-site1-201712%02d120000.gz", i), strings.NewReader("blah")))
+	}
+
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", KeepMax: 3, Exporter: &mockExporter{}, Sink: sink}
+	fname, err := bk.makeBackup()
+	require.NoError(t, err)
+	bk.upload(fname)
+	bk.removeOldBackupFiles()
+
+	files, err := sink.List("site1")
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"backup-site1-20171203.gz", "backup-site1-20171204.gz", filepath.Base(fname),
+		"changes-site1-20171203120000.gz", "changes-site1-20171204120000.gz"}, names)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, sink.Get(filepath.Base(fname), &buf))
+	local, err := ioutil.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, local, buf.Bytes())
+
+	sink.SecretKey = "bad"
+	bk.upload(fname) // failure logged
+}
+
+type mockChangeLog struct {
+	changes []store.Change
+}
+
+func (m *mockChangeLog) Changes(siteID string, since int64, limit int) ([]store.Change, error) {
+	res := []store.Change{}
+	for _, c := range m.changes {
+		if c.Seq > since && len(res) < limit {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+const mockExport = `{"version":1}
+{"id":"c1","text":"comment 1"}
+{"id":"c2","text":"comment 2"}
+`
+
+// mockExporter writes export with two comments, size overrides number of comments reported
+type mockExporter struct {
+	size int
+}
 
 func (mock *mockExporter) Export(w io.Writer, siteID string) (int, error) {
-	_, err := w.Write([]byte("some export blah blah 1234567890"))
-	return 1000, err
+	_, err := w.Write([]byte(mockExport))
+	if mock.size != 0 {
+		return mock.size, err
+	}
+	return 2, err
+}
+
+type mockNotifier struct {
+	failures []store.BackupFailure
+}
+
+func (m *mockNotifier) SubmitBackupFailure(f store.BackupFailure) {
+	m.failures = append(m.failures, f)
+}
+
+func readBackupFile(t *testing.T, fileName string) string {
+	var data []byte
+	err := readBackup(fileName, nil, func(r io.Reader) (e error) {
+		data, e = ioutil.ReadAll(r)
+		return e
+	})
+	require.NoError(t, err)
+	return string(data)
 }
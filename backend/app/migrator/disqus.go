@@ -57,10 +57,10 @@ func (d *Disqus) Import(r io.Reader, siteID string) (size int, err error) {
 		return 0, err
 	}
 
-	commentsCh := d.convert(r, siteID)
+	commentsCh, _ := d.convert(r, siteID)
 	failed, passed := 0, 0
 	for c := range commentsCh {
-		if _, err = d.DataStore.Create(c); err != nil {
+		if _, err = d.DataStore.Import(c); err != nil {
 			failed++
 			continue
 		}
@@ -79,13 +79,39 @@ func (d *Disqus) Import(r io.Reader, siteID string) (size int, err error) {
 	return passed, err
 }
 
+// Merge comments from disqus, keeping existing comments of the site. Text of comments imported before updated,
+// votes and other state made on this site kept.
+func (d *Disqus) Merge(r io.Reader, siteID string) (ImportStats, error) {
+	mrg := &merger{dataStore: d.DataStore}
+	commentsCh, _ := d.convert(r, siteID)
+	for c := range commentsCh {
+		mrg.put(c)
+	}
+	return mrg.result(siteID)
+}
+
+// Validate converts disqus xml from reader and reports problems found, nothing written to the store
+func (d *Disqus) Validate(r io.Reader, siteID string) (ValidationReport, error) {
+	v := newValidator(d.DataStore, siteID)
+	commentsCh, convStats := d.convert(r, siteID)
+	for c := range commentsCh {
+		v.add(c)
+	}
+	v.addConverted(convStats)
+	if convStats.err != nil {
+		return v.result(siteID), errors.Wrap(convStats.err, "broken disqus xml")
+	}
+	return v.result(siteID), nil
+}
+
 // convert disqus stream (xml) from reader and fill channel of comments.
-// runs async and closes channel on completion.
-func (d *Disqus) convert(r io.Reader, siteID string) (ch chan store.Comment) {
+// runs async and closes channel on completion, convStats filled by this time.
+func (d *Disqus) convert(r io.Reader, siteID string) (ch chan store.Comment, convStats *convertStats) {
 
 	postsMap := map[string]string{} // tid:url
 	decoder := xml.NewDecoder(r)
 	commentsCh := make(chan store.Comment)
+	convStats = &convertStats{}
 
 	stats := struct {
 		inpThreads, inpComments     int
@@ -97,6 +123,9 @@ func (d *Disqus) convert(r io.Reader, siteID string) (ch chan store.Comment) {
 		for {
 			t, err := decoder.Token()
 			if t == nil || err != nil {
+				if err != nil && err != io.EOF {
+					convStats.err = err
+				}
 				break
 			}
 
@@ -143,6 +172,9 @@ func (d *Disqus) convert(r io.Reader, siteID string) (ch chan store.Comment) {
 					if c.ID == "" { // no comment.UID
 						c.ID = comment.ID
 					}
+					if comment.AuthorUserName == "" {
+						convStats.noUserID = append(convStats.noUserID, c.ID)
+					}
 					commentsCh <- c
 					stats.commentsCount++
 					if stats.commentsCount%1000 == 0 {
@@ -151,11 +183,12 @@ func (d *Disqus) convert(r io.Reader, siteID string) (ch chan store.Comment) {
 				}
 			}
 		}
+		convStats.failed = stats.failedThreads + stats.failedPosts
 		close(commentsCh)
 		log.Printf("[INFO] converted %d posts, %+v", len(postsMap), stats)
 	}()
 
-	return commentsCh
+	return commentsCh, convStats
 }
 
 func (*Disqus) cleanText(text string) string {
@@ -50,7 +50,7 @@ func TestDisqus_Import(t *testing.T) {
 
 func TestDisqus_Convert(t *testing.T) {
 	d := Disqus{}
-	ch := d.convert(strings.NewReader(xmlTestDisqus), "test")
+	ch, _ := d.convert(strings.NewReader(xmlTestDisqus), "test")
 
 	res := []store.Comment{}
 	for comment := range ch {
@@ -227,3 +227,37 @@ var xmlTestDisqus = `<?xml version="1.0" encoding="utf-8"?>
 
 </disqus>
 `
+
+func TestDisqus_Merge(t *testing.T) {
+	defer os.Remove("/tmp/remark-test.db")
+	b, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{FileName: "/tmp/remark-test.db", SiteID: "test"})
+	require.Nil(t, err, "create store")
+	dataStore := service.DataStore{Interface: b, AdminStore: admin.NewStaticStore("12345", []string{}, ""), MaxVotes: -1}
+	d := Disqus{DataStore: &dataStore}
+	_, err = d.Import(strings.NewReader(xmlTestDisqus), "test")
+	require.NoError(t, err)
+
+	// comment made after import and vote on imported one kept by merge
+	locator := store.Locator{SiteID: "test", URL: "https://radio-t.com/p/2011/03/05/podcast-229/"}
+	_, err = dataStore.Create(store.Comment{Text: "new comment", Locator: locator, User: store.User{ID: "user1", Name: "user1"}})
+	require.NoError(t, err)
+	_, err = dataStore.Vote(locator, "299619020", "user1", true)
+	require.NoError(t, err)
+
+	stats, err := d.Merge(strings.NewReader(xmlTestDisqus), "test")
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Skipped: 4}, stats)
+
+	stats, err = d.Merge(strings.NewReader(strings.Replace(xmlTestDisqus, "The quick brown fox", "The slow brown fox", 1)), "test")
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Updated: 1, Skipped: 3}, stats)
+
+	c, err := dataStore.Get(locator, "299619020", adminUser)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(c.Text, "<p>The slow brown fox"), c.Text)
+	assert.Equal(t, 1, c.Score)
+
+	count, err := dataStore.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
@@ -0,0 +1,67 @@
+package migrator
+
+import (
+	"io"
+	"sync"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/service"
+)
+
+// Merger defines interface to import comments in merge mode. Unlike Importer it doesn't remove comments of the site,
+// adds missing comments and updates changed ones.
+type Merger interface {
+	Merge(r io.Reader, siteID string) (ImportStats, error)
+}
+
+// ImportStats reports results of merge
+type ImportStats struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"` // imported before and not changed
+	Failed   int `json:"failed"`
+}
+
+// merger applies imported comments to the store, keyed by comment id. Disqus and WordPress importers keep id
+// of the source comment as comment id, so comments imported before matched to their source.
+// Safe for concurrent use.
+type merger struct {
+	dataStore Store
+	full      bool // imported comments have full state, i.e. native export, otherwise text only
+
+	lock  sync.Mutex
+	stats ImportStats
+}
+
+func (m *merger) put(c store.Comment) {
+	res, err := m.dataStore.MergeComment(c, m.full)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err != nil {
+		log.Printf("[WARN] can't merge %s, %s", c.ID, err)
+		m.stats.Failed++
+		return
+	}
+	switch res {
+	case service.MergeInserted:
+		m.stats.Inserted++
+	case service.MergeUpdated:
+		m.stats.Updated++
+	default:
+		m.stats.Skipped++
+	}
+}
+
+// result returns stats of merge, with error if some comments failed
+func (m *merger) result(siteID string) (ImportStats, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	log.Printf("[INFO] merged comments to site %s, %+v", siteID, m.stats)
+	if m.stats.Failed > 0 {
+		return m.stats, errors.Errorf("failed to merge %d comments", m.stats.Failed)
+	}
+	return m.stats, nil
+}
@@ -26,12 +26,19 @@ type Exporter interface {
 
 // Store defines minimal interface needed to export and import comments
 type Store interface {
-	Create(comment store.Comment) (commentID string, err error)
+	Import(comment store.Comment) (commentID string, err error)
+	PrepareImport(comment store.Comment) (store.Comment, error)
 	Find(locator store.Locator, sort string, user store.User) ([]store.Comment, error)
 	List(siteID string, limit int, skip int) ([]store.PostInfo, error)
 	DeleteAll(siteID string) error
+	MergeComment(comment store.Comment, full bool) (service.MergeResult, error)
 	Metas(siteID string) (umetas []service.UserMetaData, pmetas []service.PostMetaData, err error)
 	SetMetas(siteID string, umetas []service.UserMetaData, pmetas []service.PostMetaData) error
+	SiteSettings(siteID string) store.SiteSettings
+	SiteConfig(siteID string) service.SiteConfig
+	SetSettings(siteID string, settings store.SiteSettings) error
+	RestrictedRules(siteID string) ([]store.RestrictedRule, error)
+	SetRestrictedRules(siteID string, rules []store.RestrictedRule) error
 }
 
 // ImportParams defines everything needed to run import
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io"
 	"sync/atomic"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
 	"github.com/go-pkgz/syncs"
@@ -27,9 +28,12 @@ type Native struct {
 }
 
 type meta struct {
-	Version int                    `json:"version"`
-	Users   []service.UserMetaData `json:"users"`
-	Posts   []service.PostMetaData `json:"posts"`
+	Version    int                    `json:"version"`
+	Created    time.Time              `json:"created,omitempty"` // time of export, not set in old exports
+	Users      []service.UserMetaData `json:"users"`
+	Posts      []service.PostMetaData `json:"posts"`
+	Settings   *store.SiteSettings    `json:"settings,omitempty"`   // per-site settings, not set in old exports
+	Restricted []store.RestrictedRule `json:"restricted,omitempty"` // per-site restricted rules, not set in old exports
 }
 
 // Export all comments to writer as json strings. Each comment is one string, separated by "\n"
@@ -73,13 +77,18 @@ func (n *Native) Export(w io.Writer, siteID string) (size int, err error) {
 	return commentsCount, nil
 }
 
-// exportMeta appends user and post metas to exported stream
+// exportMeta appends user and post metas, site settings and restricted rules to exported stream
 func (n *Native) exportMeta(siteID string, w io.Writer) (err error) {
-	m := meta{Version: nativeVersion}
+	m := meta{Version: nativeVersion, Created: time.Now()}
 	m.Users, m.Posts, err = n.DataStore.Metas(siteID)
 	if err != nil {
 		return errors.Wrap(err, "can't get meta")
 	}
+	settings := n.DataStore.SiteSettings(siteID)
+	m.Settings = &settings
+	if m.Restricted, err = n.DataStore.RestrictedRules(siteID); err != nil {
+		return errors.Wrap(err, "can't get restricted rules")
+	}
 
 	if err = json.NewEncoder(w).Encode(m); err != nil {
 		return errors.Wrap(err, "can't encode meta")
@@ -90,14 +99,10 @@ func (n *Native) exportMeta(siteID string, w io.Writer) (err error) {
 // Import comments from json strings produced by Remark.Export
 func (n *Native) Import(reader io.Reader, siteID string) (size int, err error) {
 
-	m := meta{}
 	dec := json.NewDecoder(reader)
-	if err = dec.Decode(&m); err != nil {
-		return 0, errors.Wrapf(err, "failed to import meta for site %s", siteID)
-	}
-
-	if m.Version != nativeVersion && m.Version != 0 { // this version allows back compatibility with 0 version
-		return 0, errors.Errorf("unexpected import file version %d", m.Version)
+	m, err := n.decodeMeta(dec, siteID)
+	if err != nil {
+		return 0, err
 	}
 
 	if err = n.DataStore.DeleteAll(siteID); err != nil {
@@ -129,7 +134,7 @@ func (n *Native) Import(reader io.Reader, siteID string) (size int, err error) {
 
 		// write comments in parallel
 		grp.Go(func(context.Context) {
-			if _, e := n.DataStore.Create(comment); e != nil {
+			if _, e := n.DataStore.Import(comment); e != nil {
 				atomic.AddInt64(&failed, 1)
 				log.Printf("[WARN] can't write %+v to store, %s", comment, e)
 				return
@@ -149,7 +154,91 @@ func (n *Native) Import(reader io.Reader, siteID string) (size int, err error) {
 	}
 	log.Printf("[INFO] imported %d comments from %d records", comments, total)
 
-	err = n.DataStore.SetMetas(siteID, m.Users, m.Posts)
+	if err = n.DataStore.SetMetas(siteID, m.Users, m.Posts); err != nil {
+		return int(comments), err
+	}
 
+	if m.Settings != nil { // keep current settings for exports made without settings
+		if err = n.DataStore.SetSettings(siteID, *m.Settings); err != nil {
+			return int(comments), err
+		}
+	}
+	if m.Restricted != nil {
+		err = n.DataStore.SetRestrictedRules(siteID, m.Restricted)
+	}
 	return int(comments), err
 }
+
+// Merge comments from json strings produced by Remark.Export, keeping existing comments of the site.
+// Comments merged with full state, votes, score, pin and deleted status. Metas, settings and restricted rules
+// of the site kept as is.
+func (n *Native) Merge(reader io.Reader, siteID string) (ImportStats, error) {
+	dec := json.NewDecoder(reader)
+	if _, err := n.decodeMeta(dec, siteID); err != nil {
+		return ImportStats{}, err
+	}
+
+	concurrent := defaultConcurrent
+	if n.Concurrent > 0 {
+		concurrent = n.Concurrent
+	}
+	grp := syncs.NewSizedGroup(concurrent, syncs.Preemptive)
+	mrg := &merger{dataStore: n.DataStore, full: true}
+	failed := 0
+	for {
+		comment := store.Comment{}
+		err := dec.Decode(&comment)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			failed++
+			if _, ok := err.(*json.UnmarshalTypeError); ok {
+				continue
+			}
+			break // syntax error, decoder can't continue
+		}
+		grp.Go(func(context.Context) { mrg.put(comment) })
+	}
+	grp.Wait()
+
+	mrg.stats.Failed += failed
+	return mrg.result(siteID)
+}
+
+// Validate decodes native export from reader and reports problems found, nothing written to the store
+func (n *Native) Validate(reader io.Reader, siteID string) (ValidationReport, error) {
+	dec := json.NewDecoder(reader)
+	if _, err := n.decodeMeta(dec, siteID); err != nil {
+		return ValidationReport{}, err
+	}
+
+	v := newValidator(n.DataStore, siteID)
+	for {
+		comment := store.Comment{}
+		err := dec.Decode(&comment)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			v.report.Failed++
+			if _, ok := err.(*json.UnmarshalTypeError); ok {
+				continue
+			}
+			break // syntax error, decoder can't continue
+		}
+		v.add(comment)
+	}
+	return v.result(siteID), nil
+}
+
+// decodeMeta reads meta, the first record of export, and checks its version
+func (n *Native) decodeMeta(dec *json.Decoder, siteID string) (m meta, err error) {
+	if err = dec.Decode(&m); err != nil {
+		return m, errors.Wrapf(err, "failed to import meta for site %s", siteID)
+	}
+	if m.Version != nativeVersion && m.Version != 0 { // this version allows back compatibility with 0 version
+		return m, errors.Errorf("unexpected import file version %d", m.Version)
+	}
+	return m, nil
+}
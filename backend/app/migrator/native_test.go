@@ -27,7 +27,11 @@ func TestNative_Export(t *testing.T) {
 	b := prep(t) // write 2 comments
 	assert.NoError(t, b.SetReadOnly(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, true))
 	assert.NoError(t, b.SetVerified("radio-t", "user1", true))
-	assert.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour))
+	assert.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour, store.BlockInfo{Reason: "spam", Admin: "admin1"}))
+	assert.NoError(t, b.SetBlockIP("radio-t", "ip1", true, time.Hour, store.BlockInfo{Reason: "bots"}))
+	readOnlyAge := 30
+	assert.NoError(t, b.SetSettings("radio-t", store.SiteSettings{ReadOnlyAge: &readOnlyAge}))
+	assert.NoError(t, b.SetRestrictedRules("radio-t", []store.RestrictedRule{{Pattern: "duck", Action: store.RestrictMask}}))
 	r := Native{DataStore: b}
 
 	buf := &bytes.Buffer{}
@@ -41,25 +45,37 @@ func TestNative_Export(t *testing.T) {
 	dec := json.NewDecoder(strings.NewReader(c1))
 
 	meta := struct {
-		Version int                    `json:"version"`
-		Users   []service.UserMetaData `json:"users"`
-		Posts   []service.PostMetaData `json:"posts"`
+		Version    int                    `json:"version"`
+		Users      []service.UserMetaData `json:"users"`
+		Posts      []service.PostMetaData `json:"posts"`
+		Settings   *store.SiteSettings    `json:"settings"`
+		Restricted []store.RestrictedRule `json:"restricted"`
 	}{}
 
 	require.NoError(t, dec.Decode(&meta), "decode meta")
 
-	assert.Equal(t, 2, len(meta.Users))
-	assert.Equal(t, "user1", meta.Users[0].ID)
-	assert.Equal(t, false, meta.Users[0].Blocked.Status)
-	assert.Equal(t, true, meta.Users[0].Verified)
-	assert.Equal(t, "user2", meta.Users[1].ID)
-	assert.Equal(t, true, meta.Users[1].Blocked.Status)
-	assert.Equal(t, false, meta.Users[1].Verified)
+	assert.Equal(t, 3, len(meta.Users))
+	assert.Equal(t, "ip1", meta.Users[0].ID)
+	assert.Equal(t, true, meta.Users[0].IP)
+	assert.Equal(t, "bots", meta.Users[0].Blocked.Reason)
+	assert.Equal(t, "user1", meta.Users[1].ID)
+	assert.Equal(t, false, meta.Users[1].Blocked.Status)
+	assert.Equal(t, true, meta.Users[1].Verified)
+	assert.Equal(t, "user2", meta.Users[2].ID)
+	assert.Equal(t, true, meta.Users[2].Blocked.Status)
+	assert.Equal(t, "spam", meta.Users[2].Blocked.Reason)
+	assert.Equal(t, "admin1", meta.Users[2].Blocked.Admin)
+	assert.Equal(t, false, meta.Users[2].Verified)
 
 	assert.Equal(t, 1, len(meta.Posts))
 	assert.Equal(t, "https://radio-t.com", meta.Posts[0].URL)
 	assert.Equal(t, true, meta.Posts[0].ReadOnly)
 
+	require.NotNil(t, meta.Settings)
+	require.NotNil(t, meta.Settings.ReadOnlyAge)
+	assert.Equal(t, 30, *meta.Settings.ReadOnlyAge)
+	assert.Equal(t, []store.RestrictedRule{{Pattern: "duck", Action: store.RestrictMask}}, meta.Restricted)
+
 	comments := [3]store.Comment{}
 
 	assert.NoError(t, dec.Decode(&comments[0]), "decode comment 0")
@@ -72,7 +88,7 @@ func TestNative_Export(t *testing.T) {
 func TestNative_Import(t *testing.T) {
 	defer os.Remove(testDb)
 
-	inp := `{"version":1,"users":[{"id":"user1","blocked":{"status":false,"until":"0001-01-01T00:00:00Z"},"verified":true},{"id":"user2","blocked":{"status":true,"until":"2018-12-23T02:55:22.472041-06:00"},"verified":false}],"posts":[{"url":"https://radio-t.com","read_only":true}]}
+	inp := `{"version":1,"users":[{"id":"user1","blocked":{"status":false,"until":"0001-01-01T00:00:00Z"},"verified":true},{"id":"user2","blocked":{"status":true,"until":"2018-12-23T02:55:22.472041-06:00"},"verified":false}],"posts":[{"url":"https://radio-t.com","read_only":true}],"settings":{"max_votes":5,"restricted_words":["duck"]},"restricted":[{"pattern":"goose","action":"moderate"}]}
 	{"id":"efbc17f177ee1a1c0ee6e1e025749966ec071adc","pid":"","text":"some text, <a href=\"http://radio-t.com\" rel=\"nofollow\">link</a>","user":{"name":"user name","id":"user1","picture":"","ip":"293ec5b0cf154855258824ec7fac5dc63d176915","admin":false},"locator":{"site":"radio-t","url":"https://radio-t.com"},"score":0,"votes":{},"time":"2017-12-20T15:18:22-06:00"}
 	{"id":"f863bd79-fec6-4a75-b308-61fe5dd02aa1","pid":"1234","text":"some text2","user":{"name":"user name","id":"user2","picture":"","ip":"293ec5b0cf154855258824ec7fac5dc63d176915","admin":false},"locator":{"site":"radio-t","url":"https://radio-t.com/2"},"score":0,"votes":{},"time":"2017-12-20T15:18:23-06:00"}`
 
@@ -99,6 +115,14 @@ func TestNative_Import(t *testing.T) {
 
 	assert.Equal(t, true, b.IsBlocked("radio-t", "user2"))
 	assert.Equal(t, false, b.IsVerified("radio-t", "user2"))
+
+	settings := b.SiteSettings("radio-t")
+	require.NotNil(t, settings.MaxVotes)
+	assert.Equal(t, 5, *settings.MaxVotes)
+	assert.Equal(t, []string{"duck"}, settings.RestrictedWords)
+	rules, err := b.RestrictedRules("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []store.RestrictedRule{{Pattern: "goose", Action: store.RestrictModerate}}, rules)
 }
 
 func TestNative_ImportWrongVersion(t *testing.T) {
@@ -167,3 +191,35 @@ func prep(t *testing.T) *service.DataStore {
 
 	return b
 }
+
+func TestNative_Merge(t *testing.T) {
+	defer os.Remove(testDb)
+	b := prep(t) // write 2 comments
+
+	// merge of own export changes nothing
+	buf := &bytes.Buffer{}
+	r := Native{DataStore: b}
+	_, err := r.Export(buf, "radio-t")
+	require.NoError(t, err)
+	stats, err := r.Merge(buf, "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, ImportStats{Skipped: 2}, stats)
+
+	inp := `{"version":1,"users":[],"posts":[]}
+	{"id":"efbc17f177ee1a1c0ee6e1e025749966ec071adc","pid":"","text":"some text, edited","user":{"name":"user name","id":"user1"},"locator":{"site":"radio-t","url":"https://radio-t.com"},"score":2,"votes":{"user2":true},"time":"2017-12-20T15:18:22-06:00"}
+	{"id":"f863bd79-fec6-4a75-b308-61fe5dd02aa1","pid":"","text":"some text3","user":{"name":"user name","id":"user2"},"locator":{"site":"radio-t","url":"https://radio-t.com"},"score":0,"votes":{},"time":"2017-12-20T15:18:25-06:00"}
+	{"id":"bad","score":"not a number"}`
+	stats, err = r.Merge(strings.NewReader(inp), "radio-t")
+	assert.EqualError(t, err, "failed to merge 1 comments")
+	assert.Equal(t, ImportStats{Inserted: 1, Updated: 1, Failed: 1}, stats)
+
+	comments, err := b.Last("radio-t", 10, time.Time{}, adminUser)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(comments), "comment not in merged file kept")
+
+	c, err := b.Interface.Get(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}, "efbc17f177ee1a1c0ee6e1e025749966ec071adc")
+	require.NoError(t, err)
+	assert.Equal(t, "some text, edited", c.Text)
+	assert.Equal(t, 2, c.Score)
+	assert.Equal(t, map[string]bool{"user2": true}, c.Votes)
+}
@@ -0,0 +1,370 @@
+package migrator
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/service"
+)
+
+// PointInTime rebuilds state of the site at the given time from files made by AutoBackup.
+// The latest backup made before the time taken as a base, records of change log backups
+// made after the backup replayed on top of it up to the time.
+type PointInTime struct {
+	BackupLocation string
+	SiteID         string
+	Crypter        *store.Crypter // decrypts encrypted backups
+}
+
+// Restore writes native export of the site state at ts to w.
+// Returns name of the backup used as a base and number of replayed changes.
+func (p PointInTime) Restore(w io.Writer, ts time.Time) (backup string, replayed int, err error) {
+	state, backup, err := p.baseState(ts)
+	if err != nil {
+		return "", 0, err
+	}
+	log.Printf("[INFO] restore %s at %s from %s made %s", p.SiteID, ts.Format(time.RFC3339), backup,
+		state.meta.Created.Format(time.RFC3339))
+
+	changes, err := p.changes(state.meta.Created, ts)
+	if err != nil {
+		return backup, 0, err
+	}
+	for _, c := range changes {
+		state.apply(c)
+	}
+
+	state.meta.Created = ts
+	for i := range state.meta.Users {
+		if state.meta.Users[i].Blocked.Until.Before(time.Now()) {
+			state.meta.Users[i].Blocked.Status = false // expired after ts, import makes block with past time permanent
+		}
+	}
+	if err = json.NewEncoder(w).Encode(state.meta); err != nil {
+		return backup, 0, errors.Wrap(err, "can't write meta")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, c := range state.comments {
+		if err = enc.Encode(c); err != nil {
+			return backup, 0, errors.Wrapf(err, "can't write comment %s", c.ID)
+		}
+	}
+	return backup, len(changes), nil
+}
+
+// baseState loads the latest backup made before ts. Old backups, without export time in meta, skipped.
+func (p PointInTime) baseState(ts time.Time) (state *siteState, backup string, err error) {
+	prefix := "backup-" + p.SiteID + "-"
+	files, err := backupFiles(p.BackupLocation, prefix)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "can't read backup directory %s", p.BackupLocation)
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		day, e := backupDay(files[i], prefix)
+		if e != nil || day.After(ts) {
+			continue
+		}
+		backup = filepath.Join(p.BackupLocation, files[i])
+		state = &siteState{index: map[string]int{}}
+		archive := strings.HasSuffix(backup, ".tar.gz")
+		err = readExport(backup, p.Crypter, archive, func(r io.Reader) error { return state.load(r) })
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "can't load %s", backup)
+		}
+		if state.meta.Created.IsZero() {
+			log.Printf("[WARN] time of %s unknown, skipped", backup)
+			continue
+		}
+		if state.meta.Created.After(ts) {
+			continue
+		}
+		return state, backup, nil
+	}
+	return nil, "", errors.Errorf("no backup of %s made before %s", p.SiteID, ts.Format(time.RFC3339))
+}
+
+// changes returns records of change log backups made between from and to, sorted by seq
+func (p PointInTime) changes(from, to time.Time) ([]store.Change, error) {
+	files, err := backupFiles(p.BackupLocation, "changes-"+p.SiteID+"-")
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read backup directory %s", p.BackupLocation)
+	}
+	bySeq := map[int64]store.Change{}
+	var last time.Time // time of the last backed up record
+	for _, f := range files {
+		changes, e := readChanges(filepath.Join(p.BackupLocation, f), p.Crypter)
+		if e != nil {
+			return nil, e
+		}
+		for _, c := range changes {
+			if c.Timestamp.After(last) {
+				last = c.Timestamp
+			}
+			if c.Timestamp.Before(from) || c.Timestamp.After(to) {
+				continue
+			}
+			bySeq[c.Seq] = c
+		}
+	}
+	if last.Before(to) {
+		log.Printf("[WARN] changes of %s after %s not backed up, can't be restored", p.SiteID, last.Format(time.RFC3339))
+	}
+
+	res := make([]store.Change, 0, len(bySeq))
+	for _, c := range bySeq {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Seq < res[j].Seq })
+	for i := 1; i < len(res); i++ {
+		if res[i].Seq != res[i-1].Seq+1 {
+			log.Printf("[WARN] changes of %s from %d to %d missing", p.SiteID, res[i-1].Seq+1, res[i].Seq-1)
+		}
+	}
+	return res, nil
+}
+
+// readChanges reads all records of change log backup
+func readChanges(fileName string, crypter *store.Crypter) (res []store.Change, err error) {
+	err = readBackup(fileName, crypter, func(r io.Reader) error {
+		dec := json.NewDecoder(r)
+		for {
+			c := store.Change{}
+			if e := dec.Decode(&c); e != nil {
+				if e == io.EOF {
+					return nil
+				}
+				return errors.Wrap(e, "can't decode change")
+			}
+			res = append(res, c)
+		}
+	})
+	return res, errors.Wrapf(err, "can't read %s", fileName)
+}
+
+// readExport reads native export of comments from backup file. For archive backup the export read from
+// comments entry of the tarball.
+func readExport(fileName string, crypter *store.Crypter, archive bool, read func(r io.Reader) error) error {
+	if !archive {
+		return readBackup(fileName, crypter, read)
+	}
+	return readBackup(fileName, crypter, func(r io.Reader) error {
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return errors.New("no comments in archive")
+			}
+			if err != nil {
+				return errors.Wrap(err, "can't read archive")
+			}
+			if hdr.Name == archiveComments {
+				return read(tr)
+			}
+		}
+	})
+}
+
+// readBackup opens gzipped backup file, decrypted with crypter if encrypted
+func readBackup(fileName string, crypter *store.Crypter, read func(r io.Reader) error) error {
+	fh, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := fh.Close(); e != nil {
+			log.Printf("[WARN] can't close %s, %v", fileName, e)
+		}
+	}()
+
+	encrypted, reader := store.IsEncryptedStream(fh)
+	if encrypted {
+		if crypter == nil {
+			return errors.New("encrypted file, secret not set")
+		}
+		if reader, err = crypter.NewReader(reader); err != nil {
+			return err
+		}
+	}
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return errors.Wrap(err, "can't make gz reader")
+	}
+	return read(gz)
+}
+
+// siteState is the site data from native export with changes applied
+type siteState struct {
+	meta     meta
+	comments []store.Comment
+	index    map[string]int // comment id to position in comments
+}
+
+// load reads native export
+func (s *siteState) load(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&s.meta); err != nil {
+		return errors.Wrap(err, "can't decode meta")
+	}
+	for {
+		c := store.Comment{}
+		if err := dec.Decode(&c); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "can't decode comment")
+		}
+		s.put(c)
+	}
+}
+
+// apply replays the change. Comment state recorded with the change replaces the current one.
+func (s *siteState) apply(c store.Change) {
+	switch {
+	case c.Comment != nil:
+		s.put(*c.Comment)
+	case c.Type == store.ChangeDelete && c.CommentID == "" && c.UserID != "":
+		for i := range s.comments {
+			if s.comments[i].User.ID == c.UserID {
+				s.delete(i, store.HardDelete, c.Timestamp)
+			}
+		}
+		um := s.userMeta(c.UserID, false) // stored records cleared with user's data
+		um.Verified, um.ShadowBanned, um.Trust = false, false, nil
+	case c.Type == store.ChangeDelete:
+		if i, ok := s.index[c.CommentID]; ok {
+			s.delete(i, store.SoftDelete, c.Timestamp)
+		}
+	case c.Type == store.ChangeBlock, c.Type == store.ChangeBlockIP:
+		um := s.userMeta(c.UserID, c.Type == store.ChangeBlockIP)
+		um.Blocked.Status, um.Blocked.Until = c.Status, c.Until
+	case c.Type == store.ChangeVerified:
+		s.userMeta(c.UserID, false).Verified = c.Status
+	case c.Type == store.ChangeShadow:
+		s.userMeta(c.UserID, false).ShadowBanned = c.Status
+	case c.Type == store.ChangeTrust:
+		um := s.userMeta(c.UserID, false)
+		um.Trust = nil
+		if c.Trust != nil && c.Trust.Manual {
+			trust := *c.Trust
+			um.Trust = &trust
+		}
+	case c.Type == store.ChangeSettings:
+		s.meta.Settings = c.Settings
+	case c.Type == store.ChangeRules:
+		s.meta.Restricted = append([]store.RestrictedRule{}, c.Rules...) // empty, not nil, to clear rules on import
+	case c.Type == store.ChangeMerge:
+		s.mergeUser(c.UserID, c.TargetID)
+	case c.Type == store.ChangeProfile && c.Profile != nil:
+		for i := range s.comments {
+			if s.comments[i].User.ID == c.UserID {
+				s.comments[i].User.Name, s.comments[i].User.Picture = c.Profile.Name, c.Profile.Picture
+			}
+		}
+	case c.Type == store.ChangeClearIPs:
+		for i := range s.comments {
+			if s.comments[i].Timestamp.Before(c.Until) && (c.UserID == "" || s.comments[i].User.ID == c.UserID) {
+				s.comments[i].User.IP = ""
+			}
+		}
+	case c.Type == store.ChangeReadOnly:
+		for i := range s.meta.Posts {
+			if s.meta.Posts[i].URL == c.Locator.URL {
+				s.meta.Posts[i].ReadOnly = c.Status
+				return
+			}
+		}
+		s.meta.Posts = append(s.meta.Posts, service.PostMetaData{URL: c.Locator.URL, ReadOnly: c.Status})
+	}
+}
+
+// userMeta returns meta of the user, or of the ip hash, added if missing
+func (s *siteState) userMeta(id string, ip bool) *service.UserMetaData {
+	for i := range s.meta.Users {
+		if s.meta.Users[i].ID == id && s.meta.Users[i].IP == ip {
+			return &s.meta.Users[i]
+		}
+	}
+	s.meta.Users = append(s.meta.Users, service.UserMetaData{ID: id, IP: ip})
+	return &s.meta.Users[len(s.meta.Users)-1]
+}
+
+// mergeUser moves comments and votes of fromID user to toID, as engine's merge does.
+// Verified and blocked flags of fromID combined with toID's, the longest block wins.
+func (s *siteState) mergeUser(fromID, toID string) {
+	for i := range s.comments {
+		c := &s.comments[i]
+		if c.User.ID == fromID {
+			c.User.ID = toID
+		}
+		val, ok := c.Votes[fromID]
+		if !ok {
+			continue
+		}
+		delete(c.Votes, fromID)
+		if _, voted := c.Votes[toID]; !voted {
+			c.Votes[toID] = val
+			continue
+		}
+		if val { // both voted, vote of fromID dropped with its score
+			c.Score--
+		} else {
+			c.Score++
+		}
+	}
+
+	from, to := -1, -1
+	for i := range s.meta.Users {
+		switch {
+		case s.meta.Users[i].IP:
+		case s.meta.Users[i].ID == fromID:
+			from = i
+		case s.meta.Users[i].ID == toID:
+			to = i
+		}
+	}
+	if from < 0 {
+		return
+	}
+	if to < 0 {
+		s.meta.Users[from].ID = toID
+		return
+	}
+	fm, tm := s.meta.Users[from], &s.meta.Users[to]
+	tm.Verified = tm.Verified || fm.Verified
+	tm.ShadowBanned = tm.ShadowBanned || fm.ShadowBanned
+	if fm.Blocked.Status && (!tm.Blocked.Status || fm.Blocked.Until.After(tm.Blocked.Until)) {
+		tm.Blocked = fm.Blocked
+	}
+	s.meta.Users = append(s.meta.Users[:from], s.meta.Users[from+1:]...)
+}
+
+// put adds the comment or replaces existing one with the same id
+func (s *siteState) put(c store.Comment) {
+	if i, ok := s.index[c.ID]; ok {
+		s.comments[i] = c
+		return
+	}
+	s.index[c.ID] = len(s.comments)
+	s.comments = append(s.comments, c)
+}
+
+// delete sets deleted state of i-th comment, deletion time kept from the first deletion
+func (s *siteState) delete(i int, mode store.DeleteMode, ts time.Time) {
+	c := &s.comments[i]
+	if c.DeletedAt == nil {
+		c.DeletedAt = &ts
+	}
+	c.SetDeleted(mode)
+}
@@ -0,0 +1,173 @@
+package migrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/service"
+)
+
+func TestPointInTime_Restore(t *testing.T) {
+	loc := "/tmp/remark-backups.test"
+	defer os.RemoveAll(loc)
+	assert.NoError(t, os.MkdirAll(loc, 0700))
+
+	crypter, err := store.NewCrypter("secret")
+	require.NoError(t, err)
+	bk := AutoBackup{BackupLocation: loc, SiteID: "site1", Crypter: crypter}
+
+	t0 := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	locator := store.Locator{SiteID: "site1", URL: "https://example.com/post"}
+	c1 := store.Comment{ID: "id1", Text: "c1", Locator: locator, User: store.User{ID: "u1", Name: "user1"}}
+	c2 := store.Comment{ID: "id2", Text: "c2", Locator: locator, User: store.User{ID: "u2", Name: "user2"}}
+	err = bk.writeFile(loc+"/backup-site1-"+t0.Format("20060102")+".gz", true, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		assert.NoError(t, enc.Encode(meta{Version: nativeVersion, Created: t0}))
+		assert.NoError(t, enc.Encode(c1))
+		return enc.Encode(c2)
+	})
+	require.NoError(t, err)
+
+	c1old, c1edited, c1deleted := c1, c1, c1
+	c1old.Text = "old"
+	c1edited.Text = "c1 edited"
+	c1deleted.SetDeleted(store.SoftDelete)
+	c3 := store.Comment{ID: "id3", Text: "c3", Locator: locator, User: store.User{ID: "u1", Name: "user1"}}
+	changes := []store.Change{
+		{Seq: 1, Type: store.ChangeEdit, Timestamp: t0.Add(-time.Hour), Comment: &c1old}, // before backup
+		{Seq: 2, Type: store.ChangeEdit, Timestamp: t0.Add(10 * time.Minute), Comment: &c1edited},
+		{Seq: 3, Type: store.ChangeCreate, Timestamp: t0.Add(20 * time.Minute), Comment: &c3},
+		{Seq: 4, Type: store.ChangeBlock, Timestamp: t0.Add(30 * time.Minute), UserID: "u2", Status: true,
+			Until: time.Now().Add(time.Hour)},
+		{Seq: 5, Type: store.ChangeReadOnly, Timestamp: t0.Add(40 * time.Minute), Locator: locator, Status: true},
+		{Seq: 6, Type: store.ChangeDelete, Timestamp: t0.Add(50 * time.Minute), UserID: "u2"},
+		{Seq: 7, Type: store.ChangeDelete, Timestamp: t0.Add(60 * time.Minute), CommentID: "id1", Comment: &c1deleted},
+	}
+	for i, f := range []string{"changes-site1-20000101000000.gz", "changes-site1-20000101000001.gz"} {
+		part := changes[:5]
+		if i == 1 {
+			part = changes[4:] // overlaps with the previous file
+		}
+		err = bk.writeFile(loc+"/"+f, true, func(w io.Writer) error {
+			for _, c := range part {
+				c.SiteID = "site1"
+				assert.NoError(t, json.NewEncoder(w).Encode(c))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	restore := func(ts time.Time) (*siteState, int) {
+		buf := bytes.Buffer{}
+		pit := PointInTime{BackupLocation: loc, SiteID: "site1", Crypter: crypter}
+		_, replayed, e := pit.Restore(&buf, ts)
+		require.NoError(t, e)
+		state := &siteState{index: map[string]int{}}
+		require.NoError(t, state.load(&buf))
+		assert.True(t, ts.Equal(state.meta.Created))
+		return state, replayed
+	}
+
+	state, replayed := restore(t0.Add(45 * time.Minute))
+	assert.Equal(t, 4, replayed)
+	require.Equal(t, 3, len(state.comments))
+	assert.Equal(t, "c1 edited", state.comments[0].Text)
+	assert.Equal(t, "c2", state.comments[1].Text)
+	assert.False(t, state.comments[1].Deleted)
+	assert.Equal(t, "c3", state.comments[2].Text)
+	require.Equal(t, 1, len(state.meta.Users))
+	assert.Equal(t, "u2", state.meta.Users[0].ID)
+	assert.True(t, state.meta.Users[0].Blocked.Status)
+	require.Equal(t, 1, len(state.meta.Posts))
+	assert.True(t, state.meta.Posts[0].ReadOnly)
+
+	state, replayed = restore(t0.Add(2 * time.Hour))
+	assert.Equal(t, 6, replayed)
+	require.Equal(t, 3, len(state.comments))
+	assert.True(t, state.comments[0].Deleted)
+	assert.Equal(t, "", state.comments[0].Text)
+	assert.True(t, state.comments[1].Deleted)
+	assert.Equal(t, "deleted", state.comments[1].User.ID)
+	assert.False(t, state.comments[2].Deleted)
+
+	state, replayed = restore(t0)
+	assert.Equal(t, 0, replayed)
+	assert.Equal(t, 2, len(state.comments))
+
+	pit := PointInTime{BackupLocation: loc, SiteID: "site1", Crypter: crypter}
+	_, _, err = pit.Restore(&bytes.Buffer{}, t0.Add(-time.Minute))
+	assert.EqualError(t, err, "no backup of site1 made before "+t0.Add(-time.Minute).Format(time.RFC3339))
+
+	pit.Crypter = nil
+	_, _, err = pit.Restore(&bytes.Buffer{}, t0.Add(time.Hour))
+	assert.Error(t, err, "encrypted, no secret")
+}
+
+func TestSiteState_ApplyUserChanges(t *testing.T) {
+	t0 := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	locator := store.Locator{SiteID: "site1", URL: "https://example.com/post"}
+	state := &siteState{index: map[string]int{}}
+	state.put(store.Comment{ID: "id1", Locator: locator, Timestamp: t0, User: store.User{ID: "u1", Name: "user1", IP: "ip1"}})
+	state.put(store.Comment{ID: "id2", Locator: locator, Timestamp: t0.Add(time.Hour), Score: 2,
+		Votes: map[string]bool{"u1": true, "u3": true}, User: store.User{ID: "u2", Name: "user2", IP: "ip2"}})
+	state.put(store.Comment{ID: "id3", Locator: locator, Timestamp: t0.Add(time.Hour), User: store.User{ID: "u3", IP: "ip3"}})
+	state.meta.Users = []service.UserMetaData{{ID: "u1", Verified: true}}
+
+	state.apply(store.Change{Type: store.ChangeMerge, UserID: "u1", TargetID: "u3"})
+	assert.Equal(t, "u3", state.comments[0].User.ID)
+	assert.Equal(t, map[string]bool{"u3": true}, state.comments[1].Votes)
+	assert.Equal(t, 1, state.comments[1].Score, "both voted, vote of merged user dropped")
+	require.Equal(t, 1, len(state.meta.Users))
+	assert.Equal(t, "u3", state.meta.Users[0].ID)
+	assert.True(t, state.meta.Users[0].Verified)
+
+	state.apply(store.Change{Type: store.ChangeProfile, UserID: "u3", Profile: &store.Profile{ID: "u3", Name: "new name"}})
+	assert.Equal(t, "new name", state.comments[0].User.Name)
+	assert.Equal(t, "new name", state.comments[2].User.Name)
+	assert.Equal(t, "user2", state.comments[1].User.Name)
+
+	state.apply(store.Change{Type: store.ChangeClearIPs, Until: t0.Add(time.Minute)})
+	assert.Equal(t, "", state.comments[0].User.IP)
+	assert.Equal(t, "ip2", state.comments[1].User.IP, "made after until")
+	state.apply(store.Change{Type: store.ChangeClearIPs, UserID: "u3", Until: t0.Add(2 * time.Hour)})
+	assert.Equal(t, "ip2", state.comments[1].User.IP, "another user")
+	assert.Equal(t, "", state.comments[2].User.IP)
+
+	state.apply(store.Change{Type: store.ChangeVerified, UserID: "u2", Status: true})
+	state.apply(store.Change{Type: store.ChangeShadow, UserID: "u2", Status: true})
+	state.apply(store.Change{Type: store.ChangeTrust, UserID: "u2", Trust: &store.UserTrust{Level: store.TrustRegular, Manual: true}})
+	state.apply(store.Change{Type: store.ChangeBlockIP, UserID: "u2", Status: true, Until: t0.Add(time.Hour)})
+	state.apply(store.Change{Type: store.ChangeVerified, UserID: "u3", Status: false})
+	require.Equal(t, 3, len(state.meta.Users))
+	assert.False(t, state.meta.Users[0].Verified, "verified status cleared")
+	um := state.meta.Users[1]
+	assert.Equal(t, "u2", um.ID)
+	assert.True(t, um.Verified)
+	assert.True(t, um.ShadowBanned)
+	assert.Equal(t, store.TrustRegular, um.Trust.Level)
+	assert.False(t, um.Blocked.Status, "ip with the same id blocked")
+	assert.True(t, state.meta.Users[2].IP)
+	assert.True(t, state.meta.Users[2].Blocked.Status)
+
+	state.apply(store.Change{Type: store.ChangeTrust, UserID: "u2", Trust: &store.UserTrust{}})
+	assert.Nil(t, state.meta.Users[1].Trust, "reset by admin")
+	state.apply(store.Change{Type: store.ChangeDelete, UserID: "u2"})
+	assert.False(t, state.meta.Users[1].Verified, "cleared with deleted user")
+	assert.False(t, state.meta.Users[1].ShadowBanned)
+
+	size := 100
+	state.apply(store.Change{Type: store.ChangeSettings, Settings: &store.SiteSettings{MaxCommentSize: &size}})
+	assert.Equal(t, 100, *state.meta.Settings.MaxCommentSize)
+	state.apply(store.Change{Type: store.ChangeRules})
+	assert.NotNil(t, state.meta.Restricted, "empty rules replace current ones")
+	assert.Equal(t, 0, len(state.meta.Restricted))
+}
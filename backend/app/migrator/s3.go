@@ -0,0 +1,267 @@
+package migrator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5" // nolint
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3Sink implements BackupSink with s3-compatible storage, i.e. aws s3 or minio.
+// Requests signed with aws signature v4, path-style urls used to support self-hosted services.
+// Uploaded with Content-MD5 verified by the storage and sha256 kept in object's metadata, checked on Get.
+type S3Sink struct {
+	Endpoint  string // like https://s3.amazonaws.com or http://minio:9000
+	Region    string
+	Bucket    string
+	Prefix    string // path prefix of objects in the bucket
+	AccessKey string
+	SecretKey string
+	Client    http.Client
+}
+
+const (
+	s3Service       = "s3"
+	s3DefaultRegion = "us-east-1"
+	s3ChecksumMeta  = "X-Amz-Meta-Sha256"
+	emptySHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Put uploads file with checksums
+func (s *S3Sink) Put(name string, r io.ReadSeeker) error {
+	sha, md := sha256.New(), md5.New() // nolint
+	if _, err := io.Copy(io.MultiWriter(sha, md), r); err != nil {
+		return errors.Wrapf(err, "can't read %s", name)
+	}
+	size, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrapf(err, "can't get size of %s", name)
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "can't rewind %s", name)
+	}
+	checksum := hex.EncodeToString(sha.Sum(nil))
+
+	req, err := s.request(http.MethodPut, s.Prefix+name, nil, ioutil.NopCloser(r), checksum, map[string]string{
+		"Content-MD5":  base64.StdEncoding.EncodeToString(md.Sum(nil)),
+		"Content-Type": "application/octet-stream",
+		s3ChecksumMeta: checksum,
+	})
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := s.do(req)
+	if err != nil {
+		return errors.Wrapf(err, "can't upload %s", name)
+	}
+	return resp.Body.Close()
+}
+
+// List returns backups and change log backups of the site sorted by name
+func (s *S3Sink) List(siteID string) ([]RemoteFile, error) {
+	res := []RemoteFile{}
+	for _, prefix := range []string{"backup-" + siteID + "-", "changes-" + siteID + "-"} {
+		files, err := s.list(s.Prefix + prefix)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, files...)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// Get downloads file to w, fails if content doesn't match checksum set on upload
+func (s *S3Sink) Get(name string, w io.Writer) error {
+	req, err := s.request(http.MethodGet, s.Prefix+name, nil, nil, emptySHA256, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return errors.Wrapf(err, "can't download %s", name)
+	}
+	defer resp.Body.Close() // nolint
+
+	sha := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(w, sha), resp.Body); err != nil {
+		return errors.Wrapf(err, "can't download %s", name)
+	}
+	if expected := resp.Header.Get(s3ChecksumMeta); expected != "" && expected != hex.EncodeToString(sha.Sum(nil)) {
+		return errors.Errorf("checksum mismatch for %s", name)
+	}
+	return nil
+}
+
+// Remove deletes file
+func (s *S3Sink) Remove(name string) error {
+	req, err := s.request(http.MethodDelete, s.Prefix+name, nil, nil, emptySHA256, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return errors.Wrapf(err, "can't remove %s", name)
+	}
+	return resp.Body.Close()
+}
+
+// list returns all objects with the prefix, following continuation of truncated results
+func (s *S3Sink) list(prefix string) (res []RemoteFile, err error) {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.request(http.MethodGet, "", query, nil, emptySHA256, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't list %s", prefix)
+		}
+		result := struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't decode list of %s", prefix)
+		}
+		for _, c := range result.Contents {
+			res = append(res, RemoteFile{Name: strings.TrimPrefix(c.Key, s.Prefix), Size: c.Size, Modified: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return res, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends request, non-2xx response converted to error with code and message from s3
+func (s *S3Sink) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close() // nolint
+	s3err := struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}{}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if xml.Unmarshal(body, &s3err) != nil || s3err.Code == "" {
+		return nil, errors.Errorf("s3 status %d", resp.StatusCode)
+	}
+	return nil, errors.Errorf("s3 status %d, %s: %s", resp.StatusCode, s3err.Code, s3err.Message)
+}
+
+// request makes signed request for the key in the bucket, bucket itself with empty key
+func (s *S3Sink) request(method, key string, query url.Values, body io.ReadCloser, payloadHash string,
+	headers map[string]string) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "bad s3 endpoint %s", s.Endpoint)
+	}
+	u.Path = "/" + s.Bucket + "/" + key
+	u.RawPath = s3Escape(u.Path)
+	u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't make s3 request for %s", key)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+	return req, nil
+}
+
+// sign adds aws signature v4 to the request
+func (s *S3Sink) sign(req *http.Request, payloadHash string, now time.Time) {
+	region := s.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", now.Format("20060102"), region, s3Service)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// host and all x-amz-* and content-* headers signed
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || strings.HasPrefix(lk, "content-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := bytes.Buffer{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	reqHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(reqHash[:])}, "\n")
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{now.Format("20060102"), region, s3Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// s3Escape encodes path as required by signature v4, all but unreserved characters and slashes
+func s3Escape(path string) string {
+	res := strings.Builder{}
+	for _, b := range []byte(path) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || strings.IndexByte("-_.~/", b) >= 0 {
+			res.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&res, "%%%02X", b)
+	}
+	return res.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,136 @@
+package migrator
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule is cron-like schedule with five fields: minute, hour, day of month, month and day of week.
+// Each field is "*", a number, a range like "1-5", a step like "*/2" or "1-10/3", or a list of them like "1,15".
+// Descriptors @hourly, @daily, @weekly and @monthly supported as well. As in cron, with both day of month and
+// day of week restricted the time matches either of them.
+type Schedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64 // bit sets of allowed values
+	anyDom, anyDow                bool
+}
+
+var scheduleDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseSchedule makes Schedule from cron-like spec, like "30 3 * * *" for every day at 03:30
+func ParseSchedule(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if d, ok := scheduleDescriptors[expr]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("schedule %q should have 5 fields", spec)
+	}
+
+	s := Schedule{spec: spec, anyDom: fields[2] == "*", anyDow: fields[4] == "*"}
+	var err error
+	if s.minute, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return nil, errors.Wrapf(err, "bad minute in schedule %q", spec)
+	}
+	if s.hour, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return nil, errors.Wrapf(err, "bad hour in schedule %q", spec)
+	}
+	if s.dom, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return nil, errors.Wrapf(err, "bad day of month in schedule %q", spec)
+	}
+	if s.month, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return nil, errors.Wrapf(err, "bad month in schedule %q", spec)
+	}
+	if s.dow, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return nil, errors.Wrapf(err, "bad day of week in schedule %q", spec)
+	}
+	if s.dow&(1<<7) != 0 { // 7 is sunday as well as 0
+		s.dow |= 1
+	}
+	if s.Next(time.Now()).IsZero() {
+		return nil, errors.Errorf("schedule %q never fires", spec)
+	}
+	return &s, nil
+}
+
+// Next returns the first time matching schedule after t, zero time if nothing matches within 5 years
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	domOk, dowOk := s.dom&(1<<uint(t.Day())) != 0, s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// parseScheduleField returns bit set of values allowed by the field
+func parseScheduleField(field string, min, max int) (res uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, errors.Errorf("bad step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.Errorf("bad range %q", part)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, errors.Errorf("bad range %q", part)
+			}
+		default:
+			if lo, err = strconv.Atoi(rng); err != nil {
+				return 0, errors.Errorf("bad value %q", part)
+			}
+			if step == 1 {
+				hi = lo // single value, with step it's the start of the range
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+	return res, nil
+}
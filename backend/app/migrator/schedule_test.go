@@ -0,0 +1,67 @@
+package migrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	tbl := []struct {
+		spec string
+		from string
+		next string
+	}{
+		{"30 3 * * *", "2019-05-20 10:00", "2019-05-21 03:30"},
+		{"30 3 * * *", "2019-05-20 03:29", "2019-05-20 03:30"},
+		{"30 3 * * *", "2019-05-20 03:30", "2019-05-21 03:30"},
+		{"*/15 * * * *", "2019-05-20 10:07", "2019-05-20 10:15"},
+		{"0 */6 * * *", "2019-05-20 19:00", "2019-05-21 00:00"},
+		{"0 2 * * 0", "2019-05-20 10:00", "2019-05-26 02:00"}, // sunday
+		{"0 2 * * 7", "2019-05-20 10:00", "2019-05-26 02:00"},
+		{"0 2 * * 1-5", "2019-05-24 10:00", "2019-05-27 02:00"},
+		{"0 0 1 * *", "2019-12-20 10:00", "2020-01-01 00:00"},
+		{"0 0 31 * *", "2019-04-01 00:00", "2019-05-31 00:00"},
+		{"0 0 29 2 *", "2019-03-01 00:00", "2020-02-29 00:00"},
+		{"0 0 13 * 5", "2019-05-20 00:00", "2019-05-24 00:00"}, // friday or 13th
+		{"15,45 1 * * *", "2019-05-20 01:20", "2019-05-20 01:45"},
+		{"5-59/20 * * * *", "2019-05-20 01:50", "2019-05-20 02:05"},
+		{"@daily", "2019-05-20 10:00", "2019-05-21 00:00"},
+		{"@weekly", "2019-05-20 10:00", "2019-05-26 00:00"},
+		{"@monthly", "2019-05-20 10:00", "2019-06-01 00:00"},
+		{"@hourly", "2019-05-20 10:00", "2019-05-20 11:00"},
+	}
+
+	for i, tt := range tbl {
+		s, err := ParseSchedule(tt.spec)
+		require.NoError(t, err, "#%d", i)
+		from, err := time.ParseInLocation("2006-01-02 15:04", tt.from, time.Local)
+		require.NoError(t, err)
+		assert.Equal(t, tt.next, s.Next(from).Format("2006-01-02 15:04"), "#%d %s", i, tt.spec)
+	}
+}
+
+func TestSchedule_Parse(t *testing.T) {
+	tbl := []struct {
+		spec string
+		err  string
+	}{
+		{"0 3 * *", `schedule "0 3 * *" should have 5 fields`},
+		{"60 3 * * *", `bad minute in schedule "60 3 * * *": "60" out of range 0-59`},
+		{"0 24 * * *", `bad hour in schedule "0 24 * * *": "24" out of range 0-23`},
+		{"0 3 0 * *", `bad day of month in schedule "0 3 0 * *": "0" out of range 1-31`},
+		{"0 3 * 13 *", `bad month in schedule "0 3 * 13 *": "13" out of range 1-12`},
+		{"0 3 * * 8", `bad day of week in schedule "0 3 * * 8": "8" out of range 0-7`},
+		{"0 3 * * 5-1", `bad day of week in schedule "0 3 * * 5-1": "5-1" out of range 0-7`},
+		{"*/0 3 * * *", `bad minute in schedule "*/0 3 * * *": bad step in "*/0"`},
+		{"a 3 * * *", `bad minute in schedule "a 3 * * *": bad value "a"`},
+		{"0 3 30 2 *", `schedule "0 3 30 2 *" never fires`},
+		{"@yearly", `schedule "@yearly" should have 5 fields`},
+	}
+	for i, tt := range tbl {
+		_, err := ParseSchedule(tt.spec)
+		assert.EqualError(t, err, tt.err, "#%d", i)
+	}
+}
@@ -0,0 +1,151 @@
+package migrator
+
+import (
+	"io"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// Validator defines interface to check import file without writing anything to the store
+type Validator interface {
+	Validate(r io.Reader, siteID string) (ValidationReport, error)
+}
+
+// ValidationReport describes content of import file and problems found in it
+type ValidationReport struct {
+	Posts       int             `json:"posts"`
+	Comments    int             `json:"comments"`
+	Failed      int             `json:"failed"`     // records can't be decoded
+	Orphans     ValidationIssue `json:"orphans"`    // parent comment missing in the file
+	Duplicates  ValidationIssue `json:"duplicates"` // comment id used more than once
+	InvalidTime ValidationIssue `json:"invalid_timestamps"`
+	NoUserID    ValidationIssue `json:"no_user_id"`
+	NoURL       ValidationIssue `json:"no_url"`    // post of the comment unknown
+	Oversized   ValidationIssue `json:"oversized"` // text longer than max comment size of the site
+	Sample      []store.Comment `json:"sample"`    // first converted comments, as they would be stored
+}
+
+// ValidationIssue counts comments with the problem and lists ids of the first of them
+type ValidationIssue struct {
+	Count int      `json:"count"`
+	IDs   []string `json:"ids,omitempty"`
+}
+
+const (
+	validationSampleSize = 5
+	validationMaxIDs     = 100
+)
+
+// Issues returns total number of problems found
+func (r ValidationReport) Issues() int {
+	return r.Failed + r.Orphans.Count + r.Duplicates.Count + r.InvalidTime.Count + r.NoUserID.Count + r.NoURL.Count +
+		r.Oversized.Count
+}
+
+// convertStats reports problems of xml conversion not visible in converted comments.
+// Filled by the time channel of comments closed.
+type convertStats struct {
+	failed   int      // threads, posts or items can't be decoded
+	noUserID []string // ids of comments without user id in the source, the id made from user name
+	err      error    // broken xml, conversion stopped on it
+}
+
+func (i *ValidationIssue) add(id string) {
+	i.Count++
+	if len(i.IDs) < validationMaxIDs {
+		i.IDs = append(i.IDs, id)
+	}
+}
+
+// validator collects report for converted comments, not thread safe
+type validator struct {
+	dataStore Store
+	maxSize   int // max comment size in runes, not checked if 0
+	now       time.Time
+
+	report  ValidationReport
+	ids     map[string]bool
+	posts   map[string]bool
+	replies [][2]string // comment id and parent id, checked after all comments seen
+}
+
+func newValidator(dataStore Store, siteID string) *validator {
+	v := &validator{dataStore: dataStore, now: time.Now(), ids: map[string]bool{}, posts: map[string]bool{},
+		report: ValidationReport{Sample: []store.Comment{}}}
+	if dataStore != nil {
+		v.maxSize = dataStore.SiteConfig(siteID).MaxCommentSize
+	}
+	return v
+}
+
+func (v *validator) add(c store.Comment) {
+	v.report.Comments++
+	if c.Locator.URL == "" {
+		v.report.NoURL.add(c.ID)
+	} else {
+		v.posts[c.Locator.URL] = true
+	}
+
+	if v.ids[c.ID] {
+		v.report.Duplicates.add(c.ID)
+	}
+	v.ids[c.ID] = true
+	if c.ParentID != "" {
+		v.replies = append(v.replies, [2]string{c.ID, c.ParentID})
+	}
+	if c.Timestamp.IsZero() || c.Timestamp.After(v.now) {
+		v.report.InvalidTime.add(c.ID)
+	}
+	if c.User.ID == "" {
+		v.report.NoUserID.add(c.ID)
+	}
+	text := c.Orig
+	if text == "" { // disqus and wordpress imports have no original text
+		text = c.Text
+	}
+	if v.maxSize > 0 && len([]rune(text)) > v.maxSize {
+		v.report.Oversized.add(c.ID)
+	}
+
+	if len(v.report.Sample) < validationSampleSize {
+		v.report.Sample = append(v.report.Sample, v.sample(c))
+	}
+}
+
+// sample returns comment as it would be stored, ip dropped if can't be hashed
+func (v *validator) sample(c store.Comment) store.Comment {
+	if v.dataStore != nil {
+		prepared, err := v.dataStore.PrepareImport(c)
+		if err == nil {
+			return prepared
+		}
+		log.Printf("[WARN] can't prepare sample comment %s, %v", c.ID, err)
+	}
+	c.Sanitize()
+	c.User.IP = ""
+	return c
+}
+
+// addConverted adds problems of xml conversion to the report
+func (v *validator) addConverted(stats *convertStats) {
+	v.report.Failed += stats.failed
+	for _, id := range stats.noUserID {
+		v.report.NoUserID.add(id)
+	}
+}
+
+// result completes report with orphaned comments
+func (v *validator) result(siteID string) ValidationReport {
+	for _, r := range v.replies {
+		if !v.ids[r[1]] {
+			v.report.Orphans.add(r[0])
+		}
+	}
+	v.report.Posts = len(v.posts)
+	log.Printf("[INFO] validated import for site %s, %d posts, %d comments, %d issues", siteID, v.report.Posts,
+		v.report.Comments, v.report.Issues())
+	return v.report
+}
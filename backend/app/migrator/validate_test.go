@@ -0,0 +1,93 @@
+package migrator
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+	"github.com/umputun/remark/backend/app/store/engine"
+	"github.com/umputun/remark/backend/app/store/service"
+)
+
+func TestNative_Validate(t *testing.T) {
+	defer os.Remove(testDb)
+	b := prep(t)
+	b.MaxCommentSize = 20
+
+	inp := `{"version":1,"users":[],"posts":[]}
+	{"id":"c1","pid":"","text":"some text","user":{"name":"user name","id":"user1"},"locator":{"site":"radio-t","url":"https://radio-t.com"},"time":"2017-12-20T15:18:22-06:00"}
+	{"id":"c2","pid":"c1","text":"reply","user":{"name":"user name","id":""},"locator":{"site":"radio-t","url":"https://radio-t.com"},"time":"2017-12-20T15:18:23-06:00"}
+	{"id":"c3","pid":"c0","text":"reply to missing comment","user":{"name":"user name","id":"user2"},"locator":{"site":"radio-t","url":"https://radio-t.com/2"},"time":"2017-12-20T15:18:24-06:00"}
+	{"id":"c1","pid":"","text":"dup","user":{"name":"user name","id":"user1"},"locator":{"site":"radio-t","url":"https://radio-t.com/2"}}
+	{"id":"c4","score":"bad"}`
+
+	r := Native{DataStore: b}
+	report, err := r.Validate(strings.NewReader(inp), "radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Posts)
+	assert.Equal(t, 4, report.Comments)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, ValidationIssue{Count: 1, IDs: []string{"c3"}}, report.Orphans)
+	assert.Equal(t, ValidationIssue{Count: 1, IDs: []string{"c1"}}, report.Duplicates)
+	assert.Equal(t, ValidationIssue{Count: 1, IDs: []string{"c1"}}, report.InvalidTime)
+	assert.Equal(t, ValidationIssue{Count: 1, IDs: []string{"c2"}}, report.NoUserID)
+	assert.Equal(t, ValidationIssue{Count: 1, IDs: []string{"c3"}}, report.Oversized)
+	assert.Equal(t, 6, report.Issues())
+	require.Equal(t, 4, len(report.Sample))
+	assert.Equal(t, "reply", report.Sample[1].Text)
+
+	comments, err := b.Last("radio-t", 10, time.Time{}, adminUser)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments), "nothing written")
+
+	_, err = r.Validate(strings.NewReader(`{"version":2}`), "radio-t")
+	assert.EqualError(t, err, "unexpected import file version 2")
+}
+
+func TestDisqus_Validate(t *testing.T) {
+	defer os.Remove("/tmp/remark-test.db")
+	b, err := engine.NewBoltDB(bolt.Options{}, engine.BoltSite{FileName: "/tmp/remark-test.db", SiteID: "test"})
+	require.NoError(t, err)
+	dataStore := service.DataStore{Interface: b, AdminStore: admin.NewStaticStore("12345", []string{}, "")}
+	d := Disqus{DataStore: &dataStore}
+	report, err := d.Validate(strings.NewReader(xmlTestDisqus), "test")
+	assert.EqualError(t, err, "broken disqus xml: XML syntax error on line 148: unquoted or missing attribute value in element")
+	assert.Equal(t, 2, report.Posts)
+	assert.Equal(t, 4, report.Comments)
+	assert.Equal(t, 1, report.Failed, "the last post broken")
+	assert.Equal(t, 1, report.Issues())
+	require.Equal(t, 4, len(report.Sample))
+	assert.Equal(t, store.HashValue("178.178.178.178", "12345"), report.Sample[0].User.IP, "ip hashed as stored")
+
+	count, err := dataStore.Count(report.Sample[0].Locator)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "nothing written")
+}
+
+func TestWordPress_Validate(t *testing.T) {
+	wp := WordPress{}
+	report, err := wp.Validate(strings.NewReader(xmlTestWP), "testWP")
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Posts)
+	assert.Equal(t, 3, report.Comments)
+	assert.Equal(t, 0, report.Issues())
+
+	inp := strings.Replace(xmlTestDisqus, "<username>mikhail-noname</username>", "<username></username>", 1)
+	inp = strings.Replace(inp, "<thread dsq:id=\"247918464\"/>", "<thread dsq:id=\"1\"/>", 1)
+	d := Disqus{}
+	report, err = d.Validate(strings.NewReader(inp), "test")
+	require.Error(t, err)
+	assert.Equal(t, 1, report.NoUserID.Count, "empty disqus username")
+	assert.Equal(t, 1, report.NoURL.Count, "unknown thread")
+	assert.Equal(t, "", report.Sample[0].User.IP, "ip dropped without store")
+
+	_, err = wp.Validate(strings.NewReader(xmlTestWP[:len(xmlTestWP)/2]), "testWP")
+	assert.Error(t, err, "truncated xml")
+}
@@ -65,10 +65,10 @@ func (w *WordPress) Import(r io.Reader, siteID string) (size int, err error) {
 		return 0, err
 	}
 
-	commentsCh := w.convert(r, siteID)
+	commentsCh, _ := w.convert(r, siteID)
 	failed, passed := 0, 0
 	for c := range commentsCh {
-		if _, err = w.DataStore.Create(c); err != nil {
+		if _, err = w.DataStore.Import(c); err != nil {
 			failed++
 			continue
 		}
@@ -87,10 +87,38 @@ func (w *WordPress) Import(r io.Reader, siteID string) (size int, err error) {
 	return passed, err
 }
 
-func (w *WordPress) convert(r io.Reader, siteID string) chan store.Comment {
+// Merge comments from WP, keeping existing comments of the site. Text of comments imported before updated,
+// votes and other state made on this site kept.
+func (w *WordPress) Merge(r io.Reader, siteID string) (ImportStats, error) {
+	mrg := &merger{dataStore: w.DataStore}
+	commentsCh, _ := w.convert(r, siteID)
+	for c := range commentsCh {
+		mrg.put(c)
+	}
+	return mrg.result(siteID)
+}
+
+// Validate converts wordpress xml from reader and reports problems found, nothing written to the store
+func (w *WordPress) Validate(r io.Reader, siteID string) (ValidationReport, error) {
+	v := newValidator(w.DataStore, siteID)
+	commentsCh, convStats := w.convert(r, siteID)
+	for c := range commentsCh {
+		v.add(c)
+	}
+	v.addConverted(convStats)
+	if convStats.err != nil {
+		return v.result(siteID), errors.Wrap(convStats.err, "broken wordpress xml")
+	}
+	return v.result(siteID), nil
+}
+
+// convert wordpress xml from reader and fill channel of comments.
+// runs async and closes channel on completion, convStats filled by this time.
+func (w *WordPress) convert(r io.Reader, siteID string) (ch chan store.Comment, convStats *convertStats) {
 
 	decoder := xml.NewDecoder(r)
 	commentsCh := make(chan store.Comment)
+	convStats = &convertStats{}
 
 	stats := struct {
 		inpItems, failedItems       int
@@ -104,6 +132,9 @@ func (w *WordPress) convert(r io.Reader, siteID string) chan store.Comment {
 		for {
 			t, err := decoder.Token()
 			if t == nil || err != nil {
+				if err != nil && err != io.EOF {
+					convStats.err = err
+				}
 				break
 			}
 
@@ -140,6 +171,9 @@ func (w *WordPress) convert(r io.Reader, siteID string) chan store.Comment {
 								Timestamp: comment.Date.time,
 								ParentID:  comment.PID,
 							}
+							if comment.Author == "" {
+								convStats.noUserID = append(convStats.noUserID, c.ID)
+							}
 							commentsCh <- commentFormatter.Format(c)
 							stats.inpComments++
 							if stats.inpComments%1000 == 0 {
@@ -150,8 +184,9 @@ func (w *WordPress) convert(r io.Reader, siteID string) chan store.Comment {
 				}
 			}
 		}
+		convStats.failed = stats.failedItems + stats.failedComments
 		close(commentsCh)
 		log.Printf("[INFO] converted %d comments, %+v", stats.inpComments-stats.failedComments, stats)
 	}()
-	return commentsCh
+	return commentsCh, convStats
 }
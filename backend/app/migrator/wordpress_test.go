@@ -55,7 +55,7 @@ func TestWordPress_Import(t *testing.T) {
 
 func TestWordPress_Convert(t *testing.T) {
 	wp := WordPress{}
-	ch := wp.convert(strings.NewReader(xmlTestWP), "testWP")
+	ch, _ := wp.convert(strings.NewReader(xmlTestWP), "testWP")
 
 	comments := []store.Comment{}
 	for c := range ch {
@@ -82,7 +82,7 @@ func TestWordPress_Convert(t *testing.T) {
 
 func TestWP_Convert_MD(t *testing.T) {
 	wp := WordPress{}
-	ch := wp.convert(strings.NewReader(xmlTestWPmd), "siteID")
+	ch, _ := wp.convert(strings.NewReader(xmlTestWPmd), "siteID")
 
 	comments := []store.Comment{}
 	for c := range ch {
@@ -8,6 +8,7 @@ import (
 	"sync/atomic"
 
 	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
 
 	"github.com/umputun/remark/backend/app/store"
 )
@@ -16,6 +17,7 @@ import (
 type Service struct {
 	dataService  Store
 	destinations []Destination
+	destLock     sync.RWMutex
 	queue        chan request
 
 	closed uint32 // non-zero means closed. uses uint instead of bool for atomic
@@ -35,8 +37,11 @@ type Store interface {
 }
 
 type request struct {
-	comment store.Comment
-	parent  store.Comment
+	comment    store.Comment
+	parent     store.Comment
+	moderation *store.ModerationRecord // set for auto-moderation sanction instead of comment
+	deletion   *store.DeletionRequest  // set for user's data deletion request instead of comment
+	backup     *store.BackupFailure    // set for failed backup instead of comment
 }
 
 const defaultQueueSize = 100
@@ -64,7 +69,7 @@ func NewService(dataService Store, size int, destinations ...Destination) *Servi
 
 // Submit comment to internal channel if not busy, drop if can't send
 func (s *Service) Submit(comment store.Comment) {
-	if len(s.destinations) == 0 || atomic.LoadUint32(&s.closed) != 0 {
+	if len(s.getDestinations()) == 0 || atomic.LoadUint32(&s.closed) != 0 {
 		return
 	}
 	parentComment := store.Comment{}
@@ -80,6 +85,42 @@ func (s *Service) Submit(comment store.Comment) {
 	}
 }
 
+// SubmitModeration sends auto-moderation sanction to internal channel if not busy, drop if can't send
+func (s *Service) SubmitModeration(rec store.ModerationRecord) {
+	if len(s.getDestinations()) == 0 || atomic.LoadUint32(&s.closed) != 0 {
+		return
+	}
+	select {
+	case s.queue <- request{moderation: &rec}:
+	default:
+		log.Printf("[WARN] can't send moderation notification to queue, %+v", rec)
+	}
+}
+
+// SubmitDeletion sends status of user's data deletion request to internal channel if not busy, drop if can't send
+func (s *Service) SubmitDeletion(req store.DeletionRequest) {
+	if len(s.getDestinations()) == 0 || atomic.LoadUint32(&s.closed) != 0 {
+		return
+	}
+	select {
+	case s.queue <- request{deletion: &req}:
+	default:
+		log.Printf("[WARN] can't send deletion notification to queue, %+v", req)
+	}
+}
+
+// SubmitBackupFailure sends failed backup to internal channel if not busy, drop if can't send
+func (s *Service) SubmitBackupFailure(f store.BackupFailure) {
+	if len(s.getDestinations()) == 0 || atomic.LoadUint32(&s.closed) != 0 {
+		return
+	}
+	select {
+	case s.queue <- request{backup: &f}:
+	default:
+		log.Printf("[WARN] can't send backup failure notification to queue, %+v", f)
+	}
+}
+
 // Close queue channel and wait for completion
 func (s *Service) Close() {
 	if s.queue != nil {
@@ -93,9 +134,10 @@ func (s *Service) Close() {
 
 func (s *Service) do() {
 	for c := range s.queue {
+		destinations := s.getDestinations()
 		var wg sync.WaitGroup
-		wg.Add(len(s.destinations))
-		for _, dest := range s.destinations {
+		wg.Add(len(destinations))
+		for _, dest := range destinations {
 			go func(d Destination) {
 				if err := d.Send(s.ctx, c); err != nil {
 					log.Printf("[WARN] failed to send to %s, %s", d, err)
@@ -108,5 +150,24 @@ func (s *Service) do() {
 	log.Print("[WARN] terminated notifier")
 }
 
+// SetDestinations replaces destinations of running service. Works for services created with destinations only,
+// as delivery is not started for services made without any
+func (s *Service) SetDestinations(destinations ...Destination) error {
+	s.destLock.Lock()
+	defer s.destLock.Unlock()
+	if len(s.destinations) == 0 {
+		return errors.New("notifier started without destinations")
+	}
+	s.destinations = destinations
+	log.Printf("[INFO] notifier destinations updated, destinations=%d", len(destinations))
+	return nil
+}
+
+func (s *Service) getDestinations() []Destination {
+	s.destLock.RLock()
+	defer s.destLock.RUnlock()
+	return s.destinations
+}
+
 // NopService is do-nothing notifier, without destinations
 var NopService = &Service{}
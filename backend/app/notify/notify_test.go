@@ -12,6 +12,7 @@ import (
 
 	log "github.com/go-pkgz/lgr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/remark/backend/app/store"
 )
@@ -46,6 +47,25 @@ func TestService_WithDestinations(t *testing.T) {
 	assert.Equal(t, "102", d1.get()[2].comment.ID)
 }
 
+func TestService_SetDestinations(t *testing.T) {
+	d1, d2 := &mockDest{id: 1}, &mockDest{id: 2}
+	s := NewService(nil, 1, d1)
+
+	s.Submit(store.Comment{ID: "100"})
+	time.Sleep(time.Millisecond * 110)
+	assert.NoError(t, s.SetDestinations(d2))
+	s.Submit(store.Comment{ID: "101"})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+
+	assert.Equal(t, 1, len(d1.get()))
+	assert.Equal(t, "100", d1.get()[0].comment.ID)
+	assert.Equal(t, 1, len(d2.get()))
+	assert.Equal(t, "101", d2.get()[0].comment.ID)
+
+	assert.EqualError(t, NewService(nil, 1).SetDestinations(d1), "notifier started without destinations")
+}
+
 func TestService_WithDrops(t *testing.T) {
 	d1, d2 := &mockDest{id: 1}, &mockDest{id: 2}
 	s := NewService(nil, 1, d1, d2)
@@ -107,6 +127,56 @@ func TestService_WithParent(t *testing.T) {
 	assert.Equal(t, "", destRes[1].parent.ID)
 }
 
+func TestService_SubmitModeration(t *testing.T) {
+	dest := &mockDest{id: 1}
+	s := NewService(nil, 1, dest)
+	s.SubmitModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModBlock, Rule: "spam"})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+	s.SubmitModeration(store.ModerationRecord{UserID: "user2"})
+
+	destRes := dest.get()
+	require.Equal(t, 1, len(destRes), "one sanction notified")
+	require.NotNil(t, destRes[0].moderation)
+	assert.Equal(t, "spam", destRes[0].moderation.Rule)
+	assert.Equal(t, "user1", destRes[0].moderation.UserID)
+
+	NopService.SubmitModeration(store.ModerationRecord{})
+}
+
+func TestService_SubmitDeletion(t *testing.T) {
+	dest := &mockDest{id: 1}
+	s := NewService(nil, 1, dest)
+	s.SubmitDeletion(store.DeletionRequest{ID: "123", SiteID: "radio-t", UserID: "user1", Status: store.DeletionConfirmed})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+	s.SubmitDeletion(store.DeletionRequest{ID: "456"})
+
+	destRes := dest.get()
+	require.Equal(t, 1, len(destRes), "one request notified")
+	require.NotNil(t, destRes[0].deletion)
+	assert.Equal(t, "123", destRes[0].deletion.ID)
+	assert.Equal(t, store.DeletionConfirmed, destRes[0].deletion.Status)
+
+	NopService.SubmitDeletion(store.DeletionRequest{})
+}
+
+func TestService_SubmitBackupFailure(t *testing.T) {
+	dest := &mockDest{id: 1}
+	s := NewService(nil, 1, dest)
+	s.SubmitBackupFailure(store.BackupFailure{SiteID: "radio-t", File: "backup-radio-t-20190520.gz", Error: "failed"})
+	time.Sleep(time.Millisecond * 110)
+	s.Close()
+	s.SubmitBackupFailure(store.BackupFailure{SiteID: "radio-t"})
+
+	destRes := dest.get()
+	require.Equal(t, 1, len(destRes), "one request notified")
+	require.NotNil(t, destRes[0].backup)
+	assert.Equal(t, "backup-radio-t-20190520.gz", destRes[0].backup.File)
+
+	NopService.SubmitBackupFailure(store.BackupFailure{})
+}
+
 func TestService_Nop(t *testing.T) {
 	s := NopService
 	s.Submit(store.Comment{})
@@ -13,6 +13,8 @@ import (
 	log "github.com/go-pkgz/lgr"
 	"github.com/go-pkgz/repeater"
 	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 // Telegram implements notify.Destination for telegram
@@ -87,22 +89,24 @@ func NewTelegram(token string, channelID string, timeout time.Duration, api stri
 // Send to telegram channel
 func (t *Telegram) Send(ctx context.Context, req request) error {
 	client := http.Client{Timeout: telegramTimeOut}
-	log.Printf("[DEBUG] send telegram notification to %s, comment id %s", t.channelID, req.comment.ID)
-
-	from := req.comment.User.Name
-	if req.comment.ParentID != "" {
-		from += " → " + req.parent.User.Name
-	}
-	from = "*" + from + "*"
-	link := fmt.Sprintf("↦ [original comment](%s)", req.comment.Locator.URL+uiNav+req.comment.ID)
-	if req.comment.PostTitle != "" {
-		link = fmt.Sprintf("↦ [%s](%s)", req.comment.PostTitle, req.comment.Locator.URL+uiNav+req.comment.ID)
-	}
 	u := fmt.Sprintf("%s%s/sendMessage?chat_id=%s&parse_mode=Markdown&disable_web_page_preview=true",
 		t.apiPrefix, t.token, t.channelID)
 
-	msg := fmt.Sprintf("%s\n\n%s\n\n%s", from, req.comment.Orig, link)
-	msg = html.UnescapeString(msg)
+	var msg string
+	switch {
+	case req.moderation != nil:
+		log.Printf("[DEBUG] send telegram notification to %s, sanction %s for %s", t.channelID, req.moderation.Rule, req.moderation.UserID)
+		msg = t.moderationMessage(*req.moderation)
+	case req.deletion != nil:
+		log.Printf("[DEBUG] send telegram notification to %s, deletion request %s", t.channelID, req.deletion.ID)
+		msg = t.deletionMessage(*req.deletion)
+	case req.backup != nil:
+		log.Printf("[DEBUG] send telegram notification to %s, backup of %s failed", t.channelID, req.backup.SiteID)
+		msg = t.backupMessage(*req.backup)
+	default:
+		log.Printf("[DEBUG] send telegram notification to %s, comment id %s", t.channelID, req.comment.ID)
+		msg = t.commentMessage(req)
+	}
 	body := struct {
 		Text string `json:"text"`
 	}{Text: msg}
@@ -143,6 +147,49 @@ func (t *Telegram) Send(ctx context.Context, req request) error {
 	return nil
 }
 
+// commentMessage makes markdown message for new comment
+func (t *Telegram) commentMessage(req request) string {
+	from := req.comment.User.Name
+	if req.comment.ParentID != "" {
+		from += " → " + req.parent.User.Name
+	}
+	from = "*" + from + "*"
+	link := fmt.Sprintf("↦ [original comment](%s)", req.comment.Locator.URL+uiNav+req.comment.ID)
+	if req.comment.PostTitle != "" {
+		link = fmt.Sprintf("↦ [%s](%s)", req.comment.PostTitle, req.comment.Locator.URL+uiNav+req.comment.ID)
+	}
+	return html.UnescapeString(fmt.Sprintf("%s\n\n%s\n\n%s", from, req.comment.Orig, link))
+}
+
+// moderationMessage makes markdown message for auto-moderation sanction
+func (t *Telegram) moderationMessage(rec store.ModerationRecord) string {
+	until := "permanently"
+	if !rec.Until.IsZero() {
+		until = "until " + rec.Until.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("*auto-moderation: %s*\n\nuser %s, site %s, %s %s\n\n%s",
+		rec.Rule, rec.UserID, rec.SiteID, rec.Action, until, rec.Reason)
+}
+
+// deletionMessage makes markdown message for status change of user's data deletion request
+func (t *Telegram) deletionMessage(req store.DeletionRequest) string {
+	msg := fmt.Sprintf("*data deletion %s*\n\nuser %s, site %s, mode %s, request %s",
+		req.Status, req.UserID, req.SiteID, req.Mode, req.ID)
+	if req.Status == store.DeletionConfirmed {
+		msg += "\n\nwaiting for admin's approval"
+	}
+	return msg
+}
+
+// backupMessage makes markdown message for failed backup
+func (t *Telegram) backupMessage(f store.BackupFailure) string {
+	msg := fmt.Sprintf("*backup failed*\n\nsite %s", f.SiteID)
+	if f.File != "" {
+		msg += ", file " + f.File
+	}
+	return msg + "\n\n" + f.Error
+}
+
 func (t *Telegram) String() string {
 	return "telegram: " + t.channelID
 }
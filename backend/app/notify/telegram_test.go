@@ -69,6 +69,10 @@ func TestTelegram_Send(t *testing.T) {
 	err = tb.Send(context.TODO(), request{comment: c, parent: cp})
 	assert.NoError(t, err)
 
+	err = tb.Send(context.TODO(), request{moderation: &store.ModerationRecord{UserID: "user1", Action: store.ModBlock,
+		Rule: "spam", Reason: "3 comments deleted by admins"}})
+	assert.NoError(t, err)
+
 	tb, err = NewTelegram("non-json-resp", "remark_test", 2*time.Second, ts.URL+"/")
 	assert.NotNil(t, err, "should failed")
 	err = tb.Send(context.TODO(), request{comment: c, parent: cp})
@@ -78,6 +82,39 @@ func TestTelegram_Send(t *testing.T) {
 	assert.Equal(t, "telegram: @remark_test", tb.String())
 }
 
+func TestTelegram_ModerationMessage(t *testing.T) {
+	tb := Telegram{}
+	rec := store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModBlock, Rule: "spam",
+		Reason: "3 comments deleted by admins"}
+	assert.Equal(t, "*auto-moderation: spam*\n\nuser user1, site radio-t, block permanently\n\n3 comments deleted by admins",
+		tb.moderationMessage(rec))
+
+	rec.Action, rec.Until = store.ModPremoderate, time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	assert.Equal(t, "*auto-moderation: spam*\n\nuser user1, site radio-t, premoderate until 2019-08-12T15:10:00Z\n\n3 comments deleted by admins",
+		tb.moderationMessage(rec))
+}
+
+func TestTelegram_DeletionMessage(t *testing.T) {
+	tb := Telegram{}
+	req := store.DeletionRequest{ID: "123", SiteID: "radio-t", UserID: "user1", Mode: store.DeletionAnonymize,
+		Status: store.DeletionConfirmed}
+	assert.Equal(t, "*data deletion confirmed*\n\nuser user1, site radio-t, mode anonymize, request 123\n\nwaiting for admin's approval",
+		tb.deletionMessage(req))
+
+	req.Status = store.DeletionExecuted
+	assert.Equal(t, "*data deletion executed*\n\nuser user1, site radio-t, mode anonymize, request 123", tb.deletionMessage(req))
+}
+
+func TestTelegram_BackupMessage(t *testing.T) {
+	tb := Telegram{}
+	f := store.BackupFailure{SiteID: "radio-t", File: "backup-radio-t-20190520.gz", Error: "verification failed"}
+	assert.Equal(t, "*backup failed*\n\nsite radio-t, file backup-radio-t-20190520.gz\n\nverification failed",
+		tb.backupMessage(f))
+
+	f.File = ""
+	assert.Equal(t, "*backup failed*\n\nsite radio-t\n\nverification failed", tb.backupMessage(f))
+}
+
 func mockTelegramServer() *httptest.Server {
 	router := chi.NewRouter()
 	router.Get("/good-token/getMe", func(w http.ResponseWriter, r *http.Request) {
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -15,6 +18,7 @@ import (
 
 	"github.com/umputun/remark/backend/app/rest"
 	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/engine"
 )
 
 // admin provides router for all requests available for admin users only
@@ -28,18 +32,51 @@ type admin struct {
 
 type adminStore interface {
 	Delete(locator store.Locator, commentID string, mode store.DeleteMode) error
+	AdminDelete(locator store.Locator, commentID string, adminID string) error
 	DeleteUser(siteID string, userID string) error
+	MergeUser(siteID, fromID, toID string) error
 	User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error)
+	UserCount(siteID, userID string) (int, error)
 	IsBlocked(siteID string, userID string) bool
-	SetBlock(siteID string, userID string, status bool, ttl time.Duration) error
+	SetBlock(siteID string, userID string, status bool, ttl time.Duration, bi store.BlockInfo) error
 	Blocked(siteID string) ([]store.BlockedUser, error)
+	SetBlockIP(siteID string, ip string, status bool, ttl time.Duration, bi store.BlockInfo) error
+	BlockedIPs(siteID string) ([]store.BlockedUser, error)
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
 	SetTitle(locator store.Locator, commentID string) (comment store.Comment, err error)
 	SetVerified(siteID string, userID string, status bool) error
+	SetShadowBan(siteID string, userID string, status bool) error
+	SetTrustLevel(siteID, userID string, level store.TrustLevel) error
+	ResetTrustLevel(siteID, userID string) (store.TrustLevel, error)
+	ShadowBanned(siteID string) ([]string, error)
 	SetReadOnly(locator store.Locator, status bool) error
 	SetPin(locator store.Locator, commentID string, status bool) error
+	SiteSettings(siteID string) store.SiteSettings
+	SetSettings(siteID string, settings store.SiteSettings) error
+	RestrictedRules(siteID string) ([]store.RestrictedRule, error)
+	SetRestrictedRules(siteID string, rules []store.RestrictedRule) error
+	Pending(siteID string) ([]store.Comment, error)
+	Approve(locator store.Locator, commentID string) error
+	Moderation(siteID string, userID string) ([]store.ModerationRecord, error)
+	Users(req engine.UsersRequest) ([]store.UserSummary, int, error)
+	RequestDeletion(siteID, userID string, mode store.DeletionMode) (store.DeletionRequest, error)
+	Deletion(siteID, reqID string) (store.DeletionRequest, error)
+	Deletions(siteID string) ([]store.DeletionRequest, error)
+	ConfirmDeletion(siteID, reqID, userID string) (store.DeletionRequest, error)
+	ApproveDeletion(siteID, reqID, adminID string) (store.DeletionRequest, error)
+	RejectDeletion(siteID, reqID, adminID string) (store.DeletionRequest, error)
+	ApplyRetention(siteID string) (store.RetentionReport, error)
+	RetentionReport(siteID string) (store.RetentionReport, bool)
+	Trash(siteID string) ([]store.TrashEntry, error)
+	RestoreComment(siteID, commentID string) (store.Comment, error)
+	WaitChanges(ctx context.Context, siteID string, since int64, limit int) ([]store.Change, error)
 }
 
+const (
+	changesLimit   = 1000             // max records of change log returned at once
+	changesMaxWait = 25 * time.Second // long-poll of change log limited by admin routes timeout
+)
+
 // DELETE /comment/{id}?site=siteID&url=post-url - removes comment
 func (a *admin) deleteCommentCtrl(w http.ResponseWriter, r *http.Request) {
 
@@ -47,7 +84,11 @@ func (a *admin) deleteCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
 	log.Printf("[INFO] delete comment %s", id)
 
-	err := a.dataService.Delete(locator, id, store.SoftDelete)
+	adminID := ""
+	if user, err := rest.GetUserInfo(r); err == nil {
+		adminID = user.ID
+	}
+	err := a.dataService.AdminDelete(locator, id, adminID)
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't delete comment", rest.ErrInternal)
 		return
@@ -57,6 +98,29 @@ func (a *admin) deleteCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, R.JSON{"id": id, "locator": locator})
 }
 
+// GET /trash?site=siteID - content of deleted comments kept for restore, sorted by deletion time
+func (a *admin) trashCtrl(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.dataService.Trash(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get trash", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, entries)
+}
+
+// PUT /restore/{id}?site=siteID - restore deleted comment from trash with its text, votes and score
+func (a *admin) restoreCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	siteID := r.URL.Query().Get("site")
+	comment, err := a.dataService.RestoreComment(siteID, id)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't restore comment", rest.ErrActionRejected)
+		return
+	}
+	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, comment.Locator.URL, lastCommentsScope))
+	render.JSON(w, r, comment)
+}
+
 // DELETE /user/{userid}?site=side-id - delete all user comments for requested userid
 func (a *admin) deleteUserCtrl(w http.ResponseWriter, r *http.Request) {
 
@@ -109,38 +173,122 @@ func (a *admin) deleteMeRequestCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = a.dataService.DeleteUser(claims.Audience, claims.User.ID); err != nil {
+	siteID, userID := claims.Audience, claims.User.ID
+	adminID := ""
+	if user, e := rest.GetUserInfo(r); e == nil {
+		adminID = user.ID
+	}
+
+	// token sent by user to admin confirms the request and approved by admin's click
+	delReq := store.DeletionRequest{ID: claims.User.StrAttr("delete_request")}
+	if delReq.ID == "" { // token made before tracking of deletion requests, accepted for users with comments only
+		var count int
+		if count, err = a.dataService.UserCount(siteID, userID); err == nil && count == 0 {
+			err = fmt.Errorf("no comments for user %s", userID)
+		}
+		if err == nil {
+			delReq, err = a.dataService.RequestDeletion(siteID, userID, store.DeletionFull)
+		}
+	} else {
+		delReq, err = a.dataService.Deletion(siteID, delReq.ID)
+	}
+	if err == nil && delReq.Status == store.DeletionRequested {
+		delReq, err = a.dataService.ConfirmDeletion(siteID, delReq.ID, userID)
+	}
+	if err == nil && delReq.Status == store.DeletionConfirmed {
+		delReq, err = a.dataService.ApproveDeletion(siteID, delReq.ID, adminID)
+	}
+	if err == nil && delReq.Status != store.DeletionExecuted {
+		err = fmt.Errorf("deletion request %s is %s", delReq.ID, delReq.Status)
+	}
+	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete user", rest.ErrNoAccess)
 		return
 	}
 
-	if claims.User.Picture != "" && a.authenticator.AvatarProxy() != nil {
-		avatarStore := a.authenticator.AvatarProxy().Store
-		if err = avatarStore.Remove(path.Base(claims.User.Picture)); err != nil {
-			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't delete user's avatar", rest.ErrInternal)
-			return
+	cleanupDeletion(a.authenticator, a.cache, delReq, claims.User.Picture)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, R.JSON{"user_id": userID, "site_id": siteID, "request_id": delReq.ID, "status": delReq.Status})
+}
+
+// GET /deletions?site=siteID - deletion requests of all users with history of steps
+func (a *admin) deletionsCtrl(w http.ResponseWriter, r *http.Request) {
+	reqs, err := a.dataService.Deletions(r.URL.Query().Get("site"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get deletion requests", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, reqs)
+}
+
+// PUT /deletion/{id}?site=siteID&action=approve|reject - approves and executes or rejects confirmed deletion request
+func (a *admin) setDeletionCtrl(w http.ResponseWriter, r *http.Request) {
+	reqID := chi.URLParam(r, "id")
+	siteID := r.URL.Query().Get("site")
+	adminID := ""
+	if user, err := rest.GetUserInfo(r); err == nil {
+		adminID = user.ID
+	}
+
+	var delReq store.DeletionRequest
+	var err error
+	switch action := r.URL.Query().Get("action"); action {
+	case "approve":
+		delReq, err = a.dataService.ApproveDeletion(siteID, reqID, adminID)
+	case "reject":
+		delReq, err = a.dataService.RejectDeletion(siteID, reqID, adminID)
+	default:
+		err = fmt.Errorf("unknown action %q", action)
+	}
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't process deletion request", rest.ErrActionRejected)
+		return
+	}
+	cleanupDeletion(a.authenticator, a.cache, delReq, "")
+	render.JSON(w, r, delReq)
+}
+
+// cleanupDeletion removes avatar and flushes cached comments of the user after executed deletion request.
+// Avatar id made from user id by avatar proxy, base of picture used if set
+func cleanupDeletion(authenticator *auth.Service, lc cache.LoadingCache, req store.DeletionRequest, picture string) {
+	if req.Status != store.DeletionExecuted {
+		return
+	}
+	if authenticator.AvatarProxy() != nil {
+		avatarID := store.EncodeID(req.UserID) + ".image"
+		if picture != "" {
+			avatarID = path.Base(picture)
+		}
+		if err := authenticator.AvatarProxy().Store.Remove(avatarID); err != nil {
+			log.Printf("[WARN] can't remove avatar of %s, %v", req.UserID, err)
 		}
 	}
+	lc.Flush(cache.Flusher(req.SiteID))
+}
 
-	a.cache.Flush(cache.Flusher(claims.Audience).Scopes(claims.Audience, claims.User.ID, lastCommentsScope))
-	render.Status(r, http.StatusOK)
-	render.JSON(w, r, R.JSON{"user_id": claims.User.ID, "site_id": claims.Audience})
+// PUT /merge/{userid}?site=side-id&into=userid2 - merge user into another one, i.e. the same person with another provider
+func (a *admin) mergeUserCtrl(w http.ResponseWriter, r *http.Request) {
+	fromID := chi.URLParam(r, "userid")
+	siteID := r.URL.Query().Get("site")
+	toID := r.URL.Query().Get("into")
+	log.Printf("[INFO] merge user %s into %s, site %s", fromID, toID, siteID)
+
+	if err := a.dataService.MergeUser(siteID, fromID, toID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't merge user", rest.ErrActionRejected)
+		return
+	}
+	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, fromID, toID, lastCommentsScope, topScope))
+	render.JSON(w, r, R.JSON{"user_id": toID, "merged_id": fromID, "site_id": siteID})
 }
 
-// PUT /user/{userid}?site=side-id&block=1&ttl=7d - block or unblock user
+// PUT /user/{userid}?site=side-id&block=1&ttl=7d&reason=spam - block or unblock user
 func (a *admin) setBlockCtrl(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "userid")
 	siteID := r.URL.Query().Get("site")
 	blockStatus := r.URL.Query().Get("block") == "1"
+	ttl, info := blockParams(r)
 
-	ttl := time.Duration(0) // unlimited duration by default
-	if ttlParam := r.URL.Query().Get("ttl"); ttlParam != "" {
-		if d, err := time.ParseDuration(ttlParam); err == nil {
-			ttl = d
-		}
-	}
-
-	if err := a.dataService.SetBlock(siteID, userID, blockStatus, ttl); err != nil {
+	if err := a.dataService.SetBlock(siteID, userID, blockStatus, ttl, info); err != nil {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set blocking status", rest.ErrActionRejected)
 		return
 	}
@@ -163,7 +311,41 @@ func (a *admin) blockedUsersCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get blocked users", rest.ErrSiteNotFound)
 		return
 	}
-	render.JSON(w, r, users)
+	ips, err := a.dataService.BlockedIPs(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get blocked ips", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, append(users, ips...))
+}
+
+// PUT /ip/{hash}?site=side-id&block=1&ttl=7d&reason=spam - block or unblock ip hash for all users posting from it
+func (a *admin) setBlockIPCtrl(w http.ResponseWriter, r *http.Request) {
+	ip := chi.URLParam(r, "hash")
+	siteID := r.URL.Query().Get("site")
+	blockStatus := r.URL.Query().Get("block") == "1"
+	ttl, info := blockParams(r)
+
+	if err := a.dataService.SetBlockIP(siteID, ip, blockStatus, ttl, info); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set ip blocking status", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, R.JSON{"ip": ip, "site_id": siteID, "block": blockStatus})
+}
+
+// blockParams extracts ttl and reason from request, acting admin taken from user info
+func blockParams(r *http.Request) (ttl time.Duration, info store.BlockInfo) {
+	// unlimited duration by default
+	if ttlParam := r.URL.Query().Get("ttl"); ttlParam != "" {
+		if d, err := time.ParseDuration(ttlParam); err == nil {
+			ttl = d
+		}
+	}
+	info.Reason = r.URL.Query().Get("reason")
+	if user, err := rest.GetUserInfo(r); err == nil {
+		info.Admin = user.ID
+	}
+	return ttl, info
 }
 
 // PUT /readonly?site=siteID&url=post-url&ro=1 - set or reset read-only status for the post
@@ -171,14 +353,15 @@ func (a *admin) setReadOnlyCtrl(w http.ResponseWriter, r *http.Request) {
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
 	roStatus := r.URL.Query().Get("ro") == "1"
 
+	readOnlyAge := siteReadOnlyAge(a.dataService.SiteSettings(locator.SiteID), a.readOnlyAge)
 	isRoByAge := func(info store.PostInfo) bool {
-		return a.readOnlyAge > 0 && !info.FirstTS.IsZero() &&
-			info.FirstTS.AddDate(0, 0, a.readOnlyAge).Before(time.Now())
+		return readOnlyAge > 0 && !info.FirstTS.IsZero() &&
+			info.FirstTS.AddDate(0, 0, readOnlyAge).Before(time.Now())
 	}
 
 	// don't allow to reset ro for posts turned to ro by ReadOnlyAge
 	if !roStatus {
-		if info, e := a.dataService.Info(locator, a.readOnlyAge); e == nil && isRoByAge(info) {
+		if info, e := a.dataService.Info(locator, readOnlyAge); e == nil && isRoByAge(info) {
 			rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("rejected"),
 				"read-only due the age", rest.ErrActionRejected)
 			return
@@ -205,7 +388,7 @@ func (a *admin) setTitleCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("[INFO] set comment's title %s to %q", id, c.PostTitle)
 
-	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, lastCommentsScope))
+	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, lastCommentsScope, topScope))
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, R.JSON{"id": id, "locator": locator})
 }
@@ -224,6 +407,100 @@ func (a *admin) setVerifyCtrl(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, R.JSON{"user": userID, "verified": verifyStatus})
 }
 
+// PUT /shadow/{userid}?site=siteID&shadow=1 - set or reset shadow-ban status for the user
+func (a *admin) setShadowBanCtrl(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userid")
+	siteID := r.URL.Query().Get("site")
+	shadowStatus := r.URL.Query().Get("shadow") == "1"
+
+	if err := a.dataService.SetShadowBan(siteID, userID, shadowStatus); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set shadow-ban status", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] shadow-ban status of %s set to %v", userID, shadowStatus)
+	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, userID, lastCommentsScope, topScope))
+	render.JSON(w, r, R.JSON{"user": userID, "shadow_ban": shadowStatus})
+}
+
+// PUT /trust/{userid}?site=siteID&level=2 - set trust level of the user, level=auto drops it back to calculated
+func (a *admin) setTrustLevelCtrl(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userid")
+	siteID := r.URL.Query().Get("site")
+	levelParam := r.URL.Query().Get("level")
+
+	var level store.TrustLevel
+	switch levelParam {
+	case "auto":
+		l, err := a.dataService.ResetTrustLevel(siteID, userID)
+		if err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't reset trust level", rest.ErrInternal)
+			return
+		}
+		level = l
+	default:
+		l, err := strconv.Atoi(levelParam)
+		if err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "bad trust level", rest.ErrDecode)
+			return
+		}
+		level = store.TrustLevel(l)
+		if err = a.dataService.SetTrustLevel(siteID, userID, level); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set trust level", rest.ErrActionRejected)
+			return
+		}
+	}
+	log.Printf("[INFO] trust level of %s set to %d (%s)", userID, level, levelParam)
+	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, userID, lastCommentsScope, topScope))
+	render.JSON(w, r, R.JSON{"user": userID, "trust_level": level, "manual": levelParam != "auto"})
+}
+
+// GET /shadow?site=siteID - list of shadow-banned user ids
+func (a *admin) shadowBannedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	ids, err := a.dataService.ShadowBanned(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get shadow-banned users", rest.ErrSiteNotFound)
+		return
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	render.JSON(w, r, ids)
+}
+
+// GET /moderation?site=siteID&user=userID - moderation journal of the user, all users if user not set
+func (a *admin) moderationCtrl(w http.ResponseWriter, r *http.Request) {
+	records, err := a.dataService.Moderation(r.URL.Query().Get("site"), r.URL.Query().Get("user"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get moderation journal", rest.ErrSiteNotFound)
+		return
+	}
+	if records == nil {
+		records = []store.ModerationRecord{}
+	}
+	render.JSON(w, r, records)
+}
+
+// GET /users?site=siteID&q=prefix&sort=-score&limit=50&skip=10 - users directory with activity stats,
+// q matches prefix of user id or name, sort is one of [+/-]name, id, first, last, comments, score. Default sort is -last
+func (a *admin) usersCtrl(w http.ResponseWriter, r *http.Request) {
+	req := engine.UsersRequest{SiteID: r.URL.Query().Get("site"), Query: r.URL.Query().Get("q"),
+		Sort: r.URL.Query().Get("sort")}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		req.Limit = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("skip")); err == nil {
+		req.Skip = v
+	}
+
+	users, total, err := a.dataService.Users(req)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get users", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, R.JSON{"users": users, "total": total})
+}
+
 // PUT /pin/{id}?site=siteID&url=post-url&pin=1
 // mark/unmark comment as a special
 func (a *admin) setPinCtrl(w http.ResponseWriter, r *http.Request) {
@@ -238,3 +515,144 @@ func (a *admin) setPinCtrl(w http.ResponseWriter, r *http.Request) {
 	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL))
 	render.JSON(w, r, R.JSON{"id": commentID, "locator": locator, "pin": pinStatus})
 }
+
+// GET /retention?site=siteID - get report of the last retention run for the site
+func (a *admin) retentionReportCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	report, ok := a.dataService.RetentionReport(siteID)
+	if !ok {
+		rest.SendErrorJSON(w, r, http.StatusNotFound, fmt.Errorf("no retention report for %s", siteID),
+			"retention not applied yet", rest.ErrActionRejected)
+		return
+	}
+	render.JSON(w, r, report)
+}
+
+// POST /retention?site=siteID - apply retention rules of the site right away, returns report
+func (a *admin) applyRetentionCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	report, err := a.dataService.ApplyRetention(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't apply retention", rest.ErrActionRejected)
+		return
+	}
+	a.cache.Flush(cache.Flusher(siteID))
+	render.JSON(w, r, report)
+}
+
+// GET /changes?site=siteID&since=seq&limit=100&wait=20s - get change log records after since seq.
+// With wait set and no records after since, waits for new changes. Returns seq to continue from as last_seq.
+func (a *admin) changesCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	since, limit := int64(0), 100
+	if v, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64); err == nil {
+		since = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > changesLimit {
+		limit = changesLimit
+	}
+	wait := time.Duration(0)
+	if v, err := time.ParseDuration(r.URL.Query().Get("wait")); err == nil && v > 0 {
+		wait = v
+	}
+	if wait > changesMaxWait {
+		wait = changesMaxWait
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	changes, err := a.dataService.WaitChanges(ctx, siteID, since, limit)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get changes", rest.ErrSiteNotFound)
+		return
+	}
+	lastSeq := since
+	if len(changes) > 0 {
+		lastSeq = changes[len(changes)-1].Seq
+	}
+	render.JSON(w, r, R.JSON{"changes": changes, "last_seq": lastSeq})
+}
+
+// GET /settings?site=siteID - get per-site settings overriding global parameters
+func (a *admin) getSettingsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	render.JSON(w, r, a.dataService.SiteSettings(siteID))
+}
+
+// PUT /settings?site=siteID - set per-site settings, replaces all previously set
+func (a *admin) setSettingsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+
+	settings := store.SiteSettings{}
+	if err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, hardBodyLimit), &settings); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind settings", rest.ErrDecode)
+		return
+	}
+
+	if err := a.dataService.SetSettings(siteID, settings); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set settings", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] settings for %s updated", siteID)
+
+	a.cache.Flush(cache.Flusher(siteID).Scopes(siteID, lastCommentsScope, topScope))
+	render.JSON(w, r, settings)
+}
+
+// GET /restricted?site=siteID - get restricted rules of the site
+func (a *admin) getRestrictedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	rules, err := a.dataService.RestrictedRules(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get restricted rules", rest.ErrSiteNotFound)
+		return
+	}
+	render.JSON(w, r, rules)
+}
+
+// PUT /restricted?site=siteID - set restricted rules of the site, replaces all previously set.
+// Body is a list of rules, i.e. [{"pattern":"duck*","action":"mask"}, {"pattern":"f[uo]+","regex":true,"action":"reject"}]
+func (a *admin) setRestrictedCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+
+	rules := []store.RestrictedRule{}
+	if err := render.DecodeJSON(http.MaxBytesReader(w, r.Body, hardBodyLimit), &rules); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't bind restricted rules", rest.ErrDecode)
+		return
+	}
+
+	if err := a.dataService.SetRestrictedRules(siteID, rules); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't set restricted rules", rest.ErrActionRejected)
+		return
+	}
+	log.Printf("[INFO] restricted rules for %s updated, %d rules", siteID, len(rules))
+	render.JSON(w, r, rules)
+}
+
+// GET /pending?site=siteID - get last comments waiting for moderation
+func (a *admin) pendingCommentsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	comments, err := a.dataService.Pending(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get pending comments", rest.ErrInternal)
+		return
+	}
+	render.JSON(w, r, comments)
+}
+
+// PUT /approve/{id}?site=siteID&url=post-url - approve pending comment
+func (a *admin) approveCommentCtrl(w http.ResponseWriter, r *http.Request) {
+	commentID := chi.URLParam(r, "id")
+	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
+
+	if err := a.dataService.Approve(locator, commentID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't approve comment", rest.ErrCommentNotFound)
+		return
+	}
+	log.Printf("[INFO] comment %s approved", commentID)
+	a.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.SiteID, locator.URL, lastCommentsScope, topScope))
+	render.JSON(w, r, R.JSON{"id": commentID, "locator": locator, "pending": false})
+}
@@ -370,7 +370,7 @@ func TestAdmin_BlockedList(t *testing.T) {
 
 	// block user2
 	req, err = http.NewRequest(http.MethodPut,
-		fmt.Sprintf("%s/api/v1/admin/user/%s?site=radio-t&block=%d&ttl=50ms", ts.URL, "user2", 1), nil)
+		fmt.Sprintf("%s/api/v1/admin/user/%s?site=radio-t&block=%d&ttl=50ms&reason=spam", ts.URL, "user2", 1), nil)
 	assert.Nil(t, err)
 	res, err = sendReq(t, req, adminUmputunToken)
 	require.NoError(t, err)
@@ -386,7 +386,10 @@ func TestAdmin_BlockedList(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(users), "two users blocked")
 	assert.Equal(t, "user1", users[0].ID)
+	assert.Equal(t, "", users[0].Reason)
 	assert.Equal(t, "user2", users[1].ID)
+	assert.Equal(t, "spam", users[1].Reason)
+	assert.Equal(t, "github_ef0f706a7", users[1].Admin, "acting admin recorded")
 
 	time.Sleep(50 * time.Millisecond)
 
@@ -402,6 +405,59 @@ func TestAdmin_BlockedList(t *testing.T) {
 
 }
 
+func TestAdmin_BlockIP(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}
+	id := addComment(t, store.Comment{Text: "buy pills", Locator: locator}, ts) // dev user
+	c, err := srv.DataService.Interface.Get(locator, id)
+	require.NoError(t, err)
+	require.NotEmpty(t, c.User.IP, "ip hash stored")
+
+	req, err := http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/ip/%s?site=radio-t&block=1&ttl=1h&reason=bots", ts.URL, c.User.IP), nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.True(t, srv.DataService.IsBlockedIP("radio-t", c.User.IP))
+	assert.False(t, srv.DataService.IsBlocked("radio-t", "dev"), "user itself not blocked")
+
+	// posting from blocked ip rejected
+	b, err := json.Marshal(store.Comment{Text: "more pills", Locator: locator})
+	require.NoError(t, err)
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/comment", bytes.NewBuffer(b))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, devToken)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/blocked?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	blocked := []store.BlockedUser{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&blocked))
+	assert.NoError(t, resp.Body.Close())
+	require.Equal(t, 1, len(blocked))
+	assert.Equal(t, c.User.IP, blocked[0].ID)
+	assert.True(t, blocked[0].IP)
+	assert.Equal(t, "bots", blocked[0].Reason)
+
+	// unblock
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/ip/%s?site=radio-t&block=0", ts.URL, c.User.IP), nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.False(t, srv.DataService.IsBlockedIP("radio-t", c.User.IP))
+	addComment(t, store.Comment{Text: "more pills", Locator: locator}, ts)
+}
+
 func TestAdmin_ReadOnly(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -690,6 +746,156 @@ func TestAdmin_DeleteMeRequest(t *testing.T) {
 	assert.EqualError(t, err, "no comments for user user1 in store")
 }
 
+func TestAdmin_Deletions(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.DeletionApproval = true
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1"}}
+	_, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+
+	r1, err := srv.DataService.RequestDeletion("radio-t", "user1", store.DeletionFull)
+	require.NoError(t, err)
+	_, err = srv.DataService.ConfirmDeletion("radio-t", r1.ID, "user1")
+	require.NoError(t, err)
+	r2, err := srv.DataService.RequestDeletion("radio-t", "user1", store.DeletionFull)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/deletions?site=radio-t", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	reqs := []store.DeletionRequest{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reqs))
+	require.Equal(t, 2, len(reqs))
+	assert.Equal(t, store.DeletionConfirmed, reqs[0].Status)
+	assert.Equal(t, store.DeletionRequested, reqs[1].Status)
+
+	// not confirmed by user yet
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/deletion/"+r2.ID+"?site=radio-t&action=approve", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/deletion/"+r1.ID+"?site=radio-t&action=blah", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "unknown action")
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/deletion/"+r1.ID+"?site=radio-t&action=approve", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	delReq := store.DeletionRequest{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&delReq))
+	assert.Equal(t, store.DeletionExecuted, delReq.Status)
+
+	_, err = srv.DataService.User("radio-t", "user1", 0, 0, store.User{})
+	assert.EqualError(t, err, "no comments for user user1 in store")
+}
+
+func TestAdmin_Retention(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t",
+		URL: "https://radio-t.com/blah"}, User: store.User{Name: "user1 name", ID: "user1", IP: "ip-hash"},
+		Timestamp: time.Now().AddDate(0, 0, -10)}
+	_, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/retention?site=radio-t", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode, "not applied yet")
+
+	require.NoError(t, srv.DataService.SetSettings("radio-t", store.SiteSettings{Retention: &store.RetentionPolicy{IPDays: 5}}))
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/v1/admin/retention?site=radio-t", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	report := store.RetentionReport{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, 1, report.IPsCleared)
+	assert.Equal(t, 5, report.Policy.IPDays)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/retention?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	last := store.RetentionReport{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&last))
+	assert.Equal(t, 1, last.IPsCleared)
+}
+
+func TestAdmin_Trash(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.TrashDuration = time.Hour
+
+	c1 := store.Comment{Text: "test test #1", User: store.User{ID: "id", Name: "name"},
+		Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c1, ts)
+
+	req, err := http.NewRequest(http.MethodDelete,
+		fmt.Sprintf("%s/api/v1/admin/comment/%s?site=radio-t&url=https://radio-t.com/blah", ts.URL, id1), nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/trash?site=radio-t", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	entries := []store.TrashEntry{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries))
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, id1, entries[0].ID)
+	assert.Equal(t, "<p>test test #1</p>\n", entries[0].Comment.Text)
+
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/restore/%s?site=radio-t", ts.URL, id1), nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	restored := store.Comment{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&restored))
+	assert.Equal(t, id1, restored.ID)
+	assert.False(t, restored.Deleted)
+	assert.Equal(t, "<p>test test #1</p>\n", restored.Text)
+
+	res, code := get(t, fmt.Sprintf("%s/api/v1/id/%s?site=radio-t&url=https://radio-t.com/blah", ts.URL, id1))
+	assert.Equal(t, 200, code)
+	comment := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(res), &comment))
+	assert.Equal(t, "<p>test test #1</p>\n", comment.Text, "restored comment visible")
+
+	req, err = http.NewRequest(http.MethodPut,
+		fmt.Sprintf("%s/api/v1/admin/restore/%s?site=radio-t", ts.URL, id1), nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "not in trash anymore")
+}
+
 func TestAdmin_DeleteMeRequestFailed(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -796,3 +1002,446 @@ func TestAdmin_GetUserInfo(t *testing.T) {
 	_, code = getWithAdminAuth(t, fmt.Sprintf("%s/api/v1/admin/user/userX?site=radio-t&url=https://radio-t.com/blah", ts.URL))
 	assert.Equal(t, 400, code, "no info about user")
 }
+
+func TestAdmin_Settings(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/settings?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, "") // non-admin user
+	require.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	settings := store.SiteSettings{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&settings))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, store.SiteSettings{}, settings, "nothing set")
+
+	// set invalid settings
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/settings?site=radio-t",
+		strings.NewReader(`{"low_score": -10, "critical_score": -5}`))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/settings?site=radio-t",
+		strings.NewReader(`{"edit_duration": 60, "max_comment_size": 100, "readonly_age": 20, "low_score": -2,
+			"critical_score": -3, "positive_score": true, "restricted_words": ["duck"]}`))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, code := get(t, ts.URL+"/api/v1/config?site=radio-t")
+	assert.Equal(t, 200, code)
+	j := R.JSON{}
+	require.NoError(t, json.Unmarshal([]byte(body), &j))
+	assert.Equal(t, 60., j["edit_duration"])
+	assert.Equal(t, 100., j["max_comment_size"])
+	assert.Equal(t, -2., j["low_score"])
+	assert.Equal(t, -3., j["critical_score"])
+	assert.True(t, j["positive_score"].(bool))
+	assert.Equal(t, 20., j["readonly_age"])
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/settings?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	settings = store.SiteSettings{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&settings))
+	assert.NoError(t, resp.Body.Close())
+	require.NotNil(t, settings.ReadOnlyAge)
+	assert.Equal(t, 20, *settings.ReadOnlyAge)
+	assert.Equal(t, []string{"duck"}, settings.RestrictedWords)
+	assert.Nil(t, settings.MaxVotes)
+}
+
+func TestAdmin_RestrictedAndPending(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/restricted?site=radio-t", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	// set invalid rules
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/restricted?site=radio-t",
+		strings.NewReader(`[{"pattern":"g[o", "regex":true, "action":"moderate"}]`))
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/restricted?site=radio-t",
+		strings.NewReader(`[{"pattern":"go+se", "regex":true, "action":"moderate"}, {"pattern":"fox*", "action":"mask"}]`))
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/restricted?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	rules := []store.RestrictedRule{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rules))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, []store.RestrictedRule{{Pattern: "go+se", Regex: true, Action: store.RestrictModerate},
+		{Pattern: "fox*", Action: store.RestrictMask}}, rules)
+
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}
+	masked := addComment(t, store.Comment{Text: "quick foxes", Locator: locator}, ts)
+	pending := addComment(t, store.Comment{Text: "the goose", Locator: locator}, ts)
+
+	body, code := get(t, ts.URL+"/api/v1/id/"+masked+"?site=radio-t&url=https://radio-t.com/blah")
+	assert.Equal(t, 200, code)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.Equal(t, "<p>quick ***</p>\n", c.Text)
+
+	body, code = get(t, ts.URL+"/api/v1/id/"+pending+"?site=radio-t&url=https://radio-t.com/blah")
+	assert.Equal(t, 200, code)
+	c = store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.True(t, c.Deleted, "pending comment hidden from anonymous")
+	assert.Equal(t, "", c.Text)
+
+	body, code = getWithDevAuth(t, ts.URL+"/api/v1/id/"+pending+"?site=radio-t&url=https://radio-t.com/blah")
+	assert.Equal(t, 200, code)
+	c = store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.True(t, c.Pending, "shown to author")
+	assert.Equal(t, "<p>the goose</p>\n", c.Text)
+
+	body, code = get(t, ts.URL+"/api/v1/last/10?site=radio-t")
+	assert.Equal(t, 200, code)
+	comments := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Equal(t, 1, len(comments), "pending comment filtered")
+	assert.Equal(t, masked, comments[0].ID)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/pending?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	comments = []store.Comment{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&comments))
+	assert.NoError(t, resp.Body.Close())
+	require.Equal(t, 1, len(comments))
+	assert.Equal(t, pending, comments[0].ID)
+
+	req, err = http.NewRequest(http.MethodPut,
+		ts.URL+"/api/v1/admin/approve/"+pending+"?site=radio-t&url=https://radio-t.com/blah", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, code = get(t, ts.URL+"/api/v1/id/"+pending+"?site=radio-t&url=https://radio-t.com/blah")
+	assert.Equal(t, 200, code)
+	c = store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.False(t, c.Pending)
+	assert.Equal(t, "<p>the goose</p>\n", c.Text, "approved comment visible")
+}
+
+func TestAdmin_Moderation(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.AutoModRules = []service.AutoModRule{{Name: "spam", Deleted: 1, Action: store.ModBlock, TTL: time.Hour}}
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c1, ts)
+
+	req, err := http.NewRequest(http.MethodDelete,
+		fmt.Sprintf("%s/api/v1/admin/comment/%s?site=radio-t&url=https://radio-t.com/blah", ts.URL, id1), nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.True(t, srv.DataService.IsBlocked("radio-t", "dev"), "blocked by rule")
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/moderation?site=radio-t&user=dev", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	records := []store.ModerationRecord{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&records))
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, store.ModDelete, records[0].Action)
+	assert.Equal(t, id1, records[0].CommentID)
+	assert.Equal(t, "github_ef0f706a7", records[0].Admin)
+	assert.Equal(t, store.ModBlock, records[1].Action)
+	assert.Equal(t, "spam", records[1].Rule)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/moderation?site=radio-t&user=blah", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(body))
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/moderation?site=bad", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestAdmin_Users(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	addComment(t, c1, ts) // made by dev user
+	c2 := store.Comment{Text: "test test #2", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah2"}}
+	addComment(t, c2, ts)
+	require.NoError(t, srv.DataService.SetVerified("radio-t", "dev", true))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/users?site=radio-t&q=de&sort=-comments", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	res := struct {
+		Users []store.UserSummary `json:"users"`
+		Total int                 `json:"total"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 1, res.Total)
+	require.Equal(t, 1, len(res.Users))
+	assert.Equal(t, "dev", res.Users[0].ID)
+	assert.Equal(t, 2, res.Users[0].Comments)
+	assert.True(t, res.Users[0].Verified)
+	assert.False(t, res.Users[0].Blocked)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/users?site=radio-t&q=blah&limit=10&skip=0", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"total":0,"users":[]}`+"\n", string(body))
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/users?site=bad", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestAdmin_MergeUser(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	addComment(t, c1, ts) // made by dev user
+	require.NoError(t, srv.DataService.SetVerified("radio-t", "dev", true))
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/merge/dev?site=radio-t&into=user2", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	count, err := srv.DataService.UserCount("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.True(t, srv.DataService.IsVerified("radio-t", "user2"))
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/merge/user2?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "no target user")
+}
+
+func TestAdmin_TrustLevel(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/trust/dev?site=radio-t&level=2", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, store.TrustMember, srv.DataService.TrustLevel("radio-t", "dev"))
+
+	body, code := getWithDevAuth(t, ts.URL+"/api/v1/user?site=radio-t")
+	assert.Equal(t, 200, code)
+	user := store.User{}
+	require.NoError(t, json.Unmarshal([]byte(body), &user))
+	assert.Equal(t, store.TrustMember, user.TrustLevel, "trust level in user info")
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/trust/dev?site=radio-t&level=5", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "invalid level")
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/trust/dev?site=radio-t&level=blah", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode, "bad level")
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/trust/dev?site=radio-t&level=auto", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	res := R.JSON{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, R.JSON{"user": "dev", "trust_level": 0.0, "manual": false}, res)
+}
+
+func TestAdmin_ShadowBan(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	locator := store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}
+	id := addComment(t, store.Comment{Text: "buy pills", Locator: locator}, ts) // dev user
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/shadow/dev?site=radio-t&shadow=1", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.True(t, srv.DataService.IsShadowBanned("radio-t", "dev"))
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/shadow?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	ids := []string{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ids))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, []string{"dev"}, ids)
+
+	// banned user still posts and sees own comments
+	id2 := addComment(t, store.Comment{Text: "more pills", Locator: locator}, ts)
+	body, code := getWithDevAuth(t, ts.URL+"/api/v1/last/10?site=radio-t")
+	assert.Equal(t, 200, code)
+	comments := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Equal(t, 2, len(comments))
+	assert.Equal(t, id2, comments[0].ID)
+	assert.False(t, comments[0].User.ShadowBanned)
+
+	body, code = get(t, ts.URL+"/api/v1/last/10?site=radio-t")
+	assert.Equal(t, 200, code)
+	comments = []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	assert.Equal(t, 0, len(comments), "hidden from others")
+
+	body, code = get(t, ts.URL+"/api/v1/id/"+id+"?site=radio-t&url=https://radio-t.com/blah")
+	assert.Equal(t, 200, code)
+	c := store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &c))
+	assert.True(t, c.Deleted)
+	assert.Equal(t, "", c.Text)
+
+	body, code = get(t, ts.URL+"/api/v1/count?site=radio-t&url=https://radio-t.com/blah")
+	assert.Equal(t, 200, code)
+	j := R.JSON{}
+	require.NoError(t, json.Unmarshal([]byte(body), &j))
+	assert.Equal(t, 0., j["count"])
+
+	body, code = get(t, ts.URL+"/api/v1/rss/site?site=radio-t")
+	assert.Equal(t, 200, code)
+	assert.NotContains(t, body, "pills")
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/admin/shadow/dev?site=radio-t&shadow=0", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, code = get(t, ts.URL+"/api/v1/last/10?site=radio-t")
+	assert.Equal(t, 200, code)
+	comments = []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	assert.Equal(t, 2, len(comments), "shown after unban")
+}
+
+func TestAdmin_Changes(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+	srv.DataService.ChangeLog = true
+
+	c1 := store.Comment{Text: "test test #1", User: store.User{ID: "id", Name: "name"},
+		Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	id1 := addComment(t, c1, ts)
+	addComment(t, c1, ts)
+
+	type changesResp struct {
+		Changes []store.Change `json:"changes"`
+		LastSeq int64          `json:"last_seq"`
+	}
+	getChanges := func(query string) changesResp {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/changes?site=radio-t"+query, nil)
+		require.NoError(t, err)
+		resp, err := sendReq(t, req, adminUmputunToken)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		res := changesResp{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/changes?site=radio-t", nil)
+	require.NoError(t, err)
+	requireAdminOnly(t, req)
+
+	res := getChanges("")
+	require.Equal(t, 2, len(res.Changes))
+	assert.Equal(t, int64(2), res.LastSeq)
+	assert.Equal(t, store.ChangeCreate, res.Changes[0].Type)
+	assert.Equal(t, id1, res.Changes[0].CommentID)
+
+	res = getChanges("&since=1&limit=10")
+	require.Equal(t, 1, len(res.Changes))
+	assert.Equal(t, int64(2), res.Changes[0].Seq)
+
+	st := time.Now()
+	res = getChanges("&since=2&wait=100ms")
+	assert.Equal(t, 0, len(res.Changes), "no changes after since")
+	assert.Equal(t, int64(2), res.LastSeq)
+	assert.True(t, time.Since(st) >= 100*time.Millisecond)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, srv.DataService.SetReadOnly(c1.Locator, true))
+	}()
+	st = time.Now()
+	res = getChanges("&since=2&wait=5s")
+	require.Equal(t, 1, len(res.Changes), "woken up by the change")
+	assert.Equal(t, store.ChangeReadOnly, res.Changes[0].Type)
+	assert.Equal(t, int64(3), res.LastSeq)
+	assert.True(t, time.Since(st) < 2*time.Second)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/admin/changes?site=bad", nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
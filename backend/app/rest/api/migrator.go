@@ -28,10 +28,14 @@ type Migrator struct {
 	DisqusImporter    migrator.Importer
 	WordPressImporter migrator.Importer
 	NativeExporter    migrator.Exporter
+	ArchiveImporter   migrator.Importer // full-site archive with pictures and avatars
+	ArchiveExporter   migrator.Exporter
 	KeyStore          KeyStore
 
-	busy map[string]bool
-	lock sync.Mutex
+	busy      map[string]bool
+	merged    map[string]migrator.ImportStats      // results of the last merge for site
+	validated map[string]migrator.ValidationReport // report of the last dry-run for site
+	lock      sync.Mutex
 }
 
 // KeyStore defines sub-interface for consumers needed just a key
@@ -39,8 +43,9 @@ type KeyStore interface {
 	Key() (key string, err error)
 }
 
-// POST /import?secret=key&site=site-id&provider=disqus|remark|wordpress
-// imports comments from post body.
+// POST /import?secret=key&site=site-id&provider=disqus|remark|wordpress|archive&mode=replace|merge|dry-run
+// imports comments from post body. Merge mode keeps comments of the site, adds missing and updates changed ones.
+// Dry-run mode validates the file and writes nothing, validation report returned by import/wait.
 func (m *Migrator) importCtrl(w http.ResponseWriter, r *http.Request) {
 
 	siteID := r.URL.Query().Get("site")
@@ -51,19 +56,31 @@ func (m *Migrator) importCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	provider, mode := r.URL.Query().Get("provider"), r.URL.Query().Get("mode")
+	if err := m.checkMode(provider, mode); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "import rejected", rest.ErrActionRejected)
+		return
+	}
+
 	tmpfile, err := m.saveTemp(r.Body)
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save request to temp file", rest.ErrInternal)
 		return
 	}
 
-	go m.runImport(siteID, r.URL.Query().Get("provider"), tmpfile) // import runs in background and sets busy flag for site
+	// busy flag set before response, import/wait called right after it sees running import
+	m.setBusy(siteID, true)
+	if mode == "dry-run" {
+		go m.runValidate(siteID, provider, tmpfile) // validation runs in background and resets busy flag for site
+	} else {
+		go m.runImport(siteID, provider, mode, tmpfile) // import runs in background and resets busy flag for site
+	}
 
 	render.Status(r, http.StatusAccepted)
 	render.JSON(w, r, R.JSON{"status": "import request accepted"})
 }
 
-// POST /import/form?secret=key&site=site-id&provider=disqus|remark|wordpress
+// POST /import/form?secret=key&site=site-id&provider=disqus|remark|wordpress|archive&mode=replace|merge|dry-run
 // imports comments from form body.
 func (m *Migrator) importFormCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
@@ -74,6 +91,12 @@ func (m *Migrator) importFormCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	provider, mode := r.URL.Query().Get("provider"), r.URL.Query().Get("mode")
+	if err := m.checkMode(provider, mode); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "import rejected", rest.ErrActionRejected)
+		return
+	}
+
 	if err := r.ParseMultipartForm(20 * 1024 * 1024); err != nil { // 20M max memory, if bigger will make a file
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't parse multipart form", rest.ErrDecode)
 		return
@@ -92,7 +115,12 @@ func (m *Migrator) importFormCtrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go m.runImport(siteID, r.URL.Query().Get("provider"), tmpfile) // import runs in background and sets busy flag for site
+	m.setBusy(siteID, true)
+	if mode == "dry-run" {
+		go m.runValidate(siteID, provider, tmpfile) // validation runs in background and resets busy flag for site
+	} else {
+		go m.runImport(siteID, provider, mode, tmpfile) // import runs in background and resets busy flag for site
+	}
 
 	render.Status(r, http.StatusAccepted)
 	render.JSON(w, r, R.JSON{"status": "import request accepted"})
@@ -121,16 +149,33 @@ func (m *Migrator) importWaitCtrl(w http.ResponseWriter, r *http.Request) {
 		case <-time.After(100 * time.Millisecond):
 		}
 	}
+	res := R.JSON{"status": "completed", "site_id": siteID}
+	if stats, ok := m.mergeStats(siteID); ok {
+		res["merged"] = stats
+	}
+	if report, ok := m.validationReport(siteID); ok {
+		res["validated"] = report
+	}
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, R.JSON{"status": "completed", "site_id": siteID})
+	render.JSON(w, r, res)
 }
 
-// GET /export?site=site-id&secret=12345&?mode=file|stream
-// exports all comments for siteID as gz file
+// GET /export?site=site-id&secret=12345&?mode=file|stream&format=native|archive
+// exports all comments for siteID as gz file. Archive format is tar.gz with pictures and avatars.
 func (m *Migrator) exportCtrl(w http.ResponseWriter, r *http.Request) {
 
 	siteID := r.URL.Query().Get("site")
 
+	if r.URL.Query().Get("format") == "archive" {
+		exportFile := fmt.Sprintf("%s-%s.tar.gz", siteID, time.Now().Format("20060102"))
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", "attachment;filename="+exportFile)
+		if _, err := m.ArchiveExporter.Export(w, siteID); err != nil {
+			rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "export failed", rest.ErrInternal)
+		}
+		return
+	}
+
 	var writer io.Writer = w
 	if r.URL.Query().Get("mode") == "file" {
 		exportFile := fmt.Sprintf("%s-%s.json.gz", siteID, time.Now().Format("20060102"))
@@ -152,10 +197,9 @@ func (m *Migrator) exportCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// runImport reads from tmpfile and import for given siteID and provider
-func (m *Migrator) runImport(siteID string, provider string, tmpfile string) {
-	m.setBusy(siteID, true)
-
+// runImport reads from tmpfile and import for given siteID and provider, merges with site's comments in merge mode.
+// Resets busy flag of the site set by caller.
+func (m *Migrator) runImport(siteID string, provider string, mode string, tmpfile string) {
 	defer func() {
 		m.setBusy(siteID, false)
 		if err := os.Remove(tmpfile); err != nil {
@@ -163,22 +207,22 @@ func (m *Migrator) runImport(siteID string, provider string, tmpfile string) {
 		}
 	}()
 
-	var importer migrator.Importer
-	switch provider {
-	case "disqus":
-		importer = m.DisqusImporter
-	case "wordpress":
-		importer = m.WordPressImporter
-	default:
-		importer = m.NativeImporter
-	}
-	log.Printf("[DEBUG] import request for site=%s, provider=%s", siteID, provider)
+	importer := m.importer(provider)
+	log.Printf("[DEBUG] import request for site=%s, provider=%s, mode=%s", siteID, provider, mode)
 
 	fh, err := os.Open(tmpfile)
 	if err != nil {
 		log.Printf("[WARN] import failed, %v", err)
 		return
 	}
+	defer func() { _ = fh.Close() }()
+
+	m.setMergeStats(siteID, nil) // results of previous merge and dry-run not relevant anymore
+	m.setValidationReport(siteID, nil)
+	if mode == "merge" {
+		m.runMerge(siteID, provider, importer, fh)
+		return
+	}
 
 	size, err := importer.Import(fh, siteID)
 	if err != nil {
@@ -189,6 +233,91 @@ func (m *Migrator) runImport(siteID string, provider string, tmpfile string) {
 	log.Printf("[DEBUG] import request completed. site=%s, provider=%s, comments=%d", siteID, provider, size)
 }
 
+// runValidate validates import file for given siteID and provider, keeps report for import/wait.
+// Nothing written, resets busy flag of the site set by caller.
+func (m *Migrator) runValidate(siteID string, provider string, tmpfile string) {
+	defer func() {
+		m.setBusy(siteID, false)
+		if err := os.Remove(tmpfile); err != nil {
+			log.Printf("[WARN] failed to remove tmp file %s, %v", tmpfile, err)
+		}
+	}()
+
+	m.setMergeStats(siteID, nil) // results of previous merge and dry-run not relevant anymore
+	m.setValidationReport(siteID, nil)
+
+	v, ok := m.importer(provider).(migrator.Validator)
+	if !ok {
+		log.Printf("[WARN] dry-run failed, not supported by %s importer", provider)
+		return
+	}
+	fh, err := os.Open(tmpfile)
+	if err != nil {
+		log.Printf("[WARN] dry-run failed, %v", err)
+		return
+	}
+	defer func() { _ = fh.Close() }()
+
+	report, err := v.Validate(fh, siteID)
+	if err != nil {
+		log.Printf("[WARN] dry-run failed, %v", err)
+		return
+	}
+	m.setValidationReport(siteID, &report)
+	log.Printf("[DEBUG] dry-run request completed. site=%s, provider=%s, comments=%d, issues=%d",
+		siteID, provider, report.Comments, report.Issues())
+}
+
+// checkMode validates import mode and its support by provider's importer
+func (m *Migrator) checkMode(provider, mode string) error {
+	switch mode {
+	case "", "replace":
+		return nil
+	case "merge":
+		if _, ok := m.importer(provider).(migrator.Merger); !ok {
+			return errors.Errorf("merge not supported by %s importer", provider)
+		}
+		return nil
+	case "dry-run":
+		if _, ok := m.importer(provider).(migrator.Validator); !ok {
+			return errors.Errorf("dry-run not supported by %s importer", provider)
+		}
+		return nil
+	}
+	return errors.Errorf("unknown import mode %q", mode)
+}
+
+// importer returns importer for provider, native by default
+func (m *Migrator) importer(provider string) migrator.Importer {
+	switch provider {
+	case "disqus":
+		return m.DisqusImporter
+	case "wordpress":
+		return m.WordPressImporter
+	case "archive":
+		return m.ArchiveImporter
+	default:
+		return m.NativeImporter
+	}
+}
+
+// runMerge merges comments from reader with comments of the site, keeps stats of merge for import/wait
+func (m *Migrator) runMerge(siteID string, provider string, importer migrator.Importer, r io.Reader) {
+	mrg, ok := importer.(migrator.Merger)
+	if !ok {
+		log.Printf("[WARN] merge failed, not supported by %s importer", provider)
+		return
+	}
+	stats, err := mrg.Merge(r, siteID)
+	m.setMergeStats(siteID, &stats)
+	m.Cache.Flush(cache.Flusher(siteID).Scopes(siteID))
+	if err != nil {
+		log.Printf("[WARN] merge failed, %v", err)
+		return
+	}
+	log.Printf("[DEBUG] merge request completed. site=%s, provider=%s, %+v", siteID, provider, stats)
+}
+
 // saveTemp reads from reader and saves to temp file
 func (m *Migrator) saveTemp(r io.Reader) (string, error) {
 	tmpfile, err := ioutil.TempFile("", "remark42_import")
@@ -217,6 +346,50 @@ func (m *Migrator) isBusy(siteID string) bool {
 	return m.busy[siteID]
 }
 
+// mergeStats returns stats of the last merge for siteID
+func (m *Migrator) mergeStats(siteID string) (migrator.ImportStats, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	stats, ok := m.merged[siteID]
+	return stats, ok
+}
+
+// setMergeStats keeps stats of merge for siteID, nil resets it
+func (m *Migrator) setMergeStats(siteID string, stats *migrator.ImportStats) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.merged == nil {
+		m.merged = map[string]migrator.ImportStats{}
+	}
+	if stats == nil {
+		delete(m.merged, siteID)
+		return
+	}
+	m.merged[siteID] = *stats
+}
+
+// validationReport returns report of the last dry-run for siteID
+func (m *Migrator) validationReport(siteID string) (migrator.ValidationReport, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	report, ok := m.validated[siteID]
+	return report, ok
+}
+
+// setValidationReport keeps report of dry-run for siteID, nil resets it
+func (m *Migrator) setValidationReport(siteID string, report *migrator.ValidationReport) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.validated == nil {
+		m.validated = map[string]migrator.ValidationReport{}
+	}
+	if report == nil {
+		delete(m.validated, siteID)
+		return
+	}
+	m.validated[siteID] = *report
+}
+
 // setBusy sets/resets busy flag to the map by siteID as key
 func (m *Migrator) setBusy(siteID string, status bool) {
 	m.lock.Lock()
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +17,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/migrator"
+	"github.com/umputun/remark/backend/app/store"
 )
 
 func TestMigrator_Import(t *testing.T) {
@@ -89,6 +94,118 @@ func TestMigrator_ImportFromWP(t *testing.T) {
 	waitForImportCompletion(t, ts)
 }
 
+func TestMigrator_ImportMerge(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah1"},
+		User: store.User{ID: "dev", Name: "developer one"}}
+	id1, err := srv.DataService.Create(c1)
+	require.NoError(t, err)
+
+	r := strings.NewReader(`{"version":1} {"id":"` + id1 + `","pid":"","text":"<p>test test #1 edited</p>","user":{"name":"developer one","id":"dev"},"locator":{"site":"radio-t","url":"https://radio-t.com/blah1"},"score":0,"votes":{},"time":"2018-04-30T01:37:00.849053725-05:00"}
+	{"id":"83fd97fd-ff64-48d1-9fb7-ca7769c77037","pid":"","text":"<p>test test #2</p>","user":{"name":"developer one","id":"dev"},"locator":{"site":"radio-t","url":"https://radio-t.com/blah2"},"score":0,"votes":{},"time":"2018-04-30T01:37:00.861387771-05:00"}`)
+
+	client := &http.Client{Timeout: 1 * time.Second}
+	req, err := http.NewRequest("POST", ts.URL+"/api/v1/admin/import?site=radio-t&provider=native&mode=merge", r)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/import/wait?site=radio-t", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, `{"merged":{"inserted":1,"updated":1,"skipped":0,"failed":0},"site_id":"radio-t","status":"completed"}`+"\n", string(b))
+
+	c, err := srv.DataService.Get(c1.Locator, id1, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>test test #1 edited</p>", c.Text)
+}
+
+func TestMigrator_ImportBadMode(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	client := &http.Client{Timeout: 1 * time.Second}
+	for _, q := range []string{"provider=native&mode=marge", "provider=archive&mode=merge", "provider=disqus&mode=dryrun"} {
+		req, err := http.NewRequest("POST", ts.URL+"/api/v1/admin/import?site=radio-t&"+q, strings.NewReader(`{"version":1}`))
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "password")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, q)
+		require.NoError(t, resp.Body.Close())
+	}
+}
+
+func TestMigrator_ImportDryRun(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	r := strings.NewReader(`{"version":1} {"id":"c1","pid":"","text":"<p>test test #1</p>","user":{"name":"developer one","id":"dev"},"locator":{"site":"radio-t","url":"https://radio-t.com/blah1"},"time":"2018-04-30T01:37:00.849053725-05:00"}
+	{"id":"c2","pid":"c0","text":"<p>test test #2</p>","user":{"name":"developer one","id":"dev"},"locator":{"site":"radio-t","url":"https://radio-t.com/blah2"},"time":"2018-04-30T01:37:00.861387771-05:00"}`)
+
+	client := &http.Client{Timeout: 1 * time.Second}
+	req, err := http.NewRequest("POST", ts.URL+"/api/v1/admin/import?site=radio-t&provider=native&mode=dry-run", r)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/import/wait?site=radio-t", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	res := struct {
+		Validated *migrator.ValidationReport `json:"validated"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NoError(t, resp.Body.Close())
+	require.NotNil(t, res.Validated)
+	report := *res.Validated
+	assert.Equal(t, 2, report.Posts)
+	assert.Equal(t, 2, report.Comments)
+	assert.Equal(t, migrator.ValidationIssue{Count: 1, IDs: []string{"c2"}}, report.Orphans)
+	assert.Equal(t, 2, len(report.Sample))
+
+	comments, err := srv.DataService.Last("radio-t", 10, time.Time{}, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(comments), "nothing imported")
+
+	req, err = http.NewRequest("POST", ts.URL+"/api/v1/admin/import?site=radio-t&provider=native&mode=dry-run",
+		strings.NewReader(`{"version":2}`))
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/import/wait?site=radio-t", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, `{"site_id":"radio-t","status":"completed"}`+"\n", string(b), "no report for broken file")
+}
+
 func TestMigrator_ImportRejected(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -217,6 +334,60 @@ func TestMigrator_Export(t *testing.T) {
 	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
 
+func TestMigrator_ExportArchive(t *testing.T) {
+	ts, _, teardown := startupT(t)
+	defer teardown()
+
+	r := strings.NewReader(`{"version":1} {"id":"2aa0478c-df1b-46b1-b561-03d507cf482c","pid":"","text":"<p>test test #1</p>","user":{"name":"developer one","id":"dev","picture":"/api/v1/avatar/remark.image","profile":"https://remark42.com","admin":true,"ip":"ae12fe3b5f129b5cc4cdd2b136b7b7947c4d2741"},"locator":{"site":"radio-t","url":"https://radio-t.com/blah1"},"score":0,"votes":{},"time":"2018-04-30T01:37:00.849053725-05:00"}`)
+	client := &http.Client{Timeout: 1 * time.Second}
+	req, err := http.NewRequest("POST", ts.URL+"/api/v1/admin/import?site=radio-t&provider=native", r)
+	require.Nil(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err := client.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	waitForImportCompletion(t, ts)
+
+	req, err = http.NewRequest("GET", ts.URL+"/api/v1/admin/export?mode=file&site=radio-t&format=archive", nil)
+	require.Nil(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	assert.True(t, strings.HasSuffix(resp.Header.Get("Content-Disposition"), ".tar.gz"))
+	archive, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	names := []string{}
+	for {
+		hdr, e := tr.Next()
+		if e == io.EOF {
+			break
+		}
+		require.NoError(t, e)
+		names = append(names, hdr.Name)
+	}
+	assert.Equal(t, []string{"manifest.json", "comments.json"}, names)
+
+	// import archive back
+	req, err = http.NewRequest("POST", ts.URL+"/api/v1/admin/import?site=radio-t&provider=archive", bytes.NewReader(archive))
+	require.Nil(t, err)
+	req.SetBasicAuth("admin", "password")
+	resp, err = client.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	waitForImportCompletion(t, ts)
+
+	res, code := get(t, ts.URL+"/api/v1/find?site=radio-t&url=https://radio-t.com/blah1&format=plain")
+	assert.Equal(t, 200, code)
+	assert.Contains(t, res, "test test #1")
+}
+
 func waitForImportCompletion(t *testing.T, ts *httptest.Server) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest("GET", ts.URL+"/api/v1/admin/import/wait?site=radio-t", nil)
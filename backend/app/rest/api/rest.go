@@ -54,7 +54,10 @@ type Rest struct {
 		Low      int
 		Critical int
 	}
-	UpdateLimiter float64
+	UpdateLimiter  float64
+	AllowedOrigins []string // CORS origins, any origin allowed if empty or has "*"
+
+	paramsLock sync.RWMutex // protects parameters changed with SetParams
 
 	SSLConfig   SSLConfig
 	httpsServer *http.Server
@@ -70,6 +73,7 @@ type Rest struct {
 const hardBodyLimit = 1024 * 64 // limit size of body
 
 const lastCommentsScope = "last"
+const topScope = "top"
 
 type commentsWithInfo struct {
 	Comments []store.Comment `json:"comments"`
@@ -174,7 +178,7 @@ func (s *Rest) routes() chi.Router {
 	s.pubRest, s.privRest, s.adminRest, s.rssRest = s.controllerGroups() // assign controllers for groups
 
 	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowOriginFunc:  s.isOriginAllowed,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-XSRF-Token", "X-JWT"},
 		ExposedHeaders:   []string{"Authorization"},
@@ -222,6 +226,8 @@ func (s *Rest) routes() chi.Router {
 			ropen.Get("/id/{id}", s.pubRest.commentByIDCtrl)
 			ropen.Get("/comments", s.pubRest.findUserCommentsCtrl)
 			ropen.Get("/last/{limit}", s.pubRest.lastCommentsCtrl)
+			ropen.Get("/top/comments", s.pubRest.topCommentsCtrl)
+			ropen.Get("/top/posts", s.pubRest.topPostsCtrl)
 			ropen.Get("/count", s.pubRest.countCtrl)
 			ropen.Post("/counts", s.pubRest.countMultiCtrl)
 			ropen.Get("/list", s.pubRest.listCtrl)
@@ -270,15 +276,35 @@ func (s *Rest) routes() chi.Router {
 			radmin.Use(middleware.NoCache, logInfoWithBody)
 
 			radmin.Delete("/comment/{id}", s.adminRest.deleteCommentCtrl)
+			radmin.Get("/trash", s.adminRest.trashCtrl)
+			radmin.Put("/restore/{id}", s.adminRest.restoreCommentCtrl)
 			radmin.Put("/user/{userid}", s.adminRest.setBlockCtrl)
 			radmin.Delete("/user/{userid}", s.adminRest.deleteUserCtrl)
 			radmin.Get("/user/{userid}", s.adminRest.getUserInfoCtrl)
 			radmin.Get("/deleteme", s.adminRest.deleteMeRequestCtrl)
+			radmin.Get("/deletions", s.adminRest.deletionsCtrl)
+			radmin.Put("/deletion/{id}", s.adminRest.setDeletionCtrl)
+			radmin.Get("/retention", s.adminRest.retentionReportCtrl)
+			radmin.Post("/retention", s.adminRest.applyRetentionCtrl)
+			radmin.Get("/changes", s.adminRest.changesCtrl)
+			radmin.Put("/merge/{userid}", s.adminRest.mergeUserCtrl)
 			radmin.Put("/verify/{userid}", s.adminRest.setVerifyCtrl)
+			radmin.Put("/shadow/{userid}", s.adminRest.setShadowBanCtrl)
+			radmin.Get("/shadow", s.adminRest.shadowBannedCtrl)
+			radmin.Put("/trust/{userid}", s.adminRest.setTrustLevelCtrl)
 			radmin.Put("/pin/{id}", s.adminRest.setPinCtrl)
 			radmin.Get("/blocked", s.adminRest.blockedUsersCtrl)
+			radmin.Put("/ip/{hash}", s.adminRest.setBlockIPCtrl)
 			radmin.Put("/readonly", s.adminRest.setReadOnlyCtrl)
 			radmin.Put("/title/{id}", s.adminRest.setTitleCtrl)
+			radmin.Get("/settings", s.adminRest.getSettingsCtrl)
+			radmin.Put("/settings", s.adminRest.setSettingsCtrl)
+			radmin.Get("/restricted", s.adminRest.getRestrictedCtrl)
+			radmin.Put("/restricted", s.adminRest.setRestrictedCtrl)
+			radmin.Get("/pending", s.adminRest.pendingCommentsCtrl)
+			radmin.Put("/approve/{id}", s.adminRest.approveCommentCtrl)
+			radmin.Get("/moderation", s.adminRest.moderationCtrl)
+			radmin.Get("/users", s.adminRest.usersCtrl)
 
 			// migrator
 			radmin.Get("/export", s.adminRest.migrator.exportCtrl)
@@ -299,6 +325,10 @@ func (s *Rest) routes() chi.Router {
 			rauth.Post("/comment", s.privRest.createCommentCtrl)
 			rauth.With(rejectAnonUser).Put("/vote/{id}", s.privRest.voteCtrl)
 			rauth.With(rejectAnonUser).Post("/deleteme", s.privRest.deleteMeCtrl)
+			rauth.With(rejectAnonUser).Put("/deleteme", s.privRest.confirmDeleteMeCtrl)
+			rauth.With(rejectAnonUser).Get("/deleteme", s.privRest.deleteMeStatusCtrl)
+			rauth.With(rejectAnonUser).Post("/mergeme", s.privRest.mergeMeCtrl)
+			rauth.With(rejectAnonUser).Put("/merge", s.privRest.mergeCtrl)
 		})
 
 		// protected routes, anonymous rejected
@@ -376,6 +406,7 @@ func (s *Rest) updateLimiter() float64 {
 // GET /config?site=siteID - returns configuration
 func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
+	siteCnf := s.DataService.SiteConfig(siteID)
 
 	cnf := struct {
 		Version        string   `json:"version"`
@@ -391,17 +422,26 @@ func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 		MaxImageSize   int      `json:"max_image_size"`
 	}{
 		Version:        s.Version,
-		EditDuration:   int(s.DataService.EditDuration.Seconds()),
-		MaxCommentSize: s.DataService.MaxCommentSize,
+		EditDuration:   int(siteCnf.EditDuration.Seconds()),
+		MaxCommentSize: siteCnf.MaxCommentSize,
 		Admins:         s.DataService.AdminStore.Admins(siteID),
 		AdminEmail:     s.DataService.AdminStore.Email(siteID),
-		LowScore:       s.ScoreThresholds.Low,
-		CriticalScore:  s.ScoreThresholds.Critical,
-		PositiveScore:  s.DataService.PositiveScore,
-		ReadOnlyAge:    s.ReadOnlyAge,
+		PositiveScore:  siteCnf.PositiveScore,
+		ReadOnlyAge:    siteReadOnlyAge(siteCnf.Overrides, s.ReadOnlyAge),
 		MaxImageSize:   s.ImageService.Store.SizeLimit(),
 	}
 
+	s.paramsLock.RLock()
+	cnf.LowScore, cnf.CriticalScore = s.ScoreThresholds.Low, s.ScoreThresholds.Critical
+	s.paramsLock.RUnlock()
+
+	if siteCnf.Overrides.LowScore != nil {
+		cnf.LowScore = *siteCnf.Overrides.LowScore
+	}
+	if siteCnf.Overrides.CriticalScore != nil {
+		cnf.CriticalScore = *siteCnf.Overrides.CriticalScore
+	}
+
 	cnf.Auth = []string{}
 	for _, ap := range s.Authenticator.Providers() {
 		cnf.Auth = append(cnf.Auth, ap.Name())
@@ -414,6 +454,36 @@ func (s *Rest) configCtrl(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, cnf)
 }
 
+// SetParams updates score thresholds and CORS origins of running server
+func (s *Rest) SetParams(lowScore, criticalScore int, allowedOrigins []string) {
+	s.paramsLock.Lock()
+	defer s.paramsLock.Unlock()
+	s.ScoreThresholds.Low, s.ScoreThresholds.Critical = lowScore, criticalScore
+	s.AllowedOrigins = allowedOrigins
+}
+
+// isOriginAllowed checks request's origin against AllowedOrigins. Supports a single "*" wildcard in origin,
+// i.e. "https://*.example.com"
+func (s *Rest) isOriginAllowed(_ *http.Request, origin string) bool {
+	s.paramsLock.RLock()
+	defer s.paramsLock.RUnlock()
+	if len(s.AllowedOrigins) == 0 {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, o := range s.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" || o == origin {
+			return true
+		}
+		if i := strings.IndexByte(o, '*'); i >= 0 && len(origin) >= len(o)-1 &&
+			strings.HasPrefix(origin, o[:i]) && strings.HasSuffix(origin, o[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
 // serves static files from /web or embedded by statik
 func addFileServer(r chi.Router, path string, root http.FileSystem) {
 
@@ -468,6 +538,14 @@ func filterComments(comments []store.Comment, fn func(c store.Comment) bool) []s
 	return filtered
 }
 
+// siteReadOnlyAge returns read-only age from per-site settings if set, global readOnlyAge otherwise
+func siteReadOnlyAge(settings store.SiteSettings, readOnlyAge int) int {
+	if settings.ReadOnlyAge != nil {
+		return *settings.ReadOnlyAge
+	}
+	return readOnlyAge
+}
+
 // URLKey gets url from request to use it as cache key
 // admins will have different keys in order to prevent leak of admin-only data to regular users
 func URLKey(r *http.Request) string {
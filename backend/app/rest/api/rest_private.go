@@ -1,10 +1,9 @@
 package api
 
 import (
-	"compress/gzip"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -17,7 +16,6 @@ import (
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/go-pkgz/rest/cache"
-	"github.com/hashicorp/go-multierror"
 
 	"github.com/umputun/remark/backend/app/notify"
 	"github.com/umputun/remark/backend/app/rest"
@@ -37,6 +35,8 @@ type private struct {
 	remarkURL        string
 }
 
+const mergeTokenTTL = 15 * time.Minute // lifetime of token made by /mergeme
+
 type privStore interface {
 	Create(comment store.Comment) (commentID string, err error)
 	EditComment(locator store.Locator, commentID string, req service.EditRequest) (comment store.Comment, err error)
@@ -47,7 +47,15 @@ type privStore interface {
 	IsVerified(siteID string, userID string) bool
 	IsReadOnly(locator store.Locator) bool
 	IsBlocked(siteID string, userID string) bool
+	IsShadowBanned(siteID string, userID string) bool
+	TrustLevel(siteID, userID string) store.TrustLevel
 	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)
+	SiteSettings(siteID string) store.SiteSettings
+	MergeUser(siteID, fromID, toID string) error
+	RequestDeletion(siteID, userID string, mode store.DeletionMode) (store.DeletionRequest, error)
+	ConfirmDeletion(siteID, reqID, userID string) (store.DeletionRequest, error)
+	Deletions(siteID string) ([]store.DeletionRequest, error)
+	ExportUser(siteID string, user store.User, w io.Writer) error
 }
 
 // POST /comment - adds comment, resets all immutable fields
@@ -88,6 +96,18 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
 		return
 	}
+	if err == service.ErrIPBlocked {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "ip blocked", rest.ErrUserBlocked)
+		return
+	}
+	if err == service.ErrTrustLinks {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "invalid comment", rest.ErrTrustLevel)
+		return
+	}
+	if err == service.ErrFloodLimit {
+		rest.SendErrorJSON(w, r, http.StatusTooManyRequests, err, "rejected", rest.ErrFloodLimit)
+		return
+	}
 	if err != nil {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't save comment", rest.ErrInternal)
 		return
@@ -102,7 +122,8 @@ func (s *private) createCommentCtrl(w http.ResponseWriter, r *http.Request) {
 	s.cache.Flush(cache.Flusher(comment.Locator.SiteID).
 		Scopes(comment.Locator.URL, lastCommentsScope, comment.User.ID, comment.Locator.SiteID))
 
-	if s.notifyService != nil {
+	// comments of shadow-banned users not announced
+	if s.notifyService != nil && !s.dataService.IsShadowBanned(comment.Locator.SiteID, comment.User.ID) {
 		s.notifyService.Submit(finalComment)
 	}
 
@@ -157,6 +178,10 @@ func (s *private) updateCommentCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "invalid comment", rest.ErrCommentValidation)
 		return
 	}
+	if err == service.ErrTrustLinks {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, err, "invalid comment", rest.ErrTrustLevel)
+		return
+	}
 
 	if err != nil {
 		code := parseError(err, rest.ErrCommentRejected)
@@ -173,6 +198,7 @@ func (s *private) userInfoCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
 	if siteID := r.URL.Query().Get("site"); siteID != "" {
 		user.Verified = s.dataService.IsVerified(siteID, user.ID)
+		user.TrustLevel = s.dataService.TrustLevel(siteID, user.ID)
 	}
 
 	render.JSON(w, r, user)
@@ -204,70 +230,100 @@ func (s *private) voteCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't vote for comment", code)
 		return
 	}
-	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, comment.User.ID))
+	s.cache.Flush(cache.Flusher(locator.SiteID).Scopes(locator.URL, comment.User.ID, topScope))
 	render.JSON(w, r, R.JSON{"id": comment.ID, "score": comment.Score})
 }
 
-// GET /userdata?site=siteID - exports all data about the user as a json with user info and list of all comments
+// GET /userdata?site=siteID - exports all data about the user as a zip with json files, pictures and manifest
 func (s *private) userAllDataCtrl(w http.ResponseWriter, r *http.Request) {
 	siteID := r.URL.Query().Get("site")
 	user := rest.MustGetUserInfo(r)
-	userB, err := json.Marshal(&user)
+
+	exportFile := fmt.Sprintf("%s-%s-%s.zip", siteID, user.ID, time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment;filename="+exportFile)
+	if err := s.dataService.ExportUser(siteID, user, w); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't export user data", rest.ErrInternal)
+		return
+	}
+}
+
+// POST /deleteme?site=site&mode=delete|anonymize - requesting delete of all user info, mode "delete" by default.
+// makes deletion request waiting for user's confirmation and jwt with user info, sends it back as a part of json response
+func (s *private) deleteMeCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	delReq, err := s.dataService.RequestDeletion(siteID, user.ID, store.DeletionMode(r.URL.Query().Get("mode")))
 	if err != nil {
-		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't marshal user info", rest.ErrInternal)
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't make deletion request", rest.ErrActionRejected)
 		return
 	}
 
-	exportFile := fmt.Sprintf("%s-%s-%s.json.gz", siteID, user.ID, time.Now().Format("20060102"))
-	w.Header().Set("Content-Type", "application/gzip")
-	w.Header().Set("Content-Disposition", "attachment;filename="+exportFile)
-	gzWriter := gzip.NewWriter(w)
-	defer func() {
-		if e := gzWriter.Close(); e != nil {
-			log.Printf("[WARN] can't close gzip writer, %s", e)
-		}
-	}()
+	claims := token.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  siteID,
+			Issuer:    "remark42",
+			ExpiresAt: time.Now().AddDate(0, 3, 0).Unix(),
+			NotBefore: time.Now().Add(-1 * time.Minute).Unix(),
+		},
+		User: &token.User{
+			ID:   user.ID,
+			Name: user.Name,
+			Attributes: map[string]interface{}{
+				"delete_me":      true, // prevents this token from being used for login
+				"delete_request": delReq.ID,
+			},
+		},
+	}
 
-	write := func(val []byte) error {
-		_, e := gzWriter.Write(val)
-		return e
+	tokenStr, err := s.authenticator.TokenService().Token(claims)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make token", rest.ErrInternal)
+		return
 	}
 
-	var merr error
-	merr = multierror.Append(merr, write([]byte(`{"info": `)))     // send user prefix
-	merr = multierror.Append(merr, write(userB))                   // send user info
-	merr = multierror.Append(merr, write([]byte(`, "comments":`))) // send comments prefix
+	link := fmt.Sprintf("%s/web/deleteme.html?token=%s", s.remarkURL, tokenStr)
+	render.JSON(w, r, R.JSON{"site": siteID, "user_id": user.ID, "token": tokenStr, "link": link,
+		"request_id": delReq.ID, "status": delReq.Status})
+}
 
-	// get comments in 100 in each paginated request
-	for i := 0; i < 100; i++ {
-		comments, errUser := s.dataService.User(siteID, user.ID, 100, i*100, rest.GetUserOrEmpty(r))
-		if errUser != nil {
-			rest.SendErrorJSON(w, r, http.StatusInternalServerError, errUser, "can't get user comments", rest.ErrInternal)
-			return
-		}
-		b, errUser := json.Marshal(comments)
-		if errUser != nil {
-			rest.SendErrorJSON(w, r, http.StatusInternalServerError, errUser, "can't marshal user comments", rest.ErrInternal)
-			return
-		}
+// PUT /deleteme?site=site&request=id - confirms deletion request of the current user.
+// Executed right away if admin's approval not required
+func (s *private) confirmDeleteMeCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
 
-		merr = multierror.Append(merr, write(b))
-		if len(comments) != 100 {
-			break
-		}
+	delReq, err := s.dataService.ConfirmDeletion(siteID, r.URL.Query().Get("request"), user.ID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't confirm deletion request", rest.ErrActionRejected)
+		return
 	}
+	cleanupDeletion(s.authenticator, s.cache, delReq, "")
+	render.JSON(w, r, delReq)
+}
 
-	merr = multierror.Append(merr, write([]byte(`}`)))
-	if merr.(*multierror.Error).ErrorOrNil() != nil {
-		rest.SendErrorJSON(w, r, http.StatusInternalServerError, merr, "can't write user info", rest.ErrInternal)
+// GET /deleteme?site=site - deletion requests of the current user
+func (s *private) deleteMeStatusCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	reqs, err := s.dataService.Deletions(siteID)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't get deletion requests", rest.ErrSiteNotFound)
 		return
 	}
-
+	res := []store.DeletionRequest{}
+	for _, req := range reqs {
+		if req.UserID == user.ID {
+			res = append(res, req)
+		}
+	}
+	render.JSON(w, r, res)
 }
 
-// POST /deleteme?site_id=site - requesting delete of all user info
-// makes jwt with user info and sends it back as a part of json response
-func (s *private) deleteMeCtrl(w http.ResponseWriter, r *http.Request) {
+// POST /mergeme?site=siteID - makes short-living token proving the current login for merge with another provider
+func (s *private) mergeMeCtrl(w http.ResponseWriter, r *http.Request) {
 	user := rest.MustGetUserInfo(r)
 	siteID := r.URL.Query().Get("site")
 
@@ -275,14 +331,14 @@ func (s *private) deleteMeCtrl(w http.ResponseWriter, r *http.Request) {
 		StandardClaims: jwt.StandardClaims{
 			Audience:  siteID,
 			Issuer:    "remark42",
-			ExpiresAt: time.Now().AddDate(0, 3, 0).Unix(),
+			ExpiresAt: time.Now().Add(mergeTokenTTL).Unix(),
 			NotBefore: time.Now().Add(-1 * time.Minute).Unix(),
 		},
 		User: &token.User{
 			ID:   user.ID,
 			Name: user.Name,
 			Attributes: map[string]interface{}{
-				"delete_me": true, // prevents this token from being used for login
+				"merge_me": true, // prevents this token from being used for login
 			},
 		},
 	}
@@ -292,9 +348,31 @@ func (s *private) deleteMeCtrl(w http.ResponseWriter, r *http.Request) {
 		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't make token", rest.ErrInternal)
 		return
 	}
+	render.JSON(w, r, R.JSON{"site": siteID, "user_id": user.ID, "token": tokenStr})
+}
 
-	link := fmt.Sprintf("%s/web/deleteme.html?token=%s", s.remarkURL, tokenStr)
-	render.JSON(w, r, R.JSON{"site": siteID, "user_id": user.ID, "token": tokenStr, "link": link})
+// PUT /merge?site=siteID&merge_token=token - merge user of the token made by /mergeme into the current user.
+// Both logins proven, the token's user logged in with another provider.
+func (s *private) mergeCtrl(w http.ResponseWriter, r *http.Request) {
+	user := rest.MustGetUserInfo(r)
+	siteID := r.URL.Query().Get("site")
+
+	claims, err := s.authenticator.TokenService().Parse(r.URL.Query().Get("merge_token"))
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't process token", rest.ErrActionRejected)
+		return
+	}
+	if claims.User == nil || !claims.User.BoolAttr("merge_me") || claims.Audience != siteID {
+		rest.SendErrorJSON(w, r, http.StatusForbidden, errors.New("forbidden"), "can't use provided token", rest.ErrNoAccess)
+		return
+	}
+
+	if err = s.dataService.MergeUser(siteID, claims.User.ID, user.ID); err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't merge user", rest.ErrActionRejected)
+		return
+	}
+	s.cache.Flush(cache.Flusher(siteID).Scopes(siteID, claims.User.ID, user.ID, lastCommentsScope, topScope))
+	render.JSON(w, r, R.JSON{"user_id": user.ID, "merged_id": claims.User.ID, "site_id": siteID})
 }
 
 // POST /image - save image with form request
@@ -323,9 +401,9 @@ func (s *private) savePictureCtrl(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *private) isReadOnly(locator store.Locator) bool {
-	if s.readOnlyAge > 0 {
+	if readOnlyAge := siteReadOnlyAge(s.dataService.SiteSettings(locator.SiteID), s.readOnlyAge); readOnlyAge > 0 {
 		// check RO by age
-		if info, e := s.dataService.Info(locator, s.readOnlyAge); e == nil && info.ReadOnly {
+		if info, e := s.dataService.Info(locator, readOnlyAge); e == nil && info.ReadOnly {
 			return true
 		}
 	}
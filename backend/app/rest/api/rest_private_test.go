@@ -1,8 +1,8 @@
 package api
 
 import (
+	"archive/zip"
 	"bytes"
-	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -450,27 +450,23 @@ func TestRest_UserAllData(t *testing.T) {
 	resp, err := client.Do(req)
 	require.Nil(t, err)
 	require.Equal(t, 200, resp.StatusCode)
-	require.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	require.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
 
-	ungzReader, err := gzip.NewReader(resp.Body)
-	assert.NoError(t, err)
-	ungzBody, err := ioutil.ReadAll(ungzReader)
-	assert.NoError(t, err)
-	assert.True(t, strings.HasPrefix(string(ungzBody),
-		`{"info": {"name":"developer one","id":"dev","picture":"http://example.com/pic.png","ip":"127.0.0.1","admin":false}, "comments":[{`))
-	assert.Equal(t, 3, strings.Count(string(ungzBody), `"text":`), "3 comments inside")
-	t.Logf("%s", string(ungzBody))
+	files := readZip(t, resp.Body)
+	assert.Equal(t, 6, len(files), "json files and manifest")
 
 	parsed := struct {
-		Info     store.User      `json:"info"`
-		Comments []store.Comment `json:"comments"`
+		Info store.User `json:"info"`
 	}{}
-
-	err = json.Unmarshal(ungzBody, &parsed)
+	err = json.Unmarshal(files["user.json"], &parsed)
 	assert.Nil(t, err)
 	assert.Equal(t, store.User{Name: "developer one", ID: "dev",
 		Picture: "http://example.com/pic.png", IP: "127.0.0.1"}, parsed.Info)
-	assert.Equal(t, 3, len(parsed.Comments))
+
+	comments := []store.Comment{}
+	err = json.Unmarshal(files["comments.json"], &comments)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(comments))
 
 	req, err = http.NewRequest("GET", ts.URL+"/api/v1/userdata?site=radio-t", nil)
 	require.Nil(t, err)
@@ -487,7 +483,7 @@ func TestRest_UserAllDataManyComments(t *testing.T) {
 	c := store.Comment{User: user, Text: "test test #1", Locator: store.Locator{SiteID: "radio-t",
 		URL: "https://radio-t.com/blah1"}, Timestamp: time.Date(2018, 05, 27, 1, 14, 10, 0, time.Local)}
 
-	for i := 0; i < 51; i++ {
+	for i := 0; i < 151; i++ {
 		c.ID = fmt.Sprintf("id-%03d", i)
 		c.Timestamp = c.Timestamp.Add(time.Second)
 		_, err := srv.DataService.Create(c)
@@ -500,15 +496,26 @@ func TestRest_UserAllDataManyComments(t *testing.T) {
 	resp, err := client.Do(req)
 	require.Nil(t, err)
 	require.Equal(t, 200, resp.StatusCode)
-	require.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	require.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
 
-	ungzReader, err := gzip.NewReader(resp.Body)
-	assert.NoError(t, err)
-	ungzBody, err := ioutil.ReadAll(ungzReader)
-	assert.NoError(t, err)
-	assert.True(t, strings.HasPrefix(string(ungzBody),
-		`{"info": {"name":"developer one","id":"dev","picture":"http://example.com/pic.png","ip":"127.0.0.1","admin":false}, "comments":[{`))
-	assert.Equal(t, 51, strings.Count(string(ungzBody), `"text":`), "51 comments inside")
+	files := readZip(t, resp.Body)
+	assert.Equal(t, 151, strings.Count(string(files["comments.json"]), `"text":`), "151 comments inside")
+}
+
+// readZip reads all files from zip archive
+func readZip(t *testing.T, r io.Reader) map[string][]byte {
+	body, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	res := map[string][]byte{}
+	for _, f := range zr.File {
+		rd, e := f.Open()
+		require.NoError(t, e)
+		res[f.Name], e = ioutil.ReadAll(rd)
+		require.NoError(t, e)
+	}
+	return res
 }
 
 func TestRest_DeleteMe(t *testing.T) {
@@ -544,6 +551,112 @@ func TestRest_DeleteMe(t *testing.T) {
 	assert.Equal(t, 401, resp.StatusCode)
 }
 
+func TestRest_DeleteMeConfirm(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	addComment(t, c1, ts) // made by dev user
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/deleteme?site=radio-t&mode=anonymize", nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	m := map[string]string{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	assert.Equal(t, "requested", m["status"])
+	reqID := m["request_id"]
+	require.NotEmpty(t, reqID)
+
+	// other user can't confirm
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/deleteme?site=radio-t&request="+reqID, nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/deleteme?site=radio-t&request="+reqID, nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, devToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	delReq := store.DeletionRequest{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&delReq))
+	assert.Equal(t, store.DeletionExecuted, delReq.Status)
+	assert.Equal(t, store.DeletionAnonymize, delReq.Mode)
+
+	comments, err := srv.DataService.User("radio-t", delReq.AnonID, 0, 0, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(comments), "comment moved to anonymous user")
+	assert.Equal(t, "deleted user", comments[0].User.Name)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/api/v1/deleteme?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, devToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	reqs := []store.DeletionRequest{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reqs))
+	require.Equal(t, 1, len(reqs))
+	assert.Equal(t, reqID, reqs[0].ID)
+	assert.Equal(t, 3, len(reqs[0].Steps))
+}
+
+func TestRest_MergeMe(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah"}}
+	addComment(t, c1, ts) // made by dev user
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/mergeme?site=radio-t", nil)
+	require.NoError(t, err)
+	resp, err := sendReq(t, req, devToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	m := map[string]string{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	assert.Equal(t, "dev", m["user_id"])
+	claims, err := srv.Authenticator.TokenService().Parse(m["token"])
+	require.NoError(t, err)
+	assert.True(t, claims.User.BoolAttr("merge_me"))
+
+	// other site rejected
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/merge?site=other&merge_token="+m["token"], nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	// regular login token rejected
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/merge?site=radio-t&merge_token="+devToken, nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+
+	// the same user logged in with another provider merges dev into itself
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/merge?site=radio-t&merge_token="+m["token"], nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	require.Equal(t, 200, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&m))
+	assert.Equal(t, "github_ef0f706a7", m["user_id"])
+	assert.Equal(t, "dev", m["merged_id"])
+
+	count, err := srv.DataService.UserCount("radio-t", "github_ef0f706a7")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/api/v1/merge?site=radio-t&merge_token=bad", nil)
+	require.NoError(t, err)
+	resp, err = sendReq(t, req, adminUmputunToken)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
 func TestRest_SavePictureCtrl(t *testing.T) {
 	ts, _, teardown := startupT(t)
 	defer teardown()
@@ -16,6 +16,7 @@ import (
 	log "github.com/go-pkgz/lgr"
 	R "github.com/go-pkgz/rest"
 	"github.com/go-pkgz/rest/cache"
+	"github.com/pkg/errors"
 
 	"github.com/umputun/remark/backend/app/rest"
 	"github.com/umputun/remark/backend/app/store"
@@ -38,6 +39,8 @@ type pubStore interface {
 	Get(locator store.Locator, commentID string, user store.User) (store.Comment, error)
 	Find(locator store.Locator, sort string, user store.User) ([]store.Comment, error)
 	Last(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error)
+	TopComments(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error)
+	TopPosts(siteID, sortFld string, limit int, since time.Time) ([]store.PostActivity, error)
 	User(siteID, userID string, limit, skip int, user store.User) ([]store.Comment, error)
 	UserCount(siteID, userID string) (int, error)
 	Count(locator store.Locator) (int, error)
@@ -47,9 +50,15 @@ type pubStore interface {
 	ValidateComment(c *store.Comment) error
 	IsReadOnly(locator store.Locator) bool
 	Counts(siteID string, postIDs []string) ([]store.PostInfo, error)
+	SiteSettings(siteID string) store.SiteSettings
 }
 
-// GET /find?site=siteID&url=post-url&format=[tree|plain]&sort=[+/-time|+/-score|+/-controversy ]&view=[user|all]
+const (
+	defaultTopDays = 7   // default time window for top comments and posts
+	maxTopDays     = 365 // max time window for top comments and posts
+)
+
+// GET /find?site=siteID&url=post-url&format=[tree|plain]&sort=[+/-time|+/-score|+/-controversy|+/-best|+/-hot ]&view=[user|all]
 // find comments for given post. Returns in tree or plain formats, sorted
 func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 	locator := store.Locator{SiteID: r.URL.Query().Get("site"), URL: r.URL.Query().Get("url")}
@@ -71,7 +80,7 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		var b []byte
 		switch r.URL.Query().Get("format") {
 		case "tree":
-			tree := service.MakeTree(comments, sort, s.readOnlyAge)
+			tree := service.MakeTree(comments, sort, s.siteReadOnlyAge(locator.SiteID))
 			if tree.Nodes == nil { // eliminate json nil serialization
 				tree.Nodes = []*service.Node{}
 			}
@@ -81,7 +90,7 @@ func (s *public) findCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 			b, e = encodeJSONWithHTML(tree)
 		default:
 			withInfo := commentsWithInfo{Comments: comments}
-			if info, ee := s.dataService.Info(locator, s.readOnlyAge); ee == nil {
+			if info, ee := s.dataService.Info(locator, s.siteReadOnlyAge(locator.SiteID)); ee == nil {
 				withInfo.Info = info
 			}
 			b, e = encodeJSONWithHTML(withInfo)
@@ -130,7 +139,7 @@ func (s *public) infoCtrl(w http.ResponseWriter, r *http.Request) {
 
 	key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
-		info, e := s.dataService.Info(locator, s.readOnlyAge)
+		info, e := s.dataService.Info(locator, s.siteReadOnlyAge(locator.SiteID))
 		if e != nil {
 			return nil, e
 		}
@@ -158,7 +167,7 @@ func (s *public) infoStreamCtrl(w http.ResponseWriter, r *http.Request) {
 		return func() (data []byte, upd bool, err error) {
 			key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
 			data, err = s.cache.Get(key, func() ([]byte, error) {
-				info, e := s.dataService.Info(locator, s.readOnlyAge)
+				info, e := s.dataService.Info(locator, s.siteReadOnlyAge(locator.SiteID))
 				if e != nil {
 					return nil, e
 				}
@@ -206,14 +215,15 @@ func (s *public) lastCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 		sinceTime = time.Unix(unixTS/1000, 1000000*(unixTS%1000)) // since param in msec timestamp
 	}
 
-	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(lastCommentsScope)
+	key := cache.NewKey(siteID).ID(URLKeyWithUser(r)).Scopes(lastCommentsScope)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
 		comments, e := s.dataService.Last(siteID, limit, sinceTime, rest.GetUserOrEmpty(r))
 		if e != nil {
 			return nil, e
 		}
-		// filter deleted from last comments view. Blocked marked as deleted and will sneak in without
-		filterDeleted := filterComments(comments, func(c store.Comment) bool { return !c.Deleted })
+		// filter deleted from last comments view. Blocked marked as deleted and will sneak in without.
+		// pending comments filtered too, cache shared by all users
+		filterDeleted := filterComments(comments, func(c store.Comment) bool { return !c.Deleted && !c.Pending })
 		return encodeJSONWithHTML(filterDeleted)
 	})
 
@@ -235,12 +245,13 @@ func (s *public) lastCommentsStreamCtrl(w http.ResponseWriter, r *http.Request)
 	fn := func() steamEventFn {
 		sinceTime := time.Now()
 		return func() (data []byte, upd bool, err error) {
-			key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(lastCommentsScope)
+			key := cache.NewKey(siteID).ID(URLKeyWithUser(r)).Scopes(lastCommentsScope)
 			data, err = s.cache.Get(key, func() ([]byte, error) {
 				comments, e := s.dataService.Last(siteID, 1, sinceTime, rest.GetUserOrEmpty(r))
 				if e != nil {
 					return nil, e
 				}
+				comments = filterComments(comments, func(c store.Comment) bool { return !c.Pending })
 				if len(comments) > 0 {
 					sinceTime = comments[0].Timestamp
 					upd = true
@@ -365,6 +376,90 @@ func (s *public) countMultiCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GET /top/comments?site=siteID&limit=10&days=7 - top-scored comments made in the last days, cross-post
+func (s *public) topCommentsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	limit, since, err := topParams(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse top parameters", rest.ErrDecode)
+		return
+	}
+
+	key := cache.NewKey(siteID).ID(URLKeyWithUser(r)).Scopes(siteID, topScope)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		comments, e := s.dataService.TopComments(siteID, limit, since, rest.GetUserOrEmpty(r))
+		if e != nil {
+			return nil, e
+		}
+		// filter deleted and pending, blocked marked as deleted and will sneak in without
+		filterDeleted := filterComments(comments, func(c store.Comment) bool { return !c.Deleted && !c.Pending })
+		return encodeJSONWithHTML(filterDeleted)
+	})
+
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get top comments", rest.ErrInternal)
+		return
+	}
+
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render top comments for site %s", siteID)
+	}
+}
+
+// GET /top/posts?site=siteID&limit=10&days=7&sort=comments|participants|votes - the most discussed posts in the last days
+func (s *public) topPostsCtrl(w http.ResponseWriter, r *http.Request) {
+	siteID := r.URL.Query().Get("site")
+	limit, since, err := topParams(r)
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, err, "can't parse top parameters", rest.ErrDecode)
+		return
+	}
+
+	sortFld := r.URL.Query().Get("sort")
+	switch sortFld {
+	case "", "comments", "participants", "votes":
+	default:
+		rest.SendErrorJSON(w, r, http.StatusBadRequest, errors.Errorf("unknown sort %q", sortFld),
+			"can't get top posts", rest.ErrDecode)
+		return
+	}
+
+	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(siteID, topScope)
+	data, err := s.cache.Get(key, func() ([]byte, error) {
+		posts, e := s.dataService.TopPosts(siteID, sortFld, limit, since)
+		if e != nil {
+			return nil, e
+		}
+		return encodeJSONWithHTML(posts)
+	})
+
+	if err != nil {
+		rest.SendErrorJSON(w, r, http.StatusInternalServerError, err, "can't get top posts", rest.ErrInternal)
+		return
+	}
+
+	if err = R.RenderJSONFromBytes(w, r, data); err != nil {
+		log.Printf("[WARN] can't render top posts for site %s", siteID)
+	}
+}
+
+// topParams extracts limit and time window for top requests. The window is in days, 7 by default
+func topParams(r *http.Request) (limit int, since time.Time, err error) {
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return 0, since, errors.Errorf("bad limit %q", v)
+		}
+	}
+
+	days := defaultTopDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days <= 0 || days > maxTopDays {
+			return 0, since, errors.Errorf("bad days %q, should be in 1-%d range", v, maxTopDays)
+		}
+	}
+	return limit, time.Now().AddDate(0, 0, -days), nil
+}
+
 // GET /list?site=siteID&limit=50&skip=10 - list posts with comments
 func (s *public) listCtrl(w http.ResponseWriter, r *http.Request) {
 
@@ -478,3 +573,8 @@ func (s *public) applyView(comments []store.Comment, view string) []store.Commen
 	}
 	return comments
 }
+
+// siteReadOnlyAge returns read-only age for the site, per-site setting overrides the global one
+func (s *public) siteReadOnlyAge(siteID string) int {
+	return siteReadOnlyAge(s.dataService.SiteSettings(siteID), s.readOnlyAge)
+}
@@ -314,6 +314,59 @@ func TestRest_Last(t *testing.T) {
 	assert.Equal(t, 500, code)
 }
 
+func TestRest_Top(t *testing.T) {
+	ts, srv, teardown := startupT(t)
+	defer teardown()
+
+	res, code := get(t, ts.URL+"/api/v1/top/comments?site=radio-t")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "[]\n", res, "empty top should return empty list")
+
+	c1 := store.Comment{Text: "test test #1", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah1"}}
+	c2 := store.Comment{Text: "test test #2", Locator: store.Locator{SiteID: "radio-t", URL: "https://radio-t.com/blah2"}}
+	id1 := addComment(t, c1, ts)
+	addComment(t, c2, ts)
+	addComment(t, c2, ts)
+	_, err := srv.DataService.Vote(c1.Locator, id1, "user2", true)
+	require.NoError(t, err)
+	_, err = srv.DataService.Vote(c1.Locator, id1, "user3", true)
+	require.NoError(t, err)
+
+	res, code = get(t, ts.URL+"/api/v1/top/comments?site=radio-t&limit=2&days=1")
+	assert.Equal(t, 200, code)
+	comments := []store.Comment{}
+	require.NoError(t, json.Unmarshal([]byte(res), &comments))
+	require.Equal(t, 2, len(comments))
+	assert.Equal(t, id1, comments[0].ID)
+	assert.Equal(t, 2, comments[0].Score)
+
+	res, code = get(t, ts.URL+"/api/v1/top/posts?site=radio-t")
+	assert.Equal(t, 200, code)
+	posts := []store.PostActivity{}
+	require.NoError(t, json.Unmarshal([]byte(res), &posts))
+	require.Equal(t, 2, len(posts))
+	assert.Equal(t, "https://radio-t.com/blah2", posts[0].URL)
+	assert.Equal(t, 2, posts[0].Comments)
+	assert.Equal(t, 1, posts[0].Participants)
+
+	res, code = get(t, ts.URL+"/api/v1/top/posts?site=radio-t&sort=votes")
+	assert.Equal(t, 200, code)
+	posts = []store.PostActivity{}
+	require.NoError(t, json.Unmarshal([]byte(res), &posts))
+	require.Equal(t, 2, len(posts))
+	assert.Equal(t, "https://radio-t.com/blah1", posts[0].URL)
+	assert.Equal(t, 2, posts[0].Votes)
+
+	_, code = get(t, ts.URL+"/api/v1/top/posts?site=radio-t&sort=bad")
+	assert.Equal(t, 400, code)
+	_, code = get(t, ts.URL+"/api/v1/top/comments?site=radio-t&days=0")
+	assert.Equal(t, 400, code)
+	_, code = get(t, ts.URL+"/api/v1/top/comments?site=radio-t&limit=abc")
+	assert.Equal(t, 400, code)
+	_, code = get(t, ts.URL+"/api/v1/top/comments?site=radio-t-bad")
+	assert.Equal(t, 500, code)
+}
+
 func TestRest_FindUserComments(t *testing.T) {
 	ts, srv, teardown := startupT(t)
 	defer teardown()
@@ -281,6 +281,29 @@ func TestRest_parseError(t *testing.T) {
 	}
 }
 
+func TestRest_isOriginAllowed(t *testing.T) {
+	srv := Rest{}
+	assert.True(t, srv.isOriginAllowed(nil, "https://example.com"), "all allowed by default")
+
+	srv.SetParams(-5, -10, []string{"https://remark42.com", "https://*.Example.com"})
+	tbl := []struct {
+		origin string
+		res    bool
+	}{
+		{"https://remark42.com", true},
+		{"https://blog.example.com", true},
+		{"https://example.com", false},
+		{"http://blog.example.com", false},
+		{"https://evil.com", false},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, srv.isOriginAllowed(nil, tt.origin), tt.origin)
+	}
+
+	srv.SetParams(-5, -10, []string{"*"})
+	assert.True(t, srv.isOriginAllowed(nil, "https://evil.com"))
+}
+
 func startupT(t *testing.T) (ts *httptest.Server, srv *Rest, teardown func()) {
 	// log.Setup(log.Out(ioutil.Discard))
 	log.Setup(log.CallerFile, log.CallerFunc, log.Msec, log.LevelBraces)
@@ -298,7 +321,8 @@ func startupT(t *testing.T) (ts *httptest.Server, srv *Rest, teardown func()) {
 	assert.NoError(t, err)
 
 	adminStore := adminstore.NewStaticStore("123456", []string{"a1", "a2"}, "admin@remark-42.com")
-	restrictedWordsMatcher := service.NewRestrictedWordsMatcher(service.StaticRestrictedWordsLister{Words: []string{"duck"}})
+	restrictedWordsMatcher := service.NewRestrictedWordsMatcher(service.EngineRestrictedWordsLister{Engine: b,
+		Default: service.StaticRestrictedWordsLister{Words: []string{"duck"}}})
 
 	dataStore := &service.DataStore{
 		Interface:              b,
@@ -336,6 +360,8 @@ func startupT(t *testing.T) (ts *httptest.Server, srv *Rest, teardown func()) {
 			WordPressImporter: &migrator.WordPress{DataStore: dataStore},
 			NativeImporter:    &migrator.Native{DataStore: dataStore},
 			NativeExporter:    &migrator.Native{DataStore: dataStore},
+			ArchiveImporter:   &migrator.Archive{NativeImporter: &migrator.Native{DataStore: dataStore}},
+			ArchiveExporter:   &migrator.Archive{NativeExporter: &migrator.Native{DataStore: dataStore}},
 			Cache:             &cache.Nop{},
 			KeyStore:          adminStore,
 		},
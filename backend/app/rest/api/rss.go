@@ -39,7 +39,7 @@ func (s *rss) postCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 
 	key := cache.NewKey(locator.SiteID).ID(URLKey(r)).Scopes(locator.SiteID, locator.URL)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
-		comments, e := s.dataService.Find(locator, "-time", rest.GetUserOrEmpty(r))
+		comments, e := s.dataService.Find(locator, "-time", store.User{}) // feeds cached for all users
 		if e != nil {
 			return nil, e
 		}
@@ -70,7 +70,7 @@ func (s *rss) siteCommentsCtrl(w http.ResponseWriter, r *http.Request) {
 
 	key := cache.NewKey(siteID).ID(URLKey(r)).Scopes(siteID, lastCommentsScope)
 	data, err := s.cache.Get(key, func() ([]byte, error) {
-		comments, e := s.dataService.Last(siteID, maxRssItems, time.Time{}, rest.GetUserOrEmpty(r))
+		comments, e := s.dataService.Last(siteID, maxRssItems, time.Time{}, store.User{})
 		if e != nil {
 			return nil, e
 		}
@@ -146,6 +146,9 @@ func (s *rss) toRssFeed(url string, comments []store.Comment, description string
 
 	feed.Items = []*feeds.Item{}
 	for i, c := range comments {
+		if c.Pending || c.Deleted { // deleted include comments of blocked and shadow-banned users
+			continue
+		}
 		f := feeds.Item{
 			Title:       c.User.Name,
 			Link:        &feeds.Link{Href: c.Locator.URL + uiNav + c.ID},
@@ -33,6 +33,8 @@ const (
 	ErrVoteMinScore       = 16 // min score reached for the comment
 	ErrActionRejected     = 17 // general error for rejected actions
 	ErrAssetNotFound      = 18 // requested file not found
+	ErrTrustLevel         = 19 // action not allowed for user's trust level
+	ErrFloodLimit         = 20 // too many comments for user's trust level
 )
 
 // SendErrorJSON makes {error: blah, details: blah} json body and responds with error code
@@ -3,6 +3,7 @@ package admin
 
 import (
 	"errors"
+	"sync"
 
 	log "github.com/go-pkgz/lgr"
 )
@@ -19,6 +20,7 @@ type StaticStore struct {
 	admins []string
 	email  string
 	key    string
+	lock   sync.RWMutex
 }
 
 // Key returns static key for all sites, allows empty site
@@ -42,10 +44,22 @@ func NewStaticKeyStore(key string) *StaticStore {
 
 // Admins returns static list of admin's ids, the same for all sites
 func (s *StaticStore) Admins(string) (ids []string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.admins
 }
 
 // Email gets static email address
 func (s *StaticStore) Email(string) (email string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.email
 }
+
+// Set replaces admins and email, safe for concurrent use
+func (s *StaticStore) Set(admins []string, email string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.admins, s.email = admins, email
+	log.Printf("[DEBUG] admin users %+v, email %s", admins, email)
+}
@@ -23,6 +23,13 @@ func TestStaticStore_Get(t *testing.T) {
 	assert.Equal(t, "aa@example.com", email)
 }
 
+func TestStaticStore_Set(t *testing.T) {
+	ks := NewStaticStore("key123", []string{"123", "xyz"}, "aa@example.com")
+	ks.Set([]string{"abc"}, "bb@example.com")
+	assert.Equal(t, []string{"abc"}, ks.Admins("any"))
+	assert.Equal(t, "bb@example.com", ks.Email("any"))
+}
+
 func TestMongoStore_Get(t *testing.T) {
 	conn, err := mongo.MakeTestConnection(t)
 	require.NoError(t, err)
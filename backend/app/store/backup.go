@@ -0,0 +1,11 @@
+package store
+
+import "time"
+
+// BackupFailure describes failed automatic backup, reported to admins by notifier
+type BackupFailure struct {
+	SiteID    string    `json:"site"`
+	File      string    `json:"file,omitempty"` // backup file failed to make, verify or upload
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"time"`
+}
@@ -0,0 +1,45 @@
+package store
+
+import "time"
+
+// ChangeType is the kind of change recorded in change log
+type ChangeType string
+
+// enum of change types
+const (
+	ChangeCreate   ChangeType = "create"
+	ChangeEdit     ChangeType = "edit"
+	ChangeVote     ChangeType = "vote"
+	ChangeDelete   ChangeType = "delete" // comment deleted, or all user's comments if comment id empty
+	ChangeBlock    ChangeType = "block"
+	ChangeReadOnly ChangeType = "readonly"
+	ChangeMerge    ChangeType = "merge"     // user's comments and votes moved to target user
+	ChangeProfile  ChangeType = "profile"   // name and picture of user's comments changed
+	ChangeClearIPs ChangeType = "clear_ips" // ip hashes of comments made before until cleared, of the user only if set
+	ChangeBlockIP  ChangeType = "block_ip"  // ip hash in user id blocked or unblocked
+	ChangeVerified ChangeType = "verified"
+	ChangeShadow   ChangeType = "shadow_ban"
+	ChangeTrust    ChangeType = "trust"      // trust level set by admin, reset if trust not manual
+	ChangeSettings ChangeType = "settings"   // per-site settings replaced
+	ChangeRules    ChangeType = "restricted" // per-site restricted rules replaced
+)
+
+// Change is a record of append-only change log. Seq assigned by engine, increases monotonically for the site
+// and never reused, even after compaction.
+type Change struct {
+	Seq       int64            `json:"seq" bson:"seq"`
+	SiteID    string           `json:"site" bson:"site"`
+	Type      ChangeType       `json:"type" bson:"type"`
+	Timestamp time.Time        `json:"time" bson:"time"`
+	Locator   Locator          `json:"locator,omitempty" bson:"locator,omitempty"`
+	CommentID string           `json:"comment_id,omitempty" bson:"comment_id,omitempty"`
+	UserID    string           `json:"user_id,omitempty" bson:"user_id,omitempty"`     // author, voter, blocked or deleted user, blocked ip hash
+	Status    bool             `json:"status,omitempty" bson:"status,omitempty"`       // block, read-only, verified and shadow-ban status set
+	Until     time.Time        `json:"until,omitempty" bson:"until,omitempty"`         // block expiration
+	Comment   *Comment         `json:"comment,omitempty" bson:"comment,omitempty"`     // comment after create, edit, vote or delete
+	TargetID  string           `json:"target_id,omitempty" bson:"target_id,omitempty"` // user merged into
+	Profile   *Profile         `json:"profile,omitempty" bson:"profile,omitempty"`     // profile after change
+	Trust     *UserTrust       `json:"trust,omitempty" bson:"trust,omitempty"`
+	Settings  *SiteSettings    `json:"settings,omitempty" bson:"settings,omitempty"`
+	Rules     []RestrictedRule `json:"rules,omitempty" bson:"rules,omitempty"`
+}
@@ -20,10 +20,15 @@ type Comment struct {
 	Votes       map[string]bool `json:"votes,omitempty"`
 	Vote        int             `json:"vote"` // vote for the current user, -1/1/0.
 	Controversy float64         `json:"controversy,omitempty"`
+	Best        float64         `json:"best,omitempty"`                   // lower bound of Wilson score interval
+	Hot         float64         `json:"hot,omitempty"`                    // score with time decay
+	Replies     int             `json:"replies_count,omitempty" bson:"-"` // number of replies, set on read from replies index
 	Timestamp   time.Time       `json:"time" bson:"time"`
 	Edit        *Edit           `json:"edit,omitempty" bson:"edit,omitempty"` // pointer to have empty default in json response
 	Pin         bool            `json:"pin,omitempty" bson:"pin,omitempty"`
 	Deleted     bool            `json:"delete,omitempty" bson:"delete"`
+	DeletedAt   *time.Time      `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"` // time of the first deletion
+	Pending     bool            `json:"pending,omitempty" bson:"pending,omitempty"`       // waits for moderation, shown to admins and author only
 	PostTitle   string          `json:"title,omitempty" bson:"title"`
 }
 
@@ -48,11 +53,29 @@ type PostInfo struct {
 	LastTS   time.Time `json:"last_time,omitempty" bson:"last_time,omitempty"`
 }
 
-// BlockedUser holds id and ts for blocked user
+// PostActivity holds activity summary for given post url over time window
+type PostActivity struct {
+	URL          string    `json:"url"`
+	Title        string    `json:"title,omitempty"`
+	Comments     int       `json:"comments"`     // number of comments made in window
+	Participants int       `json:"participants"` // number of distinct commenters in window
+	Votes        int       `json:"votes"`        // number of votes for comments made in window
+	LastTS       time.Time `json:"last_time" bson:"last_time"`
+}
+
+// BlockedUser holds id and ts for blocked user or ip hash
 type BlockedUser struct {
 	ID    string    `json:"id"`
 	Name  string    `json:"name"`
 	Until time.Time `json:"time"`
+	IP    bool      `json:"ip,omitempty"` // id is a hash of blocked ip
+	BlockInfo
+}
+
+// BlockInfo describes why and by whom the block was set
+type BlockInfo struct {
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+	Admin  string `json:"admin,omitempty" bson:"admin,omitempty"` // id of admin set the block
 }
 
 // DeleteMode defines how much comment info will be erased
@@ -74,9 +97,12 @@ func (c *Comment) PrepareUntrusted() {
 	c.Timestamp = time.Time{} // reset time, force auto-gen
 	c.Votes = make(map[string]bool)
 	c.Score = 0
+	c.Best = 0
+	c.Replies = 0
 	c.Edit = nil
 	c.Pin = false
 	c.Deleted = false
+	c.DeletedAt = nil
 }
 
 // SetDeleted clears comment info, reset to deleted state. hard flag will clear all user info as well
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Crypter encrypts data at rest with AES-GCM, key derived from the secret.
+// Single values encrypted as prefix+nonce+sealed data. Streams, i.e. backup files, encrypted in chunks
+// with the header and random nonce base, the last chunk marked to detect truncation.
+type Crypter struct {
+	aead cipher.AEAD
+}
+
+const (
+	valuePrefix  = "\x00rk1"          // marks encrypted value
+	streamHeader = "REMARK42-ENC1\n"  // marks encrypted stream
+	keyContext   = "remark42 storage" // mixed with the secret to derive the key
+	chunkSize    = 64 * 1024          // plain data sealed at once in streams
+)
+
+// NewCrypter makes crypter with AES-256 key derived from the secret
+func NewCrypter(secret string) (*Crypter, error) {
+	if secret == "" {
+		return nil, errors.New("empty encryption secret")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	if _, err := mac.Write([]byte(keyContext)); err != nil {
+		return nil, errors.Wrap(err, "can't derive key")
+	}
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't make cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't make gcm")
+	}
+	return &Crypter{aead: aead}, nil
+}
+
+// IsEncrypted checks if value made by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(valuePrefix))
+}
+
+// Encrypt seals the value with random nonce
+func (c *Crypter) Encrypt(data []byte) ([]byte, error) {
+	res := make([]byte, len(valuePrefix)+c.aead.NonceSize(), len(valuePrefix)+c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	copy(res, valuePrefix)
+	nonce := res[len(valuePrefix):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "can't make nonce")
+	}
+	return c.aead.Seal(res, nonce, data, nil), nil
+}
+
+// Decrypt opens value made by Encrypt
+func (c *Crypter) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) || len(data) < len(valuePrefix)+c.aead.NonceSize() {
+		return nil, errors.New("not encrypted value")
+	}
+	data = data[len(valuePrefix):]
+	res, err := c.aead.Open(nil, data[:c.aead.NonceSize()], data[c.aead.NonceSize():], nil)
+	return res, errors.Wrap(err, "can't decrypt, wrong secret or damaged value")
+}
+
+// IsEncryptedStream checks if the stream starts with the header of encrypted stream.
+// Returns reader with the full stream, including peeked header.
+func IsEncryptedStream(r io.Reader) (bool, io.Reader) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(len(streamHeader))
+	return string(header) == streamHeader, br
+}
+
+// NewWriter makes writer encrypting stream to w. Close has to be called to write the last chunk,
+// it doesn't close w.
+func (c *Crypter) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "can't make nonce")
+	}
+	if _, err := io.WriteString(w, streamHeader); err != nil {
+		return nil, errors.Wrap(err, "can't write header")
+	}
+	if _, err := w.Write(nonce); err != nil {
+		return nil, errors.Wrap(err, "can't write nonce")
+	}
+	return &cryptWriter{aead: c.aead, w: w, base: nonce, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// NewReader makes reader decrypting stream made by writer
+func (c *Crypter) NewReader(r io.Reader) (io.Reader, error) {
+	header := make([]byte, len(streamHeader)+c.aead.NonceSize())
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "can't read header")
+	}
+	if string(header[:len(streamHeader)]) != streamHeader {
+		return nil, errors.New("not encrypted stream")
+	}
+	return &cryptReader{aead: c.aead, r: r, base: header[len(streamHeader):]}, nil
+}
+
+// chunk nonce is the base nonce with counter mixed into the last 8 bytes
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	tail := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^counter)
+	return nonce
+}
+
+// cryptWriter seals chunks as flag+length+sealed data, flag (1 for the last chunk) authenticated with chunk
+type cryptWriter struct {
+	aead    cipher.AEAD
+	w       io.Writer
+	base    []byte
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// Write buffers data and seals full chunks
+func (cw *cryptWriter) Write(p []byte) (n int, err error) {
+	if cw.closed {
+		return 0, errors.New("write to closed writer")
+	}
+	for len(p) > 0 {
+		if len(cw.buf) == chunkSize {
+			if err = cw.flush(false); err != nil {
+				return n, err
+			}
+		}
+		l := copy(cw.buf[len(cw.buf):chunkSize], p)
+		cw.buf = cw.buf[:len(cw.buf)+l]
+		p = p[l:]
+		n += l
+	}
+	return n, nil
+}
+
+// Close seals the last chunk
+func (cw *cryptWriter) Close() error {
+	if cw.closed {
+		return nil
+	}
+	cw.closed = true
+	return cw.flush(true)
+}
+
+func (cw *cryptWriter) flush(last bool) error {
+	flag := []byte{0}
+	if last {
+		flag[0] = 1
+	}
+	sealed := cw.aead.Seal(nil, chunkNonce(cw.base, cw.counter), cw.buf, flag)
+	cw.counter++
+	cw.buf = cw.buf[:0]
+
+	hdr := make([]byte, 5)
+	hdr[0] = flag[0]
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(sealed)))
+	if _, err := cw.w.Write(hdr); err != nil {
+		return errors.Wrap(err, "can't write chunk")
+	}
+	_, err := cw.w.Write(sealed)
+	return errors.Wrap(err, "can't write chunk")
+}
+
+// cryptReader opens chunks made by cryptWriter, fails on stream truncated before the last chunk
+type cryptReader struct {
+	aead    cipher.AEAD
+	r       io.Reader
+	base    []byte
+	buf     []byte
+	counter uint64
+	last    bool
+}
+
+// Read returns decrypted data, chunk by chunk
+func (cr *cryptReader) Read(p []byte) (n int, err error) {
+	for len(cr.buf) == 0 {
+		if cr.last {
+			return 0, io.EOF
+		}
+		if err = cr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+func (cr *cryptReader) next() error {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(cr.r, hdr); err != nil {
+		return errors.Wrap(err, "encrypted stream truncated")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > chunkSize+uint32(cr.aead.Overhead()) {
+		return errors.Errorf("invalid chunk size %d", size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(cr.r, sealed); err != nil {
+		return errors.Wrap(err, "encrypted stream truncated")
+	}
+	data, err := cr.aead.Open(nil, chunkNonce(cr.base, cr.counter), sealed, hdr[:1])
+	if err != nil {
+		return errors.Wrap(err, "can't decrypt, wrong secret or damaged stream")
+	}
+	cr.counter++
+	cr.buf = data
+	cr.last = hdr[0] == 1
+	return nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrypter_Value(t *testing.T) {
+	_, err := NewCrypter("")
+	assert.EqualError(t, err, "empty encryption secret")
+
+	c, err := NewCrypter("secret")
+	require.NoError(t, err)
+	enc, err := c.Encrypt([]byte(`{"id":"123"}`))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(enc))
+	assert.False(t, IsEncrypted([]byte(`{"id":"123"}`)))
+	assert.NotContains(t, string(enc), "123")
+
+	enc2, err := c.Encrypt([]byte(`{"id":"123"}`))
+	require.NoError(t, err)
+	assert.NotEqual(t, enc, enc2, "random nonce")
+
+	dec, err := c.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"123"}`, string(dec))
+
+	other, err := NewCrypter("secret2")
+	require.NoError(t, err)
+	_, err = other.Decrypt(enc)
+	assert.EqualError(t, err, "can't decrypt, wrong secret or damaged value: cipher: message authentication failed")
+	_, err = c.Decrypt([]byte(`{"id":"123"}`))
+	assert.EqualError(t, err, "not encrypted value")
+}
+
+func TestCrypter_Stream(t *testing.T) {
+	c, err := NewCrypter("secret")
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 10, chunkSize, 3*chunkSize + 17} {
+		data := []byte(strings.Repeat("0123456789", size/10+1)[:size])
+		buf := bytes.Buffer{}
+		w, err := c.NewWriter(&buf)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		encrypted, rd := IsEncryptedStream(bytes.NewReader(buf.Bytes()))
+		assert.True(t, encrypted)
+		rd, err = c.NewReader(rd)
+		require.NoError(t, err)
+		res, err := ioutil.ReadAll(rd)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, data, res, "size %d", size)
+
+		// truncated stream detected
+		if size > chunkSize {
+			rd, err = c.NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-100]))
+			require.NoError(t, err)
+			_, err = ioutil.ReadAll(rd)
+			assert.Error(t, err)
+		}
+	}
+
+	encrypted, rd := IsEncryptedStream(strings.NewReader("plain data"))
+	assert.False(t, encrypted)
+	res, err := ioutil.ReadAll(rd)
+	require.NoError(t, err)
+	assert.Equal(t, "plain data", string(res), "peeked data kept")
+
+	_, err = c.NewReader(strings.NewReader("plain data, not encrypted at all"))
+	assert.EqualError(t, err, "not encrypted stream")
+}
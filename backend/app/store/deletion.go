@@ -0,0 +1,60 @@
+package store
+
+import "time"
+
+// DeletionStatus is the state of user's data deletion request
+type DeletionStatus string
+
+// enum of deletion statuses. Request goes requested -> confirmed -> approved -> executed, approval skipped
+// if not required. Executed and rejected are final
+const (
+	DeletionRequested DeletionStatus = "requested" // made by user, waits for user's confirmation
+	DeletionConfirmed DeletionStatus = "confirmed" // confirmed by user, waits for admin's approval
+	DeletionApproved  DeletionStatus = "approved"
+	DeletionExecuted  DeletionStatus = "executed"
+	DeletionRejected  DeletionStatus = "rejected"
+)
+
+// DeletionMode defines how user's data removed
+type DeletionMode string
+
+// enum of deletion modes
+const (
+	DeletionFull      DeletionMode = "delete"    // comments erased, user's name and id replaced with "deleted"
+	DeletionAnonymize DeletionMode = "anonymize" // comments kept under anonymous user, threads stay readable
+)
+
+// DeletionStep is the record of request's status change
+type DeletionStep struct {
+	Status    DeletionStatus `json:"status" bson:"status"`
+	Actor     string         `json:"actor" bson:"actor"` // id of user or admin made the change
+	Timestamp time.Time      `json:"time" bson:"time"`
+}
+
+// DeletionRequest is user's request for removal of personal data. All steps kept for compliance.
+type DeletionRequest struct {
+	ID      string         `json:"id" bson:"_id"`
+	SiteID  string         `json:"site" bson:"site"`
+	UserID  string         `json:"user_id" bson:"user_id"`
+	Mode    DeletionMode   `json:"mode" bson:"mode"`
+	Status  DeletionStatus `json:"status" bson:"status"`
+	AnonID  string         `json:"anon_id,omitempty" bson:"anon_id,omitempty"` // owner of anonymized comments
+	Created time.Time      `json:"created" bson:"created"`
+	Steps   []DeletionStep `json:"steps" bson:"steps"`
+}
+
+// AddStep sets status of the request and records the change
+func (r *DeletionRequest) AddStep(status DeletionStatus, actor string) {
+	r.Status = status
+	r.Steps = append(r.Steps, DeletionStep{Status: status, Actor: actor, Timestamp: time.Now()})
+}
+
+// Executed returns time of request's execution, zero if not executed
+func (r DeletionRequest) Executed() time.Time {
+	for _, s := range r.Steps {
+		if s.Status == DeletionExecuted {
+			return s.Timestamp
+		}
+	}
+	return time.Time{}
+}
@@ -24,9 +24,21 @@ import (
 //    is a nested bucket named userID with kv as ts:reference
 //  - blocking info sits in "block" bucket. Key is userID, value - ts
 //  - counts per post to keep number of comments. Key is post url, value - count
+//  - counts of not deleted comments of shadow-banned users per post in "shadow_count" bucket. Key is post url, value - count
 //  - readonly per post to keep status of manually set RO posts. Key is post url, value - ts
+//  - replies index in "replies" bucket. Key is parent commentID and value is a nested bucket with ts!!commentID:reference
+//  - replies received by user in "user_replies" bucket. Key is userID of the parent comment and value is a nested bucket
+//    with ts!!commentID:reference. Replies to yourself are not indexed.
+//  - per-site settings in "settings" bucket. Single key "site", value - json of store.SiteSettings
+//  - users directory in "user_stats" bucket. Key is userID, value - json of store.UserSummary
+//  - data deletion requests in "deletion" bucket. Key is request id, value - json of store.DeletionRequest
+//  - content of soft-deleted comments in "trash" bucket. Key is commentID, value - json of store.TrashEntry
+//  - change log in "changelog" bucket. Key is big-endian seq from bucket's sequence, value - json of store.Change
+//  - comments waiting for moderation in "pending" bucket. Key is ts!!commentID, value - reference
+// With crypter set all json values encrypted, keys, references and timestamps stay plain.
 type BoltDB struct {
-	dbs map[string]*bolt.DB
+	dbs     map[string]*bolt.DB
+	crypter *store.Crypter
 }
 
 const (
@@ -38,6 +50,20 @@ const (
 	infoBucketName     = "info"
 	readonlyBucketName = "readonly"
 	verifiedBucketName = "verified"
+	shadowBucketName   = "shadow_ban"
+	shadowCountBktName = "shadow_count"
+	blockIPBucketName  = "block_ip"
+	trustBucketName    = "trust"
+	moderationBktName  = "moderation"
+	profileBucketName  = "profile"
+	userStatsBktName   = "user_stats"
+	deletionBktName    = "deletion"
+	trashBucketName    = "trash"
+	changeLogBktName   = "changelog"
+	repliesBucketName  = "replies"
+	userRepliesBktName = "user_replies"
+	settingsBucketName = "settings"
+	pendingBucketName  = "pending"
 
 	tsNano = "2006-01-02T15:04:05.000000000Z07:00"
 )
@@ -50,8 +76,14 @@ type BoltSite struct {
 
 // NewBoltDB makes persistent boltdb-based store
 func NewBoltDB(options bolt.Options, sites ...BoltSite) (*BoltDB, error) {
-	log.Printf("[INFO] bolt store for sites %+v, options %+v", sites, options)
-	result := BoltDB{dbs: make(map[string]*bolt.DB)}
+	return NewEncryptedBoltDB(options, nil, sites...)
+}
+
+// NewEncryptedBoltDB makes persistent boltdb-based store with values encrypted by crypter.
+// Plain values left from unencrypted db readable, use RotateBoltKey to encrypt them.
+func NewEncryptedBoltDB(options bolt.Options, crypter *store.Crypter, sites ...BoltSite) (*BoltDB, error) {
+	log.Printf("[INFO] bolt store for sites %+v, options %+v, encrypted %v", sites, options, crypter != nil)
+	result := BoltDB{dbs: make(map[string]*bolt.DB), crypter: crypter}
 	for _, site := range sites {
 		db, err := bolt.Open(site.FileName, 0600, &options) // bolt.Options{Timeout: 30 * time.Second}
 		if err != nil {
@@ -60,13 +92,38 @@ func NewBoltDB(options bolt.Options, sites ...BoltSite) (*BoltDB, error) {
 
 		// make top-level buckets
 		topBuckets := []string{postsBucketName, lastBucketName, userBucketName, blocksBucketName,
-			infoBucketName, readonlyBucketName, verifiedBucketName}
+			infoBucketName, readonlyBucketName, verifiedBucketName, repliesBucketName, userRepliesBktName,
+			settingsBucketName, shadowBucketName, blockIPBucketName, trustBucketName,
+			moderationBktName, profileBucketName, userStatsBktName, deletionBktName, trashBucketName, changeLogBktName,
+			shadowCountBktName, pendingBucketName}
 		err = db.Update(func(tx *bolt.Tx) error {
+			noRepliesIndex := tx.Bucket([]byte(repliesBucketName)) == nil
+			noUserStats := tx.Bucket([]byte(userStatsBktName)) == nil
+			noShadowCount := tx.Bucket([]byte(shadowCountBktName)) == nil
+			noPending := tx.Bucket([]byte(pendingBucketName)) == nil
 			for _, bktName := range topBuckets {
 				if _, e := tx.CreateBucketIfNotExists([]byte(bktName)); e != nil {
 					return errors.Wrapf(e, "failed to create top level bucket %s", bktName)
 				}
 			}
+			if noRepliesIndex { // db made before replies index, build it from posts
+				if e := result.buildRepliesIndex(tx); e != nil {
+					return e
+				}
+			}
+			if noUserStats { // db made before users directory, build it from users' comments
+				if e := result.buildUserStats(tx); e != nil {
+					return e
+				}
+			}
+			if noShadowCount { // db made before shadow-banned counts, count comments of banned users
+				if e := result.buildShadowCount(tx); e != nil {
+					return e
+				}
+			}
+			if noPending { // db made before pending index, collect pending comments from posts
+				return result.buildPending(tx)
+			}
 			return nil
 		})
 
@@ -133,7 +190,27 @@ func (b *BoltDB) Create(comment store.Comment) (commentID string, err error) {
 		if _, e = b.setInfo(tx, comment); e != nil {
 			return errors.Wrapf(e, "failed to set info for %s", comment.Locator)
 		}
-		return nil
+
+		// add comment to user's entry of users directory
+		if e = b.addUserStats(tx, comment); e != nil {
+			return errors.Wrapf(e, "failed to update stats of %s", comment.User.ID)
+		}
+
+		// count comment of shadow-banned user, excluded from post's count
+		if e = b.countShadowed(tx, comment, 1); e != nil {
+			return errors.Wrapf(e, "failed to count shadow-banned comment %s", comment.ID)
+		}
+
+		// add comment waiting for moderation to pending index
+		if e = b.indexPending(tx, comment); e != nil {
+			return errors.Wrapf(e, "failed to index pending comment %s", comment.ID)
+		}
+
+		// add reply and replies made before the comment itself (possible on import) to the replies index
+		if e = b.indexReply(tx, postBkt, comment); e != nil {
+			return errors.Wrapf(e, "failed to index reply %s", comment.ID)
+		}
+		return b.indexParent(tx, postBkt, comment)
 	})
 
 	return comment.ID, err
@@ -157,7 +234,7 @@ func (b *BoltDB) Find(locator store.Locator, sortFld string) (comments []store.C
 
 		return bucket.ForEach(func(k, v []byte) error {
 			comment := store.Comment{}
-			if e = json.Unmarshal(v, &comment); e != nil {
+			if e = b.unmarshal(v, &comment); e != nil {
 				return errors.Wrap(e, "failed to unmarshal")
 			}
 			comments = append(comments, comment)
@@ -224,7 +301,43 @@ func (b *BoltDB) Last(siteID string, max int, since time.Time) (comments []store
 	return comments, err
 }
 
-// Count returns number of comments for locator
+// Pending returns all comments waiting for moderation, sorted by time descending
+func (b *BoltDB) Pending(siteID string) (comments []store.Comment, err error) {
+
+	comments = []store.Comment{}
+
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bdb.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(pendingBucketName)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			url, commentID, e := b.parseRef(v)
+			if e != nil {
+				return e
+			}
+			postBkt, e := b.getPostBucket(tx, url)
+			if e != nil {
+				return e
+			}
+			comment := store.Comment{}
+			if e = b.load(postBkt, []byte(commentID), &comment); e != nil {
+				log.Printf("[WARN] can't load comment for %s from store %s", commentID, url)
+				continue
+			}
+			if comment.Pending && !comment.Deleted {
+				comments = append(comments, comment)
+			}
+		}
+		return nil
+	})
+
+	return comments, err
+}
+
+// Count returns number of comments for locator, comments of shadow-banned users not counted
 func (b *BoltDB) Count(locator store.Locator) (count int, err error) {
 
 	bdb, err := b.db(locator.SiteID)
@@ -235,6 +348,7 @@ func (b *BoltDB) Count(locator store.Locator) (count int, err error) {
 	err = bdb.View(func(tx *bolt.Tx) error {
 		var e error
 		count, e = b.count(tx, locator.URL, 0)
+		count -= b.shadowCount(tx, locator.URL)
 		return e
 	})
 
@@ -242,7 +356,7 @@ func (b *BoltDB) Count(locator store.Locator) (count int, err error) {
 }
 
 // List returns list of all commented posts with counters
-// uses count bucket to get number of comments
+// uses count bucket to get number of comments, comments of shadow-banned users not counted
 func (b BoltDB) List(siteID string, limit, skip int) (list []store.PostInfo, err error) {
 
 	bdb, err := b.db(siteID)
@@ -266,6 +380,7 @@ func (b BoltDB) List(siteID string, limit, skip int) (list []store.PostInfo, err
 			if e := b.load(infoBkt, []byte(postURL), &info); e != nil {
 				return errors.Wrapf(e, "can't load info for %s", postURL)
 			}
+			info.Count -= b.shadowCount(tx, postURL)
 			list = append(list, info)
 			if limit > 0 && len(list) >= limit {
 				break
@@ -277,7 +392,7 @@ func (b BoltDB) List(siteID string, limit, skip int) (list []store.PostInfo, err
 	return list, err
 }
 
-// Info returns time range and count for locator
+// Info returns time range and count for locator, comments of shadow-banned users not counted
 func (b *BoltDB) Info(locator store.Locator, readOnlyAge int) (store.PostInfo, error) {
 	bdb, err := b.db(locator.SiteID)
 	if err != nil {
@@ -290,6 +405,7 @@ func (b *BoltDB) Info(locator store.Locator, readOnlyAge int) (store.PostInfo, e
 		if e := b.load(infoBkt, []byte(locator.URL), &info); e != nil {
 			return errors.Wrapf(e, "can't load info for %s", locator.URL)
 		}
+		info.Count -= b.shadowCount(tx, locator.URL)
 		return nil
 	})
 
@@ -322,7 +438,7 @@ func (b *BoltDB) User(siteID, userID string, limit, skip int) (comments []store.
 		usersBkt := tx.Bucket([]byte(userBucketName))
 		userIDBkt := usersBkt.Bucket([]byte(userID))
 		if userIDBkt == nil {
-			return errors.Errorf("no comments for user %s in store", userID)
+			return UnknownUserError{UserID: userID}
 		}
 
 		c := userIDBkt.Cursor()
@@ -358,6 +474,150 @@ func (b *BoltDB) User(siteID, userID string, limit, skip int) (comments []store.
 	return comments, err
 }
 
+// UserReplies returns replies to comments of given userID, sorted by time in descending order.
+// Uses "user_replies" bucket with sub-bucket for each userID, keeps it as ts!!commentID:ref
+func (b *BoltDB) UserReplies(siteID, userID string, limit int, since time.Time) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+
+	if limit == 0 || limit > repliesLimit {
+		limit = repliesLimit
+	}
+
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bdb.View(func(tx *bolt.Tx) error {
+		userBkt := tx.Bucket([]byte(userRepliesBktName)).Bucket([]byte(userID))
+		if userBkt == nil {
+			return nil // no replies for user
+		}
+
+		c := userBkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if !since.IsZero() && bytes.Compare(bytes.SplitN(k, []byte("!!"), 2)[0], []byte(since.Format(tsNano))) <= 0 {
+				break // stop if reached "since" ts, key is ts!!commentID
+			}
+			url, commentID, e := b.parseRef(v)
+			if e != nil {
+				return e
+			}
+			postBkt, e := b.getPostBucket(tx, url)
+			if e != nil {
+				return e
+			}
+			comment := store.Comment{}
+			if e = b.load(postBkt, []byte(commentID), &comment); e != nil {
+				log.Printf("[WARN] can't load reply %s from store %s", commentID, url)
+				continue
+			}
+			if comment.Deleted {
+				continue
+			}
+			comments = append(comments, comment)
+			if len(comments) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	return comments, err
+}
+
+// RepliesCount returns number of replies for each of commentIDs. Comments without replies are not in the result.
+// Uses "replies" bucket with sub-bucket for each parent commentID
+func (b *BoltDB) RepliesCount(siteID string, commentIDs []string) (map[string]int, error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]int{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		repliesBkt := tx.Bucket([]byte(repliesBucketName))
+		for _, id := range commentIDs {
+			parentBkt := repliesBkt.Bucket([]byte(id))
+			if parentBkt == nil {
+				continue
+			}
+			if count := parentBkt.Stats().KeyN; count > 0 {
+				res[id] = count
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// TopComments returns up to limit comments with the highest score made since given ts
+func (b *BoltDB) TopComments(siteID string, limit int, since time.Time) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+	if limit == 0 || limit > topLimit {
+		limit = topLimit
+	}
+
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bdb.View(func(tx *bolt.Tx) error {
+		return b.walkLast(tx, since, func(comment store.Comment) {
+			comments = append(comments, comment)
+		})
+	})
+
+	comments = SortComments(comments, "-score")
+	if len(comments) > limit {
+		comments = comments[:limit]
+	}
+	return comments, err
+}
+
+// TopPosts returns up to limit posts with the most activity since given ts, sorted by sortFld
+// which can be comments, participants or votes
+func (b *BoltDB) TopPosts(siteID, sortFld string, limit int, since time.Time) (posts []store.PostActivity, err error) {
+	posts = []store.PostActivity{}
+	if limit == 0 || limit > topLimit {
+		limit = topLimit
+	}
+
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := map[string]*store.PostActivity{}
+	participants := map[string]map[string]bool{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		return b.walkLast(tx, since, func(comment store.Comment) {
+			url := comment.Locator.URL
+			if _, ok := activity[url]; !ok {
+				activity[url] = &store.PostActivity{URL: url, Title: comment.PostTitle, LastTS: comment.Timestamp}
+				participants[url] = map[string]bool{}
+			}
+			activity[url].Comments++
+			activity[url].Votes += len(comment.Votes)
+			participants[url][comment.User.ID] = true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for url, a := range activity {
+		a.Participants = len(participants[url])
+		posts = append(posts, *a)
+	}
+	posts = SortActivity(posts, sortFld)
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
 // UserCount returns number of comments for user
 func (b *BoltDB) UserCount(siteID, userID string) (int, error) {
 	bdb, err := b.db(siteID)
@@ -369,7 +629,7 @@ func (b *BoltDB) UserCount(siteID, userID string) (int, error) {
 		usersBkt := tx.Bucket([]byte(userBucketName))
 		userIDBkt := usersBkt.Bucket([]byte(userID))
 		if userIDBkt == nil {
-			return errors.Errorf("no comments for user %s in store", userID)
+			return UnknownUserError{UserID: userID}
 		}
 		stats := userIDBkt.Stats()
 		count = stats.KeyN
@@ -399,7 +659,8 @@ func (b *BoltDB) Get(locator store.Locator, commentID string) (comment store.Com
 // Put updates comment for locator.URL with mutable part of comment
 func (b *BoltDB) Put(locator store.Locator, comment store.Comment) error {
 
-	if curComment, err := b.Get(locator, comment.ID); err == nil {
+	curComment, curErr := b.Get(locator, comment.ID)
+	if curErr == nil {
 		// preserve immutable fields
 		comment.ParentID = curComment.ParentID
 		comment.Locator = curComment.Locator
@@ -417,10 +678,50 @@ func (b *BoltDB) Put(locator store.Locator, comment store.Comment) error {
 		if e != nil {
 			return e
 		}
-		return b.save(bucket, []byte(comment.ID), comment)
+		if e = b.save(bucket, []byte(comment.ID), comment); e != nil {
+			return e
+		}
+		if e = b.indexPending(tx, comment); e != nil {
+			return errors.Wrapf(e, "failed to index pending comment %s", comment.ID)
+		}
+		if curErr != nil {
+			return nil
+		}
+		// keep user's entry of users directory and shadow-banned count in sync with changed score or deleted status
+		switch {
+		case comment.Deleted && !curComment.Deleted:
+			if e = b.countShadowed(tx, curComment, -1); e != nil {
+				return e
+			}
+			return b.removeUserStats(tx, curComment)
+		case !comment.Deleted && curComment.Deleted:
+			return b.undelete(tx, bucket, comment)
+		case !comment.Deleted:
+			return b.addUserScore(tx, comment.User.ID, comment.Score-curComment.Score)
+		}
+		return nil
 	})
 }
 
+// undelete puts restored comment back to "last" bucket, post's count, replies index and users directory.
+// Reverses changes made by Delete, should run in update tx
+func (b *BoltDB) undelete(tx *bolt.Tx, postBkt *bolt.Bucket, comment store.Comment) error {
+	ref := b.makeRef(comment)
+	if err := tx.Bucket([]byte(lastBucketName)).Put([]byte(comment.Timestamp.Format(tsNano)), ref); err != nil {
+		return errors.Wrapf(err, "can't put reference %s to %s", ref, lastBucketName)
+	}
+	if _, err := b.count(tx, comment.Locator.URL, 1); err != nil {
+		return errors.Wrapf(err, "failed to increment count for %s", comment.Locator)
+	}
+	if err := b.indexReply(tx, postBkt, comment); err != nil {
+		return errors.Wrapf(err, "failed to index reply %s", comment.ID)
+	}
+	if err := b.countShadowed(tx, comment, 1); err != nil {
+		return errors.Wrapf(err, "failed to count shadow-banned comment %s", comment.ID)
+	}
+	return b.addUserStats(tx, comment)
+}
+
 // Close boltdb store
 func (b *BoltDB) Close() error {
 	errs := new(multierror.Error)
@@ -466,6 +767,365 @@ func (b *BoltDB) getUserBucket(tx *bolt.Tx, userID string) (*bolt.Bucket, error)
 	return userIDBkt, nil
 }
 
+// walkLast calls fn for each non-deleted comment made after since ts, from the most recent. Should run in tx
+func (b *BoltDB) walkLast(tx *bolt.Tx, since time.Time, fn func(comment store.Comment)) error {
+	tsSince := []byte(since.Format(tsNano))
+	c := tx.Bucket([]byte(lastBucketName)).Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		if !since.IsZero() && bytes.Compare(k, tsSince) <= 0 {
+			break
+		}
+		url, commentID, e := b.parseRef(v)
+		if e != nil {
+			return e
+		}
+		postBkt, e := b.getPostBucket(tx, url)
+		if e != nil {
+			return e
+		}
+		comment := store.Comment{}
+		if e = b.load(postBkt, []byte(commentID), &comment); e != nil {
+			log.Printf("[WARN] can't load comment for %s from store %s", commentID, url)
+			continue
+		}
+		if comment.Deleted {
+			continue
+		}
+		fn(comment)
+	}
+	return nil
+}
+
+// indexReply adds reply to "replies" index of the parent and to "user_replies" of parent's author. Should run in update tx
+func (b *BoltDB) indexReply(tx *bolt.Tx, postBkt *bolt.Bucket, reply store.Comment) error {
+	if reply.ParentID == "" {
+		return nil
+	}
+	key, ref := b.makeReplyKey(reply), b.makeRef(reply)
+
+	parentBkt, err := tx.Bucket([]byte(repliesBucketName)).CreateBucketIfNotExists([]byte(reply.ParentID))
+	if err != nil {
+		return errors.Wrapf(err, "can't get replies bucket %s", reply.ParentID)
+	}
+	if err = parentBkt.Put(key, ref); err != nil {
+		return errors.Wrapf(err, "can't put reply %s to %s", reply.ID, reply.ParentID)
+	}
+
+	parent := store.Comment{}
+	if err = b.load(postBkt, []byte(reply.ParentID), &parent); err != nil {
+		return nil // parent not created yet, will be indexed by indexParent
+	}
+	return b.indexUserReply(tx, parent.User.ID, reply)
+}
+
+// indexParent adds replies already in the replies index to "user_replies" of comment's author.
+// Replies can be created before the parent comment on concurrent import only. Should run in update tx
+func (b *BoltDB) indexParent(tx *bolt.Tx, postBkt *bolt.Bucket, comment store.Comment) error {
+	parentBkt := tx.Bucket([]byte(repliesBucketName)).Bucket([]byte(comment.ID))
+	if parentBkt == nil {
+		return nil
+	}
+	return parentBkt.ForEach(func(_, v []byte) error {
+		_, replyID, err := b.parseRef(v)
+		if err != nil {
+			return err
+		}
+		reply := store.Comment{}
+		if err = b.load(postBkt, []byte(replyID), &reply); err != nil {
+			return errors.Wrapf(err, "can't load reply %s", replyID)
+		}
+		return b.indexUserReply(tx, comment.User.ID, reply)
+	})
+}
+
+// indexUserReply puts reference to the reply to "user_replies" bucket of parentUserID. Should run in update tx
+func (b *BoltDB) indexUserReply(tx *bolt.Tx, parentUserID string, reply store.Comment) error {
+	if parentUserID == reply.User.ID || parentUserID == "" {
+		return nil // not interested in replies to yourself
+	}
+	userBkt, err := tx.Bucket([]byte(userRepliesBktName)).CreateBucketIfNotExists([]byte(parentUserID))
+	if err != nil {
+		return errors.Wrapf(err, "can't get user replies bucket %s", parentUserID)
+	}
+	return errors.Wrapf(userBkt.Put(b.makeReplyKey(reply), b.makeRef(reply)),
+		"can't put reply %s for user %s", reply.ID, parentUserID)
+}
+
+// unindexReply removes reply from "replies" and "user_replies" buckets. Should run in update tx
+func (b *BoltDB) unindexReply(tx *bolt.Tx, postBkt *bolt.Bucket, reply store.Comment) error {
+	if reply.ParentID == "" {
+		return nil
+	}
+	key := b.makeReplyKey(reply)
+	if parentBkt := tx.Bucket([]byte(repliesBucketName)).Bucket([]byte(reply.ParentID)); parentBkt != nil {
+		if err := parentBkt.Delete(key); err != nil {
+			return errors.Wrapf(err, "can't delete reply %s from %s", reply.ID, reply.ParentID)
+		}
+	}
+	parent := store.Comment{}
+	if err := b.load(postBkt, []byte(reply.ParentID), &parent); err != nil {
+		return nil
+	}
+	if userBkt := tx.Bucket([]byte(userRepliesBktName)).Bucket([]byte(parent.User.ID)); userBkt != nil {
+		if err := userBkt.Delete(key); err != nil {
+			return errors.Wrapf(err, "can't delete reply %s for user %s", reply.ID, parent.User.ID)
+		}
+	}
+	return nil
+}
+
+// buildRepliesIndex fills "replies" and "user_replies" buckets from all posts. Used once for db made before the index.
+func (b *BoltDB) buildRepliesIndex(tx *bolt.Tx) error {
+	count := 0
+	postsBkt := tx.Bucket([]byte(postsBucketName))
+	err := postsBkt.ForEach(func(postURL, _ []byte) error {
+		postBkt := postsBkt.Bucket(postURL)
+		if postBkt == nil {
+			return nil
+		}
+		return postBkt.ForEach(func(_, v []byte) error {
+			comment := store.Comment{}
+			if e := b.unmarshal(v, &comment); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			if comment.ParentID == "" || comment.Deleted {
+				return nil
+			}
+			count++
+			return b.indexReply(tx, postBkt, comment)
+		})
+	})
+	if count > 0 {
+		log.Printf("[INFO] replies index created, %d replies", count)
+	}
+	return errors.Wrap(err, "can't build replies index")
+}
+
+// indexPending adds comment waiting for moderation to "pending" bucket and removes it from there otherwise.
+// Should run in update tx
+func (b *BoltDB) indexPending(tx *bolt.Tx, comment store.Comment) error {
+	bkt := tx.Bucket([]byte(pendingBucketName))
+	key := []byte(comment.Timestamp.Format(tsNano) + "!!" + comment.ID)
+	if comment.Pending && !comment.Deleted {
+		return bkt.Put(key, b.makeRef(comment))
+	}
+	return bkt.Delete(key)
+}
+
+// buildPending fills "pending" bucket from all posts, used for db made before the index. Should run in update tx
+func (b *BoltDB) buildPending(tx *bolt.Tx) error {
+	postsBkt := tx.Bucket([]byte(postsBucketName))
+	err := postsBkt.ForEach(func(postURL, _ []byte) error {
+		postBkt := postsBkt.Bucket(postURL)
+		if postBkt == nil {
+			return nil
+		}
+		return postBkt.ForEach(func(_, v []byte) error {
+			comment := store.Comment{}
+			if e := b.unmarshal(v, &comment); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			if !comment.Pending || comment.Deleted {
+				return nil
+			}
+			return b.indexPending(tx, comment)
+		})
+	})
+	return errors.Wrap(err, "can't build pending index")
+}
+
+// addUserStats adds comment to user's entry of users directory. Should run in update tx
+func (b *BoltDB) addUserStats(tx *bolt.Tx, comment store.Comment) error {
+	if comment.Deleted {
+		return nil
+	}
+	bkt := tx.Bucket([]byte(userStatsBktName))
+	stats := store.UserSummary{ID: comment.User.ID}
+	if bkt.Get([]byte(comment.User.ID)) != nil {
+		if err := b.load(bkt, []byte(comment.User.ID), &stats); err != nil {
+			return err
+		}
+	}
+	addToUserSummary(&stats, comment)
+	return b.save(bkt, []byte(comment.User.ID), stats)
+}
+
+// removeUserStats removes deleted comment from user's entry of users directory. The entry rebuilt from user's
+// comments if the removed one was the first or the last. Should run in update tx after comment marked as deleted
+func (b *BoltDB) removeUserStats(tx *bolt.Tx, comment store.Comment) error {
+	bkt := tx.Bucket([]byte(userStatsBktName))
+	if comment.Deleted || bkt.Get([]byte(comment.User.ID)) == nil {
+		return nil
+	}
+	stats := store.UserSummary{}
+	if err := b.load(bkt, []byte(comment.User.ID), &stats); err != nil {
+		return err
+	}
+	if stats.First.Equal(comment.Timestamp) || stats.Last.Equal(comment.Timestamp) {
+		return b.rebuildUserStats(tx, comment.User.ID)
+	}
+	stats.Comments--
+	stats.Score -= comment.Score
+	if stats.Comments <= 0 {
+		return bkt.Delete([]byte(comment.User.ID))
+	}
+	return b.save(bkt, []byte(comment.User.ID), stats)
+}
+
+// addUserScore adds delta to total score of user's entry of users directory. Should run in update tx
+func (b *BoltDB) addUserScore(tx *bolt.Tx, userID string, delta int) error {
+	bkt := tx.Bucket([]byte(userStatsBktName))
+	if delta == 0 || bkt.Get([]byte(userID)) == nil {
+		return nil
+	}
+	stats := store.UserSummary{}
+	if err := b.load(bkt, []byte(userID), &stats); err != nil {
+		return err
+	}
+	stats.Score += delta
+	return b.save(bkt, []byte(userID), stats)
+}
+
+// rebuildUserStats makes user's entry of users directory from all user's comments, removes the entry
+// if user has no comments left. Should run in update tx
+func (b *BoltDB) rebuildUserStats(tx *bolt.Tx, userID string) error {
+	stats := store.UserSummary{ID: userID}
+	if userBkt := tx.Bucket([]byte(userBucketName)).Bucket([]byte(userID)); userBkt != nil {
+		err := userBkt.ForEach(func(_, ref []byte) error {
+			url, commentID, e := b.parseRef(ref)
+			if e != nil {
+				return e
+			}
+			postBkt, e := b.getPostBucket(tx, url)
+			if e != nil {
+				return e
+			}
+			comment := store.Comment{}
+			if e = b.load(postBkt, []byte(commentID), &comment); e != nil {
+				return errors.Wrapf(e, "can't load comment %s", commentID)
+			}
+			if comment.User.ID == userID && !comment.Deleted { // skip deleted and merged to other user
+				addToUserSummary(&stats, comment)
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "can't get comments of %s", userID)
+		}
+	}
+
+	bkt := tx.Bucket([]byte(userStatsBktName))
+	if stats.Comments == 0 {
+		return bkt.Delete([]byte(userID))
+	}
+	return b.save(bkt, []byte(userID), stats)
+}
+
+// buildUserStats fills "user_stats" bucket from comments of all users. Used once for db made before users directory.
+func (b *BoltDB) buildUserStats(tx *bolt.Tx) error {
+	count := 0
+	err := tx.Bucket([]byte(userBucketName)).ForEach(func(userID, _ []byte) error {
+		count++
+		return b.rebuildUserStats(tx, string(userID))
+	})
+	if count > 0 {
+		log.Printf("[INFO] users directory created, %d users", count)
+	}
+	return errors.Wrap(err, "can't build users directory")
+}
+
+// countShadowed adds val to shadow-banned count of comment's post if the author is shadow-banned.
+// Deleted comments not counted. Should run in update tx
+func (b *BoltDB) countShadowed(tx *bolt.Tx, comment store.Comment, val int) error {
+	if comment.Deleted || tx.Bucket([]byte(shadowBucketName)).Get([]byte(comment.User.ID)) == nil {
+		return nil
+	}
+	return b.addShadowCount(tx, comment.Locator.URL, val)
+}
+
+// addShadowCount adds val to number of shadow-banned comments of the post, removes the key when nothing left.
+// Should run in update tx
+func (b *BoltDB) addShadowCount(tx *bolt.Tx, postURL string, val int) error {
+	bkt := tx.Bucket([]byte(shadowCountBktName))
+	count := b.shadowCount(tx, postURL) + val
+	if count <= 0 {
+		return bkt.Delete([]byte(postURL))
+	}
+	return b.save(bkt, []byte(postURL), count)
+}
+
+// shadowCount returns number of not deleted comments of shadow-banned users for the post
+func (b *BoltDB) shadowCount(tx *bolt.Tx, postURL string) (count int) {
+	bkt := tx.Bucket([]byte(shadowCountBktName))
+	if bkt.Get([]byte(postURL)) == nil {
+		return 0
+	}
+	if err := b.load(bkt, []byte(postURL), &count); err != nil {
+		log.Printf("[WARN] can't load shadow-banned count for %s, %v", postURL, err)
+		return 0
+	}
+	return count
+}
+
+// addUserShadowCount adds val to shadow-banned count of posts for each not deleted comment of the user.
+// Used with val=1 when user gets shadow-banned and val=-1 when the ban removed. Should run in update tx
+func (b *BoltDB) addUserShadowCount(tx *bolt.Tx, userID string, val int) error {
+	userBkt := tx.Bucket([]byte(userBucketName)).Bucket([]byte(userID))
+	if userBkt == nil {
+		return nil
+	}
+	counts := map[string]int{}
+	err := userBkt.ForEach(func(_, ref []byte) error {
+		url, commentID, e := b.parseRef(ref)
+		if e != nil {
+			return e
+		}
+		postBkt, e := b.getPostBucket(tx, url)
+		if e != nil {
+			return e
+		}
+		comment := store.Comment{}
+		if e = b.load(postBkt, []byte(commentID), &comment); e != nil {
+			return errors.Wrapf(e, "can't load comment %s", commentID)
+		}
+		if comment.User.ID == userID && !comment.Deleted { // skip deleted and merged to other user
+			counts[url] += val
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't get comments of %s", userID)
+	}
+	for url, delta := range counts {
+		if err = b.addShadowCount(tx, url, delta); err != nil {
+			return errors.Wrapf(err, "can't update shadow-banned count for %s", url)
+		}
+	}
+	return nil
+}
+
+// buildShadowCount fills "shadow_count" bucket from comments of shadow-banned users.
+// Used once for db made before shadow-banned counts.
+func (b *BoltDB) buildShadowCount(tx *bolt.Tx) error {
+	err := tx.Bucket([]byte(shadowBucketName)).ForEach(func(userID, _ []byte) error {
+		return b.addUserShadowCount(tx, string(userID), 1)
+	})
+	return errors.Wrap(err, "can't build shadow-banned counts")
+}
+
+// addToUserSummary counts comment in user's summary, name taken from the most recent comment
+func addToUserSummary(stats *store.UserSummary, comment store.Comment) {
+	if stats.First.IsZero() || comment.Timestamp.Before(stats.First) {
+		stats.First = comment.Timestamp
+	}
+	if !comment.Timestamp.Before(stats.Last) {
+		stats.Last = comment.Timestamp
+		stats.Name = comment.User.Name
+	}
+	stats.Comments++
+	stats.Score += comment.Score
+}
+
 // save marshaled value to key for bucket. Should run in update tx
 func (b *BoltDB) save(bkt *bolt.Bucket, key []byte, value interface{}) (err error) {
 	if value == nil {
@@ -475,12 +1135,30 @@ func (b *BoltDB) save(bkt *bolt.Bucket, key []byte, value interface{}) (err erro
 	if jerr != nil {
 		return errors.Wrap(jerr, "can't marshal comment")
 	}
+	if b.crypter != nil {
+		if jdata, err = b.crypter.Encrypt(jdata); err != nil {
+			return errors.Wrapf(err, "can't encrypt %s", key)
+		}
+	}
 	if err = bkt.Put(key, jdata); err != nil {
 		return errors.Wrapf(err, "failed to save key %s", key)
 	}
 	return nil
 }
 
+// unmarshal decrypts json value if encrypted and unmarshals it to res
+func (b *BoltDB) unmarshal(data []byte, res interface{}) (err error) {
+	if store.IsEncrypted(data) {
+		if b.crypter == nil {
+			return errors.New("encrypted value, secret not set")
+		}
+		if data, err = b.crypter.Decrypt(data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, res)
+}
+
 // load and unmarshal json value by key from bucket. Should run in view tx
 func (b *BoltDB) load(bkt *bolt.Bucket, key []byte, res interface{}) error {
 	value := bkt.Get(key)
@@ -488,7 +1166,7 @@ func (b *BoltDB) load(bkt *bolt.Bucket, key []byte, res interface{}) error {
 		return errors.Errorf("no value for %s", key)
 	}
 
-	if err := json.Unmarshal(value, &res); err != nil {
+	if err := b.unmarshal(value, &res); err != nil {
 		return errors.Wrap(err, "failed to unmarshal")
 	}
 	return nil
@@ -540,6 +1218,11 @@ func (b *BoltDB) makeRef(comment store.Comment) []byte {
 	return []byte(fmt.Sprintf("%s!!%s", comment.Locator.URL, comment.ID))
 }
 
+// makeReplyKey creates key for replies indexes, sorted by time and unique for comment
+func (b *BoltDB) makeReplyKey(comment store.Comment) []byte {
+	return []byte(fmt.Sprintf("%s!!%s", comment.Timestamp.Format(tsNano), comment.ID))
+}
+
 // parseRef gets parts of reference
 func (b *BoltDB) parseRef(val []byte) (url string, id string, err error) {
 	elems := strings.Split(string(val), "!!")
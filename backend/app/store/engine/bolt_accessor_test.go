@@ -147,6 +147,72 @@ func TestBoltDB_LastSince(t *testing.T) {
 	assert.Equal(t, 0, len(res))
 }
 
+func TestBoltDB_Pending(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	res, err := b.Pending("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	for i, ts := range []time.Time{time.Date(2010, 1, 1, 0, 0, 0, 0, time.Local), time.Now()} {
+		c := store.Comment{ID: fmt.Sprintf("p%d", i), Text: "pending", Timestamp: ts, Pending: true,
+			Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, User: store.User{ID: "user2"}}
+		_, err = b.Create(c)
+		require.NoError(t, err)
+	}
+	res, err = b.Pending("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "p1", res[0].ID)
+	assert.Equal(t, "p0", res[1].ID, "old pending comment included")
+
+	// approved comment removed from pending
+	approved := res[1]
+	approved.Pending = false
+	require.NoError(t, b.Put(approved.Locator, approved))
+	res, err = b.Pending("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "p1", res[0].ID)
+
+	// deleted comment removed from pending
+	require.NoError(t, b.Delete(res[0].Locator, "p1", store.SoftDelete))
+	res, err = b.Pending("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(res))
+
+	_, err = b.Pending("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltDB_PendingIndexBuild(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	c := store.Comment{ID: "p1", Text: "pending", Timestamp: time.Now(), Pending: true,
+		Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, User: store.User{ID: "user2"}}
+	_, err := b.Create(c)
+	require.NoError(t, err)
+
+	// drop index bucket to simulate db made before the pending index
+	bdb, err := b.db("radio-t")
+	require.NoError(t, err)
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(pendingBucketName))
+	})
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	b, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+
+	res, err := b.Pending("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "p1", res[0].ID)
+}
+
 func TestBoltDB_Count(t *testing.T) {
 	var b, teardown = prep(t)
 	defer teardown()
@@ -344,6 +410,175 @@ func TestBoltDB_GetForUserCounter(t *testing.T) {
 	assert.EqualError(t, err, `no comments for user userZ in store`)
 }
 
+func TestBoltDB_Replies(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	ts := time.Date(2017, 12, 20, 15, 20, 0, 0, time.Local)
+	replies := []store.Comment{
+		{ID: "r1", ParentID: "id-1", User: store.User{ID: "user2"}, Timestamp: ts},
+		{ID: "r2", ParentID: "id-1", User: store.User{ID: "user3"}, Timestamp: ts.Add(time.Minute)},
+		{ID: "r3", ParentID: "id-2", User: store.User{ID: "user1"}, Timestamp: ts.Add(2 * time.Minute)}, // reply to yourself
+		{ID: "r4", ParentID: "r1", User: store.User{ID: "user1"}, Timestamp: ts.Add(3 * time.Minute)},
+	}
+	for _, r := range replies {
+		r.Locator = store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+		_, err := b.Create(r)
+		require.NoError(t, err)
+	}
+
+	counts, err := b.RepliesCount("radio-t", []string{"id-1", "id-2", "r1", "r2", "bad"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"id-1": 2, "id-2": 1, "r1": 1}, counts)
+
+	res, err := b.UserReplies("radio-t", "user1", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "reply to yourself not included")
+	assert.Equal(t, "r2", res[0].ID)
+	assert.Equal(t, "r1", res[1].ID)
+
+	res, err = b.UserReplies("radio-t", "user1", 1, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "r2", res[0].ID)
+
+	res, err = b.UserReplies("radio-t", "user1", 10, ts)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "r1 made at since ts")
+	assert.Equal(t, "r2", res[0].ID)
+
+	res, err = b.UserReplies("radio-t", "user2", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "r4", res[0].ID)
+
+	err = b.Delete(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "r2", store.SoftDelete)
+	require.NoError(t, err)
+	counts, err = b.RepliesCount("radio-t", []string{"id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"id-1": 1}, counts)
+	res, err = b.UserReplies("radio-t", "user1", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res), "deleted reply removed from index")
+	assert.Equal(t, "r1", res[0].ID)
+
+	_, err = b.UserReplies("bad", "user1", 10, time.Time{})
+	assert.EqualError(t, err, `site "bad" not found`)
+	_, err = b.RepliesCount("bad", []string{"id-1"})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltDB_RepliesBeforeParent(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	// reply created before the parent, possible on concurrent import
+	reply := store.Comment{ID: "r1", ParentID: "p1", User: store.User{ID: "user2"}, Timestamp: time.Now(),
+		Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}}
+	_, err := b.Create(reply)
+	require.NoError(t, err)
+	parent := store.Comment{ID: "p1", User: store.User{ID: "user1"}, Timestamp: time.Now().Add(-time.Minute),
+		Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}}
+	_, err = b.Create(parent)
+	require.NoError(t, err)
+
+	res, err := b.UserReplies("radio-t", "user1", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "r1", res[0].ID)
+}
+
+func TestBoltDB_RepliesIndexBuild(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	reply := store.Comment{ID: "r1", ParentID: "id-1", User: store.User{ID: "user2"}, Timestamp: time.Now(),
+		Locator: store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}}
+	_, err := b.Create(reply)
+	require.NoError(t, err)
+
+	// drop index buckets to simulate db made before the replies index
+	bdb, err := b.db("radio-t")
+	require.NoError(t, err)
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		if e := tx.DeleteBucket([]byte(repliesBucketName)); e != nil {
+			return e
+		}
+		return tx.DeleteBucket([]byte(userRepliesBktName))
+	})
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	b, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+
+	counts, err := b.RepliesCount("radio-t", []string{"id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"id-1": 1}, counts)
+	res, err := b.UserReplies("radio-t", "user1", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "r1", res[0].ID)
+	require.NoError(t, b.Close())
+}
+
+func TestBoltDB_Top(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	ts := time.Date(2017, 12, 21, 10, 0, 0, 0, time.Local)
+	comments := []store.Comment{
+		{ID: "c1", Score: 5, Votes: map[string]bool{"u1": true, "u2": true}, User: store.User{ID: "user1"},
+			Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "radio-t"}, Timestamp: ts},
+		{ID: "c2", Score: 7, Votes: map[string]bool{"u1": true}, User: store.User{ID: "user2"},
+			Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, Timestamp: ts.Add(time.Minute)},
+		{ID: "c3", Score: 1, User: store.User{ID: "user3"},
+			Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, Timestamp: ts.Add(2 * time.Minute)},
+		{ID: "c4", Score: 2, User: store.User{ID: "user2"},
+			Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, Timestamp: ts.Add(3 * time.Minute)},
+	}
+	for _, c := range comments {
+		_, err := b.Create(c)
+		require.NoError(t, err)
+	}
+
+	res, err := b.TopComments("radio-t", 2, ts.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "c2", res[0].ID)
+	assert.Equal(t, "c1", res[1].ID)
+
+	res, err = b.TopComments("radio-t", 10, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 6, len(res), "all comments, including two from prep")
+
+	posts, err := b.TopPosts("radio-t", "comments", 10, ts.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(posts))
+	assert.Equal(t, "https://radio-t.com/2", posts[0].URL)
+	assert.Equal(t, 3, posts[0].Comments)
+	assert.Equal(t, 2, posts[0].Participants)
+	assert.Equal(t, 1, posts[0].Votes)
+	assert.True(t, ts.Add(3*time.Minute).Equal(posts[0].LastTS))
+	assert.Equal(t, "https://radio-t.com/1", posts[1].URL)
+
+	posts, err = b.TopPosts("radio-t", "votes", 10, ts.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(posts))
+	assert.Equal(t, "https://radio-t.com/1", posts[0].URL)
+	assert.Equal(t, 2, posts[0].Votes)
+
+	posts, err = b.TopPosts("radio-t", "participants", 1, ts.Add(90*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(posts))
+	assert.Equal(t, 2, posts[0].Comments, "only comments made since ts")
+
+	_, err = b.TopComments("bad", 10, time.Time{})
+	assert.EqualError(t, err, `site "bad" not found`)
+	_, err = b.TopPosts("bad", "", 10, time.Time{})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
 func TestBoltDB_Ref(t *testing.T) {
 	b := BoltDB{}
 	comment := store.Comment{
@@ -1,7 +1,9 @@
 package engine
 
 import (
-	"encoding/json"
+	"encoding/binary"
+	"sort"
+	"strings"
 	"time"
 
 	bolt "github.com/coreos/bbolt"
@@ -11,6 +13,11 @@ import (
 	"github.com/umputun/remark/backend/app/store"
 )
 
+const (
+	siteSettingsKey    = "site"
+	restrictedRulesKey = "restricted"
+)
+
 // Delete removes comment, by locator from the store.
 // Posts collection only sets status to deleted and clear fields in order to prevent breaking trees of replies.
 // From last bucket removed for real.
@@ -32,12 +39,41 @@ func (b *BoltDB) Delete(locator store.Locator, commentID string, mode store.Dele
 		if err = b.load(postBkt, []byte(commentID), &comment); err != nil {
 			return errors.Wrapf(err, "can't load key %s from bucket %s", commentID, locator.URL)
 		}
+
+		// remove from replies index, deleted comments are not counted as replies
+		if err = b.unindexReply(tx, postBkt, comment); err != nil {
+			return errors.Wrapf(err, "can't remove %s from replies index", commentID)
+		}
+
 		// set deleted status and clear fields
+		orig := comment
 		comment.SetDeleted(mode)
+		if !orig.Deleted {
+			ts := time.Now()
+			comment.DeletedAt = &ts
+		}
 
 		if err = b.save(postBkt, []byte(commentID), comment); err != nil {
 			return errors.Wrapf(err, "can't save deleted comment for key %s from bucket %s", commentID, locator.URL)
 		}
+		if orig.Deleted {
+			return nil // counters and indexes updated on the first deletion, i.e. soft delete followed by hard one
+		}
+
+		// remove from user's entry of users directory
+		if err = b.removeUserStats(tx, orig); err != nil {
+			return errors.Wrapf(err, "can't update stats of %s", orig.User.ID)
+		}
+
+		// remove from pending index
+		if err = b.indexPending(tx, comment); err != nil {
+			return errors.Wrapf(err, "can't remove %s from pending index", commentID)
+		}
+
+		// remove from shadow-banned count of the post
+		if err = b.countShadowed(tx, orig, -1); err != nil {
+			return errors.Wrapf(err, "can't update shadow-banned count for %s", locator.URL)
+		}
 
 		// delete from "last" bucket
 		lastBkt := tx.Bucket([]byte(lastBucketName))
@@ -63,7 +99,9 @@ func (b *BoltDB) DeleteAll(siteID string) error {
 	}
 
 	// delete all buckets except blocked users
-	toDelete := []string{postsBucketName, lastBucketName, userBucketName, infoBucketName}
+	toDelete := []string{postsBucketName, lastBucketName, userBucketName, infoBucketName,
+		repliesBucketName, userRepliesBktName, userStatsBktName, trashBucketName, shadowCountBktName,
+		pendingBucketName}
 
 	// delete top-level buckets
 	err = bdb.Update(func(tx *bolt.Tx) error {
@@ -109,7 +147,7 @@ func (b *BoltDB) DeleteUser(siteID string, userID string) error {
 			postBkt := postsBkt.Bucket([]byte(postInfo.URL))
 			err = postBkt.ForEach(func(postURL []byte, commentVal []byte) error {
 				comment := store.Comment{}
-				if err = json.Unmarshal(commentVal, &comment); err != nil {
+				if err = b.unmarshal(commentVal, &comment); err != nil {
 					return errors.Wrap(err, "failed to unmarshal")
 				}
 				if comment.User.ID == userID {
@@ -141,7 +179,13 @@ func (b *BoltDB) DeleteUser(siteID string, userID string) error {
 				return errors.Wrapf(err, "failed to delete user bucket for %s", userID)
 			}
 		}
-		return nil
+		userRepliesBkt := tx.Bucket([]byte(userRepliesBktName))
+		if userRepliesBkt != nil && userRepliesBkt.Bucket([]byte(userID)) != nil {
+			if e := userRepliesBkt.DeleteBucket([]byte(userID)); e != nil {
+				return errors.Wrapf(e, "failed to delete user replies bucket for %s", userID)
+			}
+		}
+		return errors.Wrapf(tx.Bucket([]byte(userStatsBktName)).Delete([]byte(userID)), "failed to delete stats of %s", userID)
 	})
 
 	if err != nil {
@@ -155,92 +199,350 @@ func (b *BoltDB) DeleteUser(siteID string, userID string) error {
 	return err
 }
 
+// ClearIPs removes ip hashes from comments made before ts, of all users if userID empty.
+// Returns number of updated comments.
+func (b *BoltDB) ClearIPs(siteID, userID string, before time.Time) (count int, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		postsBkt := tx.Bucket([]byte(postsBucketName))
+		return postsBkt.ForEach(func(postURL []byte, _ []byte) error {
+			postBkt := postsBkt.Bucket(postURL)
+			if postBkt == nil {
+				return nil
+			}
+			// collect first, bucket can't be modified inside of ForEach
+			updated := []store.Comment{}
+			e := postBkt.ForEach(func(k, v []byte) error {
+				comment := store.Comment{}
+				if e := b.unmarshal(v, &comment); e != nil {
+					return errors.Wrapf(e, "failed to unmarshal %s", k)
+				}
+				if comment.User.IP != "" && comment.Timestamp.Before(before) && (userID == "" || comment.User.ID == userID) {
+					comment.User.IP = ""
+					updated = append(updated, comment)
+				}
+				return nil
+			})
+			if e != nil {
+				return errors.Wrapf(e, "can't collect comments of %s", postURL)
+			}
+			for _, c := range updated {
+				if e = b.save(postBkt, []byte(c.ID), c); e != nil {
+					return e
+				}
+			}
+			count += len(updated)
+			return nil
+		})
+	})
+	return count, err
+}
+
+// MergeUser moves comments, votes, user's indexes and moderation journal of fromID user to toID.
+// Keeps union of verified, blocked and shadow-ban flags, the longest block wins.
+func (b *BoltDB) MergeUser(siteID, fromID, toID string) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+
+	return bdb.Update(func(tx *bolt.Tx) error {
+		// uncount comments of both users, counted again for merged user with merged shadow-ban flag
+		shadowBkt := tx.Bucket([]byte(shadowBucketName))
+		for _, userID := range []string{fromID, toID} {
+			if shadowBkt.Get([]byte(userID)) == nil {
+				continue
+			}
+			if e := b.addUserShadowCount(tx, userID, -1); e != nil {
+				return errors.Wrapf(e, "failed to update shadow-banned count of %s", userID)
+			}
+		}
+
+		// rewrite author and votes in all comments
+		authors := map[string]bool{toID: true, fromID: true} // users with changed stats
+		postsBkt := tx.Bucket([]byte(postsBucketName))
+		err := postsBkt.ForEach(func(postURL []byte, _ []byte) error {
+			postBkt := postsBkt.Bucket(postURL)
+			if postBkt == nil {
+				return nil
+			}
+			changed := []store.Comment{}
+			e := postBkt.ForEach(func(_ []byte, commentVal []byte) error {
+				comment := store.Comment{}
+				if e := b.unmarshal(commentVal, &comment); e != nil {
+					return errors.Wrap(e, "failed to unmarshal")
+				}
+				updated := mergeVotes(&comment, fromID, toID)
+				if comment.User.ID == fromID {
+					comment.User.ID = toID
+					updated = true
+				}
+				if updated {
+					changed = append(changed, comment)
+					authors[comment.User.ID] = true
+				}
+				return nil
+			})
+			if e != nil {
+				return errors.Wrapf(e, "failed to collect comments of %s", string(postURL))
+			}
+			for _, c := range changed {
+				if e = b.save(postBkt, []byte(c.ID), c); e != nil {
+					return errors.Wrapf(e, "failed to save comment %s", c.ID)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, bktName := range []string{userBucketName, userRepliesBktName, moderationBktName} {
+			if e := b.mergeNested(tx.Bucket([]byte(bktName)), fromID, toID); e != nil {
+				return errors.Wrapf(e, "failed to merge %s of %s", bktName, fromID)
+			}
+		}
+		for userID := range authors {
+			if e := b.rebuildUserStats(tx, userID); e != nil {
+				return errors.Wrapf(e, "failed to update stats of %s", userID)
+			}
+		}
+
+		keepTo := func(from, to []byte) bool { return to != nil }
+		keepLongerBlock := func(from, to []byte) bool {
+			fromRec, e := b.parseBlockRecord(from)
+			if e != nil || to == nil {
+				return to != nil
+			}
+			toRec, e := b.parseBlockRecord(to)
+			return e == nil && !fromRec.Until.After(toRec.Until)
+		}
+		flags := []struct {
+			bktName string
+			keepTo  func(from, to []byte) bool
+		}{{verifiedBucketName, keepTo}, {shadowBucketName, keepTo}, {blocksBucketName, keepLongerBlock}}
+		for _, f := range flags {
+			bkt := tx.Bucket([]byte(f.bktName))
+			from := bkt.Get([]byte(fromID))
+			if from == nil {
+				continue
+			}
+			if !f.keepTo(from, bkt.Get([]byte(toID))) {
+				if e := bkt.Put([]byte(toID), from); e != nil {
+					return errors.Wrapf(e, "failed to put %s to %s", toID, f.bktName)
+				}
+			}
+			if e := bkt.Delete([]byte(fromID)); e != nil {
+				return errors.Wrapf(e, "failed to clean %s from %s", fromID, f.bktName)
+			}
+		}
+		if shadowBkt.Get([]byte(toID)) != nil {
+			if e := b.addUserShadowCount(tx, toID, 1); e != nil {
+				return errors.Wrapf(e, "failed to update shadow-banned count of %s", toID)
+			}
+		}
+		return errors.Wrapf(tx.Bucket([]byte(trustBucketName)).Delete([]byte(fromID)), "failed to clean trust of %s", fromID)
+	})
+}
+
+// mergeNested moves all records of fromID sub-bucket to toID sub-bucket and removes fromID sub-bucket
+func (b *BoltDB) mergeNested(bkt *bolt.Bucket, fromID, toID string) error {
+	fromBkt := bkt.Bucket([]byte(fromID))
+	if fromBkt == nil {
+		return nil
+	}
+	toBkt, err := bkt.CreateBucketIfNotExists([]byte(toID))
+	if err != nil {
+		return err
+	}
+	if err = fromBkt.ForEach(func(k, v []byte) error { return toBkt.Put(k, v) }); err != nil {
+		return err
+	}
+	return bkt.DeleteBucket([]byte(fromID))
+}
+
+// Users returns users directory of the site, filtered by prefix of user id or name (case-insensitive),
+// sorted and paginated. Uses userStatsBktName with key=userID and val=store.UserSummary
+func (b *BoltDB) Users(req UsersRequest) (users []store.UserSummary, total int, err error) {
+	users = []store.UserSummary{}
+	bdb, err := b.db(req.SiteID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := strings.ToLower(req.Query)
+	err = bdb.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(userStatsBktName)).ForEach(func(_, v []byte) error {
+			stats := store.UserSummary{}
+			if e := b.unmarshal(v, &stats); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			if strings.HasPrefix(stats.ID, req.Query) || strings.HasPrefix(strings.ToLower(stats.Name), query) {
+				users = append(users, stats)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "can't get users of %s", req.SiteID)
+	}
+
+	total = len(users)
+	users = SortUsers(users, req.Sort)
+	if req.Skip > 0 {
+		if req.Skip >= len(users) {
+			return []store.UserSummary{}, total, nil
+		}
+		users = users[req.Skip:]
+	}
+	if req.Limit <= 0 || req.Limit > usersLimit {
+		req.Limit = usersLimit
+	}
+	if len(users) > req.Limit {
+		users = users[:req.Limit]
+	}
+	return users, total, nil
+}
+
 // SetBlock blocks/unblocks user for given site. ttl defines for for how long, 0 - permanent
-// block uses blocksBucketName with key=userID and val=TTL+now
-func (b *BoltDB) SetBlock(siteID string, userID string, status bool, ttl time.Duration) error {
+// block uses blocksBucketName with key=userID and val=blockRecord
+func (b *BoltDB) SetBlock(siteID string, userID string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	return b.setBlock(siteID, blocksBucketName, userID, status, ttl, bi)
+}
+
+// IsBlocked checks if user blocked
+func (b *BoltDB) IsBlocked(siteID string, userID string) (blocked bool) {
+	return b.isBlocked(siteID, blocksBucketName, userID)
+}
+
+// Blocked get lists of blocked users for given site
+// bucket uses userID:
+func (b *BoltDB) Blocked(siteID string) (users []store.BlockedUser, err error) {
+	if users, err = b.blocked(siteID, blocksBucketName); err != nil {
+		return nil, err
+	}
+	for i := range users {
+		// get user name from comment user section
+		userComments, errUser := b.User(siteID, users[i].ID, 1, 0)
+		if errUser == nil && len(userComments) > 0 {
+			users[i].Name = userComments[0].User.Name
+		}
+	}
+	return users, nil
+}
 
+// SetBlockIP blocks/unblocks ip hash for given site. ttl defines for for how long, 0 - permanent
+// block uses blockIPBucketName with key=ip and val=blockRecord
+func (b *BoltDB) SetBlockIP(siteID string, ip string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	return b.setBlock(siteID, blockIPBucketName, ip, status, ttl, bi)
+}
+
+// IsBlockedIP checks if ip hash blocked
+func (b *BoltDB) IsBlockedIP(siteID string, ip string) bool {
+	return b.isBlocked(siteID, blockIPBucketName, ip)
+}
+
+// BlockedIPs get lists of blocked ip hashes for given site
+func (b *BoltDB) BlockedIPs(siteID string) (ips []store.BlockedUser, err error) {
+	if ips, err = b.blocked(siteID, blockIPBucketName); err != nil {
+		return nil, err
+	}
+	for i := range ips {
+		ips[i].IP = true
+	}
+	return ips, nil
+}
+
+// blockRecord stored as a value in blocks buckets
+type blockRecord struct {
+	Until time.Time `json:"until"`
+	store.BlockInfo
+}
+
+func (b *BoltDB) setBlock(siteID, bktName, key string, status bool, ttl time.Duration, bi store.BlockInfo) error {
 	bdb, err := b.db(siteID)
 	if err != nil {
 		return err
 	}
 
 	return bdb.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(blocksBucketName))
+		bucket := tx.Bucket([]byte(bktName))
 		switch status {
 		case true:
-			val := time.Now().AddDate(100, 0, 0).Format(tsNano) // permanent is 100 year
+			rec := blockRecord{Until: time.Now().AddDate(100, 0, 0), BlockInfo: bi} // permanent is 100 year
 			if ttl > 0 {
-				val = time.Now().Add(ttl).Format(tsNano)
+				rec.Until = time.Now().Add(ttl)
 			}
-			if e := bucket.Put([]byte(userID), []byte(val)); e != nil {
-				return errors.Wrapf(e, "failed to put %s to %s", userID, blocksBucketName)
+			if e := b.save(bucket, []byte(key), rec); e != nil {
+				return errors.Wrapf(e, "failed to put %s to %s", key, bktName)
 			}
 		case false:
-			if e := bucket.Delete([]byte(userID)); e != nil {
-				return errors.Wrapf(e, "failed to clean %s from %s", userID, blocksBucketName)
+			if e := bucket.Delete([]byte(key)); e != nil {
+				return errors.Wrapf(e, "failed to clean %s from %s", key, bktName)
 			}
 		}
 		return nil
 	})
 }
 
-// IsBlocked checks if user blocked
-func (b *BoltDB) IsBlocked(siteID string, userID string) (blocked bool) {
-
+func (b *BoltDB) isBlocked(siteID, bktName, key string) (blocked bool) {
 	bdb, err := b.db(siteID)
 	if err != nil {
 		return false
 	}
 
 	_ = bdb.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(blocksBucketName))
-		val := bucket.Get([]byte(userID))
+		val := tx.Bucket([]byte(bktName)).Get([]byte(key))
 		if val == nil {
-			blocked = false
 			return nil
 		}
-
-		until, e := time.Parse(tsNano, string(val))
+		rec, e := b.parseBlockRecord(val)
 		if e != nil {
-			blocked = false
 			return nil
 		}
-		blocked = time.Now().Before(until)
+		blocked = time.Now().Before(rec.Until)
 		return nil
 	})
 	return blocked
 }
 
-// Blocked get lists of blocked users for given site
-// bucket uses userID:
-func (b *BoltDB) Blocked(siteID string) (users []store.BlockedUser, err error) {
-	users = []store.BlockedUser{}
+// blocked lists active blocks from the bucket, user names not filled
+func (b *BoltDB) blocked(siteID, bktName string) (res []store.BlockedUser, err error) {
+	res = []store.BlockedUser{}
 	bdb, err := b.db(siteID)
 	if err != nil {
 		return nil, err
 	}
 
 	err = bdb.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(blocksBucketName))
+		bucket := tx.Bucket([]byte(bktName))
 		return bucket.ForEach(func(k []byte, v []byte) error {
-			ts, errParse := time.ParseInLocation(tsNano, string(v), time.Local)
+			rec, errParse := b.parseBlockRecord(v)
 			if errParse != nil {
 				return errors.Wrap(errParse, "can't parse block ts")
 			}
-			if time.Now().Before(ts) {
-				// get user name from comment user section
-				userName := ""
-				userComments, errUser := b.User(siteID, string(k), 1, 0)
-				if errUser == nil && len(userComments) > 0 {
-					userName = userComments[0].User.Name
-				}
-				users = append(users, store.BlockedUser{ID: string(k), Name: userName, Until: ts})
+			if time.Now().Before(rec.Until) {
+				res = append(res, store.BlockedUser{ID: string(k), Until: rec.Until, BlockInfo: rec.BlockInfo})
 			}
 			return nil
 		})
 	})
 
-	return users, err
+	return res, err
+}
+
+// parseBlockRecord decodes block value. Old records have the plain until ts without reason and admin
+func (b *BoltDB) parseBlockRecord(val []byte) (rec blockRecord, err error) {
+	if store.IsEncrypted(val) || len(val) > 0 && val[0] == '{' {
+		err = b.unmarshal(val, &rec)
+		return rec, errors.Wrap(err, "can't unmarshal block record")
+	}
+	rec.Until, err = time.ParseInLocation(tsNano, string(val), time.Local)
+	return rec, err
 }
 
 // SetReadOnly makes post read-only or reset the ro flag
@@ -337,3 +639,545 @@ func (b *BoltDB) Verified(siteID string) (ids []string, err error) {
 	})
 	return ids, err
 }
+
+// SetShadowBan makes user shadow-banned or reset the flag
+func (b *BoltDB) SetShadowBan(siteID string, userID string, status bool) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+
+	return bdb.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(shadowBucketName))
+		if (bucket.Get([]byte(userID)) != nil) == status {
+			return nil // status not changed, counts of posts stay as is
+		}
+		switch status {
+		case true:
+			if e := bucket.Put([]byte(userID), []byte(time.Now().Format(tsNano))); e != nil {
+				return errors.Wrapf(e, "failed to set shadow-ban status for %s", userID)
+			}
+			return errors.Wrapf(b.addUserShadowCount(tx, userID, 1), "failed to count comments of %s", userID)
+		default:
+			if e := bucket.Delete([]byte(userID)); e != nil {
+				return errors.Wrapf(e, "failed to clean shadow-ban status for %s", userID)
+			}
+			return errors.Wrapf(b.addUserShadowCount(tx, userID, -1), "failed to uncount comments of %s", userID)
+		}
+	})
+}
+
+// IsShadowBanned checks if user shadow-banned
+func (b *BoltDB) IsShadowBanned(siteID string, userID string) (banned bool) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return false
+	}
+
+	_ = bdb.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(shadowBucketName))
+		banned = bucket.Get([]byte(userID)) != nil
+		return nil
+	})
+	return banned
+}
+
+// ShadowBanned returns list of shadow-banned userIDs
+func (b *BoltDB) ShadowBanned(siteID string) (ids []string, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		usersBkt := tx.Bucket([]byte(shadowBucketName))
+		_ = usersBkt.ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+		return nil
+	})
+	return ids, err
+}
+
+// Trust returns stored trust level of the user, empty if nothing set
+func (b *BoltDB) Trust(siteID string, userID string) (trust store.UserTrust, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return trust, err
+	}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(trustBucketName))
+		if bkt.Get([]byte(userID)) == nil {
+			return nil
+		}
+		return b.load(bkt, []byte(userID), &trust)
+	})
+	return trust, errors.Wrapf(err, "can't load trust for %s", userID)
+}
+
+// SetTrust saves trust level of the user
+func (b *BoltDB) SetTrust(siteID string, userID string, trust store.UserTrust) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(trustBucketName))
+		return errors.Wrapf(b.save(bkt, []byte(userID), trust), "can't save trust for %s", userID)
+	})
+}
+
+// Profile returns stored profile of the user, empty if nothing set
+func (b *BoltDB) Profile(siteID string, userID string) (profile store.Profile, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return profile, err
+	}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(profileBucketName))
+		if bkt.Get([]byte(userID)) == nil {
+			return nil
+		}
+		return b.load(bkt, []byte(userID), &profile)
+	})
+	return profile, errors.Wrapf(err, "can't load profile for %s", userID)
+}
+
+// SetProfile saves profile of the user and sets its name and picture in all user's comments
+func (b *BoltDB) SetProfile(siteID string, profile store.Profile) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		if e := b.save(tx.Bucket([]byte(profileBucketName)), []byte(profile.ID), profile); e != nil {
+			return errors.Wrapf(e, "can't save profile for %s", profile.ID)
+		}
+
+		userBkt := tx.Bucket([]byte(userBucketName)).Bucket([]byte(profile.ID))
+		if userBkt == nil {
+			return nil // no comments
+		}
+		refs := [][]byte{}
+		if e := userBkt.ForEach(func(_, ref []byte) error { refs = append(refs, ref); return nil }); e != nil {
+			return errors.Wrapf(e, "can't get comments of %s", profile.ID)
+		}
+
+		for _, ref := range refs {
+			url, commentID, e := b.parseRef(ref)
+			if e != nil {
+				return e
+			}
+			postBkt, e := b.getPostBucket(tx, url)
+			if e != nil {
+				return e
+			}
+			comment := store.Comment{}
+			if e = b.load(postBkt, []byte(commentID), &comment); e != nil {
+				return errors.Wrapf(e, "can't load comment %s", commentID)
+			}
+			if comment.User.ID != profile.ID { // deleted comment
+				continue
+			}
+			comment.User.Name, comment.User.Picture = profile.Name, profile.Picture
+			if e = b.save(postBkt, []byte(commentID), comment); e != nil {
+				return errors.Wrapf(e, "can't save comment %s", commentID)
+			}
+		}
+		return b.rebuildUserStats(tx, profile.ID)
+	})
+}
+
+// AddModeration adds record to moderation journal.
+// Journal uses moderationBktName with nested bucket for each user, key=ts!action and val=record
+func (b *BoltDB) AddModeration(rec store.ModerationRecord) error {
+	bdb, err := b.db(rec.SiteID)
+	if err != nil {
+		return err
+	}
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		userBkt, e := tx.Bucket([]byte(moderationBktName)).CreateBucketIfNotExists([]byte(rec.UserID))
+		if e != nil {
+			return errors.Wrapf(e, "can't make moderation bucket for %s", rec.UserID)
+		}
+		key := rec.Timestamp.Format(tsNano) + "!" + string(rec.Action)
+		return errors.Wrapf(b.save(userBkt, []byte(key), rec), "can't save moderation record for %s", rec.UserID)
+	})
+}
+
+// Moderation returns moderation journal of the user or all users if userID empty, sorted by time
+func (b *BoltDB) Moderation(siteID string, userID string) (records []store.ModerationRecord, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+	records = []store.ModerationRecord{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(moderationBktName))
+		loadUser := func(userBkt *bolt.Bucket) error {
+			return userBkt.ForEach(func(k, v []byte) error {
+				rec := store.ModerationRecord{}
+				if e := b.unmarshal(v, &rec); e != nil {
+					return errors.Wrap(e, "failed to unmarshal")
+				}
+				records = append(records, rec)
+				return nil
+			})
+		}
+		if userID != "" {
+			if userBkt := bkt.Bucket([]byte(userID)); userBkt != nil {
+				return loadUser(userBkt)
+			}
+			return nil
+		}
+		return bkt.ForEach(func(k, _ []byte) error {
+			if userBkt := bkt.Bucket(k); userBkt != nil {
+				return loadUser(userBkt)
+			}
+			return nil
+		})
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	return records, errors.Wrapf(err, "can't load moderation journal for %s", siteID)
+}
+
+// SaveDeletion adds or replaces deletion request. Uses deletionBktName with key=id and val=request
+func (b *BoltDB) SaveDeletion(req store.DeletionRequest) error {
+	bdb, err := b.db(req.SiteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		return errors.Wrapf(b.save(tx.Bucket([]byte(deletionBktName)), []byte(req.ID), req),
+			"can't save deletion request %s", req.ID)
+	})
+}
+
+// Deletions returns all deletion requests of the site, sorted by creation time
+func (b *BoltDB) Deletions(siteID string) (reqs []store.DeletionRequest, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+	reqs = []store.DeletionRequest{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(deletionBktName)).ForEach(func(_, v []byte) error {
+			req := store.DeletionRequest{}
+			if e := b.unmarshal(v, &req); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			reqs = append(reqs, req)
+			return nil
+		})
+	})
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Created.Before(reqs[j].Created) })
+	return reqs, errors.Wrapf(err, "can't load deletion requests for %s", siteID)
+}
+
+// SaveTrash adds or replaces content of deleted comment. Uses trashBucketName with key=commentID and val=entry
+func (b *BoltDB) SaveTrash(entry store.TrashEntry) error {
+	bdb, err := b.db(entry.SiteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		return errors.Wrapf(b.save(tx.Bucket([]byte(trashBucketName)), []byte(entry.ID), entry),
+			"can't save %s to trash", entry.ID)
+	})
+}
+
+// Trash returns content of all deleted comments kept for the site, sorted by deletion time
+func (b *BoltDB) Trash(siteID string) (entries []store.TrashEntry, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+	entries = []store.TrashEntry{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(trashBucketName)).ForEach(func(_, v []byte) error {
+			entry := store.TrashEntry{}
+			if e := b.unmarshal(v, &entry); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Deleted.Before(entries[j].Deleted) })
+	return entries, errors.Wrapf(err, "can't load trash for %s", siteID)
+}
+
+// RemoveTrash removes content of deleted comments from trash, missing ids ignored
+func (b *BoltDB) RemoveTrash(siteID string, commentIDs []string) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(trashBucketName))
+		for _, id := range commentIDs {
+			if e := bkt.Delete([]byte(id)); e != nil {
+				return errors.Wrapf(e, "can't remove %s from trash", id)
+			}
+		}
+		return nil
+	})
+}
+
+// AppendChange adds record to change log with the next sequence number of the site
+func (b *BoltDB) AppendChange(change store.Change) (seq int64, err error) {
+	bdb, err := b.db(change.SiteID)
+	if err != nil {
+		return 0, err
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(changeLogBktName))
+		next, e := bkt.NextSequence()
+		if e != nil {
+			return errors.Wrap(e, "can't get next sequence")
+		}
+		change.Seq = int64(next)
+		return b.save(bkt, seqKey(change.Seq), change)
+	})
+	return change.Seq, errors.Wrapf(err, "can't append change for %s", change.SiteID)
+}
+
+// Changes returns change log records with seq after since, up to limit, ordered by seq
+func (b *BoltDB) Changes(siteID string, since int64, limit int) (changes []store.Change, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+	changes = []store.Change{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(changeLogBktName)).Cursor()
+		for k, v := c.Seek(seqKey(since + 1)); k != nil && (limit <= 0 || len(changes) < limit); k, v = c.Next() {
+			change := store.Change{}
+			if e := b.unmarshal(v, &change); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	return changes, errors.Wrapf(err, "can't load changes for %s", siteID)
+}
+
+// CompactChanges removes change log records made before ts, returns number of removed records
+func (b *BoltDB) CompactChanges(siteID string, before time.Time) (count int, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return 0, err
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(changeLogBktName))
+		keys := [][]byte{}
+		c := bkt.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			change := store.Change{}
+			if e := b.unmarshal(v, &change); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			if !change.Timestamp.Before(before) {
+				break // records ordered by seq, the rest made later
+			}
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if e := bkt.Delete(k); e != nil {
+				return errors.Wrapf(e, "can't remove change %d", binary.BigEndian.Uint64(k))
+			}
+		}
+		count = len(keys)
+		return nil
+	})
+	return count, errors.Wrapf(err, "can't compact changes for %s", siteID)
+}
+
+// RedactChanges removes user's data from change log, or moves it to anon user if anon.ID set.
+// Returns number of changed and removed records.
+func (b *BoltDB) RedactChanges(siteID, userID string, anon store.User) (count int, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return 0, err
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(changeLogBktName))
+		removed, updated := [][]byte{}, []store.Change{}
+		e := bkt.ForEach(func(k, v []byte) error {
+			change := store.Change{}
+			if e := b.unmarshal(v, &change); e != nil {
+				return errors.Wrap(e, "failed to unmarshal")
+			}
+			keep, changed := redactChange(&change, userID, anon)
+			switch {
+			case !keep:
+				removed = append(removed, k)
+			case changed:
+				updated = append(updated, change)
+			}
+			return nil
+		})
+		if e != nil {
+			return e
+		}
+		for _, k := range removed {
+			if e = bkt.Delete(k); e != nil {
+				return errors.Wrapf(e, "can't remove change %d", binary.BigEndian.Uint64(k))
+			}
+		}
+		for _, c := range updated {
+			if e = b.save(bkt, seqKey(c.Seq), c); e != nil {
+				return e
+			}
+		}
+		count = len(removed) + len(updated)
+		return nil
+	})
+	return count, errors.Wrapf(err, "can't redact changes of %s", userID)
+}
+
+// seqKey makes key of change log record, sorted by seq
+func seqKey(seq int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(seq))
+	return key
+}
+
+// Settings returns per-site settings, empty if nothing set
+func (b *BoltDB) Settings(siteID string) (settings store.SiteSettings, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return settings, err
+	}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(settingsBucketName))
+		if bkt.Get([]byte(siteSettingsKey)) == nil {
+			return nil
+		}
+		return b.load(bkt, []byte(siteSettingsKey), &settings)
+	})
+	return settings, errors.Wrapf(err, "can't load settings for %s", siteID)
+}
+
+// SetSettings saves per-site settings, replaces previously set
+func (b *BoltDB) SetSettings(siteID string, settings store.SiteSettings) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(settingsBucketName))
+		return errors.Wrapf(b.save(bkt, []byte(siteSettingsKey), settings), "can't save settings for %s", siteID)
+	})
+}
+
+// RestrictedRules returns per-site restricted rules, empty if nothing set
+func (b *BoltDB) RestrictedRules(siteID string) (rules []store.RestrictedRule, err error) {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return nil, err
+	}
+	rules = []store.RestrictedRule{}
+	err = bdb.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(settingsBucketName))
+		if bkt.Get([]byte(restrictedRulesKey)) == nil {
+			return nil
+		}
+		return b.load(bkt, []byte(restrictedRulesKey), &rules)
+	})
+	return rules, errors.Wrapf(err, "can't load restricted rules for %s", siteID)
+}
+
+// SetRestrictedRules saves per-site restricted rules, replaces previously set
+func (b *BoltDB) SetRestrictedRules(siteID string, rules []store.RestrictedRule) error {
+	bdb, err := b.db(siteID)
+	if err != nil {
+		return err
+	}
+	return bdb.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(settingsBucketName))
+		return errors.Wrapf(b.save(bkt, []byte(restrictedRulesKey), rules), "can't save restricted rules for %s", siteID)
+	})
+}
+
+// RotateBoltKey re-encrypts json values of bolt file in place, values encrypted by from crypter
+// encrypted again by to. Nil from used to encrypt plain db, nil to decrypts it. Returns number of updated values.
+// Should run on closed db, i.e. with server stopped.
+func RotateBoltKey(fileName string, options bolt.Options, from, to *store.Crypter) (count int, err error) {
+	db, err := bolt.Open(fileName, 0600, &options)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to open boltdb %s", fileName)
+	}
+	defer func() {
+		if e := db.Close(); e != nil {
+			log.Printf("[WARN] can't close %s, %v", fileName, e)
+		}
+	}()
+
+	recode := func(val []byte) (res []byte, changed bool, err error) {
+		if store.IsEncrypted(val) {
+			if from == nil {
+				return nil, false, errors.New("encrypted value, old secret not set")
+			}
+			if val, err = from.Decrypt(val); err != nil {
+				return nil, false, err
+			}
+		} else if to == nil || len(val) == 0 || (val[0] != '{' && val[0] != '[') {
+			return val, false, nil // not json or plain json kept plain
+		}
+		if to == nil {
+			return val, true, nil
+		}
+		res, err = to.Encrypt(val)
+		return res, err == nil, err
+	}
+
+	var walk func(bkt *bolt.Bucket) error
+	walk = func(bkt *bolt.Bucket) error {
+		updates := map[string][]byte{}
+		nested := [][]byte{}
+		err := bkt.ForEach(func(k, v []byte) error {
+			if v == nil {
+				nested = append(nested, k)
+				return nil
+			}
+			res, changed, e := recode(v)
+			if e != nil {
+				return errors.Wrapf(e, "can't re-encrypt %s", string(k))
+			}
+			if changed {
+				updates[string(k)] = res
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range updates {
+			if e := bkt.Put([]byte(k), v); e != nil {
+				return errors.Wrapf(e, "can't save %s", k)
+			}
+			count++
+		}
+		for _, k := range nested {
+			if e := walk(bkt.Bucket(k)); e != nil {
+				return errors.Wrapf(e, "bucket %s", string(k))
+			}
+		}
+		return nil
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bkt *bolt.Bucket) error {
+			return errors.Wrapf(walk(bkt), "bucket %s", string(name))
+		})
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to re-encrypt %s", fileName)
+	}
+	return count, nil
+}
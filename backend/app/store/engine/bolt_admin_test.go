@@ -1,9 +1,14 @@
 package engine
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
+	bolt "github.com/coreos/bbolt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -140,16 +145,16 @@ func TestBoltAdmin_BlockUser(t *testing.T) {
 
 	assert.False(t, b.IsBlocked("radio-t", "user1"), "nothing blocked")
 
-	assert.NoError(t, b.SetBlock("radio-t", "user1", true, 0))
+	assert.NoError(t, b.SetBlock("radio-t", "user1", true, 0, store.BlockInfo{}))
 	assert.True(t, b.IsBlocked("radio-t", "user1"), "user1 blocked")
 
 	assert.False(t, b.IsBlocked("radio-t", "user2"), "user2 still unblocked")
 
-	assert.NoError(t, b.SetBlock("radio-t", "user1", false, 0))
+	assert.NoError(t, b.SetBlock("radio-t", "user1", false, 0, store.BlockInfo{}))
 	assert.False(t, b.IsBlocked("radio-t", "user1"), "user1 unblocked")
 
-	assert.EqualError(t, b.SetBlock("bad", "user1", true, 0), `site "bad" not found`)
-	assert.NoError(t, b.SetBlock("radio-t", "userX", false, 0))
+	assert.EqualError(t, b.SetBlock("bad", "user1", true, 0, store.BlockInfo{}), `site "bad" not found`)
+	assert.NoError(t, b.SetBlock("radio-t", "userX", false, 0, store.BlockInfo{}))
 
 	assert.False(t, b.IsBlocked("radio-t-bad", "user1"), "nothing blocked on wrong site")
 }
@@ -160,7 +165,7 @@ func TestBoltAdmin_BlockUserWithTTL(t *testing.T) {
 	defer teardown()
 
 	assert.False(t, b.IsBlocked("radio-t", "user1"), "nothing blocked")
-	assert.NoError(t, b.SetBlock("radio-t", "user1", true, 50*time.Millisecond))
+	assert.NoError(t, b.SetBlock("radio-t", "user1", true, 50*time.Millisecond, store.BlockInfo{}))
 	assert.True(t, b.IsBlocked("radio-t", "user1"), "user1 blocked")
 	time.Sleep(50 * time.Millisecond)
 	assert.False(t, b.IsBlocked("radio-t", "user1"), "user1 un-blocked automatically")
@@ -171,15 +176,17 @@ func TestBoltAdmin_BlockList(t *testing.T) {
 	b, teardown := prep(t)
 	defer teardown()
 
-	assert.NoError(t, b.SetBlock("radio-t", "user1", true, 0))
-	assert.NoError(t, b.SetBlock("radio-t", "user2", true, 50*time.Millisecond))
-	assert.NoError(t, b.SetBlock("radio-t", "user3", false, 0))
+	assert.NoError(t, b.SetBlock("radio-t", "user1", true, 0, store.BlockInfo{Reason: "spam", Admin: "admin1"}))
+	assert.NoError(t, b.SetBlock("radio-t", "user2", true, 50*time.Millisecond, store.BlockInfo{}))
+	assert.NoError(t, b.SetBlock("radio-t", "user3", false, 0, store.BlockInfo{}))
 
 	ids, err := b.Blocked("radio-t")
 	assert.NoError(t, err)
 
 	assert.Equal(t, 2, len(ids))
 	assert.Equal(t, "user1", ids[0].ID)
+	assert.Equal(t, "user name", ids[0].Name)
+	assert.Equal(t, store.BlockInfo{Reason: "spam", Admin: "admin1"}, ids[0].BlockInfo)
 	assert.Equal(t, "user2", ids[1].ID)
 	t.Logf("%+v", ids)
 
@@ -193,6 +200,58 @@ func TestBoltAdmin_BlockList(t *testing.T) {
 	assert.EqualError(t, err, `site "bad" not found`)
 }
 
+func TestBoltAdmin_BlockLegacyValue(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	// blocks made before block info kept plain until ts
+	err := b.dbs["radio-t"].Update(func(tx *bolt.Tx) error {
+		until := time.Now().Add(time.Hour).Format(tsNano)
+		return tx.Bucket([]byte(blocksBucketName)).Put([]byte("user1"), []byte(until))
+	})
+	require.NoError(t, err)
+
+	assert.True(t, b.IsBlocked("radio-t", "user1"))
+	ids, err := b.Blocked("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(ids))
+	assert.Equal(t, "user1", ids[0].ID)
+	assert.Equal(t, store.BlockInfo{}, ids[0].BlockInfo)
+	assert.True(t, ids[0].Until.After(time.Now()))
+}
+
+func TestBoltAdmin_BlockIP(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	assert.False(t, b.IsBlockedIP("radio-t", "ip1"), "nothing blocked")
+	assert.NoError(t, b.SetBlockIP("radio-t", "ip1", true, 0, store.BlockInfo{Reason: "bots", Admin: "admin1"}))
+	assert.NoError(t, b.SetBlockIP("radio-t", "ip2", true, 50*time.Millisecond, store.BlockInfo{}))
+	assert.True(t, b.IsBlockedIP("radio-t", "ip1"))
+	assert.True(t, b.IsBlockedIP("radio-t", "ip2"))
+	assert.False(t, b.IsBlocked("radio-t", "ip1"), "ip blocks separate from users")
+
+	ips, err := b.BlockedIPs("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ips))
+	assert.Equal(t, "ip1", ips[0].ID)
+	assert.True(t, ips[0].IP)
+	assert.Equal(t, store.BlockInfo{Reason: "bots", Admin: "admin1"}, ips[0].BlockInfo)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, b.IsBlockedIP("radio-t", "ip2"), "ip2 un-blocked automatically")
+	assert.NoError(t, b.SetBlockIP("radio-t", "ip1", false, 0, store.BlockInfo{}))
+	ips, err = b.BlockedIPs("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(ips))
+
+	assert.EqualError(t, b.SetBlockIP("bad", "ip1", true, 0, store.BlockInfo{}), `site "bad" not found`)
+	_, err = b.BlockedIPs("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
 func TestBoltAdmin_ReadOnly(t *testing.T) {
 
 	b, teardown := prep(t)
@@ -244,3 +303,756 @@ func TestBoltAdmin_Verified(t *testing.T) {
 	_, err = b.Verified("radio-t-bad")
 	assert.Error(t, err, "site \"radio-t-bad\" not found", "fail on wrong site")
 }
+
+func TestBoltAdmin_Trust(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	trust, err := b.Trust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.UserTrust{}, trust, "nothing set")
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	require.NoError(t, b.SetTrust("radio-t", "user1", store.UserTrust{Level: store.TrustMember, Manual: true, Updated: ts}))
+	trust, err = b.Trust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustMember, trust.Level)
+	assert.True(t, trust.Manual)
+	assert.True(t, ts.Equal(trust.Updated))
+
+	trust, err = b.Trust("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustNew, trust.Level)
+
+	assert.EqualError(t, b.SetTrust("bad", "user1", store.UserTrust{}), `site "bad" not found`)
+	_, err = b.Trust("bad", "user1")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_Moderation(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	records, err := b.Moderation("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(records), "nothing recorded")
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	require.NoError(t, b.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModBlock,
+		Rule: "spam", Reason: "3 comments deleted", Timestamp: ts.Add(time.Minute)}))
+	require.NoError(t, b.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModDelete,
+		CommentID: "id-1", Admin: "admin1", Timestamp: ts}))
+	require.NoError(t, b.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user2", Action: store.ModDelete,
+		CommentID: "id-2", Admin: "admin1"}))
+
+	records, err = b.Moderation("radio-t", "user1")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, store.ModDelete, records[0].Action, "sorted by time")
+	assert.Equal(t, "id-1", records[0].CommentID)
+	assert.Equal(t, "admin1", records[0].Admin)
+	assert.Equal(t, store.ModBlock, records[1].Action)
+	assert.Equal(t, "spam", records[1].Rule)
+	assert.True(t, records[1].Active(), "permanent sanction")
+
+	records, err = b.Moderation("radio-t", "")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records), "all users")
+	assert.Equal(t, "user2", records[2].UserID)
+	assert.False(t, records[2].Timestamp.IsZero(), "time set")
+
+	assert.EqualError(t, b.AddModeration(store.ModerationRecord{SiteID: "bad", UserID: "user1"}), `site "bad" not found`)
+	_, err = b.Moderation("bad", "user1")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_MergeUser(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	// both users vote for id-4, a reply to user1
+	_, err := b.Create(store.Comment{ID: "id-3", Text: "text 3", Locator: locator, User: store.User{ID: "user2"},
+		Votes: map[string]bool{"user3": true}, Score: 1, Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local)})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{ID: "id-4", ParentID: "id-1", Text: "reply", Locator: locator, User: store.User{ID: "user3"},
+		Votes: map[string]bool{"user1": true, "user2": false}, Timestamp: time.Date(2017, 12, 20, 15, 18, 25, 0, time.Local)})
+	require.NoError(t, err)
+
+	require.NoError(t, b.SetVerified("radio-t", "user1", true))
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, time.Hour, store.BlockInfo{Reason: "spam"}))
+	require.NoError(t, b.SetBlock("radio-t", "user2", true, time.Minute, store.BlockInfo{}))
+	require.NoError(t, b.SetTrust("radio-t", "user1", store.UserTrust{Level: store.TrustMember}))
+	require.NoError(t, b.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModDelete}))
+
+	require.NoError(t, b.MergeUser("radio-t", "user1", "user2"))
+
+	comments, err := b.User("radio-t", "user2", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(comments), "own and merged comments")
+	for _, c := range comments {
+		assert.Equal(t, "user2", c.User.ID)
+	}
+	_, err = b.User("radio-t", "user1", 0, 0)
+	assert.Error(t, err, "no comments left for merged user")
+	count, err := b.UserCount("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	c, err := b.Get(locator, "id-4")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"user2": false}, c.Votes, "vote of merged user dropped, both voted")
+	assert.Equal(t, -1, c.Score)
+
+	replies, err := b.UserReplies("radio-t", "user2", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(replies), "replies index moved")
+	assert.Equal(t, "id-4", replies[0].ID)
+
+	assert.True(t, b.IsVerified("radio-t", "user2"))
+	assert.False(t, b.IsVerified("radio-t", "user1"))
+	blocked, err := b.Blocked("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(blocked))
+	assert.Equal(t, "user2", blocked[0].ID)
+	assert.Equal(t, "spam", blocked[0].Reason, "the longest block kept")
+
+	trust, err := b.Trust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.UserTrust{}, trust)
+	records, err := b.Moderation("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(records), "moderation journal moved")
+
+	assert.EqualError(t, b.MergeUser("bad", "user1", "user2"), `site "bad" not found`)
+}
+
+func TestBoltAdmin_Profile(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	profile, err := b.Profile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.Profile{}, profile, "nothing set")
+
+	require.NoError(t, b.Delete(locator, "id-2", store.HardDelete))
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	require.NoError(t, b.SetProfile("radio-t", store.Profile{ID: "user1", Name: "new name", Picture: "http://example.com/pic.png",
+		Updated: ts}))
+
+	profile, err = b.Profile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "new name", profile.Name)
+	assert.Equal(t, "http://example.com/pic.png", profile.Picture)
+	assert.True(t, ts.Equal(profile.Updated))
+
+	c, err := b.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.Equal(t, "new name", c.User.Name, "name updated in comment")
+	assert.Equal(t, "http://example.com/pic.png", c.User.Picture)
+	c, err = b.Get(locator, "id-2")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", c.User.Name, "deleted comment not changed")
+
+	require.NoError(t, b.SetProfile("radio-t", store.Profile{ID: "user2", Name: "user2"}), "user without comments")
+	assert.EqualError(t, b.SetProfile("bad", store.Profile{ID: "user1"}), `site "bad" not found`)
+	_, err = b.Profile("bad", "user1")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_Users(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	users, total, err := b.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Equal(t, 1, len(users))
+	assert.Equal(t, "user1", users[0].ID)
+	assert.Equal(t, "user name", users[0].Name)
+	assert.Equal(t, 2, users[0].Comments)
+	assert.Equal(t, time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local).Unix(), users[0].First.Unix())
+	assert.Equal(t, time.Date(2017, 12, 20, 15, 18, 23, 0, time.Local).Unix(), users[0].Last.Unix())
+
+	ts := time.Date(2017, 12, 21, 10, 0, 0, 0, time.Local)
+	for i, u := range []store.User{{ID: "github_1", Name: "Alice"}, {ID: "google_2", Name: "bob"}, {ID: "google_2", Name: "Bobby"}} {
+		_, err = b.Create(store.Comment{ID: fmt.Sprintf("c%d", i), Locator: locator, User: u, Score: i + 1,
+			Timestamp: ts.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+	}
+	c, err := b.Get(locator, "c0")
+	require.NoError(t, err)
+	c.Score = 10
+	require.NoError(t, b.Put(locator, c))
+
+	users, total, err = b.Users(UsersRequest{SiteID: "radio-t", Sort: "-score"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Equal(t, 3, len(users))
+	assert.Equal(t, store.UserSummary{ID: "github_1", Name: "Alice", Comments: 1, Score: 10}, usersNoTime(users)[0])
+	assert.Equal(t, store.UserSummary{ID: "google_2", Name: "Bobby", Comments: 2, Score: 5}, usersNoTime(users)[1],
+		"name from the last comment")
+
+	users, total, err = b.Users(UsersRequest{SiteID: "radio-t", Query: "BO"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Equal(t, 1, len(users))
+	assert.Equal(t, "google_2", users[0].ID, "name prefix, case-insensitive")
+
+	users, total, err = b.Users(UsersRequest{SiteID: "radio-t", Query: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "user1", users[0].ID, "id prefix")
+
+	users, total, err = b.Users(UsersRequest{SiteID: "radio-t", Sort: "+name", Limit: 1, Skip: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Equal(t, 1, len(users))
+	assert.Equal(t, "google_2", users[0].ID)
+
+	users, _, err = b.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"google_2", "github_1", "user1"}, usersIDs(users), "default sort by last comment")
+
+	// delete the last comment of the user, stats rebuilt
+	require.NoError(t, b.Delete(locator, "c2", store.SoftDelete))
+	users, _, err = b.Users(UsersRequest{SiteID: "radio-t", Query: "google"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(users))
+	assert.Equal(t, store.UserSummary{ID: "google_2", Name: "bob", Comments: 1, Score: 2}, usersNoTime(users)[0])
+	assert.Equal(t, ts.Add(time.Minute).Unix(), users[0].Last.Unix())
+
+	require.NoError(t, b.MergeUser("radio-t", "google_2", "github_1"))
+	users, total, err = b.Users(UsersRequest{SiteID: "radio-t", Sort: "id"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []string{"github_1", "user1"}, usersIDs(users))
+	assert.Equal(t, 2, users[0].Comments)
+	assert.Equal(t, 12, users[0].Score)
+
+	require.NoError(t, b.DeleteUser("radio-t", "user1"))
+	users, total, err = b.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []string{"github_1"}, usersIDs(users))
+
+	_, _, err = b.Users(UsersRequest{SiteID: "bad"})
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_UsersBuild(t *testing.T) {
+	var b, teardown = prep(t)
+	defer teardown()
+
+	// drop users directory to simulate db made before it
+	bdb, err := b.db("radio-t")
+	require.NoError(t, err)
+	err = bdb.Update(func(tx *bolt.Tx) error { return tx.DeleteBucket([]byte(userStatsBktName)) })
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	b, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	users, total, err := b.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, store.UserSummary{ID: "user1", Name: "user name", Comments: 2}, usersNoTime(users)[0])
+	require.NoError(t, b.Close())
+}
+
+// usersNoTime clears first and last time of users summary for comparison
+func usersNoTime(users []store.UserSummary) []store.UserSummary {
+	res := make([]store.UserSummary, len(users))
+	for i, u := range users {
+		u.First, u.Last = time.Time{}, time.Time{}
+		res[i] = u
+	}
+	return res
+}
+
+func usersIDs(users []store.UserSummary) (ids []string) {
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestBoltAdmin_ClearIPs(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	comment := store.Comment{ID: "id-3", Text: "some text3", Timestamp: time.Now(),
+		Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"},
+		User:    store.User{ID: "user2", Name: "user name 2", IP: "ip-hash-3"}}
+	_, err := b.Create(comment)
+	require.NoError(t, err)
+	comment.ID, comment.Timestamp, comment.User.IP = "id-4", time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local), "ip-hash-4"
+	_, err = b.Create(comment)
+	require.NoError(t, err)
+
+	count, err := b.ClearIPs("radio-t", "", time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "only id-4 old enough and has ip")
+
+	c, err := b.Get(comment.Locator, "id-4")
+	require.NoError(t, err)
+	assert.Equal(t, "", c.User.IP)
+	assert.Equal(t, "some text3", c.Text)
+	c, err = b.Get(comment.Locator, "id-3")
+	require.NoError(t, err)
+	assert.Equal(t, "ip-hash-3", c.User.IP, "recent comment kept")
+
+	count, err = b.ClearIPs("radio-t", "", time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "nothing left to clear")
+
+	count, err = b.ClearIPs("radio-t", "user1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "user1 has no ip hashes")
+	count, err = b.ClearIPs("radio-t", "user2", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "recent comment of user2 cleared")
+
+	_, err = b.ClearIPs("bad", "", time.Now())
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_DeleteTwice(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	require.NoError(t, b.Delete(loc, "id-1", store.SoftDelete))
+	require.NoError(t, b.Delete(loc, "id-1", store.HardDelete))
+	count, err := b.Count(loc)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "count decremented once")
+	c, err := b.Get(loc, "id-1")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", c.User.ID, "user info cleared by hard delete")
+	users, total, err := b.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	assert.Equal(t, 1, users[0].Comments)
+}
+
+func TestBoltAdmin_Trash(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	entries, err := b.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries), "empty trash")
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	c, err := b.Get(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "id-1")
+	require.NoError(t, err)
+	require.NoError(t, b.SaveTrash(store.TrashEntry{ID: "id-1", SiteID: "radio-t", Comment: c, Deleted: ts.Add(time.Minute)}))
+	require.NoError(t, b.SaveTrash(store.TrashEntry{ID: "id-2", SiteID: "radio-t", Deleted: ts}))
+
+	entries, err = b.Trash("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "id-2", entries[0].ID, "sorted by deletion")
+	assert.Equal(t, c.Text, entries[1].Comment.Text)
+
+	require.NoError(t, b.RemoveTrash("radio-t", []string{"id-2", "bad-id"}))
+	entries, err = b.Trash("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "id-1", entries[0].ID)
+
+	require.NoError(t, b.DeleteAll("radio-t"))
+	entries, err = b.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries), "trash removed with site")
+	assert.EqualError(t, b.SaveTrash(store.TrashEntry{ID: "id-3", SiteID: "bad"}), `site "bad" not found`)
+	_, err = b.Trash("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_Undelete(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	reply := store.Comment{ID: "id-3", ParentID: "id-1", Text: "reply", Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local),
+		Locator: loc, User: store.User{ID: "user2", Name: "user name 2"}}
+	_, err := b.Create(reply)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Delete(loc, "id-3", store.SoftDelete))
+	count, err := b.Count(loc)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	replies, err := b.RepliesCount("radio-t", []string{"id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, replies["id-1"])
+
+	require.NoError(t, b.Put(loc, reply), "restore")
+	count, err = b.Count(loc)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "count restored")
+	replies, err = b.RepliesCount("radio-t", []string{"id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replies["id-1"], "replies index restored")
+	last, err := b.Last("radio-t", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(last))
+	assert.Equal(t, "id-3", last[0].ID, "back in last comments")
+	userReplies, err := b.UserReplies("radio-t", "user1", 10, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(userReplies))
+}
+
+func TestBoltAdmin_Deletions(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	reqs, err := b.Deletions("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(reqs), "nothing requested")
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	req := store.DeletionRequest{ID: "r2", SiteID: "radio-t", UserID: "user1", Mode: store.DeletionFull, Created: ts.Add(time.Minute)}
+	req.AddStep(store.DeletionRequested, "user1")
+	require.NoError(t, b.SaveDeletion(req))
+	require.NoError(t, b.SaveDeletion(store.DeletionRequest{ID: "r1", SiteID: "radio-t", UserID: "user2", Created: ts}))
+	req.AddStep(store.DeletionConfirmed, "user1")
+	require.NoError(t, b.SaveDeletion(req), "replaced")
+
+	reqs, err = b.Deletions("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(reqs))
+	assert.Equal(t, "r1", reqs[0].ID, "sorted by creation")
+	assert.Equal(t, "r2", reqs[1].ID)
+	assert.Equal(t, store.DeletionConfirmed, reqs[1].Status)
+	require.Equal(t, 2, len(reqs[1].Steps))
+	assert.Equal(t, store.DeletionRequested, reqs[1].Steps[0].Status)
+
+	assert.EqualError(t, b.SaveDeletion(store.DeletionRequest{ID: "r3", SiteID: "bad"}), `site "bad" not found`)
+	_, err = b.Deletions("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_ShadowBan(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	assert.False(t, b.IsShadowBanned("radio-t", "u1"), "nothing banned")
+
+	assert.NoError(t, b.SetShadowBan("radio-t", "u1", true))
+	assert.True(t, b.IsShadowBanned("radio-t", "u1"), "u1 banned")
+	assert.False(t, b.IsShadowBanned("radio-t", "u2"), "u2 not banned")
+
+	assert.NoError(t, b.SetShadowBan("radio-t", "u2", true))
+	ids, err := b.ShadowBanned("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, ids)
+
+	assert.NoError(t, b.SetShadowBan("radio-t", "u1", false))
+	assert.False(t, b.IsShadowBanned("radio-t", "u1"), "u1 not banned anymore")
+	ids, err = b.ShadowBanned("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u2"}, ids)
+
+	assert.EqualError(t, b.SetShadowBan("bad", "u1", true), `site "bad" not found`)
+	assert.False(t, b.IsShadowBanned("bad", "u2"))
+	_, err = b.ShadowBanned("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+}
+
+func TestBoltAdmin_ShadowBanCount(t *testing.T) {
+
+	b, teardown := prep(t) // two comments of user1
+	defer teardown()
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	checkCount := func(expected int, msg string) {
+		count, err := b.Count(locator)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, count, msg)
+		info, err := b.Info(locator, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, info.Count, msg)
+		list, err := b.List("radio-t", 0, 0)
+		assert.NoError(t, err)
+		require.Equal(t, 1, len(list))
+		assert.Equal(t, expected, list[0].Count, msg)
+	}
+
+	_, err := b.Create(store.Comment{ID: "id-3", Locator: locator, Text: "text 3", User: store.User{ID: "user2"},
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local)})
+	require.NoError(t, err)
+	checkCount(3, "nothing banned")
+
+	assert.NoError(t, b.SetShadowBan("radio-t", "user1", true))
+	checkCount(1, "comments of user1 not counted")
+	assert.NoError(t, b.SetShadowBan("radio-t", "user1", true))
+	checkCount(1, "ban set again")
+
+	_, err = b.Create(store.Comment{ID: "id-4", Locator: locator, Text: "text 4", User: store.User{ID: "user1"},
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 25, 0, time.Local)})
+	require.NoError(t, err)
+	checkCount(1, "new comment of banned user not counted")
+
+	assert.NoError(t, b.Delete(locator, "id-1", store.SoftDelete))
+	assert.NoError(t, b.Delete(locator, "id-1", store.HardDelete))
+	checkCount(1, "deleted comment of banned user")
+
+	assert.NoError(t, b.MergeUser("radio-t", "user2", "user1"))
+	checkCount(0, "merged to banned user")
+
+	assert.NoError(t, b.SetShadowBan("radio-t", "user1", false))
+	checkCount(3, "ban removed")
+}
+
+func TestBoltAdmin_Settings(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	settings, err := b.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, store.SiteSettings{}, settings, "nothing set")
+
+	maxVotes, positive := 10, true
+	assert.NoError(t, b.SetSettings("radio-t", store.SiteSettings{MaxVotes: &maxVotes, PositiveScore: &positive,
+		RestrictedWords: []string{}}))
+
+	settings, err = b.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, store.SiteSettings{MaxVotes: &maxVotes, PositiveScore: &positive, RestrictedWords: []string{}}, settings)
+
+	assert.NoError(t, b.DeleteAll("radio-t"))
+	settings, err = b.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, *settings.MaxVotes, "settings kept on delete all")
+
+	_, err = b.Settings("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+	assert.EqualError(t, b.SetSettings("bad", store.SiteSettings{}), `site "bad" not found`)
+}
+
+func TestBoltAdmin_RestrictedRules(t *testing.T) {
+
+	b, teardown := prep(t)
+	defer teardown()
+
+	rules, err := b.RestrictedRules("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.RestrictedRule{}, rules, "nothing set")
+
+	maxVotes := 10
+	assert.NoError(t, b.SetSettings("radio-t", store.SiteSettings{MaxVotes: &maxVotes}))
+	set := []store.RestrictedRule{{Pattern: "duck*", Action: store.RestrictMask},
+		{Pattern: `f[a-z]+k`, Regex: true, Action: store.RestrictReject}}
+	assert.NoError(t, b.SetRestrictedRules("radio-t", set))
+
+	rules, err = b.RestrictedRules("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, set, rules)
+
+	settings, err := b.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, *settings.MaxVotes, "settings not affected")
+
+	_, err = b.RestrictedRules("bad")
+	assert.EqualError(t, err, `site "bad" not found`)
+	assert.EqualError(t, b.SetRestrictedRules("bad", nil), `site "bad" not found`)
+}
+
+func TestBoltAdmin_Changes(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		seq, err := b.AppendChange(store.Change{SiteID: "radio-t", Type: store.ChangeCreate, CommentID: fmt.Sprintf("id-%d", i),
+			Timestamp: ts.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), seq)
+	}
+
+	changes, err := b.Changes("radio-t", 2, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, int64(3), changes[0].Seq)
+	assert.Equal(t, "id-2", changes[0].CommentID)
+	assert.Equal(t, store.ChangeCreate, changes[0].Type)
+	assert.Equal(t, int64(4), changes[1].Seq)
+	changes, err = b.Changes("radio-t", 5, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+
+	count, err := b.CompactChanges("radio-t", ts.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	changes, err = b.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, int64(4), changes[0].Seq)
+
+	seq, err := b.AppendChange(store.Change{SiteID: "radio-t", Type: store.ChangeVote, Timestamp: ts})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), seq, "seq not reused after compaction")
+
+	_, err = b.AppendChange(store.Change{SiteID: "bad"})
+	assert.Error(t, err)
+	_, err = b.Changes("bad", 0, 0)
+	assert.Error(t, err)
+}
+
+func TestBoltAdmin_RedactChanges(t *testing.T) {
+	b, teardown := prep(t)
+	defer teardown()
+
+	own := store.Comment{ID: "id-1", User: store.User{ID: "user1", Name: "user name"}}
+	other := store.Comment{ID: "id-2", User: store.User{ID: "user2"}, Score: 1, Votes: map[string]bool{"user1": true}}
+	changes := []store.Change{
+		{SiteID: "radio-t", Type: store.ChangeCreate, CommentID: "id-1", UserID: "user1", Comment: &own},
+		{SiteID: "radio-t", Type: store.ChangeVote, CommentID: "id-2", UserID: "user1", Comment: &other},
+		{SiteID: "radio-t", Type: store.ChangeBlock, UserID: "user1", Status: true},
+		{SiteID: "radio-t", Type: store.ChangeDelete, UserID: "user1"},
+		{SiteID: "radio-t", Type: store.ChangeBlock, UserID: "user2", Status: true},
+		{SiteID: "radio-t", Type: store.ChangeProfile, UserID: "user1", Profile: &store.Profile{ID: "user1", Name: "name"}},
+		{SiteID: "radio-t", Type: store.ChangeMerge, UserID: "user1", TargetID: "anon"},
+	}
+	for _, c := range changes {
+		_, err := b.AppendChange(c)
+		require.NoError(t, err)
+	}
+
+	// anonymize moves everything to anon user
+	anon := store.User{ID: "anon", Name: "deleted user"}
+	count, err := b.RedactChanges("radio-t", "user1", anon)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+	res, err := b.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 6, len(res), "profile change dropped")
+	assert.Equal(t, "anon", res[0].UserID)
+	assert.Equal(t, anon, res[0].Comment.User)
+	assert.Equal(t, "anon", res[1].UserID)
+	assert.Equal(t, map[string]bool{"anon": true}, res[1].Comment.Votes)
+	assert.Equal(t, "anon", res[2].UserID)
+	assert.Equal(t, "user1", res[3].UserID, "deletion of all comments kept")
+	assert.Equal(t, "user1", res[5].UserID, "merge kept")
+
+	// full deletion drops user's records and unlinks votes
+	count, err = b.RedactChanges("radio-t", "anon", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	res, err = b.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(res))
+	assert.Equal(t, "", res[0].UserID, "voter cleared")
+	assert.Equal(t, 0, len(res[0].Comment.Votes))
+	assert.Equal(t, 1, res[0].Comment.Score)
+	assert.Equal(t, store.ChangeDelete, res[1].Type)
+	assert.Equal(t, "user2", res[2].UserID)
+
+	_, err = b.RedactChanges("bad", "user1", store.User{})
+	assert.Error(t, err)
+}
+
+func TestBoltAdmin_Encrypted(t *testing.T) {
+	os.Remove(testDb)
+	defer os.Remove(testDb)
+	c1, err := store.NewCrypter("secret1")
+	require.NoError(t, err)
+	c2, err := store.NewCrypter("secret2")
+	require.NoError(t, err)
+
+	b, err := NewEncryptedBoltDB(bolt.Options{}, c1, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err = b.Create(store.Comment{ID: "id-1", Text: "some secret text", Locator: loc,
+		User: store.User{ID: "user1", Name: "user name", IP: "some-ip-hash"}, Timestamp: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour, store.BlockInfo{Reason: "spam reason"}))
+	require.NoError(t, b.Close())
+
+	data, err := ioutil.ReadFile(testDb)
+	require.NoError(t, err)
+	for _, s := range []string{"some secret text", "user name", "some-ip-hash", "spam reason"} {
+		assert.False(t, bytes.Contains(data, []byte(s)), "%s not encrypted", s)
+	}
+
+	b, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	_, err = b.Find(loc, "time")
+	assert.EqualError(t, err, "failed to unmarshal: encrypted value, secret not set")
+	require.NoError(t, b.Close())
+
+	count, err := RotateBoltKey(testDb, bolt.Options{}, c1, c2)
+	require.NoError(t, err)
+	assert.True(t, count >= 4, "comment, block, post info and user stats re-encrypted")
+	_, err = RotateBoltKey(testDb, bolt.Options{}, c1, c2)
+	assert.Error(t, err, "old secret doesn't work anymore")
+
+	b, err = NewEncryptedBoltDB(bolt.Options{}, c2, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	res, err := b.Find(loc, "time")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, "some secret text", res[0].Text)
+	assert.True(t, b.IsBlocked("radio-t", "user2"))
+	blocked, err := b.Blocked("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(blocked))
+	assert.Equal(t, "spam reason", blocked[0].Reason)
+	require.NoError(t, b.Close())
+
+	// decrypt and encrypt again
+	_, err = RotateBoltKey(testDb, bolt.Options{}, c2, nil)
+	require.NoError(t, err)
+	b, err = NewBoltDB(bolt.Options{}, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	res, err = b.Find(loc, "time")
+	require.NoError(t, err)
+	assert.Equal(t, "some secret text", res[0].Text)
+	require.NoError(t, b.Close())
+
+	count, err = RotateBoltKey(testDb, bolt.Options{}, nil, c1)
+	require.NoError(t, err)
+	assert.True(t, count >= 4)
+	b, err = NewEncryptedBoltDB(bolt.Options{}, c1, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.True(t, b.IsBlocked("radio-t", "user2"))
+	require.NoError(t, b.Close())
+}
+
+func TestBoltAdmin_EncryptedMixed(t *testing.T) {
+	b, teardown := prep(t)
+	require.NoError(t, b.Close())
+	defer teardown()
+
+	crypter, err := store.NewCrypter("secret")
+	require.NoError(t, err)
+	b, err = NewEncryptedBoltDB(bolt.Options{}, crypter, BoltSite{FileName: testDb, SiteID: "radio-t"})
+	require.NoError(t, err)
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err = b.Create(store.Comment{ID: "id-3", Text: "some text3", Locator: loc, User: store.User{ID: "user1"},
+		Timestamp: time.Now()})
+	require.NoError(t, err)
+
+	res, err := b.Find(loc, "time")
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(res), "plain comments made before encryption readable")
+	count, err := b.Count(loc)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
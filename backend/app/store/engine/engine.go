@@ -3,6 +3,7 @@
 package engine
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -21,38 +22,114 @@ type UserRequest struct {
 	Skip   int
 }
 
+// UsersRequest is the request send to get users directory of the site.
+// Query matches prefix of user id or name, Sort is one of [+/-]name, id, first, last, comments, score.
+type UsersRequest struct {
+	SiteID string
+	Query  string
+	Sort   string
+	Limit  int
+	Skip   int
+}
+
 // Interface defines methods provided by low-level storage engine
 type Interface interface {
-	Create(comment store.Comment) (commentID string, err error)                  // create new comment, avoid dups by id
-	Get(locator store.Locator, commentID string) (store.Comment, error)          // get comment by id
-	Put(locator store.Locator, comment store.Comment) error                      // update comment, mutable parts only
-	Find(locator store.Locator, sort string) ([]store.Comment, error)            // find comments for locator
-	Last(siteID string, limit int, since time.Time) ([]store.Comment, error)     // last comments for given site, sorted by time
-	User(siteID, userID string, limit, skip int) ([]store.Comment, error)        // comments by user, sorted by time
-	UserCount(siteID, userID string) (int, error)                                // comments count by user
-	Count(locator store.Locator) (int, error)                                    // number of comments for the post
-	List(siteID string, limit int, skip int) ([]store.PostInfo, error)           // list of commented posts
-	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)         // get post info
-	Delete(locator store.Locator, commentID string, mode store.DeleteMode) error // delete comment by id
-	DeleteAll(siteID string) error                                               // delete all data from site
-	DeleteUser(siteID string, userID string) error                               // remove all comments from user
-	SetBlock(siteID string, userID string, status bool, ttl time.Duration) error // block or unblock user with TTL (0-permanent)
-	IsBlocked(siteID string, userID string) bool                                 // check if user blocked
-	Blocked(siteID string) ([]store.BlockedUser, error)                          // get list of blocked users
-	SetReadOnly(locator store.Locator, status bool) error                        // set/reset read-only flag
-	IsReadOnly(locator store.Locator) bool                                       // check if post read-only
-	SetVerified(siteID string, userID string, status bool) error                 // set/reset verified flag
-	IsVerified(siteID string, userID string) bool                                // check verified status
-	Verified(siteID string) ([]string, error)                                    // list of verified user ids
-	Close() error                                                                // close/stop engine
+	Create(comment store.Comment) (commentID string, err error)                                // create new comment, avoid dups by id
+	Get(locator store.Locator, commentID string) (store.Comment, error)                        // get comment by id
+	Put(locator store.Locator, comment store.Comment) error                                    // update comment, mutable parts only
+	Find(locator store.Locator, sort string) ([]store.Comment, error)                          // find comments for locator
+	Last(siteID string, limit int, since time.Time) ([]store.Comment, error)                   // last comments for given site, sorted by time
+	Pending(siteID string) ([]store.Comment, error)                                            // all comments waiting for moderation
+	User(siteID, userID string, limit, skip int) ([]store.Comment, error)                      // comments by user, sorted by time
+	UserCount(siteID, userID string) (int, error)                                              // comments count by user
+	Count(locator store.Locator) (int, error)                                                  // number of comments for the post
+	List(siteID string, limit int, skip int) ([]store.PostInfo, error)                         // list of commented posts
+	Info(locator store.Locator, readonlyAge int) (store.PostInfo, error)                       // get post info
+	Delete(locator store.Locator, commentID string, mode store.DeleteMode) error               // delete comment by id
+	DeleteAll(siteID string) error                                                             // delete all data from site
+	DeleteUser(siteID string, userID string) error                                             // remove all comments from user
+	MergeUser(siteID, fromID, toID string) error                                               // move comments, votes and flags to other user
+	ClearIPs(siteID, userID string, before time.Time) (count int, err error)                   // clear ip hashes of comments made before ts
+	Users(req UsersRequest) (users []store.UserSummary, total int, err error)                  // users directory with activity stats
+	SetBlock(siteID, userID string, status bool, ttl time.Duration, bi store.BlockInfo) error  // block or unblock user with TTL (0-permanent)
+	IsBlocked(siteID string, userID string) bool                                               // check if user blocked
+	Blocked(siteID string) ([]store.BlockedUser, error)                                        // get list of blocked users
+	SetBlockIP(siteID, ip string, status bool, ttl time.Duration, bi store.BlockInfo) error    // block or unblock ip hash with TTL
+	IsBlockedIP(siteID string, ip string) bool                                                 // check if ip hash blocked
+	BlockedIPs(siteID string) ([]store.BlockedUser, error)                                     // get list of blocked ip hashes
+	SetReadOnly(locator store.Locator, status bool) error                                      // set/reset read-only flag
+	IsReadOnly(locator store.Locator) bool                                                     // check if post read-only
+	SetVerified(siteID string, userID string, status bool) error                               // set/reset verified flag
+	IsVerified(siteID string, userID string) bool                                              // check verified status
+	Verified(siteID string) ([]string, error)                                                  // list of verified user ids
+	SetShadowBan(siteID string, userID string, status bool) error                              // set/reset shadow-ban flag
+	IsShadowBanned(siteID string, userID string) bool                                          // check shadow-ban status
+	ShadowBanned(siteID string) ([]string, error)                                              // list of shadow-banned user ids
+	Trust(siteID string, userID string) (store.UserTrust, error)                               // stored trust level, empty if not set
+	SetTrust(siteID string, userID string, trust store.UserTrust) error                        // store trust level
+	Profile(siteID string, userID string) (store.Profile, error)                               // stored user profile, empty if not set
+	SetProfile(siteID string, profile store.Profile) error                                     // store profile, update user's comments
+	AddModeration(rec store.ModerationRecord) error                                            // add record to moderation journal
+	Moderation(siteID string, userID string) ([]store.ModerationRecord, error)                 // moderation journal, all users if userID empty
+	SaveDeletion(req store.DeletionRequest) error                                              // add or update deletion request
+	Deletions(siteID string) ([]store.DeletionRequest, error)                                  // deletion requests, sorted by creation
+	SaveTrash(entry store.TrashEntry) error                                                    // keep content of soft-deleted comment
+	Trash(siteID string) ([]store.TrashEntry, error)                                           // content of deleted comments, sorted by deletion
+	RemoveTrash(siteID string, commentIDs []string) error                                      // remove deleted comments from trash
+	AppendChange(change store.Change) (seq int64, err error)                                   // add record to change log, seq assigned
+	Changes(siteID string, since int64, limit int) ([]store.Change, error)                     // change log records after seq, up to limit
+	CompactChanges(siteID string, before time.Time) (int, error)                               // remove change log records made before ts
+	RedactChanges(siteID, userID string, anon store.User) (int, error)                         // remove user's data from change log, or move to anon
+	RepliesCount(siteID string, commentIDs []string) (map[string]int, error)                   // number of replies for each comment
+	UserReplies(siteID, userID string, limit int, since time.Time) ([]store.Comment, error)    // replies to user's comments
+	TopComments(siteID string, limit int, since time.Time) ([]store.Comment, error)            // top-scored comments made since ts
+	TopPosts(siteID, sortFld string, limit int, since time.Time) ([]store.PostActivity, error) // most active posts since ts
+	Settings(siteID string) (store.SiteSettings, error)                                        // per-site settings, empty if not set
+	SetSettings(siteID string, settings store.SiteSettings) error                              // set per-site settings, replaces all
+	RestrictedRules(siteID string) ([]store.RestrictedRule, error)                             // per-site restricted rules
+	SetRestrictedRules(siteID string, rules []store.RestrictedRule) error                      // set per-site restricted rules, replaces all
+	Close() error                                                                              // close/stop engine
 }
 
 const (
 	// limits
-	lastLimit = 1000
-	userLimit = 500
+	lastLimit    = 1000
+	userLimit    = 500
+	repliesLimit = 1000
+	topLimit     = 100
+	usersLimit   = 1000
 )
 
+// UnknownUserError returned by engine for user without stored comments
+type UnknownUserError struct {
+	UserID string
+}
+
+func (e UnknownUserError) Error() string {
+	return fmt.Sprintf("no comments for user %s in store", e.UserID)
+}
+
+// SortActivity sorts posts activity by comments, participants or votes, descending.
+// Ties resolved by last comment time, most recent first
+func SortActivity(posts []store.PostActivity, sortFld string) []store.PostActivity {
+	sort.Slice(posts, func(i, j int) bool {
+		var a, b int
+		switch strings.TrimPrefix(sortFld, "-") {
+		case "participants":
+			a, b = posts[i].Participants, posts[j].Participants
+		case "votes":
+			a, b = posts[i].Votes, posts[j].Votes
+		default:
+			a, b = posts[i].Comments, posts[j].Comments
+		}
+		if a == b {
+			return posts[i].LastTS.After(posts[j].LastTS)
+		}
+		return a > b
+	})
+	return posts
+}
+
 // SortComments is for engines can't sort data internally
 func SortComments(comments []store.Comment, sortFld string) []store.Comment {
 	sort.Slice(comments, func(i, j int) bool {
@@ -87,9 +164,129 @@ func SortComments(comments []store.Comment, sortFld string) []store.Comment {
 			}
 			return comments[i].Controversy < comments[j].Controversy
 
+		case "+best", "-best", "best":
+			if strings.HasPrefix(sortFld, "-") {
+				if comments[i].Best == comments[j].Best {
+					return comments[i].Timestamp.Before(comments[j].Timestamp)
+				}
+				return comments[i].Best > comments[j].Best
+			}
+			if comments[i].Best == comments[j].Best {
+				return comments[i].Timestamp.Before(comments[j].Timestamp)
+			}
+			return comments[i].Best < comments[j].Best
+
+		case "+hot", "-hot", "hot":
+			if strings.HasPrefix(sortFld, "-") {
+				if comments[i].Hot == comments[j].Hot {
+					return comments[i].Timestamp.Before(comments[j].Timestamp)
+				}
+				return comments[i].Hot > comments[j].Hot
+			}
+			if comments[i].Hot == comments[j].Hot {
+				return comments[i].Timestamp.Before(comments[j].Timestamp)
+			}
+			return comments[i].Hot < comments[j].Hot
+
 		default:
 			return comments[i].Timestamp.Before(comments[j].Timestamp)
 		}
 	})
 	return comments
 }
+
+// SortUsers sorts users directory by [+/-]name, id, first, last, comments or score, default is -last.
+// Ties resolved by user id
+func SortUsers(users []store.UserSummary, sortFld string) []store.UserSummary {
+	if sortFld == "" {
+		sortFld = "-last"
+	}
+	desc := strings.HasPrefix(sortFld, "-")
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if desc {
+			a, b = b, a
+		}
+		switch strings.TrimLeft(sortFld, "+-") {
+		case "name":
+			if !strings.EqualFold(a.Name, b.Name) {
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			}
+		case "first":
+			if !a.First.Equal(b.First) {
+				return a.First.Before(b.First)
+			}
+		case "last":
+			if !a.Last.Equal(b.Last) {
+				return a.Last.Before(b.Last)
+			}
+		case "comments":
+			if a.Comments != b.Comments {
+				return a.Comments < b.Comments
+			}
+		case "score":
+			if a.Score != b.Score {
+				return a.Score < b.Score
+			}
+		}
+		return a.ID < b.ID
+	})
+	return users
+}
+
+// redactChange removes user's data from change log record. With empty anon.ID records of user's comments and
+// changes of the user without comment dropped, user's votes removed and voter cleared. Otherwise all of them
+// moved to anon user. Records of deletion of all user's comments and of merges kept as they needed to replay
+// the deletion, user's profile changes always dropped.
+func redactChange(c *store.Change, userID string, anon store.User) (keep, changed bool) {
+	switch {
+	case c.Type == store.ChangeDelete && c.CommentID == "", c.Type == store.ChangeMerge:
+		return true, false
+	case c.Type == store.ChangeProfile && c.UserID == userID:
+		return false, true
+	}
+	if c.UserID == userID {
+		if anon.ID == "" && c.Comment == nil {
+			return false, true
+		}
+		c.UserID, changed = anon.ID, true
+	}
+	if c.Comment == nil {
+		return true, changed
+	}
+	if c.Comment.User.ID == userID {
+		if anon.ID == "" {
+			return false, true
+		}
+		c.Comment.User, changed = anon, true
+	}
+	if _, voted := c.Comment.Votes[userID]; voted {
+		if anon.ID == "" {
+			delete(c.Comment.Votes, userID)
+		} else {
+			mergeVotes(c.Comment, userID, anon.ID)
+		}
+		changed = true
+	}
+	return true, changed
+}
+
+// mergeVotes moves vote of fromID user to toID. If both users voted, vote of fromID dropped with its score.
+// Returns true if comment changed.
+func mergeVotes(comment *store.Comment, fromID, toID string) bool {
+	val, ok := comment.Votes[fromID]
+	if !ok {
+		return false
+	}
+	delete(comment.Votes, fromID)
+	if _, voted := comment.Votes[toID]; !voted {
+		comment.Votes[toID] = val
+		return true
+	}
+	if val {
+		comment.Score--
+	} else {
+		comment.Score++
+	}
+	return true
+}
@@ -10,6 +10,41 @@ type MockInterface struct {
 	mock.Mock
 }
 
+// AddModeration provides a mock function with given fields: rec
+func (_m *MockInterface) AddModeration(rec store.ModerationRecord) error {
+	ret := _m.Called(rec)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(store.ModerationRecord) error); ok {
+		r0 = rf(rec)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AppendChange provides a mock function with given fields: change
+func (_m *MockInterface) AppendChange(change store.Change) (int64, error) {
+	ret := _m.Called(change)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(store.Change) int64); ok {
+		r0 = rf(change)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(store.Change) error); ok {
+		r1 = rf(change)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Blocked provides a mock function with given fields: siteID
 func (_m *MockInterface) Blocked(siteID string) ([]store.BlockedUser, error) {
 	ret := _m.Called(siteID)
@@ -33,6 +68,73 @@ func (_m *MockInterface) Blocked(siteID string) ([]store.BlockedUser, error) {
 	return r0, r1
 }
 
+// BlockedIPs provides a mock function with given fields: siteID
+func (_m *MockInterface) BlockedIPs(siteID string) ([]store.BlockedUser, error) {
+	ret := _m.Called(siteID)
+
+	var r0 []store.BlockedUser
+	if rf, ok := ret.Get(0).(func(string) []store.BlockedUser); ok {
+		r0 = rf(siteID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.BlockedUser)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Changes provides a mock function with given fields: siteID, since, limit
+func (_m *MockInterface) Changes(siteID string, since int64, limit int) ([]store.Change, error) {
+	ret := _m.Called(siteID, since, limit)
+
+	var r0 []store.Change
+	if rf, ok := ret.Get(0).(func(string, int64, int) []store.Change); ok {
+		r0 = rf(siteID, since, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.Change)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, int) error); ok {
+		r1 = rf(siteID, since, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ClearIPs provides a mock function with given fields: siteID, userID, before
+func (_m *MockInterface) ClearIPs(siteID string, userID string, before time.Time) (int, error) {
+	ret := _m.Called(siteID, userID, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, string, time.Time) int); ok {
+		r0 = rf(siteID, userID, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, time.Time) error); ok {
+		r1 = rf(siteID, userID, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *MockInterface) Close() error {
 	ret := _m.Called()
@@ -47,6 +149,27 @@ func (_m *MockInterface) Close() error {
 	return r0
 }
 
+// CompactChanges provides a mock function with given fields: siteID, before
+func (_m *MockInterface) CompactChanges(siteID string, before time.Time) (int, error) {
+	ret := _m.Called(siteID, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, time.Time) int); ok {
+		r0 = rf(siteID, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, time.Time) error); ok {
+		r1 = rf(siteID, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Count provides a mock function with given fields: locator
 func (_m *MockInterface) Count(locator store.Locator) (int, error) {
 	ret := _m.Called(locator)
@@ -131,6 +254,29 @@ func (_m *MockInterface) DeleteUser(siteID string, userID string) error {
 	return r0
 }
 
+// Deletions provides a mock function with given fields: siteID
+func (_m *MockInterface) Deletions(siteID string) ([]store.DeletionRequest, error) {
+	ret := _m.Called(siteID)
+
+	var r0 []store.DeletionRequest
+	if rf, ok := ret.Get(0).(func(string) []store.DeletionRequest); ok {
+		r0 = rf(siteID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.DeletionRequest)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Find provides a mock function with given fields: locator, sort
 func (_m *MockInterface) Find(locator store.Locator, sort string) ([]store.Comment, error) {
 	ret := _m.Called(locator, sort)
@@ -210,6 +356,20 @@ func (_m *MockInterface) IsBlocked(siteID string, userID string) bool {
 	return r0
 }
 
+// IsBlockedIP provides a mock function with given fields: siteID, ip
+func (_m *MockInterface) IsBlockedIP(siteID string, ip string) bool {
+	ret := _m.Called(siteID, ip)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
+		r0 = rf(siteID, ip)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // IsReadOnly provides a mock function with given fields: locator
 func (_m *MockInterface) IsReadOnly(locator store.Locator) bool {
 	ret := _m.Called(locator)
@@ -224,6 +384,20 @@ func (_m *MockInterface) IsReadOnly(locator store.Locator) bool {
 	return r0
 }
 
+// IsShadowBanned provides a mock function with given fields: siteID, userID
+func (_m *MockInterface) IsShadowBanned(siteID string, userID string) bool {
+	ret := _m.Called(siteID, userID)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
+		r0 = rf(siteID, userID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // IsVerified provides a mock function with given fields: siteID, userID
 func (_m *MockInterface) IsVerified(siteID string, userID string) bool {
 	ret := _m.Called(siteID, userID)
@@ -284,6 +458,87 @@ func (_m *MockInterface) List(siteID string, limit int, skip int) ([]store.PostI
 	return r0, r1
 }
 
+// MergeUser provides a mock function with given fields: siteID, fromID, toID
+func (_m *MockInterface) MergeUser(siteID string, fromID string, toID string) error {
+	ret := _m.Called(siteID, fromID, toID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(siteID, fromID, toID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Moderation provides a mock function with given fields: siteID, userID
+func (_m *MockInterface) Moderation(siteID string, userID string) ([]store.ModerationRecord, error) {
+	ret := _m.Called(siteID, userID)
+
+	var r0 []store.ModerationRecord
+	if rf, ok := ret.Get(0).(func(string, string) []store.ModerationRecord); ok {
+		r0 = rf(siteID, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.ModerationRecord)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(siteID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Profile provides a mock function with given fields: siteID, userID
+func (_m *MockInterface) Profile(siteID string, userID string) (store.Profile, error) {
+	ret := _m.Called(siteID, userID)
+
+	var r0 store.Profile
+	if rf, ok := ret.Get(0).(func(string, string) store.Profile); ok {
+		r0 = rf(siteID, userID)
+	} else {
+		r0 = ret.Get(0).(store.Profile)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(siteID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Pending provides a mock function with given fields: siteID
+func (_m *MockInterface) Pending(siteID string) ([]store.Comment, error) {
+	ret := _m.Called(siteID)
+
+	var r0 []store.Comment
+	if rf, ok := ret.Get(0).(func(string) []store.Comment); ok {
+		r0 = rf(siteID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.Comment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Put provides a mock function with given fields: locator, comment
 func (_m *MockInterface) Put(locator store.Locator, comment store.Comment) error {
 	ret := _m.Called(locator, comment)
@@ -298,13 +553,150 @@ func (_m *MockInterface) Put(locator store.Locator, comment store.Comment) error
 	return r0
 }
 
-// SetBlock provides a mock function with given fields: siteID, userID, status, ttl
-func (_m *MockInterface) SetBlock(siteID string, userID string, status bool, ttl time.Duration) error {
-	ret := _m.Called(siteID, userID, status, ttl)
+// RedactChanges provides a mock function with given fields: siteID, userID, anon
+func (_m *MockInterface) RedactChanges(siteID string, userID string, anon store.User) (int, error) {
+	ret := _m.Called(siteID, userID, anon)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, string, store.User) int); ok {
+		r0 = rf(siteID, userID, anon)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, store.User) error); ok {
+		r1 = rf(siteID, userID, anon)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveTrash provides a mock function with given fields: siteID, commentIDs
+func (_m *MockInterface) RemoveTrash(siteID string, commentIDs []string) error {
+	ret := _m.Called(siteID, commentIDs)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, bool, time.Duration) error); ok {
-		r0 = rf(siteID, userID, status, ttl)
+	if rf, ok := ret.Get(0).(func(string, []string) error); ok {
+		r0 = rf(siteID, commentIDs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RepliesCount provides a mock function with given fields: siteID, commentIDs
+func (_m *MockInterface) RepliesCount(siteID string, commentIDs []string) (map[string]int, error) {
+	ret := _m.Called(siteID, commentIDs)
+
+	var r0 map[string]int
+	if rf, ok := ret.Get(0).(func(string, []string) map[string]int); ok {
+		r0 = rf(siteID, commentIDs)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, []string) error); ok {
+		r1 = rf(siteID, commentIDs)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestrictedRules provides a mock function with given fields: siteID
+func (_m *MockInterface) RestrictedRules(siteID string) ([]store.RestrictedRule, error) {
+	ret := _m.Called(siteID)
+
+	var r0 []store.RestrictedRule
+	if rf, ok := ret.Get(0).(func(string) []store.RestrictedRule); ok {
+		r0 = rf(siteID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.RestrictedRule)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveDeletion provides a mock function with given fields: req
+func (_m *MockInterface) SaveDeletion(req store.DeletionRequest) error {
+	ret := _m.Called(req)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(store.DeletionRequest) error); ok {
+		r0 = rf(req)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveTrash provides a mock function with given fields: entry
+func (_m *MockInterface) SaveTrash(entry store.TrashEntry) error {
+	ret := _m.Called(entry)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(store.TrashEntry) error); ok {
+		r0 = rf(entry)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetBlock provides a mock function with given fields: siteID, userID, status, ttl, bi
+func (_m *MockInterface) SetBlock(siteID string, userID string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	ret := _m.Called(siteID, userID, status, ttl, bi)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, bool, time.Duration, store.BlockInfo) error); ok {
+		r0 = rf(siteID, userID, status, ttl, bi)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetBlockIP provides a mock function with given fields: siteID, ip, status, ttl, bi
+func (_m *MockInterface) SetBlockIP(siteID string, ip string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	ret := _m.Called(siteID, ip, status, ttl, bi)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, bool, time.Duration, store.BlockInfo) error); ok {
+		r0 = rf(siteID, ip, status, ttl, bi)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetProfile provides a mock function with given fields: siteID, profile
+func (_m *MockInterface) SetProfile(siteID string, profile store.Profile) error {
+	ret := _m.Called(siteID, profile)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, store.Profile) error); ok {
+		r0 = rf(siteID, profile)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -326,6 +718,62 @@ func (_m *MockInterface) SetReadOnly(locator store.Locator, status bool) error {
 	return r0
 }
 
+// SetRestrictedRules provides a mock function with given fields: siteID, rules
+func (_m *MockInterface) SetRestrictedRules(siteID string, rules []store.RestrictedRule) error {
+	ret := _m.Called(siteID, rules)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, []store.RestrictedRule) error); ok {
+		r0 = rf(siteID, rules)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetSettings provides a mock function with given fields: siteID, settings
+func (_m *MockInterface) SetSettings(siteID string, settings store.SiteSettings) error {
+	ret := _m.Called(siteID, settings)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, store.SiteSettings) error); ok {
+		r0 = rf(siteID, settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetShadowBan provides a mock function with given fields: siteID, userID, status
+func (_m *MockInterface) SetShadowBan(siteID string, userID string, status bool) error {
+	ret := _m.Called(siteID, userID, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, bool) error); ok {
+		r0 = rf(siteID, userID, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTrust provides a mock function with given fields: siteID, userID, trust
+func (_m *MockInterface) SetTrust(siteID string, userID string, trust store.UserTrust) error {
+	ret := _m.Called(siteID, userID, trust)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, store.UserTrust) error); ok {
+		r0 = rf(siteID, userID, trust)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetVerified provides a mock function with given fields: siteID, userID, status
 func (_m *MockInterface) SetVerified(siteID string, userID string, status bool) error {
 	ret := _m.Called(siteID, userID, status)
@@ -340,6 +788,140 @@ func (_m *MockInterface) SetVerified(siteID string, userID string, status bool)
 	return r0
 }
 
+// Settings provides a mock function with given fields: siteID
+func (_m *MockInterface) Settings(siteID string) (store.SiteSettings, error) {
+	ret := _m.Called(siteID)
+
+	var r0 store.SiteSettings
+	if rf, ok := ret.Get(0).(func(string) store.SiteSettings); ok {
+		r0 = rf(siteID)
+	} else {
+		r0 = ret.Get(0).(store.SiteSettings)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ShadowBanned provides a mock function with given fields: siteID
+func (_m *MockInterface) ShadowBanned(siteID string) ([]string, error) {
+	ret := _m.Called(siteID)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(siteID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TopComments provides a mock function with given fields: siteID, limit, since
+func (_m *MockInterface) TopComments(siteID string, limit int, since time.Time) ([]store.Comment, error) {
+	ret := _m.Called(siteID, limit, since)
+
+	var r0 []store.Comment
+	if rf, ok := ret.Get(0).(func(string, int, time.Time) []store.Comment); ok {
+		r0 = rf(siteID, limit, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.Comment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int, time.Time) error); ok {
+		r1 = rf(siteID, limit, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TopPosts provides a mock function with given fields: siteID, sortFld, limit, since
+func (_m *MockInterface) TopPosts(siteID string, sortFld string, limit int, since time.Time) ([]store.PostActivity, error) {
+	ret := _m.Called(siteID, sortFld, limit, since)
+
+	var r0 []store.PostActivity
+	if rf, ok := ret.Get(0).(func(string, string, int, time.Time) []store.PostActivity); ok {
+		r0 = rf(siteID, sortFld, limit, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.PostActivity)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, int, time.Time) error); ok {
+		r1 = rf(siteID, sortFld, limit, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Trash provides a mock function with given fields: siteID
+func (_m *MockInterface) Trash(siteID string) ([]store.TrashEntry, error) {
+	ret := _m.Called(siteID)
+
+	var r0 []store.TrashEntry
+	if rf, ok := ret.Get(0).(func(string) []store.TrashEntry); ok {
+		r0 = rf(siteID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.TrashEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(siteID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Trust provides a mock function with given fields: siteID, userID
+func (_m *MockInterface) Trust(siteID string, userID string) (store.UserTrust, error) {
+	ret := _m.Called(siteID, userID)
+
+	var r0 store.UserTrust
+	if rf, ok := ret.Get(0).(func(string, string) store.UserTrust); ok {
+		r0 = rf(siteID, userID)
+	} else {
+		r0 = ret.Get(0).(store.UserTrust)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(siteID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // User provides a mock function with given fields: siteID, userID, limit, skip
 func (_m *MockInterface) User(siteID string, userID string, limit int, skip int) ([]store.Comment, error) {
 	ret := _m.Called(siteID, userID, limit, skip)
@@ -384,6 +966,59 @@ func (_m *MockInterface) UserCount(siteID string, userID string) (int, error) {
 	return r0, r1
 }
 
+// UserReplies provides a mock function with given fields: siteID, userID, limit, since
+func (_m *MockInterface) UserReplies(siteID string, userID string, limit int, since time.Time) ([]store.Comment, error) {
+	ret := _m.Called(siteID, userID, limit, since)
+
+	var r0 []store.Comment
+	if rf, ok := ret.Get(0).(func(string, string, int, time.Time) []store.Comment); ok {
+		r0 = rf(siteID, userID, limit, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.Comment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, int, time.Time) error); ok {
+		r1 = rf(siteID, userID, limit, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Users provides a mock function with given fields: req
+func (_m *MockInterface) Users(req UsersRequest) ([]store.UserSummary, int, error) {
+	ret := _m.Called(req)
+
+	var r0 []store.UserSummary
+	if rf, ok := ret.Get(0).(func(UsersRequest) []store.UserSummary); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]store.UserSummary)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(UsersRequest) int); ok {
+		r1 = rf(req)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(UsersRequest) error); ok {
+		r2 = rf(req)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // Verified provides a mock function with given fields: siteID
 func (_m *MockInterface) Verified(siteID string) ([]string, error) {
 	ret := _m.Called(siteID)
@@ -11,10 +11,10 @@ import (
 
 func TestEngine_sortComments(t *testing.T) {
 	cc := []store.Comment{
-		{ID: "1", Score: 5, Controversy: 1, Timestamp: time.Date(2018, 2, 5, 10, 1, 0, 0, time.Local)},
-		{ID: "2", Score: 4, Controversy: 2, Timestamp: time.Date(2018, 2, 5, 10, 2, 0, 0, time.Local)},
-		{ID: "3", Score: 6, Controversy: 3, Timestamp: time.Date(2018, 2, 5, 10, 3, 0, 0, time.Local)},
-		{ID: "4", Score: 6, Controversy: 1, Timestamp: time.Date(2018, 2, 5, 10, 4, 0, 0, time.Local)},
+		{ID: "1", Score: 5, Controversy: 1, Best: 0.5, Hot: 10, Timestamp: time.Date(2018, 2, 5, 10, 1, 0, 0, time.Local)},
+		{ID: "2", Score: 4, Controversy: 2, Best: 0.7, Hot: 12, Timestamp: time.Date(2018, 2, 5, 10, 2, 0, 0, time.Local)},
+		{ID: "3", Score: 6, Controversy: 3, Best: 0.5, Hot: 11, Timestamp: time.Date(2018, 2, 5, 10, 3, 0, 0, time.Local)},
+		{ID: "4", Score: 6, Controversy: 1, Best: 0.2, Hot: 13, Timestamp: time.Date(2018, 2, 5, 10, 4, 0, 0, time.Local)},
 	}
 
 	SortComments(cc, "+time")
@@ -52,4 +52,28 @@ func TestEngine_sortComments(t *testing.T) {
 	assert.Equal(t, "2", cc[1].ID)
 	assert.Equal(t, "1", cc[2].ID)
 	assert.Equal(t, "4", cc[3].ID)
+
+	SortComments(cc, "best")
+	assert.Equal(t, "4", cc[0].ID)
+	assert.Equal(t, "1", cc[1].ID)
+	assert.Equal(t, "3", cc[2].ID)
+	assert.Equal(t, "2", cc[3].ID)
+
+	SortComments(cc, "-best")
+	assert.Equal(t, "2", cc[0].ID)
+	assert.Equal(t, "1", cc[1].ID)
+	assert.Equal(t, "3", cc[2].ID)
+	assert.Equal(t, "4", cc[3].ID)
+
+	SortComments(cc, "hot")
+	assert.Equal(t, "1", cc[0].ID)
+	assert.Equal(t, "3", cc[1].ID)
+	assert.Equal(t, "2", cc[2].ID)
+	assert.Equal(t, "4", cc[3].ID)
+
+	SortComments(cc, "-hot")
+	assert.Equal(t, "4", cc[0].ID)
+	assert.Equal(t, "2", cc[1].ID)
+	assert.Equal(t, "3", cc[2].ID)
+	assert.Equal(t, "1", cc[3].ID)
 }
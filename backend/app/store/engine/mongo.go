@@ -1,10 +1,14 @@
 package engine
 
 import (
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
+	log "github.com/go-pkgz/lgr"
 	"github.com/go-pkgz/mongo"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
@@ -16,12 +20,22 @@ import (
 type Mongo struct {
 	conn       *mongo.Connection
 	postWriter mongo.BufferedWriter
+	changeLock sync.Mutex // serializes seq allocation and insert, readers never see a gap filled later
 }
 
 const (
 	mongoPosts     = "posts"
 	mongoMetaPosts = "meta_posts"
 	mongoMetaUsers = "meta_users"
+	mongoReplies   = "meta_replies"
+	mongoMetaSites = "meta_sites"
+	mongoMetaIPs   = "meta_ips"
+	mongoModLog    = "moderation"
+	mongoDeletions = "deletions"
+	mongoTrash     = "trash"
+	mongoChangeLog = "changelog"
+	mongoSequences = "sequences"
+	mongoUserStats = "user_stats"
 )
 
 type metaPost struct {
@@ -31,11 +45,53 @@ type metaPost struct {
 }
 
 type metaUser struct {
-	ID           string    `bson:"_id"` // user_id
+	ID           string          `bson:"_id"` // user_id
+	SiteID       string          `bson:"site"`
+	Verified     bool            `bson:"verified"`
+	ShadowBanned bool            `bson:"shadow_banned"`
+	Blocked      bool            `bson:"blocked"`
+	BlockedUntil time.Time       `bson:"blocked_until"`
+	BlockInfo    store.BlockInfo `bson:"block_info"`
+	Trust        store.UserTrust `bson:"trust"`
+	Profile      store.Profile   `bson:"profile"`
+}
+
+// userStats is an entry of users directory, summary of user's not deleted comments
+type userStats struct {
+	ID       string    `bson:"_id"` // site!user_id
+	SiteID   string    `bson:"site"`
+	UserID   string    `bson:"uid"`
+	Name     string    `bson:"name"`  // name from the most recent comment
+	LName    string    `bson:"lname"` // lower-cased name, used to sort by name
+	First    time.Time `bson:"first"`
+	Last     time.Time `bson:"last"`
+	Comments int       `bson:"comments"`
+	Score    int       `bson:"score"`
+}
+
+// metaIP keeps blocked ip hashes
+type metaIP struct {
+	ID        string          `bson:"_id"` // ip hash
+	SiteID    string          `bson:"site"`
+	Until     time.Time       `bson:"until"`
+	BlockInfo store.BlockInfo `bson:"block_info"`
+}
+
+type metaSite struct {
+	ID         string                 `bson:"_id"` // site id
+	Settings   store.SiteSettings     `bson:"settings"`
+	Restricted []store.RestrictedRule `bson:"restricted"`
+}
+
+// metaReply is an entry of replies index, parent user id filled as soon as parent comment known
+type metaReply struct {
+	ID           string    `bson:"_id"` // reply comment id
 	SiteID       string    `bson:"site"`
-	Verified     bool      `bson:"verified"`
-	Blocked      bool      `bson:"blocked"`
-	BlockedUntil time.Time `bson:"blocked_until"`
+	URL          string    `bson:"url"`
+	ParentID     string    `bson:"pid"`
+	ParentUserID string    `bson:"puid"`
+	UserID       string    `bson:"uid"`
+	Timestamp    time.Time `bson:"time"`
 }
 
 // NewMongo makes mongo engine. bufferSize denies how many records will be buffered, 0 turns buffering off.
@@ -54,7 +110,13 @@ func (m *Mongo) Create(comment store.Comment) (commentID string, err error) {
 	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
 		return coll.Insert(&comment)
 	})
-	return comment.ID, err
+	if err != nil {
+		return comment.ID, err
+	}
+	if err = m.addUserStats(comment); err != nil {
+		return comment.ID, errors.Wrapf(err, "failed to update stats of %s", comment.User.ID)
+	}
+	return comment.ID, errors.Wrapf(m.indexReply(comment), "failed to index reply %s", comment.ID)
 }
 
 // Find returns all comments for post and sorts results
@@ -78,17 +140,42 @@ func (m *Mongo) Get(locator store.Locator, commentID string) (comment store.Comm
 
 // Put updates comment for locator.URL with mutable part of comment
 func (m *Mongo) Put(locator store.Locator, comment store.Comment) error {
-	return m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
-		return coll.Update(bson.M{"_id": comment.ID, "locator.site": locator.SiteID, "locator.url": locator.URL},
-			bson.M{"$set": bson.M{
-				"text":    comment.Text,
-				"orig":    comment.Orig,
-				"score":   comment.Score,
-				"votes":   comment.Votes,
-				"pin":     comment.Pin,
-				"deleted": comment.Deleted,
-			}})
+	orig := store.Comment{}
+	err := m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		change := mgo.Change{Update: bson.M{"$set": bson.M{
+			"text":        comment.Text,
+			"orig":        comment.Orig,
+			"score":       comment.Score,
+			"votes":       comment.Votes,
+			"controversy": comment.Controversy,
+			"best":        comment.Best,
+			"hot":         comment.Hot,
+			"pin":         comment.Pin,
+			"delete":      comment.Deleted,
+			"deleted_at":  comment.DeletedAt,
+			"pending":     comment.Pending,
+		}}}
+		_, e := coll.Find(bson.M{"_id": comment.ID, "locator.site": locator.SiteID, "locator.url": locator.URL}).Apply(change, &orig)
+		return e
 	})
+	if err != nil {
+		return err
+	}
+	// keep user's entry of users directory in sync with changed score or deleted status
+	switch {
+	case orig.Deleted != comment.Deleted:
+		if err = m.rebuildUserStats(locator.SiteID, orig.User.ID); err != nil {
+			return errors.Wrapf(err, "failed to update stats of %s", orig.User.ID)
+		}
+	case !comment.Deleted && orig.Score != comment.Score:
+		if err = m.addUserScore(locator.SiteID, orig.User.ID, comment.Score-orig.Score); err != nil {
+			return errors.Wrapf(err, "failed to update stats of %s", orig.User.ID)
+		}
+	}
+	if orig.Deleted && !comment.Deleted { // restored comment counted as reply again
+		return errors.Wrapf(m.indexReply(orig), "failed to index reply %s", comment.ID)
+	}
+	return nil
 }
 
 // Last returns up to max last comments for given siteID
@@ -107,18 +194,33 @@ func (m *Mongo) Last(siteID string, max int, since time.Time) (comments []store.
 	return comments, err
 }
 
-// Count returns number of comments for locator
-func (m *Mongo) Count(locator store.Locator) (count int, err error) {
+// Pending returns all comments waiting for moderation, sorted by time descending
+func (m *Mongo) Pending(siteID string) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"locator.site": siteID, "pending": true, "delete": false}).Sort("-time").All(&comments)
+	})
+	return comments, err
+}
 
+// Count returns number of comments for locator, comments of shadow-banned users not counted
+func (m *Mongo) Count(locator store.Locator) (count int, err error) {
+	banned, err := m.ShadowBanned(locator.SiteID)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't get shadow-banned users")
+	}
 	e := m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
 		query := bson.M{"locator.site": locator.SiteID, "locator.url": locator.URL, "delete": false}
+		if len(banned) > 0 {
+			query["user.id"] = bson.M{"$nin": banned}
+		}
 		count, err = coll.Find(query).Count()
 		return err
 	})
 	return count, e
 }
 
-// List returns list of all commented posts with counters
+// List returns list of all commented posts with counters, comments of shadow-banned users not counted
 func (m *Mongo) List(siteID string, limit, skip int) (list []store.PostInfo, err error) {
 	list = []store.PostInfo{}
 
@@ -129,30 +231,28 @@ func (m *Mongo) List(siteID string, limit, skip int) (list []store.PostInfo, err
 		skip = 0
 	}
 
+	banned, err := m.ShadowBanned(siteID)
+	if err != nil {
+		return list, errors.Wrap(err, "can't get shadow-banned users")
+	}
 	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
-		pipeline := coll.Pipe([]bson.M{
-			{"$match": bson.M{"locator.site": siteID}},
-			{"$project": bson.M{"locator.site": 1, "locator.url": 1, "time": 1}},
-			{"$group": bson.M{"_id": "$locator.url", "url": bson.M{"$first": "$locator.url"}, "count": bson.M{"$sum": 1},
-				"first_time": bson.M{"$min": "$time"}, "last_time": bson.M{"$max": "$time"}}},
-			{"$skip": skip},
-			{"$limit": limit},
-		})
+		stages := append([]bson.M{{"$match": bson.M{"locator.site": siteID}}}, postInfoStages(banned)...)
+		pipeline := coll.Pipe(append(stages, bson.M{"$skip": skip}, bson.M{"$limit": limit}))
 		return errors.Wrap(pipeline.AllowDiskUse().All(&list), "list pipeline failed")
 	})
 	return list, errors.Wrap(err, "can't get list")
 }
 
-// Info returns time range and count for locator
+// Info returns time range and count for locator, comments of shadow-banned users not counted
 func (m *Mongo) Info(locator store.Locator, readOnlyAge int) (info store.PostInfo, err error) {
 	list := []store.PostInfo{}
+	banned, err := m.ShadowBanned(locator.SiteID)
+	if err != nil {
+		return info, errors.Wrap(err, "can't get shadow-banned users")
+	}
 	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
-		pipeline := coll.Pipe([]bson.M{
-			{"$match": bson.M{"locator.site": locator.SiteID, "locator.url": locator.URL}},
-			{"$project": bson.M{"locator.site": 1, "locator.url": 1, "time": 1}},
-			{"$group": bson.M{"_id": "$locator.url", "url": bson.M{"$first": "$locator.url"}, "count": bson.M{"$sum": 1},
-				"first_time": bson.M{"$min": "$time"}, "last_time": bson.M{"$max": "$time"}}},
-		})
+		match := bson.M{"$match": bson.M{"locator.site": locator.SiteID, "locator.url": locator.URL}}
+		pipeline := coll.Pipe(append([]bson.M{match}, postInfoStages(banned)...))
 		return errors.Wrap(pipeline.AllowDiskUse().All(&list), "list pipeline failed")
 	})
 	if err != nil {
@@ -170,6 +270,21 @@ func (m *Mongo) Info(locator store.Locator, readOnlyAge int) (info store.PostInf
 	return info, nil
 }
 
+// postInfoStages makes pipeline stages grouping comments to store.PostInfo by post url.
+// Comments of banned users kept in time range, but not counted.
+func postInfoStages(banned []string) []bson.M {
+	if banned == nil {
+		banned = []string{}
+	}
+	return []bson.M{
+		{"$project": bson.M{"locator.site": 1, "locator.url": 1, "time": 1,
+			"shadow": bson.M{"$in": []interface{}{"$user.id", banned}}}},
+		{"$group": bson.M{"_id": "$locator.url", "url": bson.M{"$first": "$locator.url"},
+			"count":      bson.M{"$sum": bson.M{"$cond": []interface{}{"$shadow", 0, 1}}},
+			"first_time": bson.M{"$min": "$time"}, "last_time": bson.M{"$max": "$time"}}},
+	}
+}
+
 // User extracts all comments for given site and given userID
 func (m *Mongo) User(siteID, userID string, limit, skip int) (comments []store.Comment, err error) {
 	comments = []store.Comment{}
@@ -180,6 +295,110 @@ func (m *Mongo) User(siteID, userID string, limit, skip int) (comments []store.C
 	return comments, errors.Wrapf(err, "can't get comments for user %s", userID)
 }
 
+// UserReplies returns replies to comments of given userID, sorted by time in descending order
+func (m *Mongo) UserReplies(siteID, userID string, limit int, since time.Time) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+	if limit == 0 || limit > repliesLimit {
+		limit = repliesLimit
+	}
+
+	replies := []metaReply{}
+	err = m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		query := bson.M{"site": siteID, "puid": userID, "uid": bson.M{"$ne": userID}}
+		if !since.IsZero() {
+			query["time"] = bson.M{"$gt": since}
+		}
+		return coll.Find(query).Sort("-time").Limit(limit).All(&replies)
+	})
+	if err != nil || len(replies) == 0 {
+		return comments, errors.Wrapf(err, "can't get replies for user %s", userID)
+	}
+
+	ids := make([]string, 0, len(replies))
+	for _, r := range replies {
+		ids = append(ids, r.ID)
+	}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		query := bson.M{"locator.site": siteID, "_id": bson.M{"$in": ids}, "delete": false}
+		return coll.Find(query).Sort("-time").All(&comments)
+	})
+	return comments, errors.Wrapf(err, "can't get replies for user %s", userID)
+}
+
+// RepliesCount returns number of replies for each of commentIDs. Comments without replies are not in the result.
+func (m *Mongo) RepliesCount(siteID string, commentIDs []string) (map[string]int, error) {
+	res := map[string]int{}
+	counts := []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}{}
+	err := m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		pipeline := coll.Pipe([]bson.M{
+			{"$match": bson.M{"site": siteID, "pid": bson.M{"$in": commentIDs}}},
+			{"$group": bson.M{"_id": "$pid", "count": bson.M{"$sum": 1}}},
+		})
+		return errors.Wrap(pipeline.All(&counts), "replies count pipeline failed")
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get replies count for site %s", siteID)
+	}
+	for _, c := range counts {
+		res[c.ID] = c.Count
+	}
+	return res, nil
+}
+
+// TopComments returns up to limit comments with the highest score made since given ts
+func (m *Mongo) TopComments(siteID string, limit int, since time.Time) (comments []store.Comment, err error) {
+	comments = []store.Comment{}
+	if limit == 0 || limit > topLimit {
+		limit = topLimit
+	}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		query := bson.M{"locator.site": siteID, "delete": false}
+		if !since.IsZero() {
+			query["time"] = bson.M{"$gt": since}
+		}
+		return coll.Find(query).Sort("-score", "time").Limit(limit).All(&comments)
+	})
+	return comments, errors.Wrapf(err, "can't get top comments for %s", siteID)
+}
+
+// TopPosts returns up to limit posts with the most activity since given ts, sorted by sortFld
+// which can be comments, participants or votes
+func (m *Mongo) TopPosts(siteID, sortFld string, limit int, since time.Time) (posts []store.PostActivity, err error) {
+	posts = []store.PostActivity{}
+	if limit == 0 || limit > topLimit {
+		limit = topLimit
+	}
+
+	sortBy := "comments"
+	switch strings.TrimPrefix(sortFld, "-") {
+	case "participants", "votes":
+		sortBy = strings.TrimPrefix(sortFld, "-")
+	}
+
+	match := bson.M{"locator.site": siteID, "delete": false}
+	if !since.IsZero() {
+		match["time"] = bson.M{"$gt": since}
+	}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		pipeline := coll.Pipe([]bson.M{
+			{"$match": match},
+			{"$group": bson.M{"_id": "$locator.url", "url": bson.M{"$first": "$locator.url"},
+				"title": bson.M{"$max": "$title"}, "comments": bson.M{"$sum": 1},
+				"users": bson.M{"$addToSet": "$user.id"}, "last_time": bson.M{"$max": "$time"},
+				"votes": bson.M{"$sum": bson.M{"$size": bson.M{"$objectToArray": bson.M{"$ifNull": []interface{}{"$votes", bson.M{}}}}}}}},
+			{"$project": bson.M{"url": 1, "title": 1, "comments": 1, "votes": 1, "last_time": 1,
+				"participants": bson.M{"$size": "$users"}}},
+			{"$sort": bson.D{{Name: sortBy, Value: -1}, {Name: "last_time", Value: -1}}},
+			{"$limit": limit},
+		})
+		return errors.Wrap(pipeline.AllowDiskUse().All(&posts), "top posts pipeline failed")
+	})
+	return posts, errors.Wrapf(err, "can't get top posts for %s", siteID)
+}
+
 // UserCount returns number of comments for user
 func (m *Mongo) UserCount(siteID, userID string) (count int, err error) {
 	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
@@ -239,20 +458,245 @@ func (m *Mongo) Verified(siteID string) (ids []string, err error) {
 	return ids, nil
 }
 
-// SetBlock blocks/unblocks user for given site. ttl defines for for how long, 0 - permanent
-// block uses blocksBucketName with key=userID and val=TTL+now
-func (m *Mongo) SetBlock(siteID string, userID string, status bool, ttl time.Duration) error {
+// SetShadowBan makes user shadow-banned or reset the flag
+func (m *Mongo) SetShadowBan(siteID string, userID string, status bool) error {
+	return m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		_, e := coll.Upsert(bson.M{"_id": userID, "site": siteID}, bson.M{"$set": bson.M{"shadow_banned": status}})
+		return e
+	})
+}
 
-	until := time.Time{}
-	if status {
-		until = time.Now().AddDate(100, 0, 0) // permanent is 50year
-		if ttl > 0 {
-			until = time.Now().Add(ttl)
+// IsShadowBanned checks if user shadow-banned
+func (m *Mongo) IsShadowBanned(siteID string, userID string) bool {
+	meta := metaUser{}
+	err := m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"_id": userID, "site": siteID}).One(&meta)
+	})
+	return err == nil && meta.ShadowBanned
+}
+
+// ShadowBanned returns list of shadow-banned user IDs
+func (m *Mongo) ShadowBanned(siteID string) (ids []string, err error) {
+	metas := []metaUser{}
+	err = m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"site": siteID, "shadow_banned": true}).All(&metas)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, meta := range metas {
+		ids = append(ids, meta.ID)
+	}
+	return ids, nil
+}
+
+// Trust returns stored trust level of the user, empty if nothing set
+func (m *Mongo) Trust(siteID string, userID string) (store.UserTrust, error) {
+	meta := metaUser{}
+	err := m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"_id": userID, "site": siteID}).One(&meta)
+	})
+	if err == mgo.ErrNotFound {
+		return store.UserTrust{}, nil
+	}
+	return meta.Trust, errors.Wrapf(err, "can't load trust for %s", userID)
+}
+
+// SetTrust saves trust level of the user
+func (m *Mongo) SetTrust(siteID string, userID string, trust store.UserTrust) error {
+	return m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		_, e := coll.Upsert(bson.M{"_id": userID, "site": siteID}, bson.M{"$set": bson.M{"trust": trust}})
+		return errors.Wrapf(e, "can't save trust for %s", userID)
+	})
+}
+
+// Profile returns stored profile of the user, empty if nothing set
+func (m *Mongo) Profile(siteID string, userID string) (store.Profile, error) {
+	meta := metaUser{}
+	err := m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"_id": userID, "site": siteID}).One(&meta)
+	})
+	if err == mgo.ErrNotFound {
+		return store.Profile{}, nil
+	}
+	return meta.Profile, errors.Wrapf(err, "can't load profile for %s", userID)
+}
+
+// SetProfile saves profile of the user and sets its name and picture in all user's comments
+func (m *Mongo) SetProfile(siteID string, profile store.Profile) error {
+	err := m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		_, e := coll.Upsert(bson.M{"_id": profile.ID, "site": siteID}, bson.M{"$set": bson.M{"profile": profile}})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't save profile for %s", profile.ID)
+	}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		_, e := coll.UpdateAll(bson.M{"locator.site": siteID, "user.id": profile.ID},
+			bson.M{"$set": bson.M{"user.name": profile.Name, "user.picture": profile.Picture}})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't update comments of %s", profile.ID)
+	}
+	// users directory keeps name of the user, rebuild it from renamed comments
+	return errors.Wrapf(m.rebuildUserStats(siteID, profile.ID), "can't update stats of %s", profile.ID)
+}
+
+// AddModeration adds record to moderation journal
+func (m *Mongo) AddModeration(rec store.ModerationRecord) error {
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+	return m.conn.WithCustomCollection(mongoModLog, func(coll *mgo.Collection) error {
+		return errors.Wrapf(coll.Insert(&rec), "can't save moderation record for %s", rec.UserID)
+	})
+}
+
+// Moderation returns moderation journal of the user or all users if userID empty, sorted by time
+func (m *Mongo) Moderation(siteID string, userID string) (records []store.ModerationRecord, err error) {
+	records = []store.ModerationRecord{}
+	query := bson.M{"site": siteID}
+	if userID != "" {
+		query["user_id"] = userID
+	}
+	err = m.conn.WithCustomCollection(mongoModLog, func(coll *mgo.Collection) error {
+		return coll.Find(query).Sort("time").All(&records)
+	})
+	return records, errors.Wrapf(err, "can't load moderation journal for %s", siteID)
+}
+
+// SaveDeletion adds or replaces deletion request
+func (m *Mongo) SaveDeletion(req store.DeletionRequest) error {
+	return m.conn.WithCustomCollection(mongoDeletions, func(coll *mgo.Collection) error {
+		_, e := coll.UpsertId(req.ID, &req)
+		return errors.Wrapf(e, "can't save deletion request %s", req.ID)
+	})
+}
+
+// Deletions returns all deletion requests of the site, sorted by creation time
+func (m *Mongo) Deletions(siteID string) (reqs []store.DeletionRequest, err error) {
+	reqs = []store.DeletionRequest{}
+	err = m.conn.WithCustomCollection(mongoDeletions, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"site": siteID}).Sort("created").All(&reqs)
+	})
+	return reqs, errors.Wrapf(err, "can't load deletion requests for %s", siteID)
+}
+
+// SaveTrash adds or replaces content of deleted comment
+func (m *Mongo) SaveTrash(entry store.TrashEntry) error {
+	return m.conn.WithCustomCollection(mongoTrash, func(coll *mgo.Collection) error {
+		_, e := coll.UpsertId(entry.ID, &entry)
+		return errors.Wrapf(e, "can't save %s to trash", entry.ID)
+	})
+}
+
+// Trash returns content of all deleted comments kept for the site, sorted by deletion time
+func (m *Mongo) Trash(siteID string) (entries []store.TrashEntry, err error) {
+	entries = []store.TrashEntry{}
+	err = m.conn.WithCustomCollection(mongoTrash, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"site": siteID}).Sort("deleted").All(&entries)
+	})
+	return entries, errors.Wrapf(err, "can't load trash for %s", siteID)
+}
+
+// RemoveTrash removes content of deleted comments from trash, missing ids ignored
+func (m *Mongo) RemoveTrash(siteID string, commentIDs []string) error {
+	return m.conn.WithCustomCollection(mongoTrash, func(coll *mgo.Collection) error {
+		_, e := coll.RemoveAll(bson.M{"site": siteID, "_id": bson.M{"$in": commentIDs}})
+		return errors.Wrapf(e, "can't remove %v from trash", commentIDs)
+	})
+}
+
+// AppendChange adds record to change log, seq of the site incremented in sequences collection.
+// Done under lock, otherwise record with lower seq may become visible after the higher one and skipped by readers.
+func (m *Mongo) AppendChange(change store.Change) (seq int64, err error) {
+	m.changeLock.Lock()
+	defer m.changeLock.Unlock()
+	counter := struct {
+		Seq int64 `bson:"seq"`
+	}{}
+	err = m.conn.WithCustomCollection(mongoSequences, func(coll *mgo.Collection) error {
+		_, e := coll.FindId(mongoChangeLog+"/"+change.SiteID).Apply(mgo.Change{Update: bson.M{"$inc": bson.M{"seq": 1}},
+			Upsert: true, ReturnNew: true}, &counter)
+		return e
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get next sequence for %s", change.SiteID)
+	}
+	change.Seq = counter.Seq
+	err = m.conn.WithCustomCollection(mongoChangeLog, func(coll *mgo.Collection) error {
+		return coll.Insert(&change)
+	})
+	return change.Seq, errors.Wrapf(err, "can't append change for %s", change.SiteID)
+}
+
+// Changes returns change log records with seq after since, up to limit, ordered by seq
+func (m *Mongo) Changes(siteID string, since int64, limit int) (changes []store.Change, err error) {
+	changes = []store.Change{}
+	err = m.conn.WithCustomCollection(mongoChangeLog, func(coll *mgo.Collection) error {
+		q := coll.Find(bson.M{"site": siteID, "seq": bson.M{"$gt": since}}).Sort("seq")
+		if limit > 0 {
+			q = q.Limit(limit)
+		}
+		return q.All(&changes)
+	})
+	return changes, errors.Wrapf(err, "can't load changes for %s", siteID)
+}
+
+// CompactChanges removes change log records made before ts, returns number of removed records
+func (m *Mongo) CompactChanges(siteID string, before time.Time) (count int, err error) {
+	err = m.conn.WithCustomCollection(mongoChangeLog, func(coll *mgo.Collection) error {
+		info, e := coll.RemoveAll(bson.M{"site": siteID, "time": bson.M{"$lt": before}})
+		if e == nil {
+			count = info.Removed
+		}
+		return e
+	})
+	return count, errors.Wrapf(err, "can't compact changes for %s", siteID)
+}
+
+// RedactChanges removes user's data from change log, or moves it to anon user if anon.ID set.
+// Returns number of changed and removed records.
+func (m *Mongo) RedactChanges(siteID, userID string, anon store.User) (count int, err error) {
+	err = m.conn.WithCustomCollection(mongoChangeLog, func(coll *mgo.Collection) error {
+		changes := []store.Change{}
+		query := bson.M{"site": siteID, "$or": []bson.M{{"user_id": userID}, {"comment.user.id": userID},
+			{"comment.votes." + userID: bson.M{"$exists": true}}}}
+		if e := coll.Find(query).All(&changes); e != nil {
+			return e
 		}
+		for _, c := range changes {
+			keep, changed := redactChange(&c, userID, anon)
+			var e error
+			switch {
+			case !keep:
+				e = coll.Remove(bson.M{"site": siteID, "seq": c.Seq})
+			case changed:
+				e = coll.Update(bson.M{"site": siteID, "seq": c.Seq}, &c)
+			default:
+				continue
+			}
+			if e != nil {
+				return errors.Wrapf(e, "can't redact change %d", c.Seq)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, errors.Wrapf(err, "can't redact changes of %s", userID)
+}
+
+// SetBlock blocks/unblocks user for given site. ttl defines for for how long, 0 - permanent
+// block uses blocksBucketName with key=userID and val=TTL+now
+func (m *Mongo) SetBlock(siteID string, userID string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	until := blockUntil(status, ttl)
+	if !status {
+		bi = store.BlockInfo{}
 	}
 	return m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
 		_, e := coll.Upsert(bson.M{"_id": userID, "site": siteID},
-			bson.M{"$set": bson.M{"blocked": status, "blocked_until": until}})
+			bson.M{"$set": bson.M{"blocked": status, "blocked_until": until, "block_info": bi}})
 		return errors.Wrapf(e, "failed to set block for %s", userID)
 	})
 }
@@ -279,7 +723,7 @@ func (m *Mongo) Blocked(siteID string) (users []store.BlockedUser, err error) {
 	}
 
 	for _, mu := range metas {
-		blockedUser := store.BlockedUser{ID: mu.ID, Until: mu.BlockedUntil}
+		blockedUser := store.BlockedUser{ID: mu.ID, Until: mu.BlockedUntil, BlockInfo: mu.BlockInfo}
 		if ucc, e := m.User(siteID, mu.ID, 1, 0); e == nil && len(ucc) > 0 {
 			blockedUser.Name = ucc[0].User.Name
 		}
@@ -288,19 +732,133 @@ func (m *Mongo) Blocked(siteID string) (users []store.BlockedUser, err error) {
 	return users, nil
 }
 
+// SetBlockIP blocks/unblocks ip hash for given site. ttl defines for for how long, 0 - permanent
+func (m *Mongo) SetBlockIP(siteID string, ip string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	return m.conn.WithCustomCollection(mongoMetaIPs, func(coll *mgo.Collection) error {
+		if !status {
+			e := coll.Remove(bson.M{"_id": ip, "site": siteID})
+			if e == mgo.ErrNotFound {
+				return nil
+			}
+			return errors.Wrapf(e, "failed to clean block for ip %s", ip)
+		}
+		_, e := coll.Upsert(bson.M{"_id": ip, "site": siteID},
+			metaIP{ID: ip, SiteID: siteID, Until: blockUntil(status, ttl), BlockInfo: bi})
+		return errors.Wrapf(e, "failed to set block for ip %s", ip)
+	})
+}
+
+// IsBlockedIP checks if ip hash blocked
+func (m *Mongo) IsBlockedIP(siteID string, ip string) bool {
+	meta := metaIP{}
+	err := m.conn.WithCustomCollection(mongoMetaIPs, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"_id": ip, "site": siteID}).One(&meta)
+	})
+	return err == nil && meta.Until.After(time.Now())
+}
+
+// BlockedIPs get lists of blocked ip hashes for given site
+func (m *Mongo) BlockedIPs(siteID string) (ips []store.BlockedUser, err error) {
+	ips = []store.BlockedUser{}
+	metas := []metaIP{}
+	err = m.conn.WithCustomCollection(mongoMetaIPs, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"site": siteID, "until": bson.M{"$gt": time.Now()}}).All(&metas)
+	})
+	if err != nil {
+		return ips, errors.Wrapf(err, "can't get blocked ips for site for %s", siteID)
+	}
+	for _, mi := range metas {
+		ips = append(ips, store.BlockedUser{ID: mi.ID, Until: mi.Until, IP: true, BlockInfo: mi.BlockInfo})
+	}
+	return ips, nil
+}
+
+// blockUntil returns block expiration time, zero for unblock
+func blockUntil(status bool, ttl time.Duration) time.Time {
+	if !status {
+		return time.Time{}
+	}
+	if ttl > 0 {
+		return time.Now().Add(ttl)
+	}
+	return time.Now().AddDate(100, 0, 0) // permanent is 100 year
+}
+
+// Settings returns per-site settings, empty if nothing set
+func (m *Mongo) Settings(siteID string) (store.SiteSettings, error) {
+	meta := metaSite{}
+	err := m.conn.WithCustomCollection(mongoMetaSites, func(coll *mgo.Collection) error {
+		return coll.FindId(siteID).One(&meta)
+	})
+	if err == mgo.ErrNotFound {
+		return store.SiteSettings{}, nil
+	}
+	return meta.Settings, errors.Wrapf(err, "can't load settings for %s", siteID)
+}
+
+// SetSettings saves per-site settings, replaces previously set
+func (m *Mongo) SetSettings(siteID string, settings store.SiteSettings) error {
+	return m.conn.WithCustomCollection(mongoMetaSites, func(coll *mgo.Collection) error {
+		_, e := coll.UpsertId(siteID, bson.M{"$set": bson.M{"settings": settings}})
+		return errors.Wrapf(e, "can't save settings for %s", siteID)
+	})
+}
+
+// RestrictedRules returns per-site restricted rules, empty if nothing set
+func (m *Mongo) RestrictedRules(siteID string) ([]store.RestrictedRule, error) {
+	meta := metaSite{}
+	err := m.conn.WithCustomCollection(mongoMetaSites, func(coll *mgo.Collection) error {
+		return coll.FindId(siteID).One(&meta)
+	})
+	if err == mgo.ErrNotFound || (err == nil && meta.Restricted == nil) {
+		return []store.RestrictedRule{}, nil
+	}
+	return meta.Restricted, errors.Wrapf(err, "can't load restricted rules for %s", siteID)
+}
+
+// SetRestrictedRules saves per-site restricted rules, replaces previously set
+func (m *Mongo) SetRestrictedRules(siteID string, rules []store.RestrictedRule) error {
+	return m.conn.WithCustomCollection(mongoMetaSites, func(coll *mgo.Collection) error {
+		_, e := coll.UpsertId(siteID, bson.M{"$set": bson.M{"restricted": rules}})
+		return errors.Wrapf(e, "can't save restricted rules for %s", siteID)
+	})
+}
+
 // Delete removes comment, by locator from the store.
 // Posts collection only sets status to deleted and clear fields in order to prevent breaking trees of replies.
 func (m *Mongo) Delete(locator store.Locator, commentID string, mode store.DeleteMode) error {
 	comment := store.Comment{}
+	wasDeleted := false
 	err := m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
 		e := coll.Find(bson.M{"locator.site": locator.SiteID, "locator.url": locator.URL, "_id": commentID}).One(&comment)
 		if e != nil {
 			return e
 		}
+		wasDeleted = comment.Deleted
 		comment.SetDeleted(mode)
+		if !wasDeleted {
+			ts := time.Now()
+			comment.DeletedAt = &ts
+		}
 		return coll.Update(bson.M{"locator.site": locator.SiteID, "locator.url": locator.URL, "_id": commentID}, comment)
 	})
-	return errors.Wrapf(err, "can't delete %s", commentID)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete %s", commentID)
+	}
+	if !wasDeleted {
+		if err = m.rebuildUserStats(locator.SiteID, comment.User.ID); err != nil {
+			return errors.Wrapf(err, "can't update stats of %s", comment.User.ID)
+		}
+	}
+
+	// deleted comments are not counted as replies
+	err = m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		if e := coll.Remove(bson.M{"_id": commentID, "site": locator.SiteID}); e != nil && e != mgo.ErrNotFound {
+			return e
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "can't remove %s from replies index", commentID)
 }
 
 // DeleteAll removes all info about siteID
@@ -309,7 +867,28 @@ func (m *Mongo) DeleteAll(siteID string) error {
 		_, e := coll.RemoveAll(bson.M{"locator.site": siteID})
 		return e
 	})
-	return errors.Wrapf(err, "can't delete site %s", siteID)
+	if err != nil {
+		return errors.Wrapf(err, "can't delete site %s", siteID)
+	}
+	err = m.conn.WithCustomCollection(mongoTrash, func(coll *mgo.Collection) error {
+		_, e := coll.RemoveAll(bson.M{"site": siteID})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't delete trash for site %s", siteID)
+	}
+	err = m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		_, e := coll.RemoveAll(bson.M{"site": siteID})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't delete users directory for site %s", siteID)
+	}
+	err = m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		_, e := coll.RemoveAll(bson.M{"site": siteID})
+		return e
+	})
+	return errors.Wrapf(err, "can't delete replies index for site %s", siteID)
 }
 
 // DeleteUser removes all comments for given user. Everything will be market as deleted
@@ -330,6 +909,145 @@ func (m *Mongo) DeleteUser(siteID string, userID string) error {
 	})
 }
 
+// Users returns users directory of the site, filtered by prefix of user id or name (case-insensitive),
+// sorted and paginated. Uses user_stats collection kept in sync with comments.
+func (m *Mongo) Users(req UsersRequest) (users []store.UserSummary, total int, err error) {
+	users = []store.UserSummary{}
+	if req.Limit <= 0 || req.Limit > usersLimit {
+		req.Limit = usersLimit
+	}
+	if req.Skip < 0 {
+		req.Skip = 0
+	}
+
+	sortFld := strings.TrimLeft(req.Sort, "+-")
+	switch sortFld {
+	case "":
+		sortFld = "last"
+	case "name":
+		sortFld = "lname"
+	case "first", "last", "comments", "score":
+	default:
+		sortFld = "uid"
+	}
+	idFld := "uid"
+	if strings.HasPrefix(req.Sort, "-") || req.Sort == "" {
+		sortFld, idFld = "-"+sortFld, "-"+idFld
+	}
+
+	query := bson.M{"site": req.SiteID}
+	if req.Query != "" {
+		prefix := "^" + regexp.QuoteMeta(req.Query)
+		query["$or"] = []bson.M{{"uid": bson.RegEx{Pattern: prefix}}, {"name": bson.RegEx{Pattern: prefix, Options: "i"}}}
+	}
+
+	stats := []userStats{}
+	err = m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		var e error
+		if total, e = coll.Find(query).Count(); e != nil {
+			return e
+		}
+		return coll.Find(query).Sort(sortFld, idFld).Skip(req.Skip).Limit(req.Limit).All(&stats)
+	})
+	if err != nil {
+		return users, 0, errors.Wrapf(err, "can't get users of %s", req.SiteID)
+	}
+	for _, st := range stats {
+		users = append(users, store.UserSummary{ID: st.UserID, Name: st.Name, First: st.First, Last: st.Last,
+			Comments: st.Comments, Score: st.Score})
+	}
+	return users, total, nil
+}
+
+// ClearIPs removes ip hashes from comments made before ts, of all users if userID empty.
+// Returns number of updated comments.
+func (m *Mongo) ClearIPs(siteID, userID string, before time.Time) (count int, err error) {
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		query := bson.M{"locator.site": siteID, "time": bson.M{"$lt": before}, "user.ip": bson.M{"$ne": ""}}
+		if userID != "" {
+			query["user.id"] = userID
+		}
+		info, e := coll.UpdateAll(query, bson.M{"$set": bson.M{"user.ip": ""}})
+		if e != nil {
+			return e
+		}
+		count = info.Updated
+		return nil
+	})
+	return count, errors.Wrapf(err, "can't clear ip hashes for %s", siteID)
+}
+
+// MergeUser moves comments, votes, replies index and moderation journal of fromID user to toID.
+// Keeps union of verified, blocked and shadow-ban flags, the longest block wins.
+func (m *Mongo) MergeUser(siteID, fromID, toID string) error {
+	authors := map[string]bool{fromID: true, toID: true} // users with changed stats
+	err := m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		voted := []store.Comment{}
+		if e := coll.Find(bson.M{"locator.site": siteID, "votes." + fromID: bson.M{"$exists": true}}).All(&voted); e != nil {
+			return e
+		}
+		for _, c := range voted {
+			mergeVotes(&c, fromID, toID)
+			authors[c.User.ID] = true
+			if e := coll.Update(bson.M{"locator.site": siteID, "_id": c.ID},
+				bson.M{"$set": bson.M{"votes": c.Votes, "score": c.Score}}); e != nil {
+				return e
+			}
+		}
+		_, e := coll.UpdateAll(bson.M{"locator.site": siteID, "user.id": fromID}, bson.M{"$set": bson.M{"user.id": toID}})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't merge comments of %s", fromID)
+	}
+	for userID := range authors {
+		if err = m.rebuildUserStats(siteID, userID); err != nil {
+			return errors.Wrapf(err, "can't update stats of %s", userID)
+		}
+	}
+
+	err = m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		if _, e := coll.UpdateAll(bson.M{"site": siteID, "puid": fromID}, bson.M{"$set": bson.M{"puid": toID}}); e != nil {
+			return e
+		}
+		_, e := coll.UpdateAll(bson.M{"site": siteID, "uid": fromID}, bson.M{"$set": bson.M{"uid": toID}})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't merge replies index of %s", fromID)
+	}
+
+	err = m.conn.WithCustomCollection(mongoModLog, func(coll *mgo.Collection) error {
+		_, e := coll.UpdateAll(bson.M{"site": siteID, "user_id": fromID}, bson.M{"$set": bson.M{"user_id": toID}})
+		return e
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't merge moderation journal of %s", fromID)
+	}
+
+	err = m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+		from, to := metaUser{}, metaUser{}
+		if e := coll.Find(bson.M{"_id": fromID, "site": siteID}).One(&from); e != nil {
+			if e == mgo.ErrNotFound {
+				return nil
+			}
+			return e
+		}
+		if e := coll.Find(bson.M{"_id": toID, "site": siteID}).One(&to); e != nil && e != mgo.ErrNotFound {
+			return e
+		}
+		set := bson.M{"verified": from.Verified || to.Verified, "shadow_banned": from.ShadowBanned || to.ShadowBanned}
+		if from.Blocked && (!to.Blocked || from.BlockedUntil.After(to.BlockedUntil)) {
+			set["blocked"], set["blocked_until"], set["block_info"] = true, from.BlockedUntil, from.BlockInfo
+		}
+		if _, e := coll.Upsert(bson.M{"_id": toID, "site": siteID}, bson.M{"$set": set}); e != nil {
+			return e
+		}
+		return coll.Remove(bson.M{"_id": fromID, "site": siteID})
+	})
+	return errors.Wrapf(err, "can't merge flags of %s", fromID)
+}
+
 // Close boltdb store
 func (m *Mongo) Close() error {
 	if m.postWriter != nil {
@@ -346,6 +1064,10 @@ func (m *Mongo) prepare() error {
 		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.url", "locator.site", "time"))
 		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.site", "time"))
 		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.url", "locator.site", "score"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.url", "locator.site", "best"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.url", "locator.site", "hot"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.site", "delete", "user.id"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("locator.site", "pending", "time"))
 		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoPosts)
 	})
 	if e != nil {
@@ -361,12 +1083,235 @@ func (m *Mongo) prepare() error {
 		return e
 	}
 
-	return m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
+	e = m.conn.WithCustomCollection(mongoMetaUsers, func(coll *mgo.Collection) error {
 		errs = multierror.Append(errs, coll.EnsureIndexKey("_id", "site"))
 		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "blocked"))
 		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "verified"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "shadow_banned"))
 		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoMetaUsers)
 	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoModLog, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "user_id", "time"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "time"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoModLog)
+	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoDeletions, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "created"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoDeletions)
+	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoTrash, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "deleted"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoTrash)
+	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoChangeLog, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "seq"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "time"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoChangeLog)
+	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoMetaIPs, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("_id", "site"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "until"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoMetaIPs)
+	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "pid"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "puid", "time"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoReplies)
+	})
+	if e != nil {
+		return e
+	}
+
+	e = m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "uid"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "lname"))
+		errs = multierror.Append(errs, coll.EnsureIndexKey("site", "last"))
+		return errors.Wrapf(errs.ErrorOrNil(), "can't create index for %s", mongoUserStats)
+	})
+	if e != nil {
+		return e
+	}
+
+	if e = m.buildRepliesIndex(); e != nil {
+		return e
+	}
+	return m.buildUserStats()
+}
+
+// indexReply adds reply to replies index and sets parent user for replies made before the comment itself
+func (m *Mongo) indexReply(comment store.Comment) error {
+	if comment.ParentID != "" {
+		reply := metaReply{ID: comment.ID, SiteID: comment.Locator.SiteID, URL: comment.Locator.URL,
+			ParentID: comment.ParentID, UserID: comment.User.ID, Timestamp: comment.Timestamp}
+		if parent, e := m.Get(comment.Locator, comment.ParentID); e == nil {
+			reply.ParentUserID = parent.User.ID
+		}
+		e := m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+			_, err := coll.UpsertId(reply.ID, reply)
+			return err
+		})
+		if e != nil {
+			return e
+		}
+	}
+
+	return m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		_, e := coll.UpdateAll(bson.M{"site": comment.Locator.SiteID, "pid": comment.ID, "puid": ""},
+			bson.M{"$set": bson.M{"puid": comment.User.ID}})
+		return e
+	})
+}
+
+// buildRepliesIndex fills replies index from all posts. Used once for db made before the index.
+func (m *Mongo) buildRepliesIndex() error {
+	count := 0
+	err := m.conn.WithCustomCollection(mongoReplies, func(coll *mgo.Collection) error {
+		var e error
+		count, e = coll.Count()
+		return e
+	})
+	if err != nil || count > 0 {
+		return errors.Wrap(err, "can't check replies index")
+	}
+
+	replies := []store.Comment{}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		return coll.Find(bson.M{"parentid": bson.M{"$ne": ""}, "delete": false}).All(&replies)
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't get replies")
+	}
+	for _, r := range replies {
+		if err = m.indexReply(r); err != nil {
+			return errors.Wrapf(err, "can't index reply %s", r.ID)
+		}
+	}
+	if len(replies) > 0 {
+		log.Printf("[INFO] replies index created, %d replies", len(replies))
+	}
+	return nil
+}
+
+// addUserStats adds comment to user's entry of users directory, name updated if the comment is the most recent one
+func (m *Mongo) addUserStats(comment store.Comment) error {
+	if comment.Deleted {
+		return nil
+	}
+	id := userStatsID(comment.Locator.SiteID, comment.User.ID)
+	return m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		_, e := coll.UpsertId(id, bson.M{
+			"$set": bson.M{"site": comment.Locator.SiteID, "uid": comment.User.ID},
+			"$inc": bson.M{"comments": 1, "score": comment.Score},
+			"$min": bson.M{"first": comment.Timestamp},
+			"$max": bson.M{"last": comment.Timestamp},
+		})
+		if e != nil {
+			return e
+		}
+		e = coll.Update(bson.M{"_id": id, "last": comment.Timestamp},
+			bson.M{"$set": bson.M{"name": comment.User.Name, "lname": strings.ToLower(comment.User.Name)}})
+		if e == mgo.ErrNotFound { // not the most recent comment
+			return nil
+		}
+		return e
+	})
+}
+
+// addUserScore adds delta to total score of user's entry of users directory
+func (m *Mongo) addUserScore(siteID, userID string, delta int) error {
+	return m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		e := coll.UpdateId(userStatsID(siteID, userID), bson.M{"$inc": bson.M{"score": delta}})
+		if e == mgo.ErrNotFound {
+			return nil
+		}
+		return e
+	})
+}
+
+// rebuildUserStats makes user's entry of users directory from all user's not deleted comments,
+// removes the entry if user has no comments left
+func (m *Mongo) rebuildUserStats(siteID, userID string) error {
+	stats := []userStats{}
+	err := m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		match := bson.M{"locator.site": siteID, "user.id": userID, "delete": false}
+		return coll.Pipe(userStatsStages(match)).All(&stats)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't aggregate comments of %s", userID)
+	}
+	return m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		id := userStatsID(siteID, userID)
+		if len(stats) == 0 {
+			if e := coll.RemoveId(id); e != nil && e != mgo.ErrNotFound {
+				return e
+			}
+			return nil
+		}
+		_, e := coll.UpsertId(id, stats[0])
+		return e
+	})
+}
+
+// buildUserStats fills user_stats collection from not deleted comments of all sites.
+// Used once for db made before users directory.
+func (m *Mongo) buildUserStats() error {
+	count := 0
+	err := m.conn.WithCustomCollection(mongoUserStats, func(coll *mgo.Collection) error {
+		var e error
+		count, e = coll.Count()
+		return e
+	})
+	if err != nil || count > 0 {
+		return errors.Wrap(err, "can't check users directory")
+	}
+	err = m.conn.WithCustomCollection(mongoPosts, func(coll *mgo.Collection) error {
+		stages := append(userStatsStages(bson.M{"delete": false}), bson.M{"$out": mongoUserStats})
+		return coll.Pipe(stages).AllowDiskUse().All(&[]userStats{})
+	})
+	return errors.Wrap(err, "can't build users directory")
+}
+
+// userStatsStages makes pipeline stages aggregating matched comments to userStats, one per site and user.
+// Name taken from the most recent comment.
+func userStatsStages(match bson.M) []bson.M {
+	return []bson.M{
+		{"$match": match},
+		{"$sort": bson.M{"time": 1}},
+		{"$group": bson.M{"_id": bson.M{"site": "$locator.site", "uid": "$user.id"},
+			"name": bson.M{"$last": "$user.name"}, "comments": bson.M{"$sum": 1}, "score": bson.M{"$sum": "$score"},
+			"first": bson.M{"$min": "$time"}, "last": bson.M{"$max": "$time"}}},
+		{"$project": bson.M{"_id": bson.M{"$concat": []string{"$_id.site", "!", "$_id.uid"}}, "site": "$_id.site",
+			"uid": "$_id.uid", "name": 1, "lname": bson.M{"$toLower": "$name"}, "comments": 1, "score": 1,
+			"first": 1, "last": 1}},
+	}
+}
+
+func userStatsID(siteID, userID string) string {
+	return siteID + "!" + userID
 }
 
 func (m *Mongo) setLimitAndSkip(q *mgo.Query, limit, skip int) *mgo.Query {
@@ -263,6 +263,364 @@ func TestMongo_Verified(t *testing.T) {
 	assert.Equal(t, 0, len(ids))
 }
 
+func TestMongo_Trust(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	trust, err := m.Trust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.UserTrust{}, trust, "nothing set")
+
+	require.NoError(t, m.SetBlock("radio-t", "user1", true, time.Hour, store.BlockInfo{}))
+	require.NoError(t, m.SetTrust("radio-t", "user1", store.UserTrust{Level: store.TrustMember, Manual: true}))
+	trust, err = m.Trust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustMember, trust.Level)
+	assert.True(t, trust.Manual)
+	assert.True(t, m.IsBlocked("radio-t", "user1"), "other user's meta not affected")
+}
+
+func TestMongo_Moderation(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	records, err := m.Moderation("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(records), "nothing recorded")
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	require.NoError(t, m.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModBlock,
+		Rule: "spam", Timestamp: ts.Add(time.Minute)}))
+	require.NoError(t, m.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModDelete,
+		CommentID: "id-1", Admin: "admin1", Timestamp: ts}))
+	require.NoError(t, m.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user2", Action: store.ModDelete}))
+
+	records, err = m.Moderation("radio-t", "user1")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, store.ModDelete, records[0].Action, "sorted by time")
+	assert.Equal(t, "spam", records[1].Rule)
+
+	records, err = m.Moderation("radio-t", "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(records), "all users")
+	records, err = m.Moderation("radio-t-bad", "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(records))
+}
+
+func TestMongo_Users(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	ts := time.Date(2017, 12, 21, 10, 0, 0, 0, time.Local)
+	for i, u := range []store.User{{ID: "github_1", Name: "Alice"}, {ID: "google_2", Name: "bob"}, {ID: "google_2", Name: "Bobby"}} {
+		_, err := m.Create(store.Comment{ID: fmt.Sprintf("c%d", i), Locator: locator, User: u, Score: i + 1,
+			Timestamp: ts.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+	}
+
+	users, total, err := m.Users(UsersRequest{SiteID: "radio-t", Sort: "-score"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Equal(t, 3, len(users))
+	assert.Equal(t, store.UserSummary{ID: "google_2", Name: "Bobby", Comments: 2, Score: 5}, usersNoTime(users)[0])
+	assert.Equal(t, ts.Add(2*time.Minute).Unix(), users[0].Last.Unix())
+	assert.Equal(t, ts.Add(time.Minute).Unix(), users[0].First.Unix())
+
+	users, total, err = m.Users(UsersRequest{SiteID: "radio-t", Query: "BO"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []string{"google_2"}, usersIDs(users), "name prefix, case-insensitive")
+
+	users, total, err = m.Users(UsersRequest{SiteID: "radio-t", Sort: "+name", Limit: 1, Skip: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"google_2"}, usersIDs(users))
+
+	require.NoError(t, m.Delete(locator, "c2", store.SoftDelete))
+	users, _, err = m.Users(UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"google_2", "github_1", "user1"}, usersIDs(users), "default sort by last comment")
+	assert.Equal(t, 1, users[0].Comments)
+}
+
+func TestMongo_Deletions(t *testing.T) {
+	m, skip := prepMongo(t, false)
+	if skip {
+		return
+	}
+	reqs, err := m.Deletions("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(reqs), "nothing requested")
+
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	req := store.DeletionRequest{ID: "r2", SiteID: "radio-t", UserID: "user1", Mode: store.DeletionFull, Created: ts.Add(time.Minute)}
+	req.AddStep(store.DeletionRequested, "user1")
+	require.NoError(t, m.SaveDeletion(req))
+	require.NoError(t, m.SaveDeletion(store.DeletionRequest{ID: "r1", SiteID: "radio-t", UserID: "user2", Created: ts}))
+	require.NoError(t, m.SaveDeletion(store.DeletionRequest{ID: "r3", SiteID: "radio-t-other", UserID: "user2", Created: ts}))
+	req.AddStep(store.DeletionConfirmed, "user1")
+	require.NoError(t, m.SaveDeletion(req), "replaced")
+
+	reqs, err = m.Deletions("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(reqs))
+	assert.Equal(t, "r1", reqs[0].ID, "sorted by creation")
+	assert.Equal(t, store.DeletionConfirmed, reqs[1].Status)
+	assert.Equal(t, 2, len(reqs[1].Steps))
+}
+
+func TestMongo_ClearIPs(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	comment := store.Comment{ID: "id-3", Text: "some text3", Timestamp: time.Now(),
+		Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"},
+		User:    store.User{ID: "user2", Name: "user name 2", IP: "ip-hash-3"}}
+	_, err := m.Create(comment)
+	require.NoError(t, err)
+	comment.ID, comment.Timestamp, comment.User.IP = "id-4", time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local), "ip-hash-4"
+	_, err = m.Create(comment)
+	require.NoError(t, err)
+
+	count, err := m.ClearIPs("radio-t", "", time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "only id-4 old enough and has ip")
+
+	c, err := m.Get(comment.Locator, "id-4")
+	require.NoError(t, err)
+	assert.Equal(t, "", c.User.IP)
+	c, err = m.Get(comment.Locator, "id-3")
+	require.NoError(t, err)
+	assert.Equal(t, "ip-hash-3", c.User.IP, "recent comment kept")
+
+	count, err = m.ClearIPs("radio-t", "user2", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "recent comment of user2 cleared")
+}
+
+func TestMongo_Trash(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	c, err := m.Get(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "id-1")
+	require.NoError(t, err)
+	require.NoError(t, m.SaveTrash(store.TrashEntry{ID: "id-1", SiteID: "radio-t", Comment: c, Deleted: ts.Add(time.Minute)}))
+	require.NoError(t, m.SaveTrash(store.TrashEntry{ID: "id-2", SiteID: "radio-t", Deleted: ts}))
+	require.NoError(t, m.SaveTrash(store.TrashEntry{ID: "id-x", SiteID: "radio-t-other", Deleted: ts}))
+
+	entries, err := m.Trash("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "id-2", entries[0].ID, "sorted by deletion")
+	assert.Equal(t, c.Text, entries[1].Comment.Text)
+
+	require.NoError(t, m.RemoveTrash("radio-t", []string{"id-2", "bad-id"}))
+	entries, err = m.Trash("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+
+	// restore with put
+	loc := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	require.NoError(t, m.Delete(loc, "id-1", store.SoftDelete))
+	require.NoError(t, m.Put(loc, c))
+	restored, err := m.Get(loc, "id-1")
+	require.NoError(t, err)
+	assert.False(t, restored.Deleted)
+	assert.Equal(t, c.Text, restored.Text)
+}
+
+func TestMongo_Changes(t *testing.T) {
+	m, skip := prepMongo(t, false)
+	if skip {
+		return
+	}
+	ts := time.Date(2019, 8, 12, 15, 10, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		seq, err := m.AppendChange(store.Change{SiteID: "radio-t", Type: store.ChangeCreate, CommentID: fmt.Sprintf("id-%d", i),
+			Timestamp: ts.Add(time.Duration(i) * time.Minute)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), seq)
+	}
+	seq, err := m.AppendChange(store.Change{SiteID: "radio-t-other", Type: store.ChangeBlock, Timestamp: ts})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq, "sequence per site")
+
+	changes, err := m.Changes("radio-t", 2, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, int64(3), changes[0].Seq)
+	assert.Equal(t, "id-2", changes[0].CommentID)
+	assert.Equal(t, int64(4), changes[1].Seq)
+
+	count, err := m.CompactChanges("radio-t", ts.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	changes, err = m.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, int64(4), changes[0].Seq)
+
+	seq, err = m.AppendChange(store.Change{SiteID: "radio-t", Type: store.ChangeVote, Timestamp: ts})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), seq, "seq not reused after compaction")
+}
+
+func TestMongo_RedactChanges(t *testing.T) {
+	m, skip := prepMongo(t, false)
+	if skip {
+		return
+	}
+	own := store.Comment{ID: "id-1", User: store.User{ID: "user1", Name: "user name"}}
+	other := store.Comment{ID: "id-2", User: store.User{ID: "user2"}, Score: 1, Votes: map[string]bool{"user1": true}}
+	changes := []store.Change{
+		{SiteID: "radio-t", Type: store.ChangeCreate, CommentID: "id-1", UserID: "user1", Comment: &own},
+		{SiteID: "radio-t", Type: store.ChangeVote, CommentID: "id-2", UserID: "user1", Comment: &other},
+		{SiteID: "radio-t", Type: store.ChangeDelete, UserID: "user1"},
+		{SiteID: "radio-t", Type: store.ChangeBlock, UserID: "user2", Status: true},
+	}
+	for _, c := range changes {
+		_, err := m.AppendChange(c)
+		require.NoError(t, err)
+	}
+
+	count, err := m.RedactChanges("radio-t", "user1", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	res, err := m.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, "", res[0].UserID, "voter cleared")
+	assert.Equal(t, 0, len(res[0].Comment.Votes))
+	assert.Equal(t, "user1", res[1].UserID, "deletion of all comments kept")
+	assert.Equal(t, "user2", res[2].UserID)
+}
+
+func TestMongo_MergeUser(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := m.Create(store.Comment{ID: "id-3", ParentID: "id-1", Text: "reply", Locator: locator, User: store.User{ID: "user3"},
+		Votes: map[string]bool{"user1": true, "user2": false}, Timestamp: time.Date(2017, 12, 20, 15, 18, 25, 0, time.Local)})
+	require.NoError(t, err)
+	require.NoError(t, m.SetVerified("radio-t", "user1", true))
+	require.NoError(t, m.SetBlock("radio-t", "user1", true, time.Hour, store.BlockInfo{Reason: "spam"}))
+
+	require.NoError(t, m.MergeUser("radio-t", "user1", "user2"))
+
+	count, err := m.UserCount("radio-t", "user2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = m.UserCount("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	c, err := m.Get(locator, "id-3")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"user2": false}, c.Votes, "vote of merged user dropped, both voted")
+	assert.Equal(t, -1, c.Score)
+
+	replies, err := m.UserReplies("radio-t", "user2", 10, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(replies), "replies index moved")
+
+	assert.True(t, m.IsVerified("radio-t", "user2"))
+	assert.True(t, m.IsBlocked("radio-t", "user2"))
+	assert.False(t, m.IsVerified("radio-t", "user1"))
+	assert.False(t, m.IsBlocked("radio-t", "user1"))
+}
+
+func TestMongo_Profile(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	profile, err := m.Profile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.Profile{}, profile, "nothing set")
+
+	require.NoError(t, m.SetProfile("radio-t", store.Profile{ID: "user1", Name: "new name", Picture: "http://example.com/pic.png"}))
+	profile, err = m.Profile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "new name", profile.Name)
+
+	comments, err := m.User("radio-t", "user1", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(comments))
+	for _, c := range comments {
+		assert.Equal(t, "new name", c.User.Name)
+		assert.Equal(t, "http://example.com/pic.png", c.User.Picture)
+	}
+
+	users, total, err := m.Users(UsersRequest{SiteID: "radio-t", Query: "new name"})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	assert.Equal(t, "user1", users[0].ID)
+	assert.Equal(t, "new name", users[0].Name)
+}
+
+func TestMongo_ShadowBan(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	assert.False(t, m.IsShadowBanned("radio-t", "u1"), "nothing banned")
+
+	assert.NoError(t, m.SetShadowBan("radio-t", "u1", true))
+	assert.NoError(t, m.SetShadowBan("radio-t", "u2", true))
+	assert.NoError(t, m.SetVerified("radio-t", "u2", true))
+	assert.True(t, m.IsShadowBanned("radio-t", "u1"), "u1 banned")
+	assert.True(t, m.IsVerified("radio-t", "u2"), "u2 verified and banned")
+	assert.False(t, m.IsShadowBanned("radio-t-bad", "u1"), "nothing banned on other site")
+
+	ids, err := m.ShadowBanned("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, ids)
+
+	assert.NoError(t, m.SetShadowBan("radio-t", "u1", false))
+	ids, err = m.ShadowBanned("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u2"}, ids)
+}
+
+func TestMongo_ShadowBanCount(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments of user1
+	if skip {
+		return
+	}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := m.Create(store.Comment{ID: "id-3", Locator: locator, Text: "text 3", User: store.User{ID: "user2"},
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local)})
+	require.NoError(t, err)
+
+	assert.NoError(t, m.SetShadowBan("radio-t", "user1", true))
+	count, err := m.Count(locator)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "comments of user1 not counted")
+	info, err := m.Info(locator, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, info.Count)
+	list, err := m.List("radio-t", 0, 0)
+	assert.NoError(t, err)
+	require.Equal(t, 1, len(list))
+	assert.Equal(t, 1, list[0].Count)
+
+	assert.NoError(t, m.SetShadowBan("radio-t", "user1", false))
+	count, err = m.Count(locator)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count, "ban removed")
+}
+
 func TestMongo_GetForUser(t *testing.T) {
 	m, skip := prepMongo(t, true) // adds two comments
 	if skip {
@@ -347,16 +705,16 @@ func TestMongo_BlockUser(t *testing.T) {
 	}
 	assert.False(t, m.IsBlocked("radio-t", "user1"), "nothing blocked")
 
-	assert.NoError(t, m.SetBlock("radio-t", "user1", true, 0))
+	assert.NoError(t, m.SetBlock("radio-t", "user1", true, 0, store.BlockInfo{}))
 	assert.True(t, m.IsBlocked("radio-t", "user1"), "user1 blocked")
 
 	assert.False(t, m.IsBlocked("radio-t", "user2"), "user2 still unblocked")
 
-	assert.NoError(t, m.SetBlock("radio-t", "user1", false, 0))
+	assert.NoError(t, m.SetBlock("radio-t", "user1", false, 0, store.BlockInfo{}))
 	assert.False(t, m.IsBlocked("radio-t", "user1"), "user1 unblocked")
 
-	assert.NotNil(t, m.SetBlock("bad", "user1", true, 0), `site "bad" not found`)
-	assert.NoError(t, m.SetBlock("radio-t", "userX", false, 0))
+	assert.NotNil(t, m.SetBlock("bad", "user1", true, 0, store.BlockInfo{}), `site "bad" not found`)
+	assert.NoError(t, m.SetBlock("radio-t", "userX", false, 0, store.BlockInfo{}))
 
 	assert.False(t, m.IsBlocked("radio-t-bad", "user1"), "nothing blocked on wrong site")
 }
@@ -367,7 +725,7 @@ func TestMongo_BlockUserWithTTL(t *testing.T) {
 		return
 	}
 	assert.False(t, m.IsBlocked("radio-t", "user1"), "nothing blocked")
-	assert.NoError(t, m.SetBlock("radio-t", "user1", true, 500*time.Millisecond))
+	assert.NoError(t, m.SetBlock("radio-t", "user1", true, 500*time.Millisecond, store.BlockInfo{}))
 	assert.True(t, m.IsBlocked("radio-t", "user1"), "user1 blocked")
 	time.Sleep(500 * time.Millisecond)
 	assert.False(t, m.IsBlocked("radio-t", "user1"), "user1 un-blocked automatically")
@@ -387,20 +745,140 @@ func TestMongo_GetForUserCounter(t *testing.T) {
 	assert.Equal(t, 0, count)
 }
 
+func TestMongo_Replies(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	ts := time.Date(2017, 12, 20, 15, 20, 0, 0, time.Local)
+	replies := []store.Comment{
+		{ID: "r1", ParentID: "id-1", User: store.User{ID: "user2"}, Timestamp: ts},
+		{ID: "r2", ParentID: "id-1", User: store.User{ID: "user3"}, Timestamp: ts.Add(time.Minute)},
+		{ID: "r3", ParentID: "id-2", User: store.User{ID: "user1"}, Timestamp: ts.Add(2 * time.Minute)},
+	}
+	for _, r := range replies {
+		r.Locator = store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+		_, err := m.Create(r)
+		require.NoError(t, err)
+	}
+
+	counts, err := m.RepliesCount("radio-t", []string{"id-1", "id-2", "r1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"id-1": 2, "id-2": 1}, counts)
+
+	res, err := m.UserReplies("radio-t", "user1", 10, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res), "reply to yourself not included")
+	assert.Equal(t, "r2", res[0].ID)
+	assert.Equal(t, "r1", res[1].ID)
+
+	require.NoError(t, m.Delete(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, "r2", store.SoftDelete))
+	counts, err = m.RepliesCount("radio-t", []string{"id-1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"id-1": 1}, counts)
+}
+
+func TestMongo_Top(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	ts := time.Date(2017, 12, 21, 10, 0, 0, 0, time.Local)
+	comments := []store.Comment{
+		{ID: "c1", Score: 5, Votes: map[string]bool{"u1": true, "u2": true}, User: store.User{ID: "user1"},
+			Locator: store.Locator{URL: "https://radio-t.com/1", SiteID: "radio-t"}, Timestamp: ts},
+		{ID: "c2", Score: 7, Votes: map[string]bool{"u1": true}, User: store.User{ID: "user2"},
+			Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, Timestamp: ts.Add(time.Minute)},
+		{ID: "c3", Score: 1, User: store.User{ID: "user3"},
+			Locator: store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, Timestamp: ts.Add(2 * time.Minute)},
+	}
+	for _, c := range comments {
+		_, err := m.Create(c)
+		require.NoError(t, err)
+	}
+
+	res, err := m.TopComments("radio-t", 2, ts.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "c2", res[0].ID)
+	assert.Equal(t, "c1", res[1].ID)
+
+	posts, err := m.TopPosts("radio-t", "comments", 10, ts.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(posts))
+	assert.Equal(t, "https://radio-t.com/2", posts[0].URL)
+	assert.Equal(t, 2, posts[0].Participants)
+
+	posts, err = m.TopPosts("radio-t", "votes", 10, ts.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(posts))
+	assert.Equal(t, "https://radio-t.com/1", posts[0].URL)
+	assert.Equal(t, 2, posts[0].Votes)
+}
+
+func TestMongo_Settings(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+
+	settings, err := m.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, store.SiteSettings{}, settings, "nothing set")
+
+	maxVotes, positive := 10, true
+	assert.NoError(t, m.SetSettings("radio-t", store.SiteSettings{MaxVotes: &maxVotes, PositiveScore: &positive,
+		RestrictedWords: []string{"duck"}}))
+
+	settings, err = m.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, store.SiteSettings{MaxVotes: &maxVotes, PositiveScore: &positive, RestrictedWords: []string{"duck"}}, settings)
+
+	settings, err = m.Settings("radio-t-2")
+	assert.NoError(t, err)
+	assert.Equal(t, store.SiteSettings{}, settings, "nothing set for other site")
+}
+
+func TestMongo_RestrictedRules(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+
+	rules, err := m.RestrictedRules("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.RestrictedRule{}, rules, "nothing set")
+
+	maxVotes := 10
+	assert.NoError(t, m.SetSettings("radio-t", store.SiteSettings{MaxVotes: &maxVotes}))
+	set := []store.RestrictedRule{{Pattern: "duck*", Action: store.RestrictMask},
+		{Pattern: `f[a-z]+k`, Regex: true, Action: store.RestrictReject}}
+	assert.NoError(t, m.SetRestrictedRules("radio-t", set))
+
+	rules, err = m.RestrictedRules("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, set, rules)
+
+	settings, err := m.Settings("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, *settings.MaxVotes, "settings not affected")
+}
+
 func TestMongo_BlockList(t *testing.T) {
 	m, skip := prepMongo(t, true) // adds two comments
 	if skip {
 		return
 	}
-	assert.NoError(t, m.SetBlock("radio-t", "user1", true, 0))
-	assert.NoError(t, m.SetBlock("radio-t", "user2", true, 500*time.Millisecond))
-	assert.NoError(t, m.SetBlock("radio-t", "user3", false, 0))
+	assert.NoError(t, m.SetBlock("radio-t", "user1", true, 0, store.BlockInfo{Reason: "spam", Admin: "admin1"}))
+	assert.NoError(t, m.SetBlock("radio-t", "user2", true, 500*time.Millisecond, store.BlockInfo{}))
+	assert.NoError(t, m.SetBlock("radio-t", "user3", false, 0, store.BlockInfo{}))
 
 	ids, err := m.Blocked("radio-t")
 	assert.NoError(t, err)
 
 	assert.Equal(t, 2, len(ids))
 	assert.Equal(t, "user1", ids[0].ID)
+	assert.Equal(t, store.BlockInfo{Reason: "spam", Admin: "admin1"}, ids[0].BlockInfo)
 	assert.Equal(t, "user2", ids[1].ID)
 	t.Logf("%+v", ids)
 
@@ -415,6 +893,34 @@ func TestMongo_BlockList(t *testing.T) {
 	assert.Equal(t, 0, len(ids))
 }
 
+func TestMongo_BlockIP(t *testing.T) {
+	m, skip := prepMongo(t, true) // adds two comments
+	if skip {
+		return
+	}
+	assert.False(t, m.IsBlockedIP("radio-t", "ip1"), "nothing blocked")
+	assert.NoError(t, m.SetBlockIP("radio-t", "ip1", true, 0, store.BlockInfo{Reason: "bots", Admin: "admin1"}))
+	assert.NoError(t, m.SetBlockIP("radio-t", "ip2", true, 500*time.Millisecond, store.BlockInfo{}))
+	assert.True(t, m.IsBlockedIP("radio-t", "ip1"))
+	assert.True(t, m.IsBlockedIP("radio-t", "ip2"))
+	assert.False(t, m.IsBlockedIP("radio-t-bad", "ip1"))
+
+	ips, err := m.BlockedIPs("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ips))
+	assert.Equal(t, "ip1", ips[0].ID)
+	assert.True(t, ips[0].IP)
+	assert.Equal(t, store.BlockInfo{Reason: "bots", Admin: "admin1"}, ips[0].BlockInfo)
+
+	time.Sleep(500 * time.Millisecond)
+	assert.False(t, m.IsBlockedIP("radio-t", "ip2"), "ip2 un-blocked automatically")
+	assert.NoError(t, m.SetBlockIP("radio-t", "ip1", false, 0, store.BlockInfo{}))
+	assert.NoError(t, m.SetBlockIP("radio-t", "ipX", false, 0, store.BlockInfo{}))
+	ips, err = m.BlockedIPs("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(ips))
+}
+
 func TestMongo_Delete(t *testing.T) {
 	m, skip := prepMongo(t, true) // adds two comments
 	if skip {
@@ -561,7 +1067,8 @@ func prepMongo(t *testing.T, writeRecs bool) (*Mongo, bool) {
 	m, err := NewMongo(conn, 1, 0*time.Microsecond)
 	require.Nil(t, err)
 
-	mongo.RemoveTestCollections(t, conn, mongoPosts, mongoMetaPosts, mongoMetaUsers)
+	mongo.RemoveTestCollections(t, conn, mongoPosts, mongoMetaPosts, mongoMetaUsers, mongoReplies, mongoMetaSites, mongoMetaIPs, mongoModLog, mongoDeletions, mongoTrash,
+		mongoChangeLog, mongoSequences, mongoUserStats)
 	comment := store.Comment{
 		ID:        "id-1",
 		Text:      `some text, <a href="http://radio-t.com">link</a>`,
@@ -597,7 +1104,8 @@ func prepMongoBuffered(t *testing.T) (*Mongo, bool) {
 	mongo.RemoveTestCollection(t, conn)
 
 	m, err := NewMongo(conn, 10, 10*time.Millisecond)
-	mongo.RemoveTestCollections(t, conn, mongoPosts, mongoMetaPosts, mongoMetaUsers)
+	mongo.RemoveTestCollections(t, conn, mongoPosts, mongoMetaPosts, mongoMetaUsers, mongoReplies, mongoMetaSites, mongoMetaIPs, mongoModLog, mongoDeletions, mongoTrash,
+		mongoChangeLog, mongoSequences, mongoUserStats)
 
 	require.Nil(t, err)
 	return m, false
@@ -88,6 +88,27 @@ func (f *FileSystem) Commit(id string) error {
 	return errors.Wrapf(err, "failed to commit image %s", id)
 }
 
+// Put stores image with given id to permanent location, as committed. Used to restore images from backup,
+// id has to be user/name.ext as made by Save.
+func (f *FileSystem) Put(id string, r io.Reader) error {
+	if strings.Count(id, "/") != 1 || path.Clean(id) != id || strings.HasPrefix(id, "/") || strings.Contains(id, "..") {
+		return errors.Errorf("invalid image id %s", id)
+	}
+	dst := f.location(f.Location, id)
+	if err := os.MkdirAll(path.Dir(dst), 0700); err != nil {
+		return errors.Wrap(err, "can't make image directory")
+	}
+	fh, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "can't create image file %s", dst)
+	}
+	if _, err = io.Copy(fh, r); err != nil {
+		_ = fh.Close()
+		return errors.Wrapf(err, "can't write image file %s", dst)
+	}
+	return errors.Wrapf(fh.Close(), "can't close image file %s", dst)
+}
+
 // Load image from FS. Uses id to get partition subdirectory.
 // returns ReadCloser and caller should call close after processing completed.
 func (f *FileSystem) Load(id string) (io.ReadCloser, int64, error) {
@@ -198,6 +198,26 @@ func TestFsStore_LoadAfterCommit(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestFsStore_Put(t *testing.T) {
+	svc, teardown := prepareImageTest(t)
+	defer teardown()
+
+	require.NoError(t, svc.Put("user1/pic.png", strings.NewReader("some picture")))
+	r, sz, err := svc.Load("user1/pic.png")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "some picture", string(data))
+	assert.Equal(t, int64(12), sz)
+	_, err = os.Stat(svc.location(svc.Location, "user1/pic.png"))
+	assert.NoError(t, err, "permanent location")
+
+	for _, id := range []string{"../pic.png", "user1/../../pic.png", "/etc/pic.png", "pic.png", "user1/sub/pic.png"} {
+		assert.EqualError(t, svc.Put(id, strings.NewReader("blah")), "invalid image id "+id)
+	}
+}
+
 func TestFsStore_location(t *testing.T) {
 	tbl := []struct {
 		partitions int
@@ -32,6 +32,7 @@ type Store interface {
 	Save(fileName string, userID string, r io.Reader) (id string, err error) // get name and reader and returns ID of stored image
 	Commit(id string) error                                                  // move image from staging to permanent
 	Load(id string) (io.ReadCloser, int64, error)                            // load image by ID. Caller has to close the reader.
+	Put(id string, r io.Reader) error                                        // store image with given ID to permanent location, i.e. on restore
 	Cleanup(ctx context.Context, ttl time.Duration) error                    // run removal loop for old images on staging
 	SizeLimit() int                                                          // max image size
 }
@@ -69,6 +69,20 @@ func (_m *MockStore) Load(id string) (io.ReadCloser, int64, error) {
 	return r0, r1, r2
 }
 
+// Put provides a mock function with given fields: id, r
+func (_m *MockStore) Put(id string, r io.Reader) error {
+	ret := _m.Called(id, r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, io.Reader) error); ok {
+		r0 = rf(id, r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Save provides a mock function with given fields: fileName, userID, r
 func (_m *MockStore) Save(fileName string, userID string, r io.Reader) (string, error) {
 	ret := _m.Called(fileName, userID, r)
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"time"
+)
+
+// ModerationAction defines moderation applied to the user
+type ModerationAction string
+
+// enum of all moderation actions
+const (
+	ModDelete      ModerationAction = "delete"      // comment deleted by admin
+	ModBlock       ModerationAction = "block"       // user blocked
+	ModPremoderate ModerationAction = "premoderate" // user's comments pending till approved
+)
+
+// ModerationRecord keeps moderation action applied to the user, made by admin or triggered by auto-moderation rule
+type ModerationRecord struct {
+	SiteID    string           `json:"site" bson:"site"`
+	UserID    string           `json:"user_id" bson:"user_id"`
+	Action    ModerationAction `json:"action" bson:"action"`
+	CommentID string           `json:"comment_id,omitempty" bson:"comment_id,omitempty"` // for comment deleted by admin
+	Admin     string           `json:"admin,omitempty" bson:"admin,omitempty"`           // id of admin made the action
+	Rule      string           `json:"rule,omitempty" bson:"rule,omitempty"`             // auto-moderation rule triggered the sanction
+	Reason    string           `json:"reason,omitempty" bson:"reason,omitempty"`
+	Until     time.Time        `json:"until,omitempty" bson:"until,omitempty"` // sanction's expiration, zero for permanent
+	Timestamp time.Time        `json:"time" bson:"time"`
+}
+
+// Active checks if the record is a sanction not expired yet
+func (r ModerationRecord) Active() bool {
+	return r.Rule != "" && (r.Until.IsZero() || time.Now().Before(r.Until))
+}
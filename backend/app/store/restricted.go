@@ -0,0 +1,58 @@
+package store
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// RestrictedAction defines what to do with a comment matching restricted rule
+type RestrictedAction string
+
+// enum of all restricted actions, ordered from the weakest to the strongest
+const (
+	RestrictMask     RestrictedAction = "mask"     // replace matched words with ***
+	RestrictModerate RestrictedAction = "moderate" // accept comment as pending, shown to admins and author only
+	RestrictReject   RestrictedAction = "reject"   // reject comment
+)
+
+// RestrictedRule defines a restricted pattern with action. Pattern is a word with optional `*` wildcards
+// or a regular expression. Both matched case-insensitive against comment text and its normalized form.
+type RestrictedRule struct {
+	Pattern string           `json:"pattern"`
+	Regex   bool             `json:"regex,omitempty"`
+	Action  RestrictedAction `json:"action"`
+}
+
+// Stronger checks if action a takes precedence over action b
+func (a RestrictedAction) Stronger(b RestrictedAction) bool {
+	weight := map[RestrictedAction]int{RestrictMask: 1, RestrictModerate: 2, RestrictReject: 3}
+	return weight[a] > weight[b]
+}
+
+// Validate checks rule's pattern and action
+func (r RestrictedRule) Validate() error {
+	switch r.Action {
+	case RestrictReject, RestrictMask, RestrictModerate:
+	default:
+		return errors.Errorf("unknown action %q", r.Action)
+	}
+
+	if r.Regex {
+		if r.Pattern == "" || len(r.Pattern) > 256 {
+			return errors.Errorf("invalid regex length %d, should be 1-256", len(r.Pattern))
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return errors.Wrapf(err, "invalid regex %q", r.Pattern)
+		}
+		return nil
+	}
+
+	// wildcard patterns matched recursively, so long patterns not allowed
+	if n := utf8.RuneCountInString(strings.TrimSpace(r.Pattern)); n < 1 || n > 64 {
+		return errors.Errorf("invalid pattern %q, length should be 1-64", r.Pattern)
+	}
+	return nil
+}
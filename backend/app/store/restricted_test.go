@@ -0,0 +1,39 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestrictedRule_Validate(t *testing.T) {
+	tbl := []struct {
+		rule RestrictedRule
+		err  string
+	}{
+		{RestrictedRule{Pattern: "duck*", Action: RestrictReject}, ""},
+		{RestrictedRule{Pattern: `d[uo]ck\w*`, Regex: true, Action: RestrictMask}, ""},
+		{RestrictedRule{Pattern: "duck", Action: "blah"}, `unknown action "blah"`},
+		{RestrictedRule{Pattern: " ", Action: RestrictModerate}, `invalid pattern " ", length should be 1-64`},
+		{RestrictedRule{Pattern: "d[uo", Regex: true, Action: RestrictMask},
+			"invalid regex \"d[uo\": error parsing regexp: missing closing ]: `[uo`"},
+		{RestrictedRule{Regex: true, Action: RestrictMask}, "invalid regex length 0, should be 1-256"},
+	}
+
+	for i, tt := range tbl {
+		err := tt.rule.Validate()
+		if tt.err == "" {
+			assert.NoError(t, err, "case #%d", i)
+			continue
+		}
+		assert.EqualError(t, err, tt.err, "case #%d", i)
+	}
+}
+
+func TestRestrictedAction_Stronger(t *testing.T) {
+	assert.True(t, RestrictReject.Stronger(RestrictModerate))
+	assert.True(t, RestrictModerate.Stronger(RestrictMask))
+	assert.True(t, RestrictMask.Stronger(""))
+	assert.False(t, RestrictMask.Stronger(RestrictMask))
+	assert.False(t, RestrictMask.Stronger(RestrictReject))
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetentionPolicy defines for how long personal data and deleted content kept. Zero value of a field disables the rule.
+type RetentionPolicy struct {
+	IPDays            int  `json:"ip_days,omitempty"`             // ip hashes cleared on comments older than that
+	DeletedDays       int  `json:"deleted_days,omitempty"`        // soft-deleted comments older than that erased with user info
+	PurgeDeletedUsers bool `json:"purge_deleted_users,omitempty"` // comments left from users with executed deletion requests removed
+}
+
+// Enabled checks if any retention rule set
+func (p RetentionPolicy) Enabled() bool {
+	return p.IPDays > 0 || p.DeletedDays > 0 || p.PurgeDeletedUsers
+}
+
+// Validate checks policy for negative periods
+func (p RetentionPolicy) Validate() error {
+	if p.IPDays < 0 {
+		return errors.Errorf("negative ip retention %d", p.IPDays)
+	}
+	if p.DeletedDays < 0 {
+		return errors.Errorf("negative deleted comments retention %d", p.DeletedDays)
+	}
+	return nil
+}
+
+// RetentionReport is the result of a single run of retention rules for the site
+type RetentionReport struct {
+	SiteID         string          `json:"site"`
+	Policy         RetentionPolicy `json:"policy"`
+	Started        time.Time       `json:"started"`
+	Finished       time.Time       `json:"finished"`
+	IPsCleared     int             `json:"ips_cleared"`     // comments with ip hash removed
+	CommentsErased int             `json:"comments_erased"` // soft-deleted comments erased
+	UsersPurged    int             `json:"users_purged"`    // deleted users with comments removed
+	Errors         []string        `json:"errors,omitempty"`
+}
@@ -0,0 +1,17 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	assert.NoError(t, RetentionPolicy{}.Validate())
+	assert.False(t, RetentionPolicy{}.Enabled())
+	assert.True(t, RetentionPolicy{PurgeDeletedUsers: true}.Enabled())
+	assert.True(t, RetentionPolicy{IPDays: 30}.Enabled())
+	assert.EqualError(t, RetentionPolicy{IPDays: -1}.Validate(), "negative ip retention -1")
+	assert.EqualError(t, RetentionPolicy{DeletedDays: -2}.Validate(), "negative deleted comments retention -2")
+	assert.EqualError(t, SiteSettings{Retention: &RetentionPolicy{IPDays: -1}}.Validate(), "negative ip retention -1")
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// AutoModRule defines sanction applied automatically when user's moderation history matches the rule.
+// All set conditions should be met, rule without conditions never triggered. History made before the previous
+// sanction of the same rule not counted again.
+type AutoModRule struct {
+	Name          string
+	Deleted       int                    // number of comments deleted by admins within Period
+	LowScored     int                    // number of comments with score below CriticalScore within Period
+	CriticalScore int                    // score threshold for LowScored, per-site critical score takes precedence
+	Period        time.Duration          // history window, 0 - all history
+	Action        store.ModerationAction // store.ModBlock or store.ModPremoderate
+	TTL           time.Duration          // sanction duration, 0 - permanent
+}
+
+// ModerationNotifier announces triggered sanctions
+type ModerationNotifier interface {
+	SubmitModeration(rec store.ModerationRecord)
+}
+
+// ParseAutoModRule makes rule from comma-separated key=value pairs, like
+// "name=spam,deleted=3,period=720h,action=block,ttl=168h". Default critical score used if rule has no "score" key.
+func ParseAutoModRule(s string, criticalScore int) (rule AutoModRule, err error) {
+	rule.CriticalScore = criticalScore
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return rule, errors.Errorf("invalid pair %q, should be key=value", pair)
+		}
+		key, val := kv[0], kv[1]
+		switch key {
+		case "name":
+			rule.Name = val
+		case "action":
+			rule.Action = store.ModerationAction(val)
+		case "deleted":
+			rule.Deleted, err = strconv.Atoi(val)
+		case "low-scored":
+			rule.LowScored, err = strconv.Atoi(val)
+		case "score":
+			rule.CriticalScore, err = strconv.Atoi(val)
+		case "period":
+			rule.Period, err = time.ParseDuration(val)
+		case "ttl":
+			rule.TTL, err = time.ParseDuration(val)
+		default:
+			return rule, errors.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return rule, errors.Wrapf(err, "invalid %s", key)
+		}
+	}
+	return rule, rule.Validate()
+}
+
+// Validate checks rule has name, supported action and at least one condition
+func (r AutoModRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("rule name not set")
+	}
+	if r.Action != store.ModBlock && r.Action != store.ModPremoderate {
+		return errors.Errorf("unsupported action %q of rule %s", r.Action, r.Name)
+	}
+	if r.Deleted <= 0 && r.LowScored <= 0 {
+		return errors.Errorf("no conditions in rule %s", r.Name)
+	}
+	return nil
+}
+
+// AdminDelete deletes comment by admin, records it to moderation journal and applies auto-moderation rules to the author
+func (s *DataStore) AdminDelete(locator store.Locator, commentID string, adminID string) error {
+	comment, err := s.Interface.Get(locator, commentID)
+	if err != nil {
+		return err
+	}
+	if err = s.Delete(locator, commentID, store.SoftDelete); err != nil {
+		return err
+	}
+	rec := store.ModerationRecord{SiteID: locator.SiteID, UserID: comment.User.ID, Action: store.ModDelete,
+		CommentID: commentID, Admin: adminID, Timestamp: time.Now()}
+	if err = s.AddModeration(rec); err != nil {
+		return errors.Wrapf(err, "can't record deletion of %s", commentID)
+	}
+	s.autoModerate(locator.SiteID, comment.User.ID)
+	return nil
+}
+
+// IsPremoderated checks if user has active pre-moderation sanction
+func (s *DataStore) IsPremoderated(siteID string, userID string) bool {
+	if len(s.AutoModRules) == 0 {
+		return false
+	}
+	records, err := s.Moderation(siteID, userID)
+	if err != nil {
+		log.Printf("[WARN] can't get moderation journal for %s, %v", userID, err)
+		return false
+	}
+	for _, r := range records {
+		if r.Action == store.ModPremoderate && r.Active() {
+			return true
+		}
+	}
+	return false
+}
+
+// autoModerate checks all rules against user's history and applies triggered sanctions. Errors logged only,
+// as the action caused the check already made.
+func (s *DataStore) autoModerate(siteID string, userID string) {
+	if len(s.AutoModRules) == 0 || s.IsAdmin(siteID, userID) {
+		return
+	}
+	records, err := s.Moderation(siteID, userID)
+	if err != nil {
+		log.Printf("[WARN] can't get moderation journal for %s, %v", userID, err)
+		return
+	}
+	comments, err := s.userComments(siteID, userID, 0)
+	if err != nil {
+		log.Printf("[WARN] can't get comments of %s for auto-moderation, %v", userID, err)
+		return
+	}
+
+	for _, rule := range s.AutoModRules {
+		reason, ok := s.autoModMatch(siteID, rule, records, comments)
+		if !ok {
+			continue
+		}
+		rec := store.ModerationRecord{SiteID: siteID, UserID: userID, Action: rule.Action, Rule: rule.Name,
+			Reason: reason, Timestamp: time.Now()}
+		if rule.TTL > 0 {
+			rec.Until = time.Now().Add(rule.TTL)
+		}
+		if err = s.applySanction(rec, rule.TTL); err != nil {
+			log.Printf("[WARN] can't apply sanction %s to %s, %v", rule.Name, userID, err)
+			continue
+		}
+		log.Printf("[INFO] auto-moderation rule %s triggered for %s, %s", rule.Name, userID, reason)
+		records = append(records, rec)
+		if s.ModerationNotifier != nil {
+			s.ModerationNotifier.SubmitModeration(rec)
+		}
+	}
+}
+
+// autoModMatch checks rule conditions against history made since the previous sanction of the rule,
+// returns description of matched conditions
+func (s *DataStore) autoModMatch(siteID string, rule AutoModRule, records []store.ModerationRecord,
+	comments []store.Comment) (reason string, ok bool) {
+
+	since := time.Time{}
+	if rule.Period > 0 {
+		since = time.Now().Add(-rule.Period)
+	}
+	for _, r := range records {
+		if r.Rule == rule.Name && r.Timestamp.After(since) {
+			since = r.Timestamp
+		}
+	}
+
+	reasons := []string{}
+	if rule.Deleted > 0 {
+		deleted := 0
+		for _, r := range records {
+			if r.Action == store.ModDelete && r.Timestamp.After(since) {
+				deleted++
+			}
+		}
+		if deleted < rule.Deleted {
+			return "", false
+		}
+		reasons = append(reasons, fmt.Sprintf("%d comments deleted by admins", deleted))
+	}
+
+	if rule.LowScored > 0 {
+		critical := rule.CriticalScore
+		if cs := s.SiteSettings(siteID).CriticalScore; cs != nil {
+			critical = *cs
+		}
+		lowScored := 0
+		for _, c := range comments {
+			if !c.Deleted && c.Score < critical && c.Timestamp.After(since) {
+				lowScored++
+			}
+		}
+		if lowScored < rule.LowScored {
+			return "", false
+		}
+		reasons = append(reasons, fmt.Sprintf("%d comments with score below %d", lowScored, critical))
+	}
+
+	if rule.Period > 0 {
+		return strings.Join(reasons, ", ") + " within " + rule.Period.String(), true
+	}
+	return strings.Join(reasons, ", "), true
+}
+
+// applySanction records sanction to moderation journal and blocks user for block sanctions
+func (s *DataStore) applySanction(rec store.ModerationRecord, ttl time.Duration) error {
+	if rec.Action == store.ModBlock {
+		info := store.BlockInfo{Reason: "auto-moderation " + rec.Rule + ": " + rec.Reason}
+		if err := s.SetBlock(rec.SiteID, rec.UserID, true, ttl, info); err != nil {
+			return errors.Wrapf(err, "can't block %s", rec.UserID)
+		}
+	}
+	return errors.Wrapf(s.AddModeration(rec), "can't record sanction for %s", rec.UserID)
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_ParseAutoModRule(t *testing.T) {
+	rule, err := ParseAutoModRule("name=spam,deleted=3,period=720h,action=block,ttl=168h", -10)
+	require.NoError(t, err)
+	assert.Equal(t, AutoModRule{Name: "spam", Deleted: 3, CriticalScore: -10, Period: 720 * time.Hour,
+		Action: store.ModBlock, TTL: 168 * time.Hour}, rule)
+
+	rule, err = ParseAutoModRule("name=trolls, low-scored=5, score=-3, action=premoderate", -10)
+	require.NoError(t, err)
+	assert.Equal(t, AutoModRule{Name: "trolls", LowScored: 5, CriticalScore: -3, Action: store.ModPremoderate}, rule)
+
+	tbl := []struct {
+		rule string
+		err  string
+	}{
+		{"name=spam,deleted,action=block", `invalid pair "deleted", should be key=value`},
+		{"name=spam,deleted=x,action=block", `invalid deleted: strconv.Atoi: parsing "x": invalid syntax`},
+		{"name=spam,deleted=1,period=1x,action=block", `invalid period: time: unknown unit "x" in duration "1x"`},
+		{"name=spam,blah=1", `unknown key "blah"`},
+		{"deleted=1,action=block", "rule name not set"},
+		{"name=spam,deleted=1,action=delete", `unsupported action "delete" of rule spam`},
+		{"name=spam,action=block", "no conditions in rule spam"},
+	}
+	for _, tt := range tbl {
+		_, err = ParseAutoModRule(tt.rule, -10)
+		assert.EqualError(t, err, tt.err, tt.rule)
+	}
+}
+
+func TestService_AdminDeleteAutoBlock(t *testing.T) {
+	defer teardown(t)
+	notifier := &mockModerationNotifier{}
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"),
+		AutoModRules:       []AutoModRule{{Name: "spam", Deleted: 2, Period: time.Hour, Action: store.ModBlock, TTL: time.Hour}},
+		ModerationNotifier: notifier}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	require.NoError(t, b.AdminDelete(locator, "id-1", "admin1"))
+	assert.False(t, b.IsBlocked("radio-t", "user1"), "one deletion only")
+	assert.Equal(t, 0, len(notifier.get()))
+
+	require.NoError(t, b.AdminDelete(locator, "id-2", "admin1"))
+	assert.True(t, b.IsBlocked("radio-t", "user1"), "blocked after two deletions")
+
+	blocked, err := b.Blocked("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(blocked))
+	assert.Equal(t, "auto-moderation spam: 2 comments deleted by admins within 1h0m0s", blocked[0].Reason)
+
+	records, err := b.Moderation("radio-t", "user1")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(records))
+	assert.Equal(t, store.ModDelete, records[0].Action)
+	assert.Equal(t, "id-1", records[0].CommentID)
+	assert.Equal(t, "admin1", records[0].Admin)
+	assert.Equal(t, store.ModBlock, records[2].Action)
+	assert.Equal(t, "spam", records[2].Rule)
+	assert.True(t, records[2].Active())
+
+	sent := notifier.get()
+	require.Equal(t, 1, len(sent), "sanction announced")
+	assert.Equal(t, "spam", sent[0].Rule)
+	assert.Equal(t, "user1", sent[0].UserID)
+
+	// history counted before the sanction not used again
+	_, err = b.Interface.Create(store.Comment{ID: "id-3", Text: "text", Locator: locator, User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	require.NoError(t, b.SetBlock("radio-t", "user1", false, 0, store.BlockInfo{}))
+	require.NoError(t, b.AdminDelete(locator, "id-3", "admin1"))
+	assert.False(t, b.IsBlocked("radio-t", "user1"), "not blocked again")
+	assert.Equal(t, 1, len(notifier.get()))
+
+	assert.Error(t, b.AdminDelete(locator, "id-bad", "admin1"))
+}
+
+func TestService_VoteAutoPremoderate(t *testing.T) {
+	defer teardown(t)
+	notifier := &mockModerationNotifier{}
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1,
+		AutoModRules:       []AutoModRule{{Name: "trolls", LowScored: 2, CriticalScore: 0, Action: store.ModPremoderate}},
+		ModerationNotifier: notifier}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	assert.False(t, b.IsPremoderated("radio-t", "user1"))
+	_, err := b.Vote(locator, "id-1", "user2", false)
+	require.NoError(t, err)
+	assert.False(t, b.IsPremoderated("radio-t", "user1"), "one low-scored comment only")
+
+	_, err = b.Vote(locator, "id-2", "user2", false)
+	require.NoError(t, err)
+	assert.True(t, b.IsPremoderated("radio-t", "user1"), "two low-scored comments")
+	assert.False(t, b.IsBlocked("radio-t", "user1"))
+	require.Equal(t, 1, len(notifier.get()))
+	assert.Equal(t, "2 comments with score below 0", notifier.get()[0].Reason)
+
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	c, err := b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.True(t, c.Pending, "comment of pre-moderated user")
+
+	id, err = b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "user2"}})
+	require.NoError(t, err)
+	c, err = b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.False(t, c.Pending)
+}
+
+type mockModerationNotifier struct {
+	lock    sync.Mutex
+	records []store.ModerationRecord
+}
+
+func (m *mockModerationNotifier) SubmitModeration(rec store.ModerationRecord) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.records = append(m.records, rec)
+}
+
+func (m *mockModerationNotifier) get() []store.ModerationRecord {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.records
+}
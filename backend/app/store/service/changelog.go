@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// SetBlock blocks or unblocks user and records the change
+func (s *DataStore) SetBlock(siteID string, userID string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	if err := s.Interface.SetBlock(siteID, userID, status, ttl, bi); err != nil {
+		return err
+	}
+	change := store.Change{SiteID: siteID, Type: store.ChangeBlock, UserID: userID, Status: status}
+	if status {
+		change.Until = time.Now().AddDate(100, 0, 0) // permanent, as set by engine
+		if ttl > 0 {
+			change.Until = time.Now().Add(ttl)
+		}
+	}
+	s.recordChange(change)
+	return nil
+}
+
+// SetBlockIP blocks or unblocks ip hash and records the change
+func (s *DataStore) SetBlockIP(siteID, ip string, status bool, ttl time.Duration, bi store.BlockInfo) error {
+	if err := s.Interface.SetBlockIP(siteID, ip, status, ttl, bi); err != nil {
+		return err
+	}
+	change := store.Change{SiteID: siteID, Type: store.ChangeBlockIP, UserID: ip, Status: status}
+	if status {
+		change.Until = time.Now().AddDate(100, 0, 0) // permanent, as set by engine
+		if ttl > 0 {
+			change.Until = time.Now().Add(ttl)
+		}
+	}
+	s.recordChange(change)
+	return nil
+}
+
+// SetVerified sets or clears verified status of the user and records the change
+func (s *DataStore) SetVerified(siteID string, userID string, status bool) error {
+	if err := s.Interface.SetVerified(siteID, userID, status); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeVerified, UserID: userID, Status: status})
+	return nil
+}
+
+// SetShadowBan sets or clears shadow-ban status of the user and records the change
+func (s *DataStore) SetShadowBan(siteID string, userID string, status bool) error {
+	if err := s.Interface.SetShadowBan(siteID, userID, status); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeShadow, UserID: userID, Status: status})
+	return nil
+}
+
+// SetReadOnly sets or clears read-only status of the post and records the change
+func (s *DataStore) SetReadOnly(locator store.Locator, status bool) error {
+	if err := s.Interface.SetReadOnly(locator, status); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: locator.SiteID, Type: store.ChangeReadOnly, Locator: locator, Status: status})
+	return nil
+}
+
+// ClearIPs removes ip hashes from comments made before ts, of all users if userID empty, and records the change
+func (s *DataStore) ClearIPs(siteID, userID string, before time.Time) (int, error) {
+	count, err := s.Interface.ClearIPs(siteID, userID, before)
+	if err != nil {
+		return count, err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeClearIPs, UserID: userID, Until: before})
+	return count, nil
+}
+
+// WaitChanges returns change log records after since seq, up to limit. With nothing recorded after since,
+// waits for new changes till ctx done and returns empty list on timeout.
+func (s *DataStore) WaitChanges(ctx context.Context, siteID string, since int64, limit int) ([]store.Change, error) {
+	for {
+		notify := s.changesNotify(siteID) // taken before read to not miss change recorded in between
+		changes, err := s.Interface.Changes(siteID, since, limit)
+		if err != nil || len(changes) > 0 {
+			return changes, err
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return changes, nil
+		}
+	}
+}
+
+// PurgeChanges compacts change log, removes records older than ChangeLogKeep. Returns number of removed records.
+func (s *DataStore) PurgeChanges(siteID string) (int, error) {
+	if s.ChangeLogKeep <= 0 {
+		return 0, nil
+	}
+	return s.Interface.CompactChanges(siteID, time.Now().Add(-s.ChangeLogKeep))
+}
+
+// recordChange appends change to change log, if enabled, and wakes up readers waiting for changes of the site.
+// Failure logged and doesn't affect the change itself. Ip hash of the comment not recorded,
+// the log outlives ip retention period.
+func (s *DataStore) recordChange(change store.Change) {
+	if !s.ChangeLog {
+		return
+	}
+	if change.Comment != nil && change.Comment.User.IP != "" {
+		comment := *change.Comment
+		comment.User.IP = ""
+		change.Comment = &comment
+	}
+	change.Timestamp = time.Now()
+	if _, err := s.Interface.AppendChange(change); err != nil {
+		log.Printf("[WARN] can't record %s change for %s, %v", change.Type, change.SiteID, err)
+		return
+	}
+	s.changes.Lock()
+	if notify, ok := s.changes.notify[change.SiteID]; ok {
+		close(notify)
+		delete(s.changes.notify, change.SiteID)
+	}
+	s.changes.Unlock()
+}
+
+// recordCommentChange records change of the comment with its current state
+func (s *DataStore) recordCommentChange(changeType store.ChangeType, comment store.Comment) {
+	s.recordChange(store.Change{SiteID: comment.Locator.SiteID, Type: changeType, Locator: comment.Locator,
+		CommentID: comment.ID, UserID: comment.User.ID, Comment: &comment})
+}
+
+// changesNotify returns channel closed on the next change of the site
+func (s *DataStore) changesNotify(siteID string) <-chan struct{} {
+	s.changes.Lock()
+	defer s.changes.Unlock()
+	if s.changes.notify == nil {
+		s.changes.notify = map[string]chan struct{}{}
+	}
+	notify, ok := s.changes.notify[siteID]
+	if !ok {
+		notify = make(chan struct{})
+		s.changes.notify[siteID] = notify
+	}
+	return notify
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_ChangeLog(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), ChangeLog: true,
+		MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	id, err := b.Create(store.Comment{Text: "text 123", User: store.User{ID: "user", Name: "name"}, Locator: locator})
+	require.NoError(t, err)
+	_, err = b.EditComment(locator, id, EditRequest{Orig: "edited", Text: "edited"})
+	require.NoError(t, err)
+	_, err = b.Vote(locator, id, "user2", true)
+	require.NoError(t, err)
+	require.NoError(t, b.SetBlock("radio-t", "user3", true, time.Hour, store.BlockInfo{}))
+	require.NoError(t, b.SetReadOnly(locator, true))
+	_, err = b.EditComment(locator, id, EditRequest{Delete: true})
+	require.NoError(t, err)
+	require.NoError(t, b.DeleteUser("radio-t", "user1"))
+	_, err = b.Vote(locator, id, "user", true)
+	require.Error(t, err, "failed change not recorded")
+
+	changes, err := b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 7, len(changes))
+	types := []store.ChangeType{}
+	for i, c := range changes {
+		types = append(types, c.Type)
+		assert.Equal(t, int64(i+1), c.Seq)
+		assert.False(t, c.Timestamp.IsZero())
+	}
+	assert.Equal(t, []store.ChangeType{store.ChangeCreate, store.ChangeEdit, store.ChangeVote, store.ChangeBlock,
+		store.ChangeReadOnly, store.ChangeDelete, store.ChangeDelete}, types)
+
+	assert.Equal(t, id, changes[0].CommentID)
+	assert.Equal(t, "user", changes[0].UserID)
+	assert.Equal(t, "text 123", changes[0].Comment.Text)
+	assert.Equal(t, "edited", changes[1].Comment.Text)
+	assert.Equal(t, "user2", changes[2].UserID, "voter")
+	assert.Equal(t, 1, changes[2].Comment.Score)
+	assert.Equal(t, "user3", changes[3].UserID)
+	assert.True(t, changes[3].Status)
+	assert.True(t, changes[3].Until.After(time.Now().Add(59*time.Minute)), "block ttl")
+	assert.Equal(t, locator, changes[4].Locator)
+	assert.True(t, changes[4].Status)
+	assert.Equal(t, id, changes[5].CommentID)
+	require.NotNil(t, changes[5].Comment)
+	assert.True(t, changes[5].Comment.Deleted, "comment after delete")
+	assert.Equal(t, "user1", changes[6].UserID)
+	assert.Equal(t, "", changes[6].CommentID)
+}
+
+func TestService_ChangeLogPrivacy(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), ChangeLog: true,
+		MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	id, err := b.Create(store.Comment{Text: "text 123", User: store.User{ID: "user", Name: "name", IP: "127.0.0.1"},
+		Locator: locator})
+	require.NoError(t, err)
+	_, err = b.Vote(locator, "id-1", "user", true)
+	require.NoError(t, err)
+	c, err := b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.NotEmpty(t, c.User.IP, "ip hash stored with comment")
+
+	changes, err := b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(changes))
+	assert.Equal(t, "", changes[0].Comment.User.IP, "ip hash not in change log")
+
+	_, err = b.Vote(locator, id, "voter", true)
+	require.NoError(t, err)
+	changes, err = b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(changes))
+	assert.Equal(t, store.ChangeVote, changes[2].Type)
+	assert.Equal(t, "", changes[2].Comment.User.IP, "ip hash of voted comment not in change log")
+
+	req, err := b.RequestDeletion("radio-t", "user", store.DeletionFull)
+	require.NoError(t, err)
+	_, err = b.ConfirmDeletion("radio-t", req.ID, "user")
+	require.NoError(t, err)
+
+	changes, err = b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	for _, ch := range changes {
+		if ch.Type == store.ChangeDelete && ch.CommentID == "" {
+			continue // deletion of all user's comments kept for replay
+		}
+		assert.NotEqual(t, "user", ch.UserID, "%+v", ch)
+		if ch.Comment != nil {
+			assert.NotEqual(t, "user", ch.Comment.User.ID, "%+v", ch)
+			_, voted := ch.Comment.Votes["user"]
+			assert.False(t, voted, "%+v", ch)
+		}
+	}
+}
+
+func TestService_ChangeLogUserChanges(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), ChangeLog: true}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	require.NoError(t, b.SetPin(locator, "id-1", true))
+	require.NoError(t, b.SetProfile("radio-t", store.Profile{ID: "user1", Name: "new name"}))
+	require.NoError(t, b.MergeUser("radio-t", "user1", "user2"))
+	ts := time.Now()
+	_, err := b.ClearIPs("radio-t", "", ts)
+	require.NoError(t, err)
+
+	changes, err := b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(changes))
+	assert.Equal(t, store.ChangeEdit, changes[0].Type)
+	assert.True(t, changes[0].Comment.Pin)
+	assert.Equal(t, store.ChangeProfile, changes[1].Type)
+	assert.Equal(t, "user1", changes[1].UserID)
+	assert.Equal(t, "new name", changes[1].Profile.Name)
+	assert.Equal(t, store.Change{Seq: 3, SiteID: "radio-t", Type: store.ChangeMerge, UserID: "user1", TargetID: "user2",
+		Timestamp: changes[2].Timestamp}, changes[2])
+	assert.Equal(t, store.ChangeClearIPs, changes[3].Type)
+	assert.True(t, ts.Equal(changes[3].Until))
+}
+
+func TestService_ChangeLogMetaChanges(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), ChangeLog: true}
+
+	require.NoError(t, b.SetVerified("radio-t", "user1", true))
+	require.NoError(t, b.SetShadowBan("radio-t", "user2", true))
+	require.NoError(t, b.SetBlockIP("radio-t", "ip-hash", true, time.Hour, store.BlockInfo{}))
+	require.NoError(t, b.SetTrustLevel("radio-t", "user1", store.TrustRegular))
+	size := 100
+	require.NoError(t, b.SetSettings("radio-t", store.SiteSettings{MaxCommentSize: &size}))
+	rules := []store.RestrictedRule{{Pattern: "bad", Action: store.RestrictMask}}
+	require.NoError(t, b.SetRestrictedRules("radio-t", rules))
+
+	changes, err := b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 6, len(changes))
+	assert.Equal(t, store.ChangeVerified, changes[0].Type)
+	assert.Equal(t, "user1", changes[0].UserID)
+	assert.True(t, changes[0].Status)
+	assert.Equal(t, store.ChangeShadow, changes[1].Type)
+	assert.Equal(t, "user2", changes[1].UserID)
+	assert.Equal(t, store.ChangeBlockIP, changes[2].Type)
+	assert.Equal(t, "ip-hash", changes[2].UserID)
+	assert.True(t, changes[2].Until.After(time.Now()))
+	assert.Equal(t, store.ChangeTrust, changes[3].Type)
+	assert.Equal(t, store.TrustRegular, changes[3].Trust.Level)
+	assert.True(t, changes[3].Trust.Manual)
+	assert.Equal(t, store.ChangeSettings, changes[4].Type)
+	assert.Equal(t, 100, *changes[4].Settings.MaxCommentSize)
+	assert.Equal(t, store.ChangeRules, changes[5].Type)
+	assert.Equal(t, rules, changes[5].Rules)
+}
+
+func TestService_ChangeLogDisabled(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.Create(store.Comment{Text: "text 123", User: store.User{ID: "user", Name: "name"}, Locator: locator})
+	require.NoError(t, err)
+	require.NoError(t, b.SetReadOnly(locator, true))
+	changes, err := b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+}
+
+func TestService_WaitChanges(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), ChangeLog: true}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	st := time.Now()
+	changes, err := b.WaitChanges(ctx, "radio-t", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(changes), "nothing recorded, timeout")
+	assert.True(t, time.Since(st) >= 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, b.SetReadOnly(locator, true))
+	}()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel2()
+	st = time.Now()
+	changes, err = b.WaitChanges(ctx2, "radio-t", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(changes), "woken up by the change")
+	assert.Equal(t, store.ChangeReadOnly, changes[0].Type)
+	assert.True(t, time.Since(st) < time.Second)
+
+	changes, err = b.WaitChanges(ctx, "radio-t", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(changes), "recorded change returned right away")
+
+	_, err = b.WaitChanges(ctx, "bad", 0, 10)
+	assert.Error(t, err)
+}
+
+func TestService_PurgeChanges(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), ChangeLog: true}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	require.NoError(t, b.SetReadOnly(locator, true))
+
+	n, err := b.PurgeChanges("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "kept forever")
+
+	b.ChangeLogKeep = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, b.SetReadOnly(locator, false))
+	b.ChangeLogKeep = 4 * time.Millisecond
+	n, err = b.PurgeChanges("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	changes, err := b.Interface.Changes("radio-t", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(changes))
+	assert.Equal(t, int64(2), changes[0].Seq)
+}
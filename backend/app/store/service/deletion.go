@@ -0,0 +1,224 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/engine"
+)
+
+// DeletionNotifier announces status changes of deletion requests
+type DeletionNotifier interface {
+	SubmitDeletion(req store.DeletionRequest)
+}
+
+const anonymizedName = "deleted user"
+
+// RequestDeletion starts deletion of user's data. Nothing removed until the request confirmed by the user.
+func (s *DataStore) RequestDeletion(siteID, userID string, mode store.DeletionMode) (store.DeletionRequest, error) {
+	if mode == "" {
+		mode = store.DeletionFull
+	}
+	if mode != store.DeletionFull && mode != store.DeletionAnonymize {
+		return store.DeletionRequest{}, errors.Errorf("unsupported deletion mode %q", mode)
+	}
+	req := store.DeletionRequest{ID: uuid.New().String(), SiteID: siteID, UserID: userID, Mode: mode, Created: time.Now()}
+	req.AddStep(store.DeletionRequested, userID)
+	if err := s.SaveDeletion(req); err != nil {
+		return store.DeletionRequest{}, err
+	}
+	log.Printf("[INFO] deletion of %s requested, mode %s, site %s", userID, mode, siteID)
+	return req, nil
+}
+
+// Deletion returns deletion request by id
+func (s *DataStore) Deletion(siteID, reqID string) (store.DeletionRequest, error) {
+	reqs, err := s.Deletions(siteID)
+	if err != nil {
+		return store.DeletionRequest{}, err
+	}
+	for _, r := range reqs {
+		if r.ID == reqID {
+			return r, nil
+		}
+	}
+	return store.DeletionRequest{}, errors.Errorf("deletion request %s not found", reqID)
+}
+
+// ConfirmDeletion confirms request by its author. Executed right away if admin's approval not required.
+func (s *DataStore) ConfirmDeletion(siteID, reqID, userID string) (store.DeletionRequest, error) {
+	return s.changeDeletion(siteID, reqID, store.DeletionRequested, func(req *store.DeletionRequest) error {
+		if req.UserID != userID {
+			return errors.Errorf("deletion request %s made by another user", reqID)
+		}
+		req.AddStep(store.DeletionConfirmed, userID)
+		if s.DeletionApproval {
+			return nil
+		}
+		return s.executeDeletion(req, userID)
+	})
+}
+
+// ApproveDeletion approves confirmed request by admin and executes it
+func (s *DataStore) ApproveDeletion(siteID, reqID, adminID string) (store.DeletionRequest, error) {
+	return s.changeDeletion(siteID, reqID, store.DeletionConfirmed, func(req *store.DeletionRequest) error {
+		req.AddStep(store.DeletionApproved, adminID)
+		return s.executeDeletion(req, adminID)
+	})
+}
+
+// RejectDeletion rejects confirmed request by admin, user's data kept
+func (s *DataStore) RejectDeletion(siteID, reqID, adminID string) (store.DeletionRequest, error) {
+	return s.changeDeletion(siteID, reqID, store.DeletionConfirmed, func(req *store.DeletionRequest) error {
+		req.AddStep(store.DeletionRejected, adminID)
+		return nil
+	})
+}
+
+// changeDeletion applies fn to request in expected status, saves and announces the result.
+// Request kept unchanged if fn failed, so it can be retried.
+func (s *DataStore) changeDeletion(siteID, reqID string, expected store.DeletionStatus,
+	fn func(req *store.DeletionRequest) error) (store.DeletionRequest, error) {
+
+	lock := s.getScopedLocks(reqID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	req, err := s.Deletion(siteID, reqID)
+	if err != nil {
+		return req, err
+	}
+	if req.Status != expected {
+		return req, errors.Errorf("deletion request %s is %s, expected %s", reqID, req.Status, expected)
+	}
+	if err = fn(&req); err != nil {
+		return req, err
+	}
+	if err = s.SaveDeletion(req); err != nil {
+		return req, err
+	}
+	if s.DeletionNotifier != nil {
+		s.DeletionNotifier.SubmitDeletion(req)
+	}
+	return req, nil
+}
+
+// executeDeletion removes user's comments or moves them to anonymous user, clears stored profile, trust and flags.
+// User without comments and votes is not an error, there is just nothing to remove except the stored records.
+func (s *DataStore) executeDeletion(req *store.DeletionRequest, actor string) error {
+	if err := s.removeUserTrash(req.SiteID, req.UserID); err != nil {
+		return err
+	}
+	switch req.Mode {
+	case store.DeletionAnonymize:
+		req.AnonID = "deleted_" + uuid.New().String() // random, can't be linked back to the user
+		if err := s.MergeUser(req.SiteID, req.UserID, req.AnonID); err != nil {
+			return errors.Wrapf(err, "can't anonymize comments of %s", req.UserID)
+		}
+		if _, err := s.ClearIPs(req.SiteID, req.AnonID, time.Now().Add(time.Minute)); err != nil {
+			return errors.Wrapf(err, "can't clear ip hashes of %s", req.UserID)
+		}
+		anon := store.Profile{ID: req.AnonID, Name: anonymizedName, Updated: time.Now()}
+		if err := s.SetProfile(req.SiteID, anon); err != nil {
+			return errors.Wrapf(err, "can't set anonymous profile for %s", req.UserID)
+		}
+	default:
+		n, err := s.userCount(req.SiteID, req.UserID)
+		if err != nil {
+			return errors.Wrapf(err, "can't count comments of %s", req.UserID)
+		}
+		if n > 0 {
+			if err = s.DeleteUser(req.SiteID, req.UserID); err != nil {
+				return errors.Wrapf(err, "can't delete comments of %s", req.UserID)
+			}
+		}
+		if _, err = s.removeVotes(req.SiteID, req.UserID); err != nil {
+			return errors.Wrapf(err, "can't remove votes of %s", req.UserID)
+		}
+	}
+
+	if err := s.SetProfile(req.SiteID, store.Profile{ID: req.UserID, Updated: time.Now()}); err != nil {
+		return errors.Wrapf(err, "can't clear profile of %s", req.UserID)
+	}
+	if err := s.clearUserRecords(req.SiteID, req.UserID); err != nil {
+		return err
+	}
+	anon := store.User{}
+	if req.Mode == store.DeletionAnonymize {
+		anon = store.User{ID: req.AnonID, Name: anonymizedName}
+	}
+	if _, err := s.Interface.RedactChanges(req.SiteID, req.UserID, anon); err != nil {
+		return errors.Wrapf(err, "can't remove %s from change log", req.UserID)
+	}
+	req.AddStep(store.DeletionExecuted, actor)
+	log.Printf("[INFO] data of %s removed, mode %s, site %s", req.UserID, req.Mode, req.SiteID)
+	return nil
+}
+
+// clearUserRecords resets stored trust, verified and shadow-ban flags of the user
+func (s *DataStore) clearUserRecords(siteID, userID string) error {
+	if err := s.Interface.SetTrust(siteID, userID, store.UserTrust{}); err != nil {
+		return errors.Wrapf(err, "can't clear trust of %s", userID)
+	}
+	if err := s.Interface.SetVerified(siteID, userID, false); err != nil {
+		return errors.Wrapf(err, "can't clear verified flag of %s", userID)
+	}
+	if err := s.Interface.SetShadowBan(siteID, userID, false); err != nil {
+		return errors.Wrapf(err, "can't clear shadow-ban flag of %s", userID)
+	}
+	return nil
+}
+
+// userCount returns number of user's comments, zero for user without comments
+func (s *DataStore) userCount(siteID, userID string) (int, error) {
+	n, err := s.Interface.UserCount(siteID, userID)
+	if _, ok := errors.Cause(err).(engine.UnknownUserError); ok {
+		return 0, nil
+	}
+	return n, err
+}
+
+// removeVotes removes user's entries from votes of all comments. Score kept as is, only the link to the user removed.
+// Returns number of removed votes.
+func (s *DataStore) removeVotes(siteID, userID string) (count int, err error) {
+	posts, err := s.Interface.List(siteID, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range posts {
+		locator := store.Locator{SiteID: siteID, URL: p.URL}
+		n, e := s.removePostVotes(locator, userID)
+		if e != nil {
+			return count, e
+		}
+		count += n
+	}
+	return count, nil
+}
+
+func (s *DataStore) removePostVotes(locator store.Locator, userID string) (count int, err error) {
+	lock := s.getScopedLocks(locator.URL)
+	lock.Lock()
+	defer lock.Unlock()
+
+	comments, err := s.Interface.Find(locator, "time")
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range comments {
+		if _, ok := c.Votes[userID]; !ok {
+			continue
+		}
+		delete(c.Votes, userID)
+		if err = s.Interface.Put(locator, c); err != nil {
+			return count, errors.Wrapf(err, "can't update votes of %s", c.ID)
+		}
+		s.recordCommentChange(store.ChangeEdit, c)
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_DeletionFull(t *testing.T) {
+	defer teardown(t)
+	notifier := &mockDeletionNotifier{}
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), DeletionNotifier: notifier}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	require.NoError(t, b.SetProfile("radio-t", store.Profile{ID: "user1", Name: "user name", Picture: "http://example.com/pic.png"}))
+
+	req, err := b.RequestDeletion("radio-t", "user1", "")
+	require.NoError(t, err)
+	assert.Equal(t, store.DeletionFull, req.Mode, "default mode")
+	assert.Equal(t, store.DeletionRequested, req.Status)
+	c, err := b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.False(t, c.Deleted, "nothing deleted before confirmation")
+
+	_, err = b.ConfirmDeletion("radio-t", req.ID, "user2")
+	assert.EqualError(t, err, "deletion request "+req.ID+" made by another user")
+
+	req, err = b.ConfirmDeletion("radio-t", req.ID, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DeletionExecuted, req.Status, "executed without approval")
+	require.Equal(t, 3, len(req.Steps))
+	assert.Equal(t, store.DeletionConfirmed, req.Steps[1].Status)
+	assert.Equal(t, "user1", req.Steps[2].Actor)
+
+	c, err = b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.True(t, c.Deleted)
+	assert.Equal(t, "deleted", c.User.ID)
+	profile, err := b.Profile("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, "", profile.Name, "profile cleared")
+	assert.Equal(t, "", profile.Picture)
+
+	stored, err := b.Deletion("radio-t", req.ID)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(stored.Steps), "all steps recorded")
+	assert.Equal(t, store.DeletionExecuted, stored.Status)
+	sent := notifier.get()
+	require.Equal(t, 1, len(sent))
+	assert.Equal(t, store.DeletionExecuted, sent[0].Status)
+
+	_, err = b.ConfirmDeletion("radio-t", req.ID, "user1")
+	assert.EqualError(t, err, "deletion request "+req.ID+" is executed, expected requested")
+	_, err = b.Deletion("radio-t", "bad-id")
+	assert.EqualError(t, err, "deletion request bad-id not found")
+	_, err = b.RequestDeletion("radio-t", "user1", "blah")
+	assert.EqualError(t, err, `unsupported deletion mode "blah"`)
+}
+
+func TestService_DeletionAnonymize(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), DeletionApproval: true}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Create(store.Comment{ID: "id-3", Text: "text", Locator: locator, User: store.User{ID: "user1", Name: "user name", IP: "127.0.0.1"}})
+	require.NoError(t, err)
+
+	req, err := b.RequestDeletion("radio-t", "user1", store.DeletionAnonymize)
+	require.NoError(t, err)
+	_, err = b.ApproveDeletion("radio-t", req.ID, "admin1")
+	assert.EqualError(t, err, "deletion request "+req.ID+" is requested, expected confirmed", "not confirmed yet")
+
+	req, err = b.ConfirmDeletion("radio-t", req.ID, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DeletionConfirmed, req.Status, "waits for approval")
+
+	req, err = b.ApproveDeletion("radio-t", req.ID, "admin1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DeletionExecuted, req.Status)
+	assert.Equal(t, "admin1", req.Steps[2].Actor)
+	assert.Equal(t, store.DeletionApproved, req.Steps[2].Status)
+	assert.NotEmpty(t, req.AnonID)
+	assert.NotEqual(t, "deleted_"+store.EncodeID("radio-t::user1"), req.AnonID, "not derived from user id")
+
+	c, err := b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.False(t, c.Deleted, "comment kept")
+	assert.Equal(t, req.AnonID, c.User.ID)
+	assert.Equal(t, "deleted user", c.User.Name)
+	c, err = b.Interface.Get(locator, "id-3")
+	require.NoError(t, err)
+	assert.Equal(t, req.AnonID, c.User.ID)
+	assert.Equal(t, "", c.User.IP, "ip hash cleared")
+	_, err = b.Interface.User("radio-t", "user1", 0, 0)
+	assert.Error(t, err, "no comments left for user1")
+}
+
+func TestService_DeletionVotesOnly(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Vote(locator, "id-1", "voter", true)
+	require.NoError(t, err)
+
+	req, err := b.RequestDeletion("radio-t", "voter", store.DeletionFull)
+	require.NoError(t, err)
+	req, err = b.ConfirmDeletion("radio-t", req.ID, "voter")
+	require.NoError(t, err, "user without comments deleted")
+	assert.Equal(t, store.DeletionExecuted, req.Status)
+
+	c, err := b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	_, voted := c.Votes["voter"]
+	assert.False(t, voted, "vote not linked to the user anymore")
+	assert.Equal(t, 1, c.Score, "score kept")
+
+	// nothing to remove but stored records
+	require.NoError(t, b.SetVerified("radio-t", "no-such-user", true))
+	require.NoError(t, b.SetProfile("radio-t", store.Profile{ID: "no-such-user", Name: "name"}))
+	req, err = b.RequestDeletion("radio-t", "no-such-user", store.DeletionFull)
+	require.NoError(t, err)
+	req, err = b.ConfirmDeletion("radio-t", req.ID, "no-such-user")
+	require.NoError(t, err)
+	assert.Equal(t, store.DeletionExecuted, req.Status)
+	assert.False(t, b.IsVerified("radio-t", "no-such-user"))
+	profile, err := b.Profile("radio-t", "no-such-user")
+	require.NoError(t, err)
+	assert.Equal(t, "", profile.Name)
+}
+
+func TestService_DeletionReject(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), DeletionApproval: true}
+
+	req, err := b.RequestDeletion("radio-t", "user1", store.DeletionFull)
+	require.NoError(t, err)
+	_, err = b.ConfirmDeletion("radio-t", req.ID, "user1")
+	require.NoError(t, err)
+	req, err = b.RejectDeletion("radio-t", req.ID, "admin1")
+	require.NoError(t, err)
+	assert.Equal(t, store.DeletionRejected, req.Status)
+
+	comments, err := b.Interface.User("radio-t", "user1", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments), "nothing deleted")
+	_, err = b.ApproveDeletion("radio-t", req.ID, "admin1")
+	assert.Error(t, err, "rejected request can't be approved")
+}
+
+type mockDeletionNotifier struct {
+	lock sync.Mutex
+	reqs []store.DeletionRequest
+}
+
+func (m *mockDeletionNotifier) SubmitDeletion(req store.DeletionRequest) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.reqs = append(m.reqs, req)
+}
+
+func (m *mockDeletionNotifier) get() []store.DeletionRequest {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.reqs
+}
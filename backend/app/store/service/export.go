@@ -0,0 +1,246 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"path"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// UserVote is a vote made by the user for somebody's comment
+type UserVote struct {
+	CommentID string        `json:"id"`
+	Locator   store.Locator `json:"locator"`
+	Vote      int           `json:"vote"` // 1 for up, -1 for down
+}
+
+// ExportManifest describes content of the user's data archive, stored as manifest.json
+type ExportManifest struct {
+	SiteID  string       `json:"site"`
+	UserID  string       `json:"user_id"`
+	Created time.Time    `json:"created"`
+	Files   []ExportFile `json:"files"`
+}
+
+// ExportFile is a single file of the user's data archive
+type ExportFile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Records     int    `json:"records"`
+}
+
+// exportUserInfo is the content of user.json in the user's data archive
+type exportUserInfo struct {
+	Info     store.User      `json:"info"`
+	Profile  store.Profile   `json:"profile"`
+	Verified bool            `json:"verified"`
+	Blocked  bool            `json:"blocked"`
+	Trust    store.UserTrust `json:"trust"`
+}
+
+const (
+	exportPageSize = 100  // comments read from engine at once
+	postsPageSize  = 1000 // posts listed at once while scanning all comments of the site
+)
+
+// ExportUser writes zip archive with all personal data of the user to w. Archive includes user's info and profile,
+// all comments, votes, uploaded pictures, moderation and deletion history. Comments and pictures streamed,
+// manifest.json with the list of files written last.
+func (s *DataStore) ExportUser(siteID string, user store.User, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	manifest := ExportManifest{SiteID: siteID, UserID: user.ID, Created: time.Now()}
+
+	addJSON := func(name, descr string, records int, val interface{}) error {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return errors.Wrapf(err, "can't make %s", name)
+		}
+		if err = json.NewEncoder(fw).Encode(val); err != nil {
+			return errors.Wrapf(err, "can't write %s", name)
+		}
+		manifest.Files = append(manifest.Files, ExportFile{Name: name, Description: descr, Records: records})
+		return nil
+	}
+
+	info := exportUserInfo{Info: user, Verified: s.IsVerified(siteID, user.ID), Blocked: s.IsBlocked(siteID, user.ID)}
+	var err error
+	if info.Profile, err = s.Interface.Profile(siteID, user.ID); err != nil {
+		return errors.Wrapf(err, "can't get profile of %s", user.ID)
+	}
+	if info.Trust, err = s.Interface.Trust(siteID, user.ID); err != nil {
+		return errors.Wrapf(err, "can't get trust of %s", user.ID)
+	}
+	if err = addJSON("user.json", "user info, profile and status", 1, info); err != nil {
+		return err
+	}
+
+	count, pictures, err := s.exportComments(zw, siteID, user)
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, ExportFile{Name: "comments.json", Description: "comments made by user", Records: count})
+
+	votes, err := s.userVotes(siteID, user.ID)
+	if err != nil {
+		return err
+	}
+	if err = addJSON("votes.json", "votes for comments", len(votes), votes); err != nil {
+		return err
+	}
+
+	moderation, err := s.Interface.Moderation(siteID, user.ID)
+	if err != nil {
+		return errors.Wrapf(err, "can't get moderation journal of %s", user.ID)
+	}
+	if err = addJSON("moderation.json", "blocks and other moderation actions", len(moderation), moderation); err != nil {
+		return err
+	}
+
+	deletions := []store.DeletionRequest{}
+	reqs, err := s.Interface.Deletions(siteID)
+	if err != nil {
+		return errors.Wrapf(err, "can't get deletion requests of %s", user.ID)
+	}
+	for _, r := range reqs {
+		if r.UserID == user.ID {
+			deletions = append(deletions, r)
+		}
+	}
+	if err = addJSON("deletions.json", "data deletion requests", len(deletions), deletions); err != nil {
+		return err
+	}
+
+	for _, id := range pictures {
+		if e := s.exportPicture(zw, id); e != nil {
+			log.Printf("[WARN] can't export picture %s of %s, %v", id, user.ID, e)
+			continue
+		}
+		manifest.Files = append(manifest.Files, ExportFile{Name: path.Join("images", id), Description: "uploaded picture", Records: 1})
+	}
+
+	if err = addJSON("manifest.json", "list of files", len(manifest.Files), manifest); err != nil {
+		return err
+	}
+	return errors.Wrap(zw.Close(), "can't close zip")
+}
+
+// exportComments streams all user's comments as json array to comments.json, page by page.
+// Returns number of comments and ids of pictures used in comments.
+func (s *DataStore) exportComments(zw *zip.Writer, siteID string, user store.User) (count int, pictures []string, err error) {
+	fw, err := zw.Create("comments.json")
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "can't make comments.json")
+	}
+	if _, err = io.WriteString(fw, "["); err != nil {
+		return 0, nil, errors.Wrap(err, "can't write comments.json")
+	}
+
+	total, e := s.Interface.UserCount(siteID, user.ID)
+	if e != nil {
+		total = 0 // bolt engine fails on user without comments
+	}
+	seen := map[string]bool{}
+	for skip := 0; skip < total; skip += exportPageSize {
+		comments, e := s.User(siteID, user.ID, exportPageSize, skip, user)
+		if e != nil {
+			return count, pictures, errors.Wrapf(e, "can't get comments of %s", user.ID)
+		}
+		for _, c := range comments {
+			b, e := json.Marshal(c)
+			if e != nil {
+				return count, pictures, errors.Wrapf(e, "can't marshal comment %s", c.ID)
+			}
+			if count > 0 {
+				b = append([]byte(","), b...)
+			}
+			if _, e = fw.Write(b); e != nil {
+				return count, pictures, errors.Wrap(e, "can't write comments.json")
+			}
+			count++
+			pictures = append(pictures, s.commentPictures(c, seen)...)
+		}
+		if len(comments) < exportPageSize {
+			break
+		}
+	}
+
+	if _, err = io.WriteString(fw, "]\n"); err != nil {
+		return count, pictures, errors.Wrap(err, "can't write comments.json")
+	}
+	return count, pictures, nil
+}
+
+// commentPictures returns ids of pictures in comment's text, skipping ids already seen
+func (s *DataStore) commentPictures(c store.Comment, seen map[string]bool) (ids []string) {
+	if s.ImageService == nil {
+		return nil
+	}
+	pics, err := s.ImageService.ExtractPictures(c.Text)
+	if err != nil {
+		log.Printf("[WARN] can't extract pictures from %s, %v", c.ID, err)
+		return nil
+	}
+	for _, id := range pics {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// exportPicture copies picture from image store to images/{id} in archive
+func (s *DataStore) exportPicture(zw *zip.Writer, id string) error {
+	rd, _, err := s.ImageService.Load(id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := rd.Close(); e != nil {
+			log.Printf("[WARN] can't close picture %s, %v", id, e)
+		}
+	}()
+	fw, err := zw.Create(path.Join("images", id))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, rd)
+	return err
+}
+
+// userVotes scans all posts of the site and collects votes made by the user
+func (s *DataStore) userVotes(siteID, userID string) ([]UserVote, error) {
+	votes := []UserVote{}
+	for skip := 0; ; skip += postsPageSize {
+		posts, err := s.Interface.List(siteID, postsPageSize, skip)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't list posts of %s", siteID)
+		}
+		for _, p := range posts {
+			comments, err := s.Interface.Find(store.Locator{SiteID: siteID, URL: p.URL}, "time")
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't get comments for %s", p.URL)
+			}
+			for _, c := range comments {
+				v, ok := c.Votes[userID]
+				if !ok {
+					continue
+				}
+				vote := UserVote{CommentID: c.ID, Locator: c.Locator, Vote: -1}
+				if v {
+					vote.Vote = 1
+				}
+				votes = append(votes, vote)
+			}
+		}
+		if len(posts) < postsPageSize {
+			return votes, nil
+		}
+	}
+}
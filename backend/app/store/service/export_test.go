@@ -0,0 +1,101 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+	"github.com/umputun/remark/backend/app/store/image"
+)
+
+func TestService_ExportUser(t *testing.T) {
+	defer teardown(t)
+
+	mockStore := image.MockStore{}
+	mockStore.On("Load", "user1/pic1.png").Return(ioutil.NopCloser(strings.NewReader("some image")), int64(10), nil)
+	mockStore.On("Load", "user1/pic2.png").Return(nil, int64(0), errors.New("no such picture"))
+	imgSvc := &image.Service{Store: &mockStore, ImageAPI: "/api/v1/picture/"}
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"),
+		ImageService: imgSvc, MaxVotes: -1}
+
+	c := store.Comment{
+		ID:        "id-3",
+		Text:      `pics <img src="/api/v1/picture/user1/pic1.png"/> <img src="/api/v1/picture/user1/pic2.png"/>`,
+		Timestamp: time.Date(2017, 12, 20, 15, 18, 24, 0, time.Local),
+		Locator:   store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"},
+		User:      store.User{ID: "user2", Name: "user name 2"},
+	}
+	_, err := b.Interface.Create(c)
+	require.NoError(t, err)
+	_, err = b.Vote(store.Locator{URL: "https://radio-t.com/2", SiteID: "radio-t"}, "id-3", "user1", false)
+	require.NoError(t, err)
+	c.ID, c.User = "id-4", store.User{ID: "user1", Name: "user name"}
+	_, err = b.Interface.Create(c)
+	require.NoError(t, err)
+	require.NoError(t, b.AddModeration(store.ModerationRecord{SiteID: "radio-t", UserID: "user1", Action: store.ModBlock,
+		Timestamp: time.Now()}))
+	_, err = b.RequestDeletion("radio-t", "user1", store.DeletionFull)
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, b.ExportUser("radio-t", store.User{ID: "user1", Name: "user name"}, &buf))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rd, e := f.Open()
+		require.NoError(t, e)
+		files[f.Name], e = ioutil.ReadAll(rd)
+		require.NoError(t, e)
+	}
+	assert.Equal(t, 7, len(files), "6 json files and a picture")
+	assert.Equal(t, "some image", string(files["images/user1/pic1.png"]))
+
+	manifest := ExportManifest{}
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Equal(t, "user1", manifest.UserID)
+	names := []string{}
+	for _, f := range manifest.Files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"user.json", "comments.json", "votes.json", "moderation.json", "deletions.json",
+		"images/user1/pic1.png"}, names)
+	assert.Equal(t, 3, manifest.Files[1].Records)
+
+	comments := []store.Comment{}
+	require.NoError(t, json.Unmarshal(files["comments.json"], &comments))
+	require.Equal(t, 3, len(comments))
+	assert.Equal(t, "id-4", comments[0].ID, "newest first")
+	assert.Equal(t, "id-1", comments[2].ID)
+
+	votes := []UserVote{}
+	require.NoError(t, json.Unmarshal(files["votes.json"], &votes))
+	assert.Equal(t, []UserVote{{CommentID: "id-3", Locator: c.Locator, Vote: -1}}, votes)
+
+	moderation := []store.ModerationRecord{}
+	require.NoError(t, json.Unmarshal(files["moderation.json"], &moderation))
+	require.Equal(t, 1, len(moderation))
+	assert.Equal(t, store.ModBlock, moderation[0].Action)
+
+	deletions := []store.DeletionRequest{}
+	require.NoError(t, json.Unmarshal(files["deletions.json"], &deletions))
+	assert.Equal(t, 1, len(deletions))
+
+	// user without comments
+	buf.Reset()
+	require.NoError(t, b.ExportUser("radio-t", store.User{ID: "user3"}, &buf))
+	zr, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, 6, len(zr.File))
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// MergeResult is the outcome of merged comment
+type MergeResult int
+
+// enum of merge results
+const (
+	MergeSkipped  MergeResult = iota // comment exists and not changed
+	MergeInserted                    // comment missing, created
+	MergeUpdated                     // comment exists, changed part updated
+)
+
+// MergeComment adds imported comment if missing or updates changed one, keyed by comment id.
+// With full set the state of the comment, i.e. votes, score, pin and deleted status, replaced as well,
+// otherwise only text updated and votes and other state made on this site kept, comments deleted on this site skipped.
+func (s *DataStore) MergeComment(comment store.Comment, full bool) (MergeResult, error) {
+	lock := s.getScopedLocks(comment.Locator.URL)
+	lock.Lock()
+	defer lock.Unlock()
+
+	current, err := s.Interface.Get(comment.Locator, comment.ID)
+	if err != nil { // not imported yet
+		if _, err = s.Import(comment); err != nil {
+			return MergeSkipped, errors.Wrapf(err, "can't create %s", comment.ID)
+		}
+		return MergeInserted, nil
+	}
+
+	if full && comment.Deleted && !current.Deleted { // deleted in source, remove with delete's bookkeeping
+		if err = s.Delete(comment.Locator, comment.ID, store.SoftDelete); err != nil {
+			return MergeSkipped, errors.Wrapf(err, "can't delete %s", comment.ID)
+		}
+		return MergeUpdated, nil
+	}
+
+	if !full && current.Deleted { // deleted or moderated on this site, source text not brought back
+		return MergeSkipped, nil
+	}
+
+	comment.Sanitize()
+	updated := current
+	updated.Text, updated.Orig = comment.Text, comment.Orig
+	if full {
+		updated.Score, updated.Votes, updated.Controversy = comment.Score, comment.Votes, comment.Controversy
+		updated.Pin, updated.Deleted, updated.Pending, updated.Edit = comment.Pin, comment.Deleted, comment.Pending, comment.Edit
+	}
+	if len(current.Votes) == 0 && len(updated.Votes) == 0 {
+		updated.Votes = current.Votes // nil and empty votes are the same
+	}
+	if reflect.DeepEqual(current, updated) {
+		return MergeSkipped, nil
+	}
+	if err = s.Interface.Put(comment.Locator, updated); err != nil {
+		return MergeSkipped, errors.Wrapf(err, "can't update %s", comment.ID)
+	}
+	s.recordCommentChange(store.ChangeEdit, updated)
+	return MergeUpdated, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_MergeComment(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Vote(locator, "id-1", "user2", true)
+	require.NoError(t, err)
+
+	imported := store.Comment{ID: "id-1", Text: "updated text <script>alert(1)</script>", Locator: locator,
+		User: store.User{ID: "user1", Name: "user name"}, Timestamp: time.Date(2017, 12, 20, 15, 18, 22, 0, time.Local)}
+	res, err := b.MergeComment(imported, false)
+	require.NoError(t, err)
+	assert.Equal(t, MergeUpdated, res)
+	c, err := b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.Equal(t, "updated text ", c.Text, "sanitized")
+	assert.Equal(t, 1, c.Score, "votes kept")
+	assert.Equal(t, map[string]bool{"user2": true}, c.Votes)
+
+	res, err = b.MergeComment(imported, false)
+	require.NoError(t, err)
+	assert.Equal(t, MergeSkipped, res, "merged again")
+
+	res, err = b.MergeComment(imported, true)
+	require.NoError(t, err)
+	assert.Equal(t, MergeUpdated, res, "full state replaced")
+	c, err = b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Score)
+	assert.Equal(t, 0, len(c.Votes))
+	res, err = b.MergeComment(imported, true)
+	require.NoError(t, err)
+	assert.Equal(t, MergeSkipped, res, "merged again")
+
+	imported.ID, imported.Text = "id-new", "new comment"
+	res, err = b.MergeComment(imported, false)
+	require.NoError(t, err)
+	assert.Equal(t, MergeInserted, res)
+	count, err := b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, 0, store.BlockInfo{}))
+	imported.ID, imported.Text = "id-blocked", "comment of blocked user"
+	res, err = b.MergeComment(imported, false)
+	require.NoError(t, err)
+	assert.Equal(t, MergeInserted, res, "imported as is, without moderation checks")
+
+	imported.ID, imported.Deleted = "id-2", true
+	res, err = b.MergeComment(imported, true)
+	require.NoError(t, err)
+	assert.Equal(t, MergeUpdated, res, "deleted in source")
+	c, err = b.Interface.Get(locator, "id-2")
+	require.NoError(t, err)
+	assert.True(t, c.Deleted)
+	assert.Equal(t, "", c.Text)
+	count, err = b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "deleted comment not counted")
+
+	imported.Deleted, imported.Text, imported.Orig = false, "text from source", "orig from source"
+	res, err = b.MergeComment(imported, false)
+	require.NoError(t, err)
+	assert.Equal(t, MergeSkipped, res, "deleted on this site")
+	c, err = b.Interface.Get(locator, "id-2")
+	require.NoError(t, err)
+	assert.Equal(t, "", c.Text)
+
+	imported.ID = "id-new"
+	res, err = b.MergeComment(imported, false)
+	require.NoError(t, err)
+	assert.Equal(t, MergeUpdated, res)
+	c, err = b.Interface.Get(locator, "id-new")
+	require.NoError(t, err)
+	assert.Equal(t, "text from source", c.Text)
+	assert.Equal(t, "orig from source", c.Orig, "orig updated with text")
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// UpdateProfile stores name and picture of the logged-in user. If changed since the previous login, all user's
+// comments updated in background and onUpdate called after that, i.e. to flush cached comments.
+func (s *DataStore) UpdateProfile(siteID string, user store.User, onUpdate func()) {
+	if siteID == "" || user.ID == "" {
+		return
+	}
+	profile, err := s.Interface.Profile(siteID, user.ID)
+	if err != nil {
+		log.Printf("[WARN] can't get profile of %s, %v", user.ID, err)
+		return
+	}
+	if profile.Name == user.Name && profile.Picture == user.Picture {
+		return
+	}
+
+	profile = store.Profile{ID: user.ID, Name: user.Name, Picture: user.Picture, Updated: time.Now()}
+	go func() {
+		if e := s.SetProfile(siteID, profile); e != nil {
+			log.Printf("[WARN] can't update profile of %s, %v", user.ID, e)
+			return
+		}
+		log.Printf("[INFO] profile of %s updated, site %s", user.ID, siteID)
+		if onUpdate != nil {
+			onUpdate()
+		}
+	}()
+}
+
+// SetProfile stores profile, updates name and picture of user's comments and records the change
+func (s *DataStore) SetProfile(siteID string, profile store.Profile) error {
+	if err := s.Interface.SetProfile(siteID, profile); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeProfile, UserID: profile.ID, Profile: &profile})
+	return nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_UpdateProfile(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	updated := make(chan struct{}, 1)
+	onUpdate := func() { updated <- struct{}{} }
+	waitUpdate := func() bool {
+		select {
+		case <-updated:
+			return true
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+
+	b.UpdateProfile("radio-t", store.User{ID: "user1", Name: "new name", Picture: "pic.png"}, onUpdate)
+	require.True(t, waitUpdate(), "first login stores profile")
+	comments, err := b.User("radio-t", "user1", 0, 0, store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(comments))
+	for _, c := range comments {
+		assert.Equal(t, "new name", c.User.Name)
+		assert.Equal(t, "pic.png", c.User.Picture)
+	}
+	c, err := b.Get(locator, "id-1", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "new name", c.User.Name)
+
+	b.UpdateProfile("radio-t", store.User{ID: "user1", Name: "new name", Picture: "pic.png"}, onUpdate)
+	assert.False(t, waitUpdate(), "nothing changed")
+
+	b.UpdateProfile("radio-t", store.User{ID: "user1", Name: "new name", Picture: "pic2.png"}, onUpdate)
+	require.True(t, waitUpdate(), "picture changed")
+	c, err = b.Get(locator, "id-2", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "pic2.png", c.User.Picture)
+
+	b.UpdateProfile("bad", store.User{ID: "user1", Name: "new name"}, onUpdate)
+	b.UpdateProfile("", store.User{ID: "user1", Name: "new name"}, onUpdate)
+	assert.False(t, waitUpdate(), "unknown site")
+}
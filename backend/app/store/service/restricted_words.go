@@ -1,11 +1,18 @@
 package service
 
 import (
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
 	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 // RestrictedWordsLister provides restricted words in comments per site
@@ -23,42 +30,208 @@ func (l StaticRestrictedWordsLister) List(siteID string) (restricted []string, e
 	return l.Words, nil
 }
 
+// DynamicRestrictedWordsLister provides same restricted words for every site, words can be changed at runtime
+type DynamicRestrictedWordsLister struct {
+	words []string
+	lock  sync.RWMutex
+}
+
+// NewDynamicRestrictedWordsLister makes lister with initial words
+func NewDynamicRestrictedWordsLister(words []string) *DynamicRestrictedWordsLister {
+	return &DynamicRestrictedWordsLister{words: words}
+}
+
+// List provides current restricted words (ignores siteID)
+func (l *DynamicRestrictedWordsLister) List(siteID string) (restricted []string, err error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.words, nil
+}
+
+// Set replaces restricted words
+func (l *DynamicRestrictedWordsLister) Set(words []string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.words = words
+}
+
+// SettingsRestrictedWordsLister provides restricted words from per-site settings,
+// falls back to Default lister for sites without restricted words set
+type SettingsRestrictedWordsLister struct {
+	Settings interface {
+		Settings(siteID string) (store.SiteSettings, error)
+	}
+	Default RestrictedWordsLister
+}
+
+// List provides restricted words set for the site or default ones
+func (l SettingsRestrictedWordsLister) List(siteID string) (restricted []string, err error) {
+	settings, err := l.Settings.Settings(siteID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get settings for %s", siteID)
+	}
+	if settings.RestrictedWords != nil || l.Default == nil {
+		return settings.RestrictedWords, nil
+	}
+	return l.Default.List(siteID)
+}
+
+// RestrictedRulesLister provides restricted rules with actions per site
+type RestrictedRulesLister interface {
+	Rules(siteID string) (rules []store.RestrictedRule, err error)
+}
+
+// EngineRestrictedWordsLister provides per-site restricted rules kept by engine. Rules read on each call,
+// so changes made by admins applied live. Words from Default lister added as reject rules.
+type EngineRestrictedWordsLister struct {
+	Engine interface {
+		RestrictedRules(siteID string) ([]store.RestrictedRule, error)
+	}
+	Default RestrictedWordsLister
+}
+
+// List provides restricted words of Default lister
+func (l EngineRestrictedWordsLister) List(siteID string) (restricted []string, err error) {
+	if l.Default == nil {
+		return nil, nil
+	}
+	return l.Default.List(siteID)
+}
+
+// Rules provides site rules from engine followed by default words
+func (l EngineRestrictedWordsLister) Rules(siteID string) (rules []store.RestrictedRule, err error) {
+	if rules, err = l.Engine.RestrictedRules(siteID); err != nil {
+		return nil, errors.Wrapf(err, "can't get restricted rules for %s", siteID)
+	}
+	words, err := l.List(siteID)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, wordsToRules(words)...), nil
+}
+
+// wordsToRules makes reject rules from plain restricted words
+func wordsToRules(words []string) []store.RestrictedRule {
+	res := make([]store.RestrictedRule, 0, len(words))
+	for _, w := range words {
+		res = append(res, store.RestrictedRule{Pattern: w, Action: store.RestrictReject})
+	}
+	return res
+}
+
 // RestrictedWordsMatcher matches comment text against restricted words
 type RestrictedWordsMatcher struct {
 	lister RestrictedWordsLister
 }
 
-// NewRestrictedWordsMatcher creates new RestrictedWordsMatcher using provided RestrictedWordsLister
+// RestrictedMatch is the result of comment text check against restricted rules
+type RestrictedMatch struct {
+	Action store.RestrictedAction // the strongest action of matched rules, empty if nothing matched
+	Text   string                 // text with matches of mask rules replaced by ***
+}
+
+// NewRestrictedWordsMatcher creates new RestrictedWordsMatcher using provided RestrictedWordsLister.
+// Lister implementing RestrictedRulesLister provides rules with actions, otherwise all words rejected.
 func NewRestrictedWordsMatcher(lister RestrictedWordsLister) *RestrictedWordsMatcher {
 	return &RestrictedWordsMatcher{lister: lister}
 }
 
-// Match matches comment text against restricted words for specified site
+// Match checks if comment text contains rejected words for specified site
 func (m *RestrictedWordsMatcher) Match(siteID string, text string) bool {
-	restrictedWords, err := m.lister.List(siteID)
+	return m.Check(siteID, text).Action == store.RestrictReject
+}
+
+// Check matches comment text against restricted rules for specified site. Rules checked against lower-cased text
+// and its normalized form without diacritics and leet substitutions, i.e. "Dúck" matches "duck" and "f0x" matches "fox".
+// HTML tags and entities skipped.
+func (m *RestrictedWordsMatcher) Check(siteID string, text string) RestrictedMatch {
+	res := RestrictedMatch{Text: text}
+	rules, err := m.rules(siteID)
 	if err != nil {
 		log.Printf("[WARN] failed to get restricted patterns for site %s: %v", siteID, err)
-		return false
+		return res
 	}
-	if len(restrictedWords) == 0 {
-		return false
+	if len(rules) == 0 {
+		return res
 	}
 
-	tokens := m.tokenize(text)
-	trie := newWildcardTrie(restrictedWords...)
+	variants := []normalizedText{normalize(text, unicode.ToLower), normalize(text, foldRune)}
+	masked := []textSpan{}
+	matched := func(action store.RestrictedAction, v normalizedText, start, end int) {
+		if action.Stronger(res.Action) {
+			res.Action = action
+		}
+		if action == store.RestrictMask {
+			masked = append(masked, v.origSpan(start, end))
+		}
+	}
 
-	for _, token := range tokens {
-		if trie.check(token) {
-			return true
+	wildcards := map[store.RestrictedAction][]string{}
+	for _, r := range rules {
+		if !r.Regex {
+			wildcards[r.Action] = append(wildcards[r.Action], r.Pattern)
+			continue
+		}
+		re, e := regexp.Compile("(?i)" + r.Pattern)
+		if e != nil {
+			log.Printf("[WARN] invalid restricted regex %q for site %s: %v", r.Pattern, siteID, e)
+			continue
+		}
+		for _, v := range variants {
+			for _, loc := range re.FindAllStringIndex(v.text, -1) {
+				if loc[0] < loc[1] {
+					matched(r.Action, v, loc[0], loc[1])
+				}
+			}
 		}
 	}
-	return false
+
+	for action, patterns := range wildcards {
+		trie := newWildcardTrie(patterns...)
+		for _, v := range variants {
+			for _, token := range m.tokenizePos(v.text) {
+				if trie.check(token.word) {
+					matched(action, v, token.start, token.end)
+				}
+			}
+		}
+	}
+
+	if len(masked) > 0 {
+		res.Text = maskSpans(text, masked)
+	}
+	return res
+}
+
+// rules returns restricted rules for the site, plain words from simple listers rejected
+func (m *RestrictedWordsMatcher) rules(siteID string) ([]store.RestrictedRule, error) {
+	if rl, ok := m.lister.(RestrictedRulesLister); ok {
+		return rl.Rules(siteID)
+	}
+	words, err := m.lister.List(siteID)
+	if err != nil {
+		return nil, err
+	}
+	return wordsToRules(words), nil
 }
 
 func (m *RestrictedWordsMatcher) tokenize(text string) []string {
-	tokens := make([]string, 0, 10) // accumulator for tokens
-	word := false                   // flag shows if current range is word
-	start := 0                      // beginning of the current range
+	tokens := make([]string, 0, 10)
+	for _, t := range m.tokenizePos(text) {
+		tokens = append(tokens, strings.ToLower(t.word))
+	}
+	return tokens
+}
+
+type token struct {
+	word       string
+	start, end int // position of the word in text
+}
+
+func (m *RestrictedWordsMatcher) tokenizePos(text string) []token {
+	tokens := make([]token, 0, 10) // accumulator for tokens
+	word := false                  // flag shows if current range is word
+	start := 0                     // beginning of the current range
 
 	for pos, r := range text {
 		if unicode.IsLetter(r) || unicode.IsNumber(r) {
@@ -72,7 +245,7 @@ func (m *RestrictedWordsMatcher) tokenize(text string) []string {
 
 		if word && start < pos {
 			// everything from start to pos - 1 is a word, so add it as a token and reset start
-			tokens = append(tokens, strings.ToLower(text[start:pos]))
+			tokens = append(tokens, token{word: text[start:pos], start: start, end: pos})
 			start = pos
 		}
 
@@ -83,12 +256,105 @@ func (m *RestrictedWordsMatcher) tokenize(text string) []string {
 	// since we append tokens when we already left the word (on next iteration),
 	// we need to do it manually for the last iteration
 	if word {
-		tokens = append(tokens, strings.ToLower(text[start:]))
+		tokens = append(tokens, token{word: text[start:], start: start, end: len(text)})
 	}
 
 	return tokens
 }
 
+// leetRunes maps common leet substitutions to letters
+var leetRunes = map[rune]rune{'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's'}
+
+var htmlEntityRe = regexp.MustCompile(`^&#?[a-zA-Z0-9]{1,10};`)
+
+// normalizedText keeps text with every rune converted and offsets of converted bytes in the original text
+type normalizedText struct {
+	text    string
+	offsets []int
+	origLen int
+}
+
+type textSpan struct {
+	start, end int
+}
+
+// normalize converts each rune of text with fn, runes of html tags and entities replaced by spaces
+func normalize(text string, fn func(r rune) rune) normalizedText {
+	res := normalizedText{offsets: make([]int, 0, len(text)), origLen: len(text)}
+	buf := strings.Builder{}
+	skipTill := 0 // end of html tag or entity
+	for pos, r := range text {
+		if pos >= skipTill {
+			switch {
+			case r == '<':
+				if end := strings.IndexByte(text[pos:], '>'); end > 0 {
+					skipTill = pos + end + 1
+				}
+			case r == '&':
+				if loc := htmlEntityRe.FindStringIndex(text[pos:]); loc != nil {
+					skipTill = pos + loc[1]
+				}
+			}
+		}
+		nr := ' '
+		if pos >= skipTill {
+			nr = fn(r)
+		}
+		n, _ := buf.WriteRune(nr)
+		for i := 0; i < n; i++ {
+			res.offsets = append(res.offsets, pos)
+		}
+	}
+	res.text = buf.String()
+	return res
+}
+
+// origSpan converts start and end of normalized text to the span in original text
+func (n normalizedText) origSpan(start, end int) textSpan {
+	res := textSpan{start: n.offsets[start], end: n.origLen}
+	if end < len(n.offsets) {
+		res.end = n.offsets[end]
+	}
+	return res
+}
+
+// foldRune lower-cases rune, removes diacritics and replaces leet substitutions
+func foldRune(r rune) rune {
+	r = unicode.ToLower(r)
+	if lr, ok := leetRunes[r]; ok {
+		return lr
+	}
+	base := []rune{}
+	for _, dr := range norm.NFKD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, dr) {
+			base = append(base, dr)
+		}
+	}
+	if len(base) != 1 { // ligatures and other multi-rune decompositions kept as is
+		return r
+	}
+	return unicode.ToLower(base[0])
+}
+
+// maskSpans replaces spans of text by ***, overlapping spans merged
+func maskSpans(text string, spans []textSpan) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	buf := strings.Builder{}
+	pos := 0
+	for _, s := range spans {
+		if s.end <= pos {
+			continue
+		}
+		if s.start >= pos {
+			buf.WriteString(text[pos:s.start])
+			buf.WriteString("***")
+		}
+		pos = s.end
+	}
+	buf.WriteString(text[pos:])
+	return buf.String()
+}
+
 type wildcardTrie struct {
 	terminal bool
 	children map[rune]*wildcardTrie
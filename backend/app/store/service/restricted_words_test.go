@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/umputun/remark/backend/app/store"
 )
 
 func TestMatcher_Tokenize(t *testing.T) {
@@ -75,3 +77,109 @@ func TestMatcher_DoNotMatchIfNoRestrictedWords(t *testing.T) {
 	text := "What the duck it that?"
 	assert.False(t, matcher.Match("fakeID", text))
 }
+
+func TestMatcher_Check(t *testing.T) {
+	matcher := NewRestrictedWordsMatcher(rulesLister{
+		{Pattern: "duck*", Action: store.RestrictMask},
+		{Pattern: `g[o0]+se`, Regex: true, Action: store.RestrictModerate},
+		{Pattern: "*fox", Action: store.RestrictReject},
+		{Pattern: "quot", Action: store.RestrictMask},
+		{Pattern: "rel", Action: store.RestrictMask},
+	})
+
+	tbl := []struct {
+		text   string
+		action store.RestrictedAction
+		res    string
+	}{
+		{"nothing to see", "", "nothing to see"},
+		{"What the duck is that, ducks!", store.RestrictMask, "What the *** is that, ***!"},
+		{"What the DÚCK, dücks and dü©k", store.RestrictMask, "What the ***, *** and dü©k"},
+		{"<p><a href=\"https://duck.com\" rel=\"nofollow\">duck</a> &quot;word&quot;</p>", store.RestrictMask,
+			"<p><a href=\"https://duck.com\" rel=\"nofollow\">***</a> &quot;word&quot;</p>"},
+		{"duck and Gooose", store.RestrictModerate, "*** and Gooose"},
+		{"g00se", store.RestrictModerate, "g00se"},
+		{"ducks and the quick fox", store.RestrictReject, "*** and the quick fox"},
+		{"Firef0x", store.RestrictReject, "Firef0x"},
+	}
+
+	for i, tt := range tbl {
+		res := matcher.Check("radio-t", tt.text)
+		assert.Equal(t, tt.action, res.Action, "case #%d", i)
+		assert.Equal(t, tt.res, res.Text, "case #%d", i)
+		assert.Equal(t, tt.action == store.RestrictReject, matcher.Match("radio-t", tt.text), "case #%d", i)
+	}
+}
+
+func TestMatcher_CheckWords(t *testing.T) {
+	matcher := NewRestrictedWordsMatcher(StaticRestrictedWordsLister{[]string{"duck"}})
+	assert.Equal(t, RestrictedMatch{Action: store.RestrictReject, Text: "the dúck"}, matcher.Check("radio-t", "the dúck"))
+	assert.Equal(t, RestrictedMatch{Text: "the goose"}, matcher.Check("radio-t", "the goose"))
+}
+
+func TestMaskSpans(t *testing.T) {
+	tbl := []struct {
+		spans []textSpan
+		res   string
+	}{
+		{nil, "0123456789"},
+		{[]textSpan{{0, 2}}, "***23456789"},
+		{[]textSpan{{8, 10}, {2, 4}}, "01***4567***"},
+		{[]textSpan{{2, 6}, {3, 5}, {5, 8}}, "01***89"},
+	}
+	for i, tt := range tbl {
+		assert.Equal(t, tt.res, maskSpans("0123456789", tt.spans), "case #%d", i)
+	}
+}
+
+func TestEngineRestrictedWordsLister(t *testing.T) {
+	defer teardown(t)
+	eng := prepStoreEngine(t)
+	lister := EngineRestrictedWordsLister{Engine: eng, Default: StaticRestrictedWordsLister{Words: []string{"duck"}}}
+
+	rules, err := lister.Rules("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.RestrictedRule{{Pattern: "duck", Action: store.RestrictReject}}, rules, "default words only")
+
+	assert.NoError(t, eng.SetRestrictedRules("radio-t", []store.RestrictedRule{{Pattern: "goose", Action: store.RestrictMask}}))
+	rules, err = lister.Rules("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.RestrictedRule{{Pattern: "goose", Action: store.RestrictMask},
+		{Pattern: "duck", Action: store.RestrictReject}}, rules, "site rules applied live")
+
+	words, err := lister.List("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"duck"}, words)
+
+	_, err = lister.Rules("bad-site")
+	assert.EqualError(t, err, `can't get restricted rules for bad-site: site "bad-site" not found`)
+}
+
+func TestSettingsRestrictedWordsLister_List(t *testing.T) {
+	defer teardown(t)
+	eng := prepStoreEngine(t)
+	lister := SettingsRestrictedWordsLister{Settings: eng, Default: StaticRestrictedWordsLister{Words: []string{"duck"}}}
+
+	words, err := lister.List("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"duck"}, words, "default words")
+
+	assert.NoError(t, eng.SetSettings("radio-t", store.SiteSettings{RestrictedWords: []string{"bad", "ugly*"}}))
+	words, err = lister.List("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bad", "ugly*"}, words, "site words")
+
+	assert.NoError(t, eng.SetSettings("radio-t", store.SiteSettings{RestrictedWords: []string{}}))
+	words, err = lister.List("radio-t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, words, "restricted words disabled for site")
+
+	_, err = lister.List("bad-site")
+	assert.EqualError(t, err, `can't get settings for bad-site: site "bad-site" not found`)
+}
+
+type rulesLister []store.RestrictedRule
+
+func (l rulesLister) List(string) ([]string, error) { return nil, nil }
+
+func (l rulesLister) Rules(string) ([]store.RestrictedRule, error) { return l, nil }
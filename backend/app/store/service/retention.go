@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// RetentionPolicy returns retention rules for the site, per-site policy replaces the global one
+func (s *DataStore) RetentionPolicy(siteID string) store.RetentionPolicy {
+	if settings := s.SiteSettings(siteID); settings.Retention != nil {
+		return *settings.Retention
+	}
+	return s.Retention
+}
+
+// RetentionReport returns report of the last retention run for the site, false if rules not applied yet
+func (s *DataStore) RetentionReport(siteID string) (store.RetentionReport, bool) {
+	s.retention.Lock()
+	defer s.retention.Unlock()
+	r, ok := s.retention.reports[siteID]
+	return r, ok
+}
+
+// ApplyRetention enforces retention rules of the site and returns report of the run.
+// Errors of individual rules collected in report, the run continues with other rules.
+func (s *DataStore) ApplyRetention(siteID string) (store.RetentionReport, error) {
+	report := store.RetentionReport{SiteID: siteID, Policy: s.RetentionPolicy(siteID), Started: time.Now()}
+	policy := report.Policy
+	if err := policy.Validate(); err != nil {
+		return report, errors.Wrapf(err, "invalid retention policy for %s", siteID)
+	}
+
+	addErr := func(err error) {
+		log.Printf("[WARN] retention for %s, %v", siteID, err)
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	if policy.IPDays > 0 {
+		count, err := s.ClearIPs(siteID, "", report.Started.AddDate(0, 0, -policy.IPDays))
+		if err != nil {
+			addErr(errors.Wrap(err, "can't clear ip hashes"))
+		}
+		report.IPsCleared = count
+	}
+
+	if policy.DeletedDays > 0 {
+		count, err := s.eraseDeleted(siteID, report.Started.AddDate(0, 0, -policy.DeletedDays))
+		if err != nil {
+			addErr(errors.Wrap(err, "can't erase deleted comments"))
+		}
+		report.CommentsErased = count
+	}
+
+	if policy.PurgeDeletedUsers {
+		count, err := s.purgeDeletedUsers(siteID)
+		if err != nil {
+			addErr(errors.Wrap(err, "can't purge deleted users"))
+		}
+		report.UsersPurged = count
+	}
+
+	report.Finished = time.Now()
+	s.retention.Lock()
+	if s.retention.reports == nil {
+		s.retention.reports = map[string]store.RetentionReport{}
+	}
+	s.retention.reports[siteID] = report
+	s.retention.Unlock()
+
+	log.Printf("[INFO] retention for %s applied, ips cleared %d, comments erased %d, users purged %d, errors %d",
+		siteID, report.IPsCleared, report.CommentsErased, report.UsersPurged, len(report.Errors))
+	return report, nil
+}
+
+// RunRetention applies retention rules to all sites, purges expired trash and compacts change log every interval,
+// blocking till ctx canceled.
+// onChange called for each site with modified data, i.e. to flush cached comments.
+func (s *DataStore) RunRetention(ctx context.Context, sites []string, interval time.Duration, onChange func(siteID string)) {
+	log.Printf("[INFO] activate retention for %v, interval %s", sites, interval)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			for _, siteID := range sites {
+				if n, err := s.PurgeTrash(siteID); err != nil {
+					log.Printf("[WARN] can't purge trash of %s, %v", siteID, err)
+				} else if n > 0 {
+					log.Printf("[INFO] %d expired comments purged from trash of %s", n, siteID)
+				}
+				if n, err := s.PurgeChanges(siteID); err != nil {
+					log.Printf("[WARN] can't compact change log of %s, %v", siteID, err)
+				} else if n > 0 {
+					log.Printf("[INFO] %d old records removed from change log of %s", n, siteID)
+				}
+				if !s.RetentionPolicy(siteID).Enabled() {
+					continue
+				}
+				report, err := s.ApplyRetention(siteID)
+				if err != nil {
+					log.Printf("[WARN] retention for %s failed, %v", siteID, err)
+					continue
+				}
+				if onChange != nil && report.IPsCleared+report.CommentsErased+report.UsersPurged > 0 {
+					onChange(siteID)
+				}
+			}
+		case <-ctx.Done():
+			log.Printf("[INFO] retention terminated")
+			return
+		}
+	}
+}
+
+// eraseDeleted hard-deletes comments soft-deleted before ts, clearing user's info left in them.
+// Comments deleted before deletion time was stored use time from trash, or creation time if not in trash.
+func (s *DataStore) eraseDeleted(siteID string, before time.Time) (count int, err error) {
+	trash, err := s.Interface.Trash(siteID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get trash of %s", siteID)
+	}
+	trashed := map[string]time.Time{}
+	for _, e := range trash {
+		trashed[e.ID] = e.Deleted
+	}
+
+	for skip := 0; ; skip += postsPageSize {
+		posts, err := s.Interface.List(siteID, postsPageSize, skip)
+		if err != nil {
+			return count, errors.Wrapf(err, "can't list posts of %s", siteID)
+		}
+		for _, p := range posts {
+			comments, err := s.Interface.Find(store.Locator{SiteID: siteID, URL: p.URL}, "time")
+			if err != nil {
+				return count, errors.Wrapf(err, "can't get comments for %s", p.URL)
+			}
+			for _, c := range comments {
+				if !c.Deleted || c.User.ID == "deleted" {
+					continue
+				}
+				deleted, ok := trashed[c.ID]
+				if !ok {
+					deleted = c.Timestamp
+				}
+				if c.DeletedAt != nil {
+					deleted = *c.DeletedAt
+				}
+				if !deleted.Before(before) {
+					continue
+				}
+				if err = s.Delete(c.Locator, c.ID, store.HardDelete); err != nil {
+					return count, errors.Wrapf(err, "can't erase comment %s", c.ID)
+				}
+				if err = s.Interface.RemoveTrash(siteID, []string{c.ID}); err != nil {
+					return count, errors.Wrapf(err, "can't remove erased comment %s from trash", c.ID)
+				}
+				count++
+			}
+		}
+		if len(posts) < postsPageSize {
+			return count, nil
+		}
+	}
+}
+
+// purgeDeletedUsers removes comments of users with executed deletion requests made before the execution,
+// i.e. brought back by import. Comments made by the user after the deletion kept.
+func (s *DataStore) purgeDeletedUsers(siteID string) (count int, err error) {
+	reqs, err := s.Interface.Deletions(siteID)
+	if err != nil {
+		return 0, err
+	}
+	executed := map[string]time.Time{} // the latest executed deletion of the user
+	for _, r := range reqs {
+		if ts := r.Executed(); ts.After(executed[r.UserID]) {
+			executed[r.UserID] = ts
+		}
+	}
+	for userID, ts := range executed {
+		n, err := s.purgeUserComments(siteID, userID, ts)
+		if err != nil {
+			return count, errors.Wrapf(err, "can't delete comments of %s", userID)
+		}
+		if n > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// purgeUserComments hard-deletes user's comments made before ts, returns number of deleted comments
+func (s *DataStore) purgeUserComments(siteID, userID string, before time.Time) (int, error) {
+	total, err := s.userCount(siteID, userID)
+	if err != nil || total == 0 {
+		return 0, err
+	}
+	old := []store.Comment{}
+	for skip := 0; skip < total; skip += exportPageSize {
+		comments, err := s.Interface.User(siteID, userID, exportPageSize, skip)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range comments {
+			if c.User.ID == userID && c.Timestamp.Before(before) { // hard-deleted comments left in user's index
+				old = append(old, c)
+			}
+		}
+		if len(comments) < exportPageSize {
+			break
+		}
+	}
+	for _, c := range old {
+		if err = s.Delete(c.Locator, c.ID, store.HardDelete); err != nil {
+			return 0, errors.Wrapf(err, "can't delete comment %s", c.ID)
+		}
+	}
+	return len(old), nil
+}
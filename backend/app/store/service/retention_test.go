@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_ApplyRetention(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	recent := store.Comment{ID: "id-3", Text: "recent", Timestamp: time.Now(), Locator: locator,
+		User: store.User{ID: "user2", Name: "user name 2", IP: "ip-hash"}}
+	_, err := b.Interface.Create(recent)
+	require.NoError(t, err)
+	old := store.Comment{ID: "id-4", Text: "old", Timestamp: time.Now().AddDate(0, 0, -40), Locator: locator,
+		User: store.User{ID: "user2", Name: "user name 2", IP: "ip-hash"}}
+	_, err = b.Interface.Create(old)
+	require.NoError(t, err)
+	require.NoError(t, b.Interface.Delete(locator, "id-4", store.SoftDelete))
+	c, err := b.Interface.Get(locator, "id-4")
+	require.NoError(t, err)
+	deletedAt := time.Now().AddDate(0, 0, -35)
+	c.DeletedAt = &deletedAt
+	require.NoError(t, b.Interface.Put(locator, c))
+	require.NoError(t, b.Interface.Delete(locator, "id-3", store.SoftDelete))
+	_, err = b.Interface.Create(store.Comment{ID: "id-6", Text: "old, deleted recently", Locator: locator,
+		Timestamp: time.Now().AddDate(0, 0, -40), User: store.User{ID: "user2", Name: "user name 2"}})
+	require.NoError(t, err)
+	require.NoError(t, b.Interface.Delete(locator, "id-6", store.SoftDelete))
+
+	_, err = b.Interface.Create(store.Comment{ID: "id-5", Text: "imported", Timestamp: time.Now().AddDate(0, 0, -1),
+		Locator: locator, User: store.User{ID: "user3", Name: "user name 3"}})
+	require.NoError(t, err)
+	_, err = b.Interface.Create(store.Comment{ID: "id-7", Text: "made after deletion", Timestamp: time.Now(),
+		Locator: locator, User: store.User{ID: "user3", Name: "user name 3"}})
+	require.NoError(t, err)
+	delReq := store.DeletionRequest{ID: "r1", SiteID: "radio-t", UserID: "user3"}
+	delReq.AddStep(store.DeletionExecuted, "user3")
+	delReq.Steps[0].Timestamp = time.Now().Add(-time.Hour)
+	require.NoError(t, b.SaveDeletion(delReq))
+
+	report, err := b.ApplyRetention("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.IPsCleared+report.CommentsErased+report.UsersPurged, "no rules, nothing changed")
+
+	b.Retention = store.RetentionPolicy{IPDays: 30, DeletedDays: 30, PurgeDeletedUsers: true}
+	report, err = b.ApplyRetention("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, "radio-t", report.SiteID)
+	assert.Equal(t, 1, report.IPsCleared)
+	assert.Equal(t, 1, report.CommentsErased)
+	assert.Equal(t, 1, report.UsersPurged)
+	assert.Equal(t, 0, len(report.Errors))
+	last, ok := b.RetentionReport("radio-t")
+	require.True(t, ok)
+	assert.Equal(t, report, last)
+
+	c, err = b.Interface.Get(locator, "id-4")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", c.User.ID, "comment deleted long ago erased")
+	assert.Equal(t, "", c.User.IP)
+	c, err = b.Interface.Get(locator, "id-3")
+	require.NoError(t, err)
+	assert.Equal(t, "user2", c.User.ID, "recent deleted comment kept")
+	assert.Equal(t, "ip-hash", c.User.IP)
+	c, err = b.Interface.Get(locator, "id-6")
+	require.NoError(t, err)
+	assert.Equal(t, "user2", c.User.ID, "old comment deleted recently kept")
+	c, err = b.Interface.Get(locator, "id-5")
+	require.NoError(t, err)
+	assert.True(t, c.Deleted, "comment of deleted user purged")
+	c, err = b.Interface.Get(locator, "id-7")
+	require.NoError(t, err)
+	assert.False(t, c.Deleted, "comment made after deletion kept")
+
+	// per-site policy replaces global one
+	require.NoError(t, b.SetSettings("radio-t", store.SiteSettings{Retention: &store.RetentionPolicy{}}))
+	assert.False(t, b.RetentionPolicy("radio-t").Enabled())
+	_, ok = b.RetentionReport("other")
+	assert.False(t, ok)
+}
+
+func TestService_RunRetention(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	_, err := b.Interface.Create(store.Comment{ID: "id-3", Text: "old", Timestamp: time.Now().AddDate(0, 0, -40),
+		Locator: locator, User: store.User{ID: "user2", IP: "ip-hash"}})
+	require.NoError(t, err)
+	require.NoError(t, b.SetSettings("radio-t", store.SiteSettings{Retention: &store.RetentionPolicy{IPDays: 10}}))
+
+	var changed int32
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	b.RunRetention(ctx, []string{"radio-t"}, 50*time.Millisecond, func(siteID string) {
+		assert.Equal(t, "radio-t", siteID)
+		atomic.AddInt32(&changed, 1)
+	})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&changed), "changed on the first run only")
+	c, err := b.Interface.Get(locator, "id-3")
+	require.NoError(t, err)
+	assert.Equal(t, "", c.User.IP)
+}
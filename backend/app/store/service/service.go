@@ -13,7 +13,6 @@ import (
 	log "github.com/go-pkgz/lgr"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
-	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 
 	"github.com/umputun/remark/backend/app/store"
@@ -33,6 +32,29 @@ type DataStore struct {
 	TitleExtractor         *TitleExtractor
 	RestrictedWordsMatcher *RestrictedWordsMatcher
 	ImageService           *image.Service
+	TrustPolicy            *TrustPolicy // trust levels disabled if nil
+	AutoModRules           []AutoModRule
+	ModerationNotifier     ModerationNotifier    // optional, announces auto-moderation sanctions
+	DeletionApproval       bool                  // deletion requests executed after admin's approval only
+	DeletionNotifier       DeletionNotifier      // optional, announces deletion requests to admins
+	Retention              store.RetentionPolicy // global retention rules, replaced by per-site policy
+	TrashDuration          time.Duration         // content of soft-deleted comments kept for restore, disabled if 0
+	ChangeLog              bool                  // record changes of comments, blocks and read-only status to change log
+	ChangeLogKeep          time.Duration         // change log records older than this compacted, kept forever if 0
+
+	paramsLock sync.RWMutex // protects global parameters changed with SetParams
+
+	// channels closed on the next change of the site, wake up readers of change log
+	changes struct {
+		sync.Mutex
+		notify map[string]chan struct{}
+	}
+
+	// last report of retention rules for each site
+	retention struct {
+		sync.Mutex
+		reports map[string]store.RetentionReport
+	}
 
 	// granular locks
 	scopedLocks struct {
@@ -40,11 +62,6 @@ type DataStore struct {
 		sync.Once
 		locks map[string]sync.Locker
 	}
-
-	repliesCache struct {
-		*cache.Cache
-		once sync.Once
-	}
 }
 
 // UserMetaData keeps info about user flags
@@ -53,8 +70,13 @@ type UserMetaData struct {
 	Blocked struct {
 		Status bool      `json:"status"`
 		Until  time.Time `json:"until"`
+		Reason string    `json:"reason,omitempty"`
+		Admin  string    `json:"admin,omitempty"`
 	} `json:"blocked"`
-	Verified bool `json:"verified"`
+	Verified     bool             `json:"verified"`
+	ShadowBanned bool             `json:"shadow_banned,omitempty"`
+	IP           bool             `json:"ip,omitempty"`    // id is a hash of blocked ip
+	Trust        *store.UserTrust `json:"trust,omitempty"` // level set by admin, brought by point-in-time restore
 }
 
 // PostMetaData keeps info about post flags
@@ -64,7 +86,6 @@ type PostMetaData struct {
 }
 
 const defaultCommentMaxSize = 2000
-const maxLastCommentsReply = 5000
 
 // UnlimitedVotes doesn't restrict MaxVotes
 const UnlimitedVotes = -1
@@ -74,6 +95,9 @@ var nonAdminUser = store.User{}
 // ErrRestrictedWordsFound returned in case comment text contains restricted words
 var ErrRestrictedWordsFound = errors.New("comment contains restricted words")
 
+// ErrIPBlocked returned in case comment posted from blocked ip
+var ErrIPBlocked = errors.New("ip blocked")
+
 // Create prepares comment and forward to Interface.Create
 func (s *DataStore) Create(comment store.Comment) (commentID string, err error) {
 
@@ -81,8 +105,20 @@ func (s *DataStore) Create(comment store.Comment) (commentID string, err error)
 		return "", errors.Wrap(err, "failed to prepare comment")
 	}
 
-	if s.RestrictedWordsMatcher != nil && s.RestrictedWordsMatcher.Match(comment.Locator.SiteID, comment.Text) {
-		return "", ErrRestrictedWordsFound
+	if s.IsBlockedIP(comment.Locator.SiteID, comment.User.IP) {
+		return "", ErrIPBlocked
+	}
+
+	if err = s.restrict(&comment); err != nil {
+		return "", err
+	}
+
+	if err = s.trustCheck(&comment); err != nil {
+		return "", err
+	}
+
+	if !comment.User.Admin && s.IsPremoderated(comment.Locator.SiteID, comment.User.ID) {
+		comment.Pending = true
 	}
 
 	func() { // keep input title and set to extracted if missing
@@ -98,7 +134,31 @@ func (s *DataStore) Create(comment store.Comment) (commentID string, err error)
 	}()
 
 	s.submitImages(comment)
-	return s.Interface.Create(comment)
+	if comment.ID, err = s.Interface.Create(comment); err != nil {
+		return comment.ID, err
+	}
+	s.recordCommentChange(store.ChangeCreate, comment)
+	return comment.ID, nil
+}
+
+// Import stores comment from import or restore. Unlike Create it doesn't apply moderation, i.e. blocked ip,
+// restricted rules, trust and premoderation checks, as the comment keeps its state from the source.
+func (s *DataStore) Import(comment store.Comment) (commentID string, err error) {
+	if comment, err = s.PrepareImport(comment); err != nil {
+		return "", err
+	}
+	s.submitImages(comment)
+	if comment.ID, err = s.Interface.Create(comment); err != nil {
+		return comment.ID, err
+	}
+	s.recordCommentChange(store.ChangeCreate, comment)
+	return comment.ID, nil
+}
+
+// PrepareImport returns comment as Import stores it, i.e. sanitized and with hashed ip. Nothing written to the store.
+func (s *DataStore) PrepareImport(comment store.Comment) (store.Comment, error) {
+	comment, err := s.prepareNewComment(comment)
+	return comment, errors.Wrap(err, "failed to prepare comment")
 }
 
 // Find wraps engine's Find call and alter results if needed
@@ -117,9 +177,33 @@ func (s *DataStore) Find(locator store.Locator, sort string, user store.User) ([
 				changedSort = true
 			}
 		}
+		// set best and hot ranks for comments added before these sorts
+		if c.Best == 0 && len(c.Votes) > 0 {
+			c.Best = s.best(s.upsAndDowns(c))
+			if !changedSort && strings.Contains(sort, "best") {
+				changedSort = true
+			}
+		}
+		if c.Hot == 0 {
+			c.Hot = s.hot(c.Score, c.Timestamp)
+			if !changedSort && strings.Contains(sort, "hot") {
+				changedSort = true
+			}
+		}
 		comments[i] = s.alterComment(c, user)
 	}
 
+	// count replies in memory, all of them already loaded
+	replies := map[string]int{}
+	for _, c := range comments {
+		if c.ParentID != "" && !c.Deleted {
+			replies[c.ParentID]++
+		}
+	}
+	for i := range comments {
+		comments[i].Replies = replies[comments[i].ID]
+	}
+
 	// resort commits if altered
 	if changedSort {
 		comments = engine.SortComments(comments, sort)
@@ -134,7 +218,7 @@ func (s *DataStore) Get(locator store.Locator, commentID string, user store.User
 	if err != nil {
 		return store.Comment{}, err
 	}
-	return s.alterComment(c, user), nil
+	return s.setRepliesCount(locator.SiteID, []store.Comment{s.alterComment(c, user)})[0], nil
 }
 
 // submitImages initiated delayed commit of all images from the comment uploaded to remark42
@@ -172,6 +256,8 @@ func (s *DataStore) prepareNewComment(comment store.Comment) (store.Comment, err
 	if comment.Votes == nil {
 		comment.Votes = make(map[string]bool)
 	}
+	comment.Replies = 0 // calculated on read from replies index
+	comment.Hot = s.hot(comment.Score, comment.Timestamp)
 	comment.Sanitize() // clear potentially dangerous js from all parts of comment
 
 	secret, err := s.AdminStore.Key()
@@ -189,7 +275,11 @@ func (s *DataStore) SetPin(locator store.Locator, commentID string, status bool)
 		return err
 	}
 	comment.Pin = status
-	return s.Put(locator, comment)
+	if err = s.Interface.Put(locator, comment); err != nil {
+		return err
+	}
+	s.recordCommentChange(store.ChangeEdit, comment)
+	return nil
 }
 
 // Vote for comment by id and locator
@@ -217,8 +307,9 @@ func (s *DataStore) Vote(locator store.Locator, commentID string, userID string,
 		return comment, errors.Errorf("user %s already voted for %s", userID, commentID)
 	}
 
-	maxVotes := s.MaxVotes // 0 value allowed and treated as "no comments allowed"
-	if s.MaxVotes < 0 {    // any negative value reset max votes to unlimited
+	cfg := s.SiteConfig(locator.SiteID)
+	maxVotes := cfg.MaxVotes // 0 value allowed and treated as "no comments allowed"
+	if cfg.MaxVotes < 0 {    // any negative value reset max votes to unlimited
 		maxVotes = UnlimitedVotes
 	}
 
@@ -226,7 +317,7 @@ func (s *DataStore) Vote(locator store.Locator, commentID string, userID string,
 		return comment, errors.Errorf("maximum number of votes exceeded for comment %s", commentID)
 	}
 
-	if s.PositiveScore && comment.Score <= 0 && !val {
+	if cfg.PositiveScore && comment.Score <= 0 && !val {
 		return comment, errors.Errorf("minimal score reached for comment %s", commentID)
 	}
 
@@ -257,8 +348,18 @@ func (s *DataStore) Vote(locator store.Locator, commentID string, userID string,
 	}
 
 	comment.Controversy = s.controversy(s.upsAndDowns(comment))
+	comment.Best = s.best(s.upsAndDowns(comment))
+	comment.Hot = s.hot(comment.Score, comment.Timestamp)
 
-	return comment, s.Put(locator, comment)
+	if err = s.Put(locator, comment); err != nil {
+		return comment, err
+	}
+	s.recordChange(store.Change{SiteID: locator.SiteID, Type: store.ChangeVote, Locator: locator, CommentID: commentID,
+		UserID: userID, Comment: &comment})
+	if !val { // down vote may trigger auto-moderation of the author
+		s.autoModerate(locator.SiteID, comment.User.ID)
+	}
+	return comment, nil
 }
 
 // controversy calculates controversial index of votes
@@ -277,6 +378,37 @@ func (s *DataStore) controversy(ups, downs int) float64 {
 	return math.Pow(float64(magnitude), balance)
 }
 
+// best calculates lower bound of Wilson score confidence interval for a Bernoulli parameter
+// source - https://github.com/reddit-archive/reddit/blob/master/r2/r2/lib/db/_sorts.pyx#L70
+func (s *DataStore) best(ups, downs int) float64 {
+	n := float64(ups + downs)
+	if n == 0 {
+		return 0
+	}
+
+	z := 1.281551565545 // 80% confidence
+	p := float64(ups) / n
+	left := p + 1/(2*n)*z*z
+	right := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n))
+	under := 1 + 1/n*z*z
+	return (left - right) / under
+}
+
+// hot calculates score with time decay, each 12.5 hours worth of 10x score
+// source - https://github.com/reddit-archive/reddit/blob/master/r2/r2/lib/db/_sorts.pyx#L47
+func (s *DataStore) hot(score int, ts time.Time) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	}
+	if score < 0 {
+		sign = -1
+	}
+	seconds := float64(ts.Unix() - 1134028003) // reddit's epoch, keeps values small
+	return math.Round((sign*order+seconds/45000)*1e7) / 1e7
+}
+
 // EditRequest contains fields needed for comment update
 type EditRequest struct {
 	Text    string
@@ -293,7 +425,8 @@ func (s *DataStore) EditComment(locator store.Locator, commentID string, req Edi
 	}
 
 	// edit allowed in editDuration window only
-	if s.EditDuration > 0 && time.Now().After(comment.Timestamp.Add(s.EditDuration)) {
+	editDuration := s.SiteConfig(locator.SiteID).EditDuration
+	if editDuration > 0 && time.Now().After(comment.Timestamp.Add(editDuration)) {
 		return comment, errors.Errorf("too late to edit %s", commentID)
 	}
 
@@ -306,61 +439,112 @@ func (s *DataStore) EditComment(locator store.Locator, commentID string, req Edi
 		return comment, s.Delete(locator, commentID, store.SoftDelete)
 	}
 
-	if s.RestrictedWordsMatcher != nil && s.RestrictedWordsMatcher.Match(comment.Locator.SiteID, req.Text) {
-		return comment, ErrRestrictedWordsFound
+	edited := comment
+	edited.Text, edited.Orig = req.Text, req.Orig
+	if err = s.restrict(&edited); err != nil {
+		return comment, err
+	}
+	if s.TrustPolicy != nil {
+		if err = s.trustLinksCheck(edited, s.TrustLevel(locator.SiteID, comment.User.ID)); err != nil {
+			return comment, err
+		}
 	}
 
-	comment.Text = req.Text
-	comment.Orig = req.Orig
+	comment.Text = edited.Text
+	comment.Orig = edited.Orig
+	comment.Pending = edited.Pending
 	comment.Edit = &store.Edit{
 		Timestamp: time.Now(),
 		Summary:   req.Summary,
 	}
 
 	comment.Sanitize()
-	err = s.Put(locator, comment)
-	return comment, err
+	if err = s.Put(locator, comment); err != nil {
+		return comment, err
+	}
+	s.recordCommentChange(store.ChangeEdit, comment)
+	return comment, nil
 }
 
-// HasReplies checks if there is any reply to the comments
-// Loads last maxLastCommentsReply comments and compare parent id to the comment's id
-// Comments with replies cached for 5 minutes
-func (s *DataStore) HasReplies(comment store.Comment) bool {
-
-	s.repliesCache.once.Do(func() {
-		//  default expiration time of 5 minutes, purge every 10 minutes
-		s.repliesCache.Cache = cache.New(5*time.Minute, 10*time.Minute)
-	})
+// restrict checks comment's text against restricted rules. Rejects comment, masks matched words
+// or marks comment as pending, depending on the strongest action of matched rules.
+func (s *DataStore) restrict(comment *store.Comment) error {
+	if s.RestrictedWordsMatcher == nil {
+		return nil
+	}
+	res := s.RestrictedWordsMatcher.Check(comment.Locator.SiteID, comment.Text)
+	switch res.Action {
+	case store.RestrictReject:
+		return ErrRestrictedWordsFound
+	case store.RestrictModerate:
+		comment.Pending = true
+	}
+	if comment.Text != res.Text { // some words masked, mask original text too
+		comment.Text = res.Text
+		comment.Orig = s.RestrictedWordsMatcher.Check(comment.Locator.SiteID, comment.Orig).Text
+	}
+	return nil
+}
 
-	if _, found := s.repliesCache.Get(comment.ID); found {
-		return true
+// Approve clears pending status of the comment, makes it visible to everyone
+func (s *DataStore) Approve(locator store.Locator, commentID string) error {
+	comment, err := s.Interface.Get(locator, commentID)
+	if err != nil {
+		return err
+	}
+	comment.Pending = false
+	if err = s.Put(locator, comment); err != nil {
+		return err
+	}
+	s.recordCommentChange(store.ChangeEdit, comment)
+	if s.TrustPolicy != nil { // approved comment counted in author's history
+		if _, err = s.RecalcTrust(locator.SiteID, comment.User.ID); err != nil {
+			log.Printf("[WARN] can't recalculate trust level for %s, %v", comment.User.ID, err)
+		}
 	}
+	return nil
+}
 
-	comments, err := s.Interface.Last(comment.Locator.SiteID, maxLastCommentsReply, time.Time{})
+// Pending returns all comments waiting for moderation
+func (s *DataStore) Pending(siteID string) ([]store.Comment, error) {
+	comments, err := s.Interface.Pending(siteID)
 	if err != nil {
-		log.Printf("[WARN] can't get last comments for reply check, %v", err)
-		return false
+		return nil, errors.Wrapf(err, "can't get pending comments for %s", siteID)
 	}
+	return s.setRepliesCount(siteID, s.alterComments(comments, store.User{Admin: true})), nil
+}
 
-	for _, c := range comments {
-		if c.ParentID != "" && !c.Deleted {
-			if c.ParentID == comment.ID {
-				s.repliesCache.Set(comment.ID, true, cache.DefaultExpiration)
-				return true
-			}
+// SetRestrictedRules validates and saves restricted rules for the site
+func (s *DataStore) SetRestrictedRules(siteID string, rules []store.RestrictedRule) error {
+	for i, r := range rules {
+		if err := r.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid restricted rule #%d for %s", i, siteID)
 		}
 	}
-	return false
+	if err := s.Interface.SetRestrictedRules(siteID, rules); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeRules, Rules: rules})
+	return nil
+}
+
+// HasReplies checks if there is any reply to the comments, uses replies index of the engine
+func (s *DataStore) HasReplies(comment store.Comment) bool {
+	counts, err := s.Interface.RepliesCount(comment.Locator.SiteID, []string{comment.ID})
+	if err != nil {
+		log.Printf("[WARN] can't get replies count for %s, %v", comment.ID, err)
+		return false
+	}
+	return counts[comment.ID] > 0
 }
 
 // UserReplies returns list of all comments replied to given user
 func (s *DataStore) UserReplies(siteID, userID string, limit int, duration time.Duration) ([]store.Comment, string, error) {
 
-	comments, e := s.Last(siteID, maxLastCommentsReply, time.Time{}, nonAdminUser)
+	comments, e := s.Interface.UserReplies(siteID, userID, limit, time.Now().Add(-duration))
 	if e != nil {
-		return nil, "", errors.Wrap(e, "can't get last comments")
+		return nil, "", errors.Wrap(e, "can't get user replies")
 	}
-	replies := []store.Comment{}
 
 	// get a comment for given userID in order to retrieve name
 	userName := ""
@@ -368,25 +552,7 @@ func (s *DataStore) UserReplies(siteID, userID string, limit int, duration time.
 		userName = cc[0].User.Name
 	}
 
-	// collect replies
-	for _, c := range comments {
-
-		if len(replies) > limit || time.Since(c.Timestamp) > duration {
-			break
-		}
-
-		if c.ParentID != "" && !c.Deleted && c.User.ID != userID { // not interested in replies to yourself
-			var pc store.Comment
-			if pc, e = s.Get(c.Locator, c.ParentID, nonAdminUser); e != nil {
-				return nil, "", errors.Wrap(e, "can't get parent comment")
-			}
-			if pc.User.ID == userID {
-				replies = append(replies, c)
-			}
-		}
-	}
-
-	return replies, userName, nil
+	return s.setRepliesCount(siteID, s.alterComments(comments, nonAdminUser)), userName, nil
 }
 
 // SetTitle puts title from the locator.URL page and overwrites any existing title
@@ -423,8 +589,8 @@ func (s *DataStore) Counts(siteID string, postIDs []string) ([]store.PostInfo, e
 
 // ValidateComment checks if comment size below max and user fields set
 func (s *DataStore) ValidateComment(c *store.Comment) error {
-	maxSize := s.MaxCommentSize
-	if s.MaxCommentSize <= 0 {
+	maxSize := s.SiteConfig(c.Locator.SiteID).MaxCommentSize
+	if maxSize <= 0 {
 		maxSize = defaultCommentMaxSize
 	}
 	if c.Orig == "" {
@@ -449,6 +615,56 @@ func (s *DataStore) IsAdmin(siteID string, userID string) bool {
 	return false
 }
 
+// MergeUser moves all comments, votes and flags of fromID user to toID, i.e. the same person logged in with
+// another provider. Trust level of toID recalculated.
+func (s *DataStore) MergeUser(siteID, fromID, toID string) error {
+	if fromID == "" || toID == "" || fromID == toID {
+		return errors.Errorf("can't merge user %q into %q", fromID, toID)
+	}
+	if err := s.Interface.MergeUser(siteID, fromID, toID); err != nil {
+		return errors.Wrapf(err, "can't merge user %s into %s", fromID, toID)
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeMerge, UserID: fromID, TargetID: toID})
+	log.Printf("[INFO] user %s merged into %s, site %s", fromID, toID, siteID)
+	if s.TrustPolicy != nil {
+		if _, err := s.RecalcTrust(siteID, toID); err != nil {
+			log.Printf("[WARN] can't recalculate trust level for %s, %v", toID, err)
+		}
+	}
+	return nil
+}
+
+// Users returns users directory of the site with auth provider, verified and blocked status set
+func (s *DataStore) Users(req engine.UsersRequest) ([]store.UserSummary, int, error) {
+	users, total, err := s.Interface.Users(req)
+	if err != nil {
+		return users, total, err
+	}
+	verified, err := s.Verified(req.SiteID)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "can't get verified users of %s", req.SiteID)
+	}
+	blocked, err := s.Blocked(req.SiteID)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "can't get blocked users of %s", req.SiteID)
+	}
+
+	verifiedIDs, blockedIDs := map[string]bool{}, map[string]bool{}
+	for _, id := range verified {
+		verifiedIDs[id] = true
+	}
+	for _, u := range blocked {
+		blockedIDs[u.ID] = true
+	}
+	for i, u := range users {
+		if pos := strings.Index(u.ID, "_"); pos > 0 {
+			users[i].Provider = u.ID[:pos]
+		}
+		users[i].Verified, users[i].Blocked = verifiedIDs[u.ID], blockedIDs[u.ID]
+	}
+	return users, total, nil
+}
+
 // Metas returns metadata for users and posts
 func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMetaData, err error) {
 	umetas = []UserMetaData{}
@@ -480,6 +696,7 @@ func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMe
 		}
 		val.Blocked.Status = true
 		val.Blocked.Until = b.Until
+		val.Blocked.Reason, val.Blocked.Admin = b.Reason, b.Admin
 		m[b.ID] = val
 	}
 
@@ -497,9 +714,36 @@ func (s *DataStore) Metas(siteID string) (umetas []UserMetaData, pmetas []PostMe
 		m[v] = val
 	}
 
+	// process shadow-banned users
+	banned, err := s.ShadowBanned(siteID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't get list of shadow-banned users for %s", siteID)
+	}
+	for _, b := range banned {
+		val, ok := m[b]
+		if !ok {
+			val = UserMetaData{ID: b}
+		}
+		val.ShadowBanned = true
+		m[b] = val
+	}
+
 	for _, u := range m {
 		umetas = append(umetas, u)
 	}
+
+	// process blocked ips, kept as separate metas with ip flag
+	ips, err := s.BlockedIPs(siteID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't get list of blocked ips for %s", siteID)
+	}
+	for _, b := range ips {
+		val := UserMetaData{ID: b.ID, IP: true}
+		val.Blocked.Status = true
+		val.Blocked.Until = b.Until
+		val.Blocked.Reason, val.Blocked.Admin = b.Reason, b.Admin
+		umetas = append(umetas, val)
+	}
 	sort.Slice(umetas, func(i, j int) bool { return umetas[i].ID < umetas[j].ID })
 
 	return umetas, pmetas, nil
@@ -518,12 +762,25 @@ func (s *DataStore) SetMetas(siteID string, umetas []UserMetaData, pmetas []Post
 
 	// save users metas
 	for _, um := range umetas {
+		info := store.BlockInfo{Reason: um.Blocked.Reason, Admin: um.Blocked.Admin}
+		if um.IP {
+			if um.Blocked.Status {
+				errs = multierror.Append(errs, s.SetBlockIP(siteID, um.ID, true, time.Until(um.Blocked.Until), info))
+			}
+			continue
+		}
 		if um.Blocked.Status {
-			errs = multierror.Append(errs, s.SetBlock(siteID, um.ID, true, time.Until(um.Blocked.Until)))
+			errs = multierror.Append(errs, s.SetBlock(siteID, um.ID, true, time.Until(um.Blocked.Until), info))
 		}
 		if um.Verified {
 			errs = multierror.Append(errs, s.SetVerified(siteID, um.ID, true))
 		}
+		if um.ShadowBanned {
+			errs = multierror.Append(errs, s.SetShadowBan(siteID, um.ID, true))
+		}
+		if um.Trust != nil && um.Trust.Manual {
+			errs = multierror.Append(errs, s.setTrust(siteID, um.ID, *um.Trust))
+		}
 	}
 
 	return errs.ErrorOrNil()
@@ -535,7 +792,7 @@ func (s *DataStore) User(siteID, userID string, limit, skip int, user store.User
 	if err != nil {
 		return comments, err
 	}
-	return s.alterComments(comments, user), nil
+	return s.setRepliesCount(siteID, s.alterComments(comments, user)), nil
 }
 
 // Last gets last comments for site, cross-post. Limited by count and optional since ts
@@ -544,7 +801,36 @@ func (s *DataStore) Last(siteID string, limit int, since time.Time, user store.U
 	if err != nil {
 		return comments, err
 	}
-	return s.alterComments(comments, user), nil
+	return s.setRepliesCount(siteID, s.alterComments(comments, user)), nil
+}
+
+// TopComments gets comments with the highest score made since ts, cross-post
+func (s *DataStore) TopComments(siteID string, limit int, since time.Time, user store.User) ([]store.Comment, error) {
+	comments, err := s.Interface.TopComments(siteID, limit, since)
+	if err != nil {
+		return comments, err
+	}
+	return s.setRepliesCount(siteID, s.alterComments(comments, user)), nil
+}
+
+// setRepliesCount sets number of replies for each comment from the replies index
+func (s *DataStore) setRepliesCount(siteID string, comments []store.Comment) []store.Comment {
+	if len(comments) == 0 {
+		return comments
+	}
+	ids := make([]string, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	counts, err := s.Interface.RepliesCount(siteID, ids)
+	if err != nil {
+		log.Printf("[WARN] can't get replies count, %v", err)
+		return comments
+	}
+	for i := range comments {
+		comments[i].Replies = counts[comments[i].ID]
+	}
+	return comments
 }
 
 func (s *DataStore) upsAndDowns(c store.Comment) (ups, downs int) {
@@ -573,14 +859,24 @@ func (s *DataStore) getScopedLocks(id string) (lock sync.Locker) {
 	return lock
 }
 
+// alterComments alters list of comments for the user, comments of shadow-banned users skipped
 func (s *DataStore) alterComments(cc []store.Comment, user store.User) (res []store.Comment) {
-	res = make([]store.Comment, len(cc))
-	for i, c := range cc {
-		res[i] = s.alterComment(c, user)
+	res = make([]store.Comment, 0, len(cc))
+	for _, c := range cc {
+		if s.shadowHidden(c, user) {
+			continue
+		}
+		res = append(res, s.alterComment(c, user))
 	}
 	return res
 }
 
+// shadowHidden checks if comment made by shadow-banned user and should be hidden from the user.
+// Shadow-banned comments shown to admins and author only.
+func (s *DataStore) shadowHidden(c store.Comment, user store.User) bool {
+	return !user.Admin && c.User.ID != user.ID && s.IsShadowBanned(c.Locator.SiteID, c.User.ID)
+}
+
 func (s *DataStore) alterComment(c store.Comment, user store.User) (res store.Comment) {
 
 	blocked := s.IsBlocked(c.Locator.SiteID, c.User.ID)
@@ -593,11 +889,30 @@ func (s *DataStore) alterComment(c store.Comment, user store.User) (res store.Co
 		c.Deleted = true
 	}
 
+	// pending comments shown to admins and author only
+	if c.Pending && !user.Admin && c.User.ID != user.ID {
+		c.SetDeleted(store.SoftDelete)
+	}
+
+	// comments of shadow-banned users look deleted for everyone but admins and author
+	if user.Admin {
+		c.User.ShadowBanned = s.IsShadowBanned(c.Locator.SiteID, c.User.ID)
+	} else if s.shadowHidden(c, user) {
+		c.SetDeleted(store.SoftDelete)
+	}
+
 	// set verified status retroactively
 	if !blocked {
 		c.User.Verified = s.IsVerified(c.Locator.SiteID, c.User.ID)
 	}
 
+	// stored trust level only, recalculated on user's activity
+	if s.TrustPolicy != nil {
+		if trust, err := s.Interface.Trust(c.Locator.SiteID, c.User.ID); err == nil {
+			c.User.TrustLevel = trust.Level
+		}
+	}
+
 	// hide info from non-admins
 	if !user.Admin {
 		c.User.IP = ""
@@ -376,6 +376,69 @@ func TestService_VoteControversy(t *testing.T) {
 	assert.InDelta(t, 1.73, res[0].Controversy, 0.01)
 }
 
+func TestService_VoteBestAndHot(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.Vote(locator, "id-1", "user2", true)
+	require.NoError(t, err)
+	_, err = b.Vote(locator, "id-1", "user3", true)
+	require.NoError(t, err)
+	c, err := b.Vote(locator, "id-1", "user4", false)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.32, c.Best, 0.01)
+	assert.Equal(t, b.hot(1, c.Timestamp), c.Hot)
+
+	// check if stored
+	c, err = b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.32, c.Best, 0.01)
+	assert.Equal(t, b.hot(1, c.Timestamp), c.Hot)
+
+	res, err := b.Find(locator, "-best", store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "id-1", res[0].ID)
+
+	res, err = b.Find(locator, "-hot", store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res))
+	assert.Equal(t, "id-2", res[0].ID, "score 1 gives no boost, id-2 made a second later")
+	assert.True(t, res[1].Hot > 0, "hot set for comments created without it")
+}
+
+func TestService_Best(t *testing.T) {
+	tbl := []struct {
+		ups, downs int
+		res        float64
+	}{
+		{0, 0, 0},
+		{1, 0, 0.378},
+		{0, 1, 0},
+		{10, 0, 0.859},
+		{10, 5, 0.501},
+		{100, 50, 0.616},
+		{1000, 100, 0.897},
+	}
+
+	b := DataStore{}
+	for i, tt := range tbl {
+		t.Run(fmt.Sprintf("check-%d-%d:%d", i, tt.ups, tt.downs), func(t *testing.T) {
+			assert.InDelta(t, tt.res, b.best(tt.ups, tt.downs), 0.001)
+		})
+	}
+}
+
+func TestService_Hot(t *testing.T) {
+	b := DataStore{}
+	ts := time.Date(2017, 12, 20, 15, 18, 22, 0, time.UTC)
+	assert.InDelta(t, 8439.0, b.hot(0, ts), 0.01)
+	assert.InDelta(t, 8440.0, b.hot(10, ts), 0.01)
+	assert.InDelta(t, 8438.3, b.hot(-5, ts), 0.01)
+	assert.True(t, b.hot(10, ts) < b.hot(0, ts.Add(13*time.Hour)), "10x score worth 12.5 hours")
+}
+
 func TestService_Controversy(t *testing.T) {
 	tbl := []struct {
 		ups, downs int
@@ -513,6 +576,118 @@ func TestService_EditCommentReplyFailed(t *testing.T) {
 	assert.EqualError(t, err, "parent comment with reply can't be edited, id-1")
 }
 
+func TestService_CreateBlockedIP(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	blockedUser := store.User{IP: "192.168.1.1"}
+	blockedUser.HashIP("secret 123")
+	require.NoError(t, b.SetBlockIP("radio-t", blockedUser.IP, true, time.Hour, store.BlockInfo{Reason: "bots"}))
+
+	_, err := b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "u1", IP: "192.168.1.1"}})
+	assert.Equal(t, ErrIPBlocked, err)
+	_, err = b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "u2", IP: "192.168.1.1"}})
+	assert.Equal(t, ErrIPBlocked, err, "any user from blocked ip rejected")
+
+	_, err = b.Create(store.Comment{Text: "text", Locator: locator, User: store.User{ID: "u1", IP: "192.168.1.2"}})
+	assert.NoError(t, err)
+}
+
+func TestService_CreateRestricted(t *testing.T) {
+	defer teardown(t)
+	eng := prepStoreEngine(t)
+	b := DataStore{Interface: eng, AdminStore: admin.NewStaticKeyStore("secret 123"),
+		RestrictedWordsMatcher: NewRestrictedWordsMatcher(EngineRestrictedWordsLister{Engine: eng,
+			Default: StaticRestrictedWordsLister{Words: []string{"fox"}}})}
+	require.NoError(t, b.SetRestrictedRules("radio-t", []store.RestrictedRule{
+		{Pattern: "duck*", Action: store.RestrictMask}, {Pattern: "go+se", Regex: true, Action: store.RestrictModerate}}))
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	user := store.User{ID: "user", Name: "name"}
+
+	_, err := b.Create(store.Comment{Text: "quick fox", Orig: "quick fox", Locator: locator, User: user})
+	assert.Equal(t, ErrRestrictedWordsFound, err)
+
+	id, err := b.Create(store.Comment{Text: "<p>the ducks</p>", Orig: "the **ducks**", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err := b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>the ***</p>", c.Text)
+	assert.Equal(t, "the *******", c.Orig)
+	assert.False(t, c.Pending)
+
+	id, err = b.Create(store.Comment{Text: "the Goose", Orig: "the Goose", Locator: locator, User: user})
+	require.NoError(t, err)
+	c, err = b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.Equal(t, "the Goose", c.Text)
+	assert.True(t, c.Pending)
+
+	c, err = b.EditComment(locator, id, EditRequest{Text: "the duck", Orig: "the duck"})
+	require.NoError(t, err)
+	assert.Equal(t, "the ***", c.Text)
+	assert.True(t, c.Pending, "edit keeps pending status")
+
+	_, err = b.EditComment(locator, id, EditRequest{Text: "the fox", Orig: "the fox"})
+	assert.Equal(t, ErrRestrictedWordsFound, err)
+}
+
+func TestService_PendingAndApprove(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	id, err := b.Create(store.Comment{Text: "pending text", Locator: locator, Pending: true,
+		User: store.User{ID: "user", Name: "name"}})
+	require.NoError(t, err)
+
+	c, err := b.Get(locator, id, store.User{ID: "other"})
+	require.NoError(t, err)
+	assert.True(t, c.Deleted, "hidden from others")
+	assert.Equal(t, "", c.Text)
+
+	for _, u := range []store.User{{ID: "user"}, {ID: "admin", Admin: true}} {
+		c, err = b.Get(locator, id, u)
+		require.NoError(t, err)
+		assert.False(t, c.Deleted, "shown to %s", u.ID)
+		assert.Equal(t, "pending text", c.Text)
+	}
+
+	pending, err := b.Pending("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(pending))
+	assert.Equal(t, id, pending[0].ID)
+
+	require.NoError(t, b.Approve(locator, id))
+	c, err = b.Get(locator, id, store.User{ID: "other"})
+	require.NoError(t, err)
+	assert.False(t, c.Deleted)
+	assert.Equal(t, "pending text", c.Text)
+
+	pending, err = b.Pending("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(pending))
+
+	assert.Error(t, b.Approve(locator, "bad-id"))
+}
+
+func TestService_SetRestrictedRules(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+
+	err := b.SetRestrictedRules("radio-t", []store.RestrictedRule{{Pattern: "duck", Action: store.RestrictMask},
+		{Pattern: "goose", Action: "drop"}})
+	assert.EqualError(t, err, `invalid restricted rule #1 for radio-t: unknown action "drop"`)
+	rules, err := b.RestrictedRules("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(rules), "nothing saved")
+
+	require.NoError(t, b.SetRestrictedRules("radio-t", []store.RestrictedRule{{Pattern: "duck", Action: store.RestrictMask}}))
+	rules, err = b.RestrictedRules("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, []store.RestrictedRule{{Pattern: "duck", Action: store.RestrictMask}}, rules)
+}
+
 func TestService_ValidateComment(t *testing.T) {
 
 	b := DataStore{MaxCommentSize: 2000, AdminStore: admin.NewStaticKeyStore("secret 123")}
@@ -580,19 +755,31 @@ func TestService_GetMetas(t *testing.T) {
 	assert.Equal(t, 0, len(pm))
 
 	assert.NoError(t, b.SetVerified("radio-t", "user1", true))
-	assert.NoError(t, b.SetBlock("radio-t", "user1", true, time.Hour))
-	assert.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour))
+	assert.NoError(t, b.SetBlock("radio-t", "user1", true, time.Hour, store.BlockInfo{}))
+	assert.NoError(t, b.SetBlock("radio-t", "user2", true, time.Hour, store.BlockInfo{Reason: "spam", Admin: "admin1"}))
 	assert.NoError(t, b.SetReadOnly(store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}, true))
+	assert.NoError(t, b.SetShadowBan("radio-t", "user3", true))
+	assert.NoError(t, b.SetBlockIP("radio-t", "ip1", true, time.Hour, store.BlockInfo{Reason: "bots"}))
 
 	um, pm, err = b.Metas("radio-t")
 	require.NoError(t, err)
 
-	assert.Equal(t, 2, len(um))
-	assert.Equal(t, "user1", um[0].ID)
-	assert.Equal(t, true, um[0].Verified)
+	assert.Equal(t, 4, len(um))
+	assert.Equal(t, "ip1", um[0].ID)
+	assert.Equal(t, true, um[0].IP)
 	assert.Equal(t, true, um[0].Blocked.Status)
-	assert.Equal(t, false, um[1].Verified)
+	assert.Equal(t, "bots", um[0].Blocked.Reason)
+	assert.Equal(t, "user1", um[1].ID)
+	assert.Equal(t, true, um[1].Verified)
 	assert.Equal(t, true, um[1].Blocked.Status)
+	assert.Equal(t, false, um[1].IP)
+	assert.Equal(t, false, um[2].Verified)
+	assert.Equal(t, true, um[2].Blocked.Status)
+	assert.Equal(t, "spam", um[2].Blocked.Reason)
+	assert.Equal(t, "admin1", um[2].Blocked.Admin)
+	assert.Equal(t, "user3", um[3].ID)
+	assert.Equal(t, true, um[3].ShadowBanned)
+	assert.Equal(t, false, um[3].Blocked.Status)
 
 	assert.Equal(t, 1, len(pm))
 	assert.Equal(t, "https://radio-t.com", pm[0].URL)
@@ -609,18 +796,78 @@ func TestService_SetMetas(t *testing.T) {
 	err := b.SetMetas("radio-t", umetas, pmetas)
 	assert.NoError(t, err, "empty metas")
 
-	um1 := UserMetaData{ID: "user1", Verified: true}
+	um1 := UserMetaData{ID: "user1", Verified: true, ShadowBanned: true}
 	um2 := UserMetaData{ID: "user2"}
 	um2.Blocked.Status = true
 	um2.Blocked.Until = time.Now().AddDate(0, 1, 1)
+	um2.Blocked.Reason, um2.Blocked.Admin = "spam", "admin1"
+	um3 := UserMetaData{ID: "ip1", IP: true}
+	um3.Blocked.Status = true
+	um3.Blocked.Until = time.Now().AddDate(0, 1, 1)
 
 	pmetas = []PostMetaData{{URL: "https://radio-t.com", ReadOnly: true}}
-	err = b.SetMetas("radio-t", []UserMetaData{um1, um2}, pmetas)
+	err = b.SetMetas("radio-t", []UserMetaData{um1, um2, um3}, pmetas)
 	assert.NoError(t, err)
 
+	blocked, err := b.Blocked("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(blocked))
+	assert.Equal(t, store.BlockInfo{Reason: "spam", Admin: "admin1"}, blocked[0].BlockInfo)
+	assert.True(t, b.IsBlockedIP("radio-t", "ip1"))
+	assert.False(t, b.IsBlocked("radio-t", "ip1"))
+
 	assert.True(t, b.IsReadOnly(store.Locator{SiteID: "radio-t", URL: "https://radio-t.com"}))
 	assert.True(t, b.IsVerified("radio-t", "user1"))
 	assert.True(t, b.IsBlocked("radio-t", "user2"))
+	assert.True(t, b.IsShadowBanned("radio-t", "user1"))
+	assert.False(t, b.IsShadowBanned("radio-t", "user2"))
+}
+
+func TestService_MergeUser(t *testing.T) {
+	defer teardown(t)
+	policy := testTrustPolicy
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), TrustPolicy: &policy}
+
+	require.NoError(t, b.SetVerified("radio-t", "user2", true))
+	require.NoError(t, b.MergeUser("radio-t", "user1", "user2"))
+
+	comments, err := b.User("radio-t", "user2", 0, 0, store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(comments))
+	assert.True(t, b.IsVerified("radio-t", "user2"))
+	assert.Equal(t, store.TrustBasic, b.TrustLevel("radio-t", "user2"), "trust recalculated")
+
+	assert.EqualError(t, b.MergeUser("radio-t", "user2", "user2"), `can't merge user "user2" into "user2"`)
+	assert.EqualError(t, b.MergeUser("radio-t", "", "user2"), `can't merge user "" into "user2"`)
+	assert.EqualError(t, b.MergeUser("bad", "user2", "user3"), `can't merge user user2 into user3: site "bad" not found`)
+}
+
+func TestService_Users(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.Interface.Create(store.Comment{ID: "c1", Text: "text", Locator: locator, Timestamp: time.Now(),
+		User: store.User{ID: "github_123", Name: "dev"}})
+	require.NoError(t, err)
+	require.NoError(t, b.SetVerified("radio-t", "github_123", true))
+	require.NoError(t, b.SetBlock("radio-t", "user1", true, 0, store.BlockInfo{}))
+
+	users, total, err := b.Users(engine.UsersRequest{SiteID: "radio-t"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Equal(t, 2, len(users))
+	assert.Equal(t, "github_123", users[0].ID)
+	assert.Equal(t, "github", users[0].Provider)
+	assert.True(t, users[0].Verified)
+	assert.False(t, users[0].Blocked)
+	assert.Equal(t, "user1", users[1].ID)
+	assert.Equal(t, "", users[1].Provider)
+	assert.False(t, users[1].Verified)
+	assert.True(t, users[1].Blocked)
+
+	_, _, err = b.Users(engine.UsersRequest{SiteID: "bad"})
+	assert.EqualError(t, err, `site "bad" not found`)
 }
 
 func TestService_IsAdmin(t *testing.T) {
@@ -663,6 +910,42 @@ func TestService_HasReplies(t *testing.T) {
 	assert.True(t, b.HasReplies(comment))
 }
 
+func TestService_RepliesCount(t *testing.T) {
+	defer teardown(t)
+
+	b := DataStore{Interface: prepStoreEngine(t),
+		AdminStore: admin.NewStaticStore("secret 123", []string{"user2"}, "user@email.com")}
+
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	for _, id := range []string{"r1", "r2"} {
+		_, err := b.Create(store.Comment{ID: id, ParentID: "id-1", Text: "reply", Locator: locator,
+			User: store.User{ID: "user2", Name: "user name 2"}})
+		require.NoError(t, err)
+	}
+
+	res, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(res))
+	assert.Equal(t, "id-1", res[0].ID)
+	assert.Equal(t, 2, res[0].Replies)
+	assert.Equal(t, 0, res[1].Replies)
+
+	c, err := b.Get(locator, "id-1", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Replies)
+
+	require.NoError(t, b.Delete(locator, "r1", store.SoftDelete))
+	c, err = b.Get(locator, "id-1", store.User{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Replies, "deleted reply not counted")
+
+	last, err := b.Last("radio-t", 10, time.Time{}, store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(last))
+	assert.Equal(t, "id-1", last[2].ID)
+	assert.Equal(t, 1, last[2].Replies)
+}
+
 func TestService_UserReplies(t *testing.T) {
 
 	defer teardown(t)
@@ -806,6 +1089,7 @@ func TestService_alterComment(t *testing.T) {
 	engineMock := engine.MockInterface{}
 	engineMock.On("IsBlocked", mock.Anything, mock.Anything).Return(false)
 	engineMock.On("IsVerified", mock.Anything, mock.Anything).Return(false)
+	engineMock.On("IsShadowBanned", mock.Anything, mock.Anything).Return(false)
 	svc := DataStore{Interface: &engineMock}
 
 	r := svc.alterComment(store.Comment{ID: "123", User: store.User{IP: "127.0.0.1"}}, store.User{Name: "dev", Admin: false})
@@ -816,6 +1100,7 @@ func TestService_alterComment(t *testing.T) {
 	engineMock = engine.MockInterface{}
 	engineMock.On("IsBlocked", mock.Anything, mock.Anything).Return(false)
 	engineMock.On("IsVerified", mock.Anything, mock.Anything).Return(true)
+	engineMock.On("IsShadowBanned", mock.Anything, mock.Anything).Return(false)
 	svc = DataStore{Interface: &engineMock}
 	r = svc.alterComment(store.Comment{ID: "123", User: store.User{IP: "127.0.0.1", Verified: true}},
 		store.User{Name: "dev", Admin: false})
@@ -824,11 +1109,66 @@ func TestService_alterComment(t *testing.T) {
 	engineMock = engine.MockInterface{}
 	engineMock.On("IsBlocked", mock.Anything, mock.Anything).Return(true)
 	engineMock.On("IsVerified", mock.Anything, mock.Anything).Return(false)
+	engineMock.On("IsShadowBanned", mock.Anything, mock.Anything).Return(false)
 	svc = DataStore{Interface: &engineMock}
 	r = svc.alterComment(store.Comment{ID: "123", User: store.User{IP: "127.0.0.1", Verified: true}},
 		store.User{Name: "dev", Admin: false})
 	assert.Equal(t, store.Comment{ID: "123", User: store.User{IP: "", Verified: true, Blocked: true}, Deleted: true}, r,
 		"blocked")
+
+	engineMock = engine.MockInterface{}
+	engineMock.On("IsBlocked", mock.Anything, mock.Anything).Return(false)
+	engineMock.On("IsVerified", mock.Anything, mock.Anything).Return(false)
+	engineMock.On("IsShadowBanned", mock.Anything, mock.Anything).Return(true)
+	svc = DataStore{Interface: &engineMock}
+	c := store.Comment{ID: "123", Text: "text", User: store.User{ID: "spammer"}}
+	r = svc.alterComment(c, store.User{ID: "dev"})
+	assert.Equal(t, store.Comment{ID: "123", User: store.User{ID: "spammer"}, Deleted: true}, r,
+		"shadow-banned hidden")
+	r = svc.alterComment(c, store.User{ID: "spammer"})
+	assert.Equal(t, store.Comment{ID: "123", Text: "text", User: store.User{ID: "spammer"}}, r, "shown to author")
+	r = svc.alterComment(c, store.User{ID: "admin", Admin: true})
+	assert.Equal(t, store.Comment{ID: "123", Text: "text", User: store.User{ID: "spammer", ShadowBanned: true}}, r,
+		"shown to admin")
+}
+
+func TestService_ShadowBan(t *testing.T) {
+	defer teardown(t)
+	// two comments for https://radio-t.com
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	require.NoError(t, b.SetShadowBan("radio-t", "user1", true))
+
+	count, err := b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "both comments by user1 not counted")
+	info, err := b.Info(locator, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, info.Count)
+
+	last, err := b.Last("radio-t", 10, time.Time{}, store.User{ID: "user2"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(last), "filtered for others")
+	last, err = b.Last("radio-t", 10, time.Time{}, store.User{ID: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(last), "shown to author")
+	assert.False(t, last[0].User.ShadowBanned, "author doesn't know")
+	last, err = b.Last("radio-t", 10, time.Time{}, store.User{ID: "admin", Admin: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(last), "shown to admin")
+	assert.True(t, last[0].User.ShadowBanned)
+
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(comments))
+	assert.True(t, comments[0].Deleted, "looks deleted in thread")
+	assert.Equal(t, "", comments[0].Text)
+
+	require.NoError(t, b.SetShadowBan("radio-t", "user1", false))
+	count, err = b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
 }
 
 // makes new boltdb, put two records
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// SiteConfig keeps DataStore parameters with per-site overrides applied
+type SiteConfig struct {
+	EditDuration   time.Duration
+	MaxCommentSize int
+	MaxVotes       int
+	PositiveScore  bool
+	Overrides      store.SiteSettings // per-site settings as-is, for parameters not managed by DataStore
+}
+
+// SiteSettings returns per-site overrides, empty if nothing set or settings can't be loaded
+func (s *DataStore) SiteSettings(siteID string) store.SiteSettings {
+	if s.Interface == nil { // engine-less DataStore used for validation only
+		return store.SiteSettings{}
+	}
+	settings, err := s.Interface.Settings(siteID)
+	if err != nil {
+		log.Printf("[WARN] can't get settings for %s, %v", siteID, err)
+		return store.SiteSettings{}
+	}
+	return settings
+}
+
+// SetSettings validates and saves per-site overrides
+func (s *DataStore) SetSettings(siteID string, settings store.SiteSettings) error {
+	if err := settings.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid settings for %s", siteID)
+	}
+	if err := s.Interface.SetSettings(siteID, settings); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeSettings, Settings: &settings})
+	return nil
+}
+
+// SiteConfig returns DataStore parameters for the site, global values overridden by per-site settings
+func (s *DataStore) SiteConfig(siteID string) SiteConfig {
+	s.paramsLock.RLock()
+	res := SiteConfig{
+		EditDuration:   s.EditDuration,
+		MaxCommentSize: s.MaxCommentSize,
+		MaxVotes:       s.MaxVotes,
+		PositiveScore:  s.PositiveScore,
+	}
+	s.paramsLock.RUnlock()
+
+	res.Overrides = s.SiteSettings(siteID)
+	if res.Overrides.EditDuration != nil {
+		res.EditDuration = time.Duration(*res.Overrides.EditDuration) * time.Second
+	}
+	if res.Overrides.MaxCommentSize != nil {
+		res.MaxCommentSize = *res.Overrides.MaxCommentSize
+	}
+	if res.Overrides.MaxVotes != nil {
+		res.MaxVotes = *res.Overrides.MaxVotes
+	}
+	if res.Overrides.PositiveScore != nil {
+		res.PositiveScore = *res.Overrides.PositiveScore
+	}
+	return res
+}
+
+// SetParams updates global parameters of running DataStore, safe for concurrent use with SiteConfig
+func (s *DataStore) SetParams(editDuration time.Duration, maxCommentSize, maxVotes int, positiveScore bool) {
+	s.paramsLock.Lock()
+	defer s.paramsLock.Unlock()
+	s.EditDuration, s.MaxCommentSize, s.MaxVotes, s.PositiveScore = editDuration, maxCommentSize, maxVotes, positiveScore
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_SiteConfig(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"),
+		EditDuration: time.Minute, MaxCommentSize: 100, MaxVotes: -1}
+
+	cfg := b.SiteConfig("radio-t")
+	assert.Equal(t, SiteConfig{EditDuration: time.Minute, MaxCommentSize: 100, MaxVotes: -1}, cfg, "globals only")
+
+	editDuration, maxVotes, positive, readOnlyAge := 5, 10, true, 7
+	err := b.SetSettings("radio-t", store.SiteSettings{EditDuration: &editDuration, MaxVotes: &maxVotes,
+		PositiveScore: &positive, ReadOnlyAge: &readOnlyAge})
+	require.NoError(t, err)
+
+	cfg = b.SiteConfig("radio-t")
+	assert.Equal(t, 5*time.Second, cfg.EditDuration)
+	assert.Equal(t, 100, cfg.MaxCommentSize, "not overridden")
+	assert.Equal(t, 10, cfg.MaxVotes)
+	assert.True(t, cfg.PositiveScore)
+	require.NotNil(t, cfg.Overrides.ReadOnlyAge)
+	assert.Equal(t, 7, *cfg.Overrides.ReadOnlyAge)
+
+	assert.Equal(t, SiteConfig{EditDuration: time.Minute, MaxCommentSize: 100, MaxVotes: -1}, b.SiteConfig("other"),
+		"no overrides for other site")
+
+	maxSize := -1
+	err = b.SetSettings("radio-t", store.SiteSettings{MaxCommentSize: &maxSize})
+	assert.EqualError(t, err, "invalid settings for radio-t: max comment size should be positive, -1")
+}
+
+func TestService_SiteConfigOverrides(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	maxVotes, maxSize := 0, 5
+	require.NoError(t, b.SetSettings("radio-t", store.SiteSettings{MaxVotes: &maxVotes, MaxCommentSize: &maxSize}))
+
+	_, err := b.Vote(locator, "id-1", "user2", true)
+	assert.EqualError(t, err, "maximum number of votes exceeded for comment id-1")
+
+	err = b.ValidateComment(&store.Comment{Locator: locator, Orig: "something blah", User: store.User{ID: "myid", Name: "name"}})
+	assert.EqualError(t, err, "comment text exceeded max allowed size 5 (14)")
+
+	editDuration := 1
+	require.NoError(t, b.SetSettings("radio-t", store.SiteSettings{EditDuration: &editDuration}))
+	_, err = b.EditComment(locator, "id-1", EditRequest{Orig: "yyy", Text: "xxx"})
+	assert.EqualError(t, err, "too late to edit id-1")
+}
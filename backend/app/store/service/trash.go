@@ -0,0 +1,143 @@
+package service
+
+import (
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// Delete removes comment. With TrashDuration set, content of soft-deleted comment kept in trash for admin's restore.
+func (s *DataStore) Delete(locator store.Locator, commentID string, mode store.DeleteMode) error {
+	if mode == store.SoftDelete && s.TrashDuration > 0 {
+		comment, err := s.Interface.Get(locator, commentID)
+		if err != nil {
+			return err
+		}
+		if !comment.Deleted {
+			now := time.Now()
+			entry := store.TrashEntry{ID: commentID, SiteID: locator.SiteID, Comment: comment, Deleted: now,
+				Expires: now.Add(s.TrashDuration)}
+			if err = s.Interface.SaveTrash(entry); err != nil {
+				return errors.Wrapf(err, "can't keep %s in trash", commentID)
+			}
+		}
+	}
+	if err := s.Interface.Delete(locator, commentID, mode); err != nil {
+		return err
+	}
+	comment, err := s.Interface.Get(locator, commentID)
+	if err != nil {
+		s.recordChange(store.Change{SiteID: locator.SiteID, Type: store.ChangeDelete, Locator: locator, CommentID: commentID})
+		return nil
+	}
+	s.recordCommentChange(store.ChangeDelete, comment)
+	return nil
+}
+
+// Trash returns content of deleted comments not expired yet
+func (s *DataStore) Trash(siteID string) ([]store.TrashEntry, error) {
+	entries, err := s.Interface.Trash(siteID)
+	if err != nil {
+		return nil, err
+	}
+	res := []store.TrashEntry{}
+	for _, e := range entries {
+		if time.Now().Before(e.Expires) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// RestoreComment puts back text, votes and score of deleted comment kept in trash
+func (s *DataStore) RestoreComment(siteID, commentID string) (store.Comment, error) {
+	entries, err := s.Trash(siteID)
+	if err != nil {
+		return store.Comment{}, err
+	}
+	var entry *store.TrashEntry
+	for i := range entries {
+		if entries[i].ID == commentID {
+			entry = &entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return store.Comment{}, errors.Errorf("comment %s not in trash", commentID)
+	}
+
+	locator := entry.Comment.Locator
+	lock := s.getScopedLocks(locator.URL)
+	lock.Lock()
+	defer lock.Unlock()
+
+	current, err := s.Interface.Get(locator, commentID)
+	if err != nil {
+		return store.Comment{}, err
+	}
+	if !current.Deleted {
+		return current, errors.Errorf("comment %s not deleted", commentID)
+	}
+	if current.User.ID != entry.Comment.User.ID {
+		return current, errors.Errorf("user's info of comment %s erased, can't be restored", commentID)
+	}
+
+	restored := entry.Comment
+	restored.Deleted = false
+	if err = s.Interface.Put(locator, restored); err != nil {
+		return current, errors.Wrapf(err, "can't restore %s", commentID)
+	}
+	if err = s.Interface.RemoveTrash(siteID, []string{commentID}); err != nil {
+		log.Printf("[WARN] can't remove restored %s from trash, %v", commentID, err)
+	}
+	log.Printf("[INFO] comment %s restored from trash, site %s", commentID, siteID)
+	if restored, err = s.Interface.Get(locator, commentID); err != nil {
+		return restored, err
+	}
+	s.recordCommentChange(store.ChangeEdit, restored)
+	return restored, nil
+}
+
+// DeleteUser removes all comments of the user, content of user's comments kept in trash removed as well
+func (s *DataStore) DeleteUser(siteID, userID string) error {
+	if err := s.removeUserTrash(siteID, userID); err != nil {
+		return err
+	}
+	if err := s.Interface.DeleteUser(siteID, userID); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeDelete, UserID: userID})
+	return nil
+}
+
+// PurgeTrash removes expired content of deleted comments, returns number of removed entries
+func (s *DataStore) PurgeTrash(siteID string) (int, error) {
+	return s.removeTrash(siteID, func(e store.TrashEntry) bool { return !time.Now().Before(e.Expires) })
+}
+
+// removeUserTrash removes content of all user's comments from trash
+func (s *DataStore) removeUserTrash(siteID, userID string) error {
+	_, err := s.removeTrash(siteID, func(e store.TrashEntry) bool { return e.Comment.User.ID == userID })
+	return errors.Wrapf(err, "can't remove trash of %s", userID)
+}
+
+// removeTrash removes trash entries matched by fn
+func (s *DataStore) removeTrash(siteID string, fn func(e store.TrashEntry) bool) (int, error) {
+	entries, err := s.Interface.Trash(siteID)
+	if err != nil {
+		return 0, err
+	}
+	ids := []string{}
+	for _, e := range entries {
+		if fn(e) {
+			ids = append(ids, e.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return len(ids), s.Interface.RemoveTrash(siteID, ids)
+}
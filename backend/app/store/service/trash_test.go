@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+func TestService_Trash(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"),
+		TrashDuration: time.Hour, MaxVotes: -1}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.Vote(locator, "id-1", "user2", true)
+	require.NoError(t, err)
+	require.NoError(t, b.AdminDelete(locator, "id-1", "admin1"))
+	c, err := b.Interface.Get(locator, "id-1")
+	require.NoError(t, err)
+	assert.True(t, c.Deleted)
+	assert.Equal(t, "", c.Text)
+
+	entries, err := b.Trash("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "id-1", entries[0].ID)
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, entries[0].Comment.Text)
+	assert.True(t, entries[0].Expires.After(time.Now().Add(59*time.Minute)))
+	require.NoError(t, b.Delete(locator, "id-1", store.SoftDelete), "second delete doesn't replace trash")
+	entries, err = b.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, entries[0].Comment.Text)
+
+	c, err = b.RestoreComment("radio-t", "id-1")
+	require.NoError(t, err)
+	assert.False(t, c.Deleted)
+	assert.Equal(t, `some text, <a href="http://radio-t.com">link</a>`, c.Text)
+	assert.Equal(t, 1, c.Score)
+	assert.Equal(t, map[string]bool{"user2": true}, c.Votes)
+	count, err := b.Count(locator)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "count restored")
+	entries, err = b.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries), "removed from trash")
+
+	_, err = b.RestoreComment("radio-t", "id-1")
+	assert.EqualError(t, err, "comment id-1 not in trash")
+	_, err = b.RestoreComment("bad", "id-1")
+	assert.Error(t, err)
+
+	// hard-deleted comment can't be restored
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+	require.NoError(t, b.Interface.Delete(locator, "id-2", store.HardDelete))
+	_, err = b.RestoreComment("radio-t", "id-2")
+	assert.EqualError(t, err, "user's info of comment id-2 erased, can't be restored")
+}
+
+func TestService_TrashPurge(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"),
+		TrashDuration: 50 * time.Millisecond}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	require.NoError(t, b.Delete(locator, "id-1", store.SoftDelete))
+	time.Sleep(60 * time.Millisecond)
+	b.TrashDuration = time.Hour
+	require.NoError(t, b.Delete(locator, "id-2", store.SoftDelete))
+
+	entries, err := b.Trash("radio-t")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries), "expired not listed")
+	assert.Equal(t, "id-2", entries[0].ID)
+	_, err = b.RestoreComment("radio-t", "id-1")
+	assert.EqualError(t, err, "comment id-1 not in trash", "expired can't be restored")
+
+	n, err := b.PurgeTrash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	all, err := b.Interface.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(all))
+
+	require.NoError(t, b.DeleteUser("radio-t", "user1"))
+	all, err = b.Interface.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(all), "trash of deleted user removed")
+}
+
+func TestService_TrashDisabled(t *testing.T) {
+	defer teardown(t)
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123")}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	_, err := b.EditComment(locator, "id-1", EditRequest{Delete: true})
+	require.NoError(t, err)
+	entries, err := b.Trash("radio-t")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
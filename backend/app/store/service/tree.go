@@ -163,6 +163,30 @@ func (t *Tree) sortNodes(sortType string) {
 			}
 			return t.Nodes[i].Comment.Controversy < t.Nodes[j].Comment.Controversy
 
+		case "+best", "-best", "best":
+			if strings.HasPrefix(sortType, "-") {
+				if t.Nodes[i].Comment.Best == t.Nodes[j].Comment.Best {
+					return t.Nodes[i].Comment.Timestamp.Before(t.Nodes[j].Comment.Timestamp)
+				}
+				return t.Nodes[i].Comment.Best > t.Nodes[j].Comment.Best
+			}
+			if t.Nodes[i].Comment.Best == t.Nodes[j].Comment.Best {
+				return t.Nodes[i].Comment.Timestamp.Before(t.Nodes[j].Comment.Timestamp)
+			}
+			return t.Nodes[i].Comment.Best < t.Nodes[j].Comment.Best
+
+		case "+hot", "-hot", "hot":
+			if strings.HasPrefix(sortType, "-") {
+				if t.Nodes[i].Comment.Hot == t.Nodes[j].Comment.Hot {
+					return t.Nodes[i].Comment.Timestamp.Before(t.Nodes[j].Comment.Timestamp)
+				}
+				return t.Nodes[i].Comment.Hot > t.Nodes[j].Comment.Hot
+			}
+			if t.Nodes[i].Comment.Hot == t.Nodes[j].Comment.Hot {
+				return t.Nodes[i].Comment.Timestamp.Before(t.Nodes[j].Comment.Timestamp)
+			}
+			return t.Nodes[i].Comment.Hot < t.Nodes[j].Comment.Hot
+
 		default:
 			return t.Nodes[i].Comment.Timestamp.Before(t.Nodes[j].Comment.Timestamp)
 		}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"regexp"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pkg/errors"
+
+	"github.com/umputun/remark/backend/app/store"
+)
+
+// TrustPolicy defines requirements for trust levels and what each level allows.
+// Users of level 0 (store.TrustNew) are pre-moderated, their comments pending till approved.
+type TrustPolicy struct {
+	Levels      []TrustRequirement // requirements for levels 1,2,3, Levels[0] is for store.TrustBasic
+	LinksLevel  store.TrustLevel   // minimal level allowed to post links and images
+	FloodLimits []int              // max comments per hour for each level, 0 - unlimited. Last value used for higher levels
+	Refresh     time.Duration      // how long stored level used before recalculation
+}
+
+// TrustRequirement defines user's history needed to reach the level
+type TrustRequirement struct {
+	Age        time.Duration // since the first comment on the site
+	Comments   int           // number of published comments
+	Score      int           // accumulated score of published comments
+	MaxDeleted int           // max number of deleted comments, counted as moderated
+}
+
+// DefaultTrustPolicy used if trust levels enabled without custom requirements
+var DefaultTrustPolicy = TrustPolicy{
+	Levels: []TrustRequirement{
+		{Comments: 3, MaxDeleted: 1},
+		{Age: 7 * 24 * time.Hour, Comments: 20, Score: 10, MaxDeleted: 3},
+		{Age: 90 * 24 * time.Hour, Comments: 100, Score: 100, MaxDeleted: 5},
+	},
+	LinksLevel:  store.TrustBasic,
+	FloodLimits: []int{5, 20, 60, 0},
+	Refresh:     10 * time.Minute,
+}
+
+// ErrTrustLinks returned in case comment with links or images posted by user of low trust level
+var ErrTrustLinks = errors.New("links and images not allowed for the trust level")
+
+// ErrFloodLimit returned in case user posted too many comments for the trust level
+var ErrFloodLimit = errors.New("too many comments")
+
+var reLinks = regexp.MustCompile(`(?i)<(a|img)\s`)
+
+// TrustLevel returns trust level of the user. Stored level recalculated if older than policy's Refresh.
+func (s *DataStore) TrustLevel(siteID, userID string) store.TrustLevel {
+	trust, err := s.Interface.Trust(siteID, userID)
+	if err != nil {
+		log.Printf("[WARN] can't get trust level for %s, %v", userID, err)
+		return store.TrustNew
+	}
+	if trust.Manual || s.TrustPolicy == nil || time.Since(trust.Updated) < s.TrustPolicy.Refresh {
+		return trust.Level
+	}
+	level, err := s.RecalcTrust(siteID, userID)
+	if err != nil {
+		log.Printf("[WARN] can't recalculate trust level for %s, %v", userID, err)
+		return trust.Level
+	}
+	return level
+}
+
+// RecalcTrust calculates trust level from user's history and stores it. Level set by admin kept as is.
+func (s *DataStore) RecalcTrust(siteID, userID string) (store.TrustLevel, error) {
+	trust, err := s.Interface.Trust(siteID, userID)
+	if err != nil {
+		return store.TrustNew, errors.Wrapf(err, "can't get trust level for %s", userID)
+	}
+	if trust.Manual {
+		return trust.Level, nil
+	}
+
+	level, err := s.calcTrust(siteID, userID)
+	if err != nil {
+		return store.TrustNew, err
+	}
+	trust = store.UserTrust{Level: level, Updated: time.Now()}
+	return level, errors.Wrapf(s.Interface.SetTrust(siteID, userID, trust), "can't save trust level for %s", userID)
+}
+
+// SetTrustLevel sets trust level manually, the level won't be recalculated till ResetTrustLevel call
+func (s *DataStore) SetTrustLevel(siteID, userID string, level store.TrustLevel) error {
+	if err := level.Validate(); err != nil {
+		return err
+	}
+	return s.setTrust(siteID, userID, store.UserTrust{Level: level, Manual: true, Updated: time.Now()})
+}
+
+// ResetTrustLevel drops level set by admin and recalculates it from user's history
+func (s *DataStore) ResetTrustLevel(siteID, userID string) (store.TrustLevel, error) {
+	if err := s.setTrust(siteID, userID, store.UserTrust{}); err != nil {
+		return store.TrustNew, errors.Wrapf(err, "can't reset trust level for %s", userID)
+	}
+	return s.RecalcTrust(siteID, userID)
+}
+
+// setTrust saves trust set or reset by admin and records the change. Calculated levels not recorded,
+// they are derived from user's history.
+func (s *DataStore) setTrust(siteID, userID string, trust store.UserTrust) error {
+	if err := s.Interface.SetTrust(siteID, userID, trust); err != nil {
+		return err
+	}
+	s.recordChange(store.Change{SiteID: siteID, Type: store.ChangeTrust, UserID: userID, Trust: &trust})
+	return nil
+}
+
+// calcTrust gets the highest level with all requirements met by user's history.
+// Blocked and shadow-banned users always get store.TrustNew.
+func (s *DataStore) calcTrust(siteID, userID string) (store.TrustLevel, error) {
+	if s.TrustPolicy == nil || s.IsBlocked(siteID, userID) || s.IsShadowBanned(siteID, userID) {
+		return store.TrustNew, nil
+	}
+
+	comments, err := s.userComments(siteID, userID, 0)
+	if err != nil {
+		return store.TrustNew, err
+	}
+
+	var published, score, deleted int
+	first := time.Now()
+	for _, c := range comments {
+		if c.Timestamp.Before(first) {
+			first = c.Timestamp
+		}
+		switch {
+		case c.Deleted:
+			deleted++
+		case !c.Pending:
+			published++
+			score += c.Score
+		}
+	}
+
+	level := store.TrustNew
+	for i, req := range s.TrustPolicy.Levels {
+		if time.Since(first) < req.Age || published < req.Comments || score < req.Score || deleted > req.MaxDeleted {
+			break
+		}
+		level = store.TrustLevel(i + 1)
+	}
+	if level > store.MaxTrustLevel {
+		level = store.MaxTrustLevel
+	}
+	return level, nil
+}
+
+// trustCheck applies trust policy to new comment. Rejects links and flood for low levels, pre-moderates new users.
+// Admins not affected.
+func (s *DataStore) trustCheck(comment *store.Comment) error {
+	if s.TrustPolicy == nil || comment.User.Admin {
+		return nil
+	}
+	siteID := comment.Locator.SiteID
+	level := s.TrustLevel(siteID, comment.User.ID)
+
+	if err := s.trustLinksCheck(*comment, level); err != nil {
+		return err
+	}
+
+	if limit := s.floodLimit(level); limit > 0 {
+		recent, err := s.userComments(siteID, comment.User.ID, limit)
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, c := range recent {
+			if time.Since(c.Timestamp) < time.Hour {
+				count++
+			}
+		}
+		if count >= limit {
+			return ErrFloodLimit
+		}
+	}
+
+	if level == store.TrustNew {
+		comment.Pending = true
+	}
+	return nil
+}
+
+// trustLinksCheck rejects links and images in comment made by user below policy's LinksLevel
+func (s *DataStore) trustLinksCheck(comment store.Comment, level store.TrustLevel) error {
+	if s.TrustPolicy == nil || comment.User.Admin || level >= s.TrustPolicy.LinksLevel {
+		return nil
+	}
+	if reLinks.MatchString(comment.Text) {
+		return ErrTrustLinks
+	}
+	return nil
+}
+
+// userComments returns last comments of the user, empty for user without comments
+func (s *DataStore) userComments(siteID, userID string, limit int) ([]store.Comment, error) {
+	// bolt engine fails on unknown user, count checked first
+	if count, err := s.Interface.UserCount(siteID, userID); err != nil || count == 0 {
+		return []store.Comment{}, nil
+	}
+	comments, err := s.Interface.User(siteID, userID, limit, 0)
+	return comments, errors.Wrapf(err, "can't get comments for %s", userID)
+}
+
+// floodLimit returns max comments per hour for the level, 0 - unlimited
+func (s *DataStore) floodLimit(level store.TrustLevel) int {
+	limits := s.TrustPolicy.FloodLimits
+	if len(limits) == 0 {
+		return 0
+	}
+	if int(level) >= len(limits) {
+		return limits[len(limits)-1]
+	}
+	return limits[level]
+}
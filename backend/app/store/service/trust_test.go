@@ -0,0 +1,170 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/remark/backend/app/store"
+	"github.com/umputun/remark/backend/app/store/admin"
+)
+
+var testTrustPolicy = TrustPolicy{
+	Levels: []TrustRequirement{
+		{Comments: 2, MaxDeleted: 1},
+		{Age: 24 * time.Hour, Comments: 3, Score: 2, MaxDeleted: 1},
+	},
+	LinksLevel:  store.TrustBasic,
+	FloodLimits: []int{2, 0},
+	Refresh:     time.Hour,
+}
+
+func TestService_RecalcTrust(t *testing.T) {
+	defer teardown(t)
+	policy := testTrustPolicy
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), TrustPolicy: &policy}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+
+	level, err := b.RecalcTrust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustBasic, level, "two old comments, no score")
+	assert.Equal(t, store.TrustBasic, b.TrustLevel("radio-t", "user1"))
+
+	_, err = b.Interface.Create(store.Comment{ID: "id-3", Text: "text", Score: 2, Locator: locator,
+		Timestamp: time.Date(2017, 12, 21, 15, 18, 22, 0, time.Local), User: store.User{ID: "user1"}})
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustBasic, b.TrustLevel("radio-t", "user1"), "stored level used till refresh")
+	level, err = b.RecalcTrust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustMember, level)
+
+	require.NoError(t, b.Delete(locator, "id-1", store.SoftDelete))
+	level, err = b.RecalcTrust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustBasic, level, "deleted comment not counted and breaks level 2")
+
+	require.NoError(t, b.SetShadowBan("radio-t", "user1", true))
+	level, err = b.RecalcTrust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustNew, level, "shadow-banned user not trusted")
+
+	level, err = b.RecalcTrust("radio-t", "unknown")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustNew, level)
+}
+
+func TestService_SetTrustLevel(t *testing.T) {
+	defer teardown(t)
+	policy := testTrustPolicy
+	policy.Refresh = 0 // recalculate on each call
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), TrustPolicy: &policy}
+
+	assert.Equal(t, store.TrustBasic, b.TrustLevel("radio-t", "user1"))
+
+	require.NoError(t, b.SetTrustLevel("radio-t", "user1", store.TrustRegular))
+	assert.Equal(t, store.TrustRegular, b.TrustLevel("radio-t", "user1"), "manual level not recalculated")
+	level, err := b.RecalcTrust("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustRegular, level)
+
+	assert.EqualError(t, b.SetTrustLevel("radio-t", "user1", 5), "invalid trust level 5, should be 0-3")
+
+	level, err = b.ResetTrustLevel("radio-t", "user1")
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustBasic, level)
+	assert.Equal(t, store.TrustBasic, b.TrustLevel("radio-t", "user1"))
+}
+
+func TestService_CreateWithTrust(t *testing.T) {
+	defer teardown(t)
+	policy := testTrustPolicy
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), TrustPolicy: &policy}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	newUser := store.User{ID: "u1", Name: "new"}
+
+	_, err := b.Create(store.Comment{Text: `see <a href="http://example.com">here</a>`, Locator: locator, User: newUser})
+	assert.Equal(t, ErrTrustLinks, err)
+	_, err = b.Create(store.Comment{Text: `<img src="http://example.com/pic.png">`, Locator: locator, User: newUser})
+	assert.Equal(t, ErrTrustLinks, err)
+
+	id, err := b.Create(store.Comment{Text: "text", Locator: locator, User: newUser})
+	require.NoError(t, err)
+	c, err := b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.True(t, c.Pending, "new user pre-moderated")
+
+	_, err = b.Create(store.Comment{Text: "text 2", Locator: locator, User: newUser})
+	require.NoError(t, err)
+	_, err = b.Create(store.Comment{Text: "text 3", Locator: locator, User: newUser})
+	assert.Equal(t, ErrFloodLimit, err, "two comments per hour for new user")
+
+	// user1 has level 1, links allowed and no flood limit
+	for i := 0; i < 3; i++ {
+		id, err = b.Create(store.Comment{Text: `<a href="http://example.com">link</a>`, Locator: locator,
+			User: store.User{ID: "user1"}})
+		require.NoError(t, err)
+	}
+	c, err = b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.False(t, c.Pending)
+
+	// admin not affected
+	id, err = b.Create(store.Comment{Text: `<a href="http://example.com">link</a>`, Locator: locator,
+		User: store.User{ID: "admin", Admin: true}})
+	require.NoError(t, err)
+	c, err = b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.False(t, c.Pending)
+
+	// trust level exposed in comments
+	comments, err := b.Find(locator, "time", store.User{})
+	require.NoError(t, err)
+	for _, c := range comments {
+		if c.User.ID == "user1" {
+			assert.Equal(t, store.TrustBasic, c.User.TrustLevel)
+		}
+	}
+}
+
+func TestService_ApproveRecalcTrust(t *testing.T) {
+	defer teardown(t)
+	policy := testTrustPolicy
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), TrustPolicy: &policy}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	newUser := store.User{ID: "u1", Name: "new"}
+
+	id1, err := b.Create(store.Comment{Text: "text 1", Locator: locator, User: newUser})
+	require.NoError(t, err)
+	id2, err := b.Create(store.Comment{Text: "text 2", Locator: locator, User: newUser})
+	require.NoError(t, err)
+	assert.Equal(t, store.TrustNew, b.TrustLevel("radio-t", "u1"), "pending comments not counted")
+
+	require.NoError(t, b.Approve(locator, id1))
+	require.NoError(t, b.Approve(locator, id2))
+	assert.Equal(t, store.TrustBasic, b.TrustLevel("radio-t", "u1"), "promoted on approve")
+}
+
+func TestService_ImportWithTrust(t *testing.T) {
+	defer teardown(t)
+	policy := testTrustPolicy
+	b := DataStore{Interface: prepStoreEngine(t), AdminStore: admin.NewStaticKeyStore("secret 123"), TrustPolicy: &policy}
+	locator := store.Locator{URL: "https://radio-t.com", SiteID: "radio-t"}
+	newUser := store.User{ID: "u1", Name: "new"}
+
+	// imported comments keep their moderation state, no trust checks
+	for i := 0; i < 3; i++ {
+		id, err := b.Import(store.Comment{Text: `see <a href="http://example.com">here</a>`, Locator: locator, User: newUser})
+		require.NoError(t, err)
+		c, err := b.Interface.Get(locator, id)
+		require.NoError(t, err)
+		assert.False(t, c.Pending)
+	}
+
+	id, err := b.Import(store.Comment{ID: "pending1", Text: "text", Locator: locator, User: newUser, Pending: true})
+	require.NoError(t, err)
+	c, err := b.Interface.Get(locator, id)
+	require.NoError(t, err)
+	assert.True(t, c.Pending)
+}
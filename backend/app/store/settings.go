@@ -0,0 +1,39 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SiteSettings keeps per-site overrides of global parameters. Nil field means not set and the global value used.
+// RestrictedWords can be set to an empty list to disable global restricted words for the site.
+type SiteSettings struct {
+	EditDuration    *int             `json:"edit_duration,omitempty"` // edit window, seconds
+	MaxCommentSize  *int             `json:"max_comment_size,omitempty"`
+	MaxVotes        *int             `json:"max_votes,omitempty"`
+	PositiveScore   *bool            `json:"positive_score,omitempty"`
+	ReadOnlyAge     *int             `json:"readonly_age,omitempty"` // days
+	LowScore        *int             `json:"low_score,omitempty"`
+	CriticalScore   *int             `json:"critical_score,omitempty"`
+	RestrictedWords []string         `json:"restricted_words"`
+	Retention       *RetentionPolicy `json:"retention,omitempty"` // replaces global retention policy
+}
+
+// Validate checks settings for values making no sense
+func (s SiteSettings) Validate() error {
+	if s.EditDuration != nil && *s.EditDuration < 0 {
+		return errors.Errorf("negative edit duration %d", *s.EditDuration)
+	}
+	if s.MaxCommentSize != nil && *s.MaxCommentSize <= 0 {
+		return errors.Errorf("max comment size should be positive, %d", *s.MaxCommentSize)
+	}
+	if s.ReadOnlyAge != nil && *s.ReadOnlyAge < 0 {
+		return errors.Errorf("negative read-only age %d", *s.ReadOnlyAge)
+	}
+	if s.LowScore != nil && s.CriticalScore != nil && *s.CriticalScore > *s.LowScore {
+		return errors.Errorf("critical score %d above low score %d", *s.CriticalScore, *s.LowScore)
+	}
+	if s.Retention != nil {
+		return s.Retention.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package store
+
+import "time"
+
+// TrashEntry keeps content of soft-deleted comment, available to admins for restore till expiration
+type TrashEntry struct {
+	ID      string    `json:"id" bson:"_id"` // id of deleted comment
+	SiteID  string    `json:"site" bson:"site"`
+	Comment Comment   `json:"comment" bson:"comment"` // comment as it was before deletion
+	Deleted time.Time `json:"deleted" bson:"deleted"`
+	Expires time.Time `json:"expires" bson:"expires"`
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TrustLevel defines how much user trusted on the site. Earned automatically from user's history or set by admin.
+type TrustLevel int
+
+// enum of all trust levels
+const (
+	TrustNew     TrustLevel = 0 // new or sanctioned user
+	TrustBasic   TrustLevel = 1
+	TrustMember  TrustLevel = 2
+	TrustRegular TrustLevel = 3
+
+	MaxTrustLevel = TrustRegular
+)
+
+// UserTrust keeps stored trust level of the user
+type UserTrust struct {
+	Level   TrustLevel `json:"level"`
+	Manual  bool       `json:"manual,omitempty"` // set by admin and not recalculated
+	Updated time.Time  `json:"updated"`
+}
+
+// Validate checks if level in the known range
+func (l TrustLevel) Validate() error {
+	if l < TrustNew || l > MaxTrustLevel {
+		return errors.Errorf("invalid trust level %d, should be %d-%d", l, TrustNew, MaxTrustLevel)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustLevel_Validate(t *testing.T) {
+	assert.NoError(t, TrustNew.Validate())
+	assert.NoError(t, MaxTrustLevel.Validate())
+	assert.EqualError(t, TrustLevel(-1).Validate(), "invalid trust level -1, should be 0-3")
+	assert.EqualError(t, TrustLevel(4).Validate(), "invalid trust level 4, should be 0-3")
+}
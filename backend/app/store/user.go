@@ -9,6 +9,7 @@ import (
 	"hash/crc64"
 	"io"
 	"regexp"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
 )
@@ -22,6 +23,30 @@ type User struct {
 	Admin    bool   `json:"admin"`
 	Blocked  bool   `json:"block,omitempty"`
 	Verified bool   `json:"verified,omitempty"`
+
+	ShadowBanned bool       `json:"shadow_ban,omitempty"`  // set for admins only, the banned user shouldn't know
+	TrustLevel   TrustLevel `json:"trust_level,omitempty"` // set if trust levels enabled
+}
+
+// Profile keeps the latest name and picture of the user from auth provider, applied to all user's comments
+type Profile struct {
+	ID      string    `json:"id" bson:"id"`
+	Name    string    `json:"name" bson:"name"`
+	Picture string    `json:"picture" bson:"picture"`
+	Updated time.Time `json:"updated" bson:"updated"`
+}
+
+// UserSummary is the entry of users directory, user's activity on the site
+type UserSummary struct {
+	ID       string    `json:"id" bson:"_id"`
+	Name     string    `json:"name" bson:"name"`
+	Provider string    `json:"provider" bson:"-"` // auth provider, prefix of user id
+	First    time.Time `json:"first_time" bson:"first"`
+	Last     time.Time `json:"last_time" bson:"last"`
+	Comments int       `json:"comments" bson:"comments"` // number of not deleted comments
+	Score    int       `json:"score" bson:"score"`       // total score of not deleted comments
+	Verified bool      `json:"verified" bson:"-"`
+	Blocked  bool      `json:"blocked" bson:"-"`
 }
 
 var reValidSha = regexp.MustCompile("^[a-fA-F0-9]{40}$")